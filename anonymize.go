@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/anton-dovnar/git-tree/structs"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// anonymizer hands out pseudonyms for people, branches and remotes in the
+// order it first meets them. The numbers carry nothing of the real names,
+// so they cannot be looked up in a list of known emails, and they differ
+// from one repository to the next.
+type anonymizer struct {
+	people   map[string]int
+	branches map[string]string
+	remotes  map[string]string
+}
+
+// keptNames are the branch and remote names most repositories share, which
+// say nothing about anyone.
+var keptNames = map[string]bool{
+	"HEAD": true, "main": true, "master": true, "develop": true, "trunk": true,
+	"origin": true, "upstream": true,
+}
+
+func newAnonymizer() *anonymizer {
+	return &anonymizer{people: map[string]int{}, branches: map[string]string{}, remotes: map[string]string{}}
+}
+
+// person returns the pseudonymous name and email for email.
+func (a *anonymizer) person(email string) (string, string) {
+	key := strings.ToLower(strings.TrimSpace(email))
+	n, ok := a.people[key]
+	if !ok {
+		n = len(a.people) + 1
+		a.people[key] = n
+	}
+	return fmt.Sprintf("Contributor %d", n), fmt.Sprintf("contributor-%d@anonymous.invalid", n)
+}
+
+// pseudonym returns the stand-in for name from names, numbering new ones
+// with prefix.
+func pseudonym(names map[string]string, prefix, name string) string {
+	if keptNames[name] {
+		return name
+	}
+	p, ok := names[name]
+	if !ok {
+		p = fmt.Sprintf("%s-%d", prefix, len(names)+1)
+		names[name] = p
+	}
+	return p
+}
+
+// branch returns the stand-in for a branch name, or for remote/branch when
+// remote is set.
+func (a *anonymizer) branch(remote, name string) string {
+	if remote != "" {
+		return pseudonym(a.remotes, "remote", remote) + "/" + pseudonym(a.branches, "branch", name)
+	}
+	return pseudonym(a.branches, "branch", name)
+}
+
+// refName renames the branch and remote in a local or remote branch ref.
+// Tags and other refs, like pull requests, are kept.
+func (a *anonymizer) refName(name plumbing.ReferenceName) plumbing.ReferenceName {
+	switch {
+	case name.IsBranch():
+		return plumbing.NewBranchReferenceName(a.branch("", name.Short()))
+	case name.IsRemote():
+		if remote, branch, ok := strings.Cut(strings.TrimPrefix(name.String(), "refs/remotes/"), "/"); ok {
+			return plumbing.ReferenceName("refs/remotes/" + a.branch(remote, branch))
+		}
+	}
+	return name
+}
+
+// label is the name to print for the ref name: its short name, or the
+// short name of its pseudonym when anonymizing. A nil anonymizer keeps the
+// real names, so annotations can take one either way.
+func (a *anonymizer) label(name plumbing.ReferenceName) string {
+	if a == nil {
+		return name.Short()
+	}
+	return a.refName(name).Short()
+}
+
+// revision is the name to print for rev, a revision given on the command
+// line that resolved to tip: its pseudonym when it names a branch or remote
+// branch, or else the commit, as any other revision may spell out a ref.
+func (a *anonymizer) revision(repo *git.Repository, rev string, tip plumbing.Hash) string {
+	if a == nil {
+		return rev
+	}
+	for _, name := range []plumbing.ReferenceName{plumbing.NewBranchReferenceName(rev), plumbing.ReferenceName("refs/remotes/" + rev)} {
+		if _, err := repo.Reference(name, false); err == nil {
+			return a.label(name)
+		}
+	}
+	return tip.String()[:7]
+}
+
+var (
+	pullRequestFrom = regexp.MustCompile(`^(Merge pull request #\d+) from .*`)
+	branchMergeOf   = regexp.MustCompile(`^Merge (remote-tracking )?branch '([^']+)'.*`)
+)
+
+// subject rewrites the names GitHub and `git merge` put in merge subjects:
+// the fork and branch a pull request came from, and the merged branch with
+// the repository and branch it was merged into.
+func (a *anonymizer) subject(subject string) string {
+	if m := pullRequestFrom.FindStringSubmatch(subject); m != nil {
+		return m[1]
+	}
+	if m := branchMergeOf.FindStringSubmatch(subject); m != nil {
+		name := a.branch("", m[2])
+		if m[1] != "" {
+			if remote, branch, ok := strings.Cut(m[2], "/"); ok {
+				name = a.branch(remote, branch)
+			}
+		}
+		return fmt.Sprintf("Merge %sbranch '%s'", m[1], name)
+	}
+	return subject
+}
+
+// anonymize replaces author and committer identities with pseudonyms and
+// drops message bodies, keeping only subjects stripped of the names merges
+// record. Commits are visited oldest first, so the numbering is the same on
+// every run. They are copied, so the repository's cached objects are left
+// untouched.
+func (a *anonymizer) anonymize(commits map[plumbing.Hash]*structs.CommitInfo) {
+	hashes := make([]plumbing.Hash, 0, len(commits))
+	for h := range commits {
+		hashes = append(hashes, h)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		ti, tj := commits[hashes[i]].Commit.Committer.When, commits[hashes[j]].Commit.Committer.When
+		if ti.Equal(tj) {
+			return hashes[i].String() < hashes[j].String()
+		}
+		return ti.Before(tj)
+	})
+	for _, h := range hashes {
+		ci := commits[h]
+		copied := *ci.Commit
+		copied.Author.Name, copied.Author.Email = a.person(copied.Author.Email)
+		copied.Committer.Name, copied.Committer.Email = a.person(copied.Committer.Email)
+		copied.Message = a.subject(strings.SplitN(copied.Message, "\n", 2)[0])
+		copied.PGPSignature = ""
+		ci.Commit = &copied
+	}
+}
+
+// refs renames the branches in heads, and in the ref labels of commits, to
+// their pseudonyms.
+func (a *anonymizer) refs(
+	heads map[plumbing.Hash][]*plumbing.Reference,
+	commits map[plumbing.Hash]*structs.CommitInfo,
+) map[plumbing.Hash][]*plumbing.Reference {
+	var all []*plumbing.Reference
+	for _, refs := range heads {
+		all = append(all, refs...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name() < all[j].Name() })
+	out := make(map[plumbing.Hash][]*plumbing.Reference, len(heads))
+	for _, ref := range all {
+		renamed := plumbing.NewHashReference(a.refName(ref.Name()), ref.Hash())
+		out[ref.Hash()] = append(out[ref.Hash()], renamed)
+	}
+	for _, ci := range commits {
+		if ci.References == nil {
+			continue
+		}
+		names := ci.References.ToSlice()
+		sort.Strings(names)
+		ci.References.Clear()
+		for _, name := range names {
+			ci.References.Add(a.refName(plumbing.ReferenceName(name)).String())
+		}
+	}
+	return out
+}
+
+// redact replaces every match of patterns in commit messages. Like
+// anonymize, it works on copies of the commits.
+func redact(commits map[plumbing.Hash]*structs.CommitInfo, patterns []*regexp.Regexp) {
+	for _, ci := range commits {
+		message := ci.Commit.Message
+		for _, re := range patterns {
+			message = re.ReplaceAllString(message, "[REDACTED]")
+		}
+		if message == ci.Commit.Message {
+			continue
+		}
+		copied := *ci.Commit
+		copied.Message = message
+		ci.Commit = &copied
+	}
+}
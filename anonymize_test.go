@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestAnonymizeHidesRefNames renders a repository with -anonymize and every
+// annotation that prints branch or remote names, and checks that none of
+// the real names made it into the page. The rendering runs main in a child
+// process, as it exits through fail.
+func TestAnonymizeHidesRefNames(t *testing.T) {
+	if args := os.Getenv("GIT_TREE_TEST_ARGS"); args != "" {
+		os.Args = append([]string{"git-tree"}, strings.Split(args, "\n")...)
+		main()
+		return
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = src
+		cmd.Env = append(cmd.Environ(), "GIT_AUTHOR_NAME=a", "GIT_AUTHOR_EMAIL=a@x", "GIT_COMMITTER_NAME=a", "GIT_COMMITTER_EMAIL=a@x",
+			"GIT_AUTHOR_DATE=2024-01-01T12:00:00", "GIT_COMMITTER_DATE=2024-01-01T12:00:00")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	if err := os.Mkdir(src, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	run("init", "-q", "-b", "main")
+	run("commit", "-q", "--allow-empty", "-m", "first")
+	run("checkout", "-q", "-b", "secret-feature")
+	run("commit", "-q", "--allow-empty", "-m", "feature work")
+	run("checkout", "-q", "main")
+	run("commit", "-q", "--allow-empty", "-m", "trunk work")
+	run("merge", "-q", "--no-ff", "--no-edit", "secret-feature")
+	run("branch", "release-candidate")
+	run("checkout", "-q", "secret-feature")
+	run("commit", "-q", "--allow-empty", "-m", "more feature work")
+	run("remote", "add", "acme-fork", "https://example.invalid/acme.git")
+	run("update-ref", "-m", "update by push", "refs/remotes/acme-fork/secret-feature", "secret-feature~1")
+	run("config", "branch.secret-feature.remote", "acme-fork")
+	run("config", "branch.secret-feature.merge", "refs/heads/secret-feature")
+
+	out := filepath.Join(dir, "tree.html")
+	args := []string{"-path", src, "-html", out, "-anonymize", "-all", "-squash-merges",
+		"-assert-linear", "release-candidate", "-push-lag", "1h"}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestAnonymizeHidesRefNames$")
+	cmd.Env = append(os.Environ(), "GIT_TREE_TEST_ARGS="+strings.Join(args, "\n"))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		// -assert-linear fails the run once it has written the page.
+		if exit, ok := err.(*exec.ExitError); !ok || exit.ExitCode() != exitNotLinear {
+			t.Fatalf("git-tree: %v\n%s", err, output)
+		}
+	}
+
+	page, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"secret-feature", "acme-fork", "release-candidate"} {
+		if strings.Contains(string(page), name) {
+			t.Errorf("anonymized page contains %q", name)
+		}
+	}
+}
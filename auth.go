@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// serveAuth is who serve lets in. A request must pass every check that is
+// configured; with none, everyone is let in.
+type serveAuth struct {
+	user, password string // -basic-auth
+	header         string // -auth-header, set by an authenticating proxy
+}
+
+// parseBasicAuth splits a -basic-auth value of the form user:password.
+func parseBasicAuth(value string) (user, password string, ok bool) {
+	user, password, ok = strings.Cut(value, ":")
+	return user, password, ok && user != "" && password != ""
+}
+
+// isHookPath reports whether p is a webhook endpoint, in single or
+// multi-repository mode. Hooks check their own secret instead of the
+// user's credentials, since the hosting provider has none.
+func isHookPath(p string) bool {
+	for _, pattern := range []string{"/hooks/*", "/r/*/hooks/*"} {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// guard wraps next so it only answers reads, and only to the users a
+// allows. Nothing serve offers changes the repository, and refusing every
+// other method keeps it that way as endpoints are added; the one exception
+// is the webhooks, whose fetch updates remote-tracking refs.
+func (a serveAuth) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isHookPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "read-only", http.StatusMethodNotAllowed)
+			return
+		}
+		if a.header != "" && r.Header.Get(a.header) == "" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if a.user != "" {
+			user, password, ok := r.BasicAuth()
+			if !ok ||
+				subtle.ConstantTimeCompare([]byte(user), []byte(a.user)) != 1 ||
+				subtle.ConstantTimeCompare([]byte(password), []byte(a.password)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="git-tree", charset="UTF-8"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anton-dovnar/git-tree/structs"
+	"github.com/anton-dovnar/git-tree/view"
+
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// bisectState is where a `git bisect` session stands, read from the refs
+// and files git keeps it in.
+type bisectState struct {
+	active       bool
+	bad          plumbing.Hash   // Newest commit known to be bad (or "new")
+	good, skip   []plumbing.Hash // Commits known to be good (or "old"), and skipped ones
+	head         plumbing.Hash   // Commit being tested
+	badTerm      string
+	goodTerm     string
+	firstBadDone bool // git has named the first bad commit
+}
+
+// key identifies the state, to tell when a step was taken.
+func (s bisectState) key() string {
+	return fmt.Sprint(s.active, s.bad, s.good, s.skip, s.head, s.firstBadDone)
+}
+
+// readBisect reads the bisect session of repo without changing anything.
+func readBisect(repo *git.Repository) (bisectState, error) {
+	gitDir := structs.GitDirFS(repo)
+	s := bisectState{badTerm: "bad", goodTerm: "good"}
+	if _, err := gitDir.Stat("BISECT_START"); err != nil {
+		return s, nil
+	}
+	s.active = true
+	if terms, err := util.ReadFile(gitDir, "BISECT_TERMS"); err == nil {
+		if lines := strings.Fields(string(terms)); len(lines) == 2 {
+			s.badTerm, s.goodTerm = lines[0], lines[1]
+		}
+	}
+	if steps, err := util.ReadFile(gitDir, "BISECT_LOG"); err == nil {
+		s.firstBadDone = strings.Contains(string(steps), "# first "+s.badTerm+" commit:")
+	}
+
+	refs, err := repo.References()
+	if err != nil {
+		return s, err
+	}
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		name, ok := strings.CutPrefix(ref.Name().String(), "refs/bisect/")
+		if !ok || ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		switch {
+		case name == s.badTerm:
+			s.bad = ref.Hash()
+		case strings.HasPrefix(name, s.goodTerm+"-"):
+			s.good = append(s.good, ref.Hash())
+		case strings.HasPrefix(name, "skip-"):
+			s.skip = append(s.skip, ref.Hash())
+		}
+		return nil
+	})
+	if err != nil {
+		return s, err
+	}
+	sortHashes(s.good)
+	sortHashes(s.skip)
+	if head, err := repo.Head(); err == nil {
+		s.head = head.Hash()
+	}
+	return s, nil
+}
+
+func sortHashes(hashes []plumbing.Hash) {
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i].String() < hashes[j].String() })
+}
+
+// bisectSuspects returns the commits that may still be the first bad one:
+// the bad commit and its ancestors that no good commit reaches.
+func bisectSuspects(commits map[plumbing.Hash]*structs.CommitInfo, s bisectState) map[plumbing.Hash]bool {
+	cleared := make(map[plumbing.Hash]bool)
+	pending := append([]plumbing.Hash(nil), s.good...)
+	for len(pending) > 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		ci, ok := commits[h]
+		if !ok || cleared[h] {
+			continue
+		}
+		cleared[h] = true
+		pending = append(pending, ci.Commit.ParentHashes...)
+	}
+
+	suspects := make(map[plumbing.Hash]bool)
+	if s.bad.IsZero() {
+		return suspects
+	}
+	for pending = []plumbing.Hash{s.bad}; len(pending) > 0; {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		ci, ok := commits[h]
+		if !ok || cleared[h] || suspects[h] {
+			continue
+		}
+		suspects[h] = true
+		pending = append(pending, ci.Commit.ParentHashes...)
+	}
+	return suspects
+}
+
+// annotateBisect badges the commits bisect has marked and returns the style
+// coloring their stops, with the suspects to highlight.
+func annotateBisect(commits map[plumbing.Hash]*structs.CommitInfo, s bisectState) (string, map[string]bool) {
+	suspects := bisectSuspects(commits, s)
+	var css strings.Builder
+	mark := func(h plumbing.Hash, text, detail, style string) {
+		ci, ok := commits[h]
+		if !ok {
+			return
+		}
+		ci.Badges = append(ci.Badges, structs.Badge{Text: text, Detail: detail})
+		fmt.Fprintf(&css, "#railway .stop[id=\"%s\"] { %s }\n", h, style)
+	}
+	for _, h := range s.good {
+		mark(h, "✓ "+s.goodTerm, "Marked "+s.goodTerm+" in this bisect", "fill: #57df6c;")
+	}
+	for _, h := range s.skip {
+		mark(h, "⤼ skip", "Skipped in this bisect; it cannot be tested", "fill: #808080;")
+	}
+	if !s.bad.IsZero() {
+		detail := fmt.Sprintf("Marked %s in this bisect; %d suspects left, about %d steps", s.badTerm, len(suspects), bisectSteps(len(suspects)))
+		if s.firstBadDone && len(suspects) == 1 {
+			detail = "The first " + s.badTerm + " commit"
+		}
+		mark(s.bad, "✗ "+s.badTerm, detail, "fill: #e5484d;")
+	}
+	if suspects[s.head] && s.head != s.bad {
+		mark(s.head, "▶ testing", "Checked out for you to test", "stroke: #f0a35e; stroke-width: 3;")
+	}
+
+	// The suspects are bracketed between the bad commit and the oldest of
+	// them, the others being dimmed.
+	highlight := make(map[string]bool, len(suspects))
+	var oldest plumbing.Hash
+	for h := range suspects {
+		highlight[h.String()] = true
+		if h != s.bad && (oldest.IsZero() || commits[h].Commit.Committer.When.Before(commits[oldest].Commit.Committer.When)) {
+			oldest = h
+		}
+	}
+	if !oldest.IsZero() {
+		commits[oldest].Badges = append(commits[oldest].Badges, structs.Badge{
+			Text:   "└ suspects",
+			Detail: fmt.Sprintf("Oldest of the %d commits that may be the first %s one", len(suspects), s.badTerm),
+		})
+	}
+	return css.String(), highlight
+}
+
+// bisectSteps estimates how many more steps bisecting n suspects takes.
+func bisectSteps(n int) int {
+	if n <= 1 {
+		return 0
+	}
+	return int(math.Ceil(math.Log2(float64(n))))
+}
+
+func runBisect(args []string) {
+	fs := flag.NewFlagSet("bisect-run", flag.ExitOnError)
+	repoPath := fs.String("path", ".", "Path to Git repository (any subdirectory is OK)")
+	all := fs.Bool("all", false, "Include remote refs")
+	htmlOut := fs.String("html", "bisect.html", "Generate HTML output file")
+	interval := fs.Duration("interval", time.Second, "How often to look for bisect steps")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: git-tree bisect-run [flags] [-- <cmd> [args...]]\n\nRedraw the graph after every step of `git bisect`, coloring the commits\nmarked good, bad and skipped and bracketing the commits still suspect.\nWith a command, runs `git bisect run <cmd>`; without one, follows the\nsteps you take with `git bisect good` and `git bisect bad` until the\nbisect ends. The repository is only read; git does all the bisecting.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var done chan error
+	if fs.NArg() > 0 {
+		cmd := exec.Command("git", append([]string{"bisect", "run"}, fs.Args()...)...)
+		cmd.Dir = *repoPath
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		if err := cmd.Start(); err != nil {
+			fail(exitFailure, fmt.Errorf("Failed to run git bisect: %w", err))
+		}
+		done = make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+	}
+
+	last, seen := "", false
+	for {
+		// Reopened every time, so refs and objects written by git are read.
+		repo, err := git.PlainOpenWithOptions(*repoPath, &git.PlainOpenOptions{DetectDotGit: true})
+		if err != nil {
+			fail(openRepoCode(err), fmt.Errorf("Failed to open repository: %w", err))
+		}
+		state, err := readBisect(repo)
+		if err != nil {
+			fail(exitFailure, fmt.Errorf("Failed to read bisect state: %w", err))
+		}
+		if !state.active && done == nil {
+			if seen {
+				log.Printf("Bisect ended")
+				return
+			}
+			fail(exitFailure, errors.New("No bisect in progress; start one with git bisect start <bad> <good>"))
+		}
+		seen = seen || state.active
+		if key := state.key(); key != last {
+			last = key
+			renderBisect(repo, repoTitle(*repoPath), *htmlOut, *all, state)
+		}
+
+		select {
+		case err := <-done:
+			if err != nil {
+				log.Printf("git bisect run: %v", err)
+			}
+			if repo, err := git.PlainOpenWithOptions(*repoPath, &git.PlainOpenOptions{DetectDotGit: true}); err == nil {
+				if state, err := readBisect(repo); err == nil && state.key() != last {
+					renderBisect(repo, repoTitle(*repoPath), *htmlOut, *all, state)
+				}
+			}
+			return
+		case <-time.After(*interval):
+		}
+	}
+}
+
+// renderBisect draws the graph colored by the bisect state.
+func renderBisect(repo *git.Repository, title, htmlOut string, all bool, state bisectState) {
+	commits, children, err := collectCommits(repo, all)
+	if err != nil {
+		fail(exitFailure, fmt.Errorf("Failed to collect commits: %w", err))
+	}
+	heads, tags, err := getRefs(repo, all)
+	if err != nil {
+		fail(exitFailure, fmt.Errorf("Failed to collect refs: %w", err))
+	}
+	css, highlight := annotateBisect(commits, state)
+	if state.active {
+		log.Printf("Bisect: %d suspects left, about %d steps", len(highlight), bisectSteps(len(highlight)))
+	}
+	svgOpts := view.SVGOptions{Aliases: branchAliases(repo, heads), Highlight: highlight}
+	if len(highlight) == 0 {
+		svgOpts.Highlight = nil
+	}
+	writeGraph(repo, title, htmlOut, commits, children, heads, tags, view.HTMLOptions{ExtraCSS: css}, svgOpts)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/anton-dovnar/git-tree/structs"
+	"github.com/anton-dovnar/git-tree/view"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Static pages embed tree listings only while the number of distinct trees
+// stays below this limit; larger repositories need serve mode to browse.
+const browseTreeLimit = 2000
+
+func treeEntries(tree *object.Tree) []view.TreeEntry {
+	entries := make([]view.TreeEntry, 0, len(tree.Entries))
+	for _, e := range tree.Entries {
+		entries = append(entries, view.TreeEntry{
+			Name: e.Name,
+			Hash: e.Hash.String(),
+			Dir:  e.Mode == filemode.Dir,
+		})
+	}
+	return entries
+}
+
+// collectTrees lists every tree reachable from the commits' root trees,
+// sharing listings between commits. It returns nil once more than limit
+// distinct trees are found.
+func collectTrees(
+	repo *git.Repository,
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	limit int,
+) map[string][]view.TreeEntry {
+	if filter := partialCloneFilter(repo); lacksTrees(filter) {
+		log.Printf("Not listing files: trees are left out of this partial clone (filter %s)", filter)
+		return nil
+	}
+	trees := make(map[string][]view.TreeEntry)
+	var pending []plumbing.Hash
+	for _, ci := range commits {
+		if ci != nil && ci.Commit != nil {
+			pending = append(pending, ci.Commit.TreeHash)
+		}
+	}
+
+	for len(pending) > 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if _, ok := trees[h.String()]; ok {
+			continue
+		}
+		if len(trees) >= limit {
+			return nil
+		}
+
+		tree, err := repo.TreeObject(h)
+		if err != nil {
+			continue
+		}
+		entries := treeEntries(tree)
+		trees[h.String()] = entries
+		for _, e := range entries {
+			if e.Dir {
+				pending = append(pending, plumbing.NewHash(e.Hash))
+			}
+		}
+	}
+	return trees
+}
+
+func treeHandler(repo *git.Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hash := r.URL.Query().Get("hash")
+		if !plumbing.IsHash(hash) {
+			http.Error(w, "invalid tree hash", http.StatusBadRequest)
+			return
+		}
+		tree, err := repo.TreeObject(plumbing.NewHash(hash))
+		if err != nil {
+			http.Error(w, notFetched(err).Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, treeEntries(tree))
+	}
+}
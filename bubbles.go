@@ -0,0 +1,281 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/anton-dovnar/git-tree/structs"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+var (
+	pullRequestMerge = regexp.MustCompile(`^Merge pull request #(\d+)`)
+	branchMerge      = regexp.MustCompile(`^Merge (?:remote-tracking )?branch '([^']+)'`)
+)
+
+// mergeLabel names the side branch a merge commit brought in, from the
+// messages GitHub and `git merge` write by default.
+func mergeLabel(message string) (string, bool) {
+	if m := pullRequestMerge.FindStringSubmatch(message); m != nil {
+		return "PR #" + m[1], true
+	}
+	if m := branchMerge.FindStringSubmatch(message); m != nil {
+		return m[1], true
+	}
+	return "", false
+}
+
+// collapseMerges folds the side branch of every recognized merge into a
+// single bubble node. A side branch is left alone when one of its commits
+// carries a head or tag, or is also reachable from outside the merge, since
+// hiding it would lose information. Merges are visited newest first, so
+// branches merged into a side branch end up inside its bubble.
+func collapseMerges(
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	heads, tags map[plumbing.Hash][]*plumbing.Reference,
+) (map[plumbing.Hash]*structs.CommitInfo, map[plumbing.Hash]mapset.Set[plumbing.Hash]) {
+	out := make(map[plumbing.Hash]*structs.CommitInfo, len(commits))
+	var merges []*structs.CommitInfo
+	for h, ci := range commits {
+		out[h] = ci
+		if ci.Commit.NumParents() > 1 {
+			if _, ok := mergeLabel(ci.Commit.Message); ok {
+				merges = append(merges, ci)
+			}
+		}
+	}
+	sort.Slice(merges, func(i, j int) bool {
+		ti, tj := merges[i].Commit.Committer.When, merges[j].Commit.Committer.When
+		if ti.Equal(tj) {
+			return merges[i].Commit.Hash.String() < merges[j].Commit.Hash.String()
+		}
+		return ti.After(tj)
+	})
+
+	children := buildChildren(out)
+	gen := generations(out)
+	for _, merge := range merges {
+		if _, ok := out[merge.Commit.Hash]; !ok {
+			continue // Already folded into a newer bubble
+		}
+		side, forks := sideBranch(out, children, merge.Commit)
+		if side.Cardinality() == 0 || !foldable(side, heads, tags) ||
+			!ancestorsOf(out, gen, merge.Commit.ParentHashes[0], forks) {
+			continue
+		}
+
+		label, _ := mergeLabel(merge.Commit.Message)
+		bubble := newBubble(out, side, merge.Commit.ParentHashes[1], label)
+		for h := range side.Iter() {
+			for _, p := range out[h].Commit.ParentHashes {
+				if cs, ok := children[p]; ok && !side.Contains(p) {
+					cs.Remove(h)
+				}
+			}
+			delete(children, h)
+			delete(gen, h)
+			delete(out, h)
+		}
+		out[bubble.Commit.Hash] = bubble
+		for _, p := range bubble.Commit.ParentHashes {
+			if _, ok := children[p]; !ok {
+				children[p] = mapset.NewSet[plumbing.Hash]()
+			}
+			children[p].Add(bubble.Commit.Hash)
+			gen[bubble.Commit.Hash] = max(gen[bubble.Commit.Hash], gen[p])
+		}
+		gen[bubble.Commit.Hash]++
+		children[bubble.Commit.Hash] = mapset.NewSet(merge.Commit.Hash)
+
+		rewritten := *merge.Commit
+		rewritten.ParentHashes = append([]plumbing.Hash(nil), merge.Commit.ParentHashes...)
+		rewritten.ParentHashes[1] = bubble.Commit.Hash
+		folded := *merge
+		folded.Commit = &rewritten
+		out[merge.Commit.Hash] = &folded
+	}
+	return out, children
+}
+
+// sideBranch returns the commits the merge's second parent brought in that
+// only the merge builds on, along with the commits they fork from. It grows
+// the set from the second parent, taking a commit once all of its children
+// are in it, so the walk stays within the side branch. The side branch is
+// every commit reachable from the second parent but not the first exactly
+// when all the forks are ancestors of the first parent.
+func sideBranch(
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	children map[plumbing.Hash]mapset.Set[plumbing.Hash],
+	merge *object.Commit,
+) (mapset.Set[plumbing.Hash], []plumbing.Hash) {
+	side := mapset.NewThreadUnsafeSet[plumbing.Hash]()
+	onlyFeedsSide := func(h plumbing.Hash) bool {
+		if cs, ok := children[h]; ok {
+			for c := range cs.Iter() {
+				if c != merge.Hash && !side.Contains(c) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	pending := []plumbing.Hash{merge.ParentHashes[1]}
+	for len(pending) > 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		ci, ok := commits[h]
+		if !ok || h == merge.ParentHashes[0] || side.Contains(h) || !onlyFeedsSide(h) {
+			continue // Revisited if another of its children joins the side
+		}
+		side.Add(h)
+		pending = append(pending, ci.Commit.ParentHashes...)
+	}
+
+	var forks []plumbing.Hash
+	seen := mapset.NewThreadUnsafeSet[plumbing.Hash]()
+	for h := range side.Iter() {
+		for _, p := range commits[h].Commit.ParentHashes {
+			if _, ok := commits[p]; ok && !side.Contains(p) && seen.Add(p) {
+				forks = append(forks, p)
+			}
+		}
+	}
+	return side, forks
+}
+
+// foldable reports whether side can be hidden in a bubble, which it cannot
+// when one of its commits carries a head or tag.
+func foldable(side mapset.Set[plumbing.Hash], heads, tags map[plumbing.Hash][]*plumbing.Reference) bool {
+	for h := range side.Iter() {
+		if len(heads[h]) > 0 || len(tags[h]) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// generations numbers commits so every commit is above its parents: roots
+// are 1 and others one more than their highest parent. A commit cannot be
+// an ancestor of one with a lower number, which bounds ancestry walks.
+func generations(commits map[plumbing.Hash]*structs.CommitInfo) map[plumbing.Hash]int {
+	gen := make(map[plumbing.Hash]int, len(commits))
+	for h := range commits {
+		pending := []plumbing.Hash{h}
+		for len(pending) > 0 {
+			top := pending[len(pending)-1]
+			if gen[top] > 0 {
+				pending = pending[:len(pending)-1]
+				continue
+			}
+			g, ready := 1, true
+			for _, p := range commits[top].Commit.ParentHashes {
+				if _, ok := commits[p]; !ok {
+					continue
+				}
+				if gen[p] == 0 {
+					pending = append(pending, p)
+					ready = false
+				} else {
+					g = max(g, gen[p]+1)
+				}
+			}
+			if ready {
+				gen[top] = g
+				pending = pending[:len(pending)-1]
+			}
+		}
+	}
+	return gen
+}
+
+// ancestorsOf reports whether every one of targets is reachable from tip.
+// The walk skips commits numbered below the lowest target, which cannot
+// lead to any of them.
+func ancestorsOf(
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	gen map[plumbing.Hash]int,
+	tip plumbing.Hash,
+	targets []plumbing.Hash,
+) bool {
+	if len(targets) == 0 {
+		return true
+	}
+	want := mapset.NewThreadUnsafeSet(targets...)
+	floor := gen[targets[0]]
+	for _, t := range targets[1:] {
+		floor = min(floor, gen[t])
+	}
+	seen := mapset.NewThreadUnsafeSet[plumbing.Hash]()
+	pending := []plumbing.Hash{tip}
+	for len(pending) > 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		ci, ok := commits[h]
+		if !ok || gen[h] < floor || !seen.Add(h) {
+			continue
+		}
+		if want.Remove(h); want.Cardinality() == 0 {
+			return true
+		}
+		pending = append(pending, ci.Commit.ParentHashes...)
+	}
+	return false
+}
+
+// newBubble builds the node standing in for side. It takes the tip's metadata,
+// hangs off the commits the side branch forked from, and lists the folded
+// commits newest first.
+func newBubble(
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	side mapset.Set[plumbing.Hash],
+	tip plumbing.Hash,
+	label string,
+) *structs.CommitInfo {
+	var folded []*object.Commit
+	var forks []plumbing.Hash
+	refs := mapset.NewSet[string]()
+	seenForks := mapset.NewThreadUnsafeSet[plumbing.Hash]()
+	for h := range side.Iter() {
+		ci := commits[h]
+		if len(ci.Collapsed) > 0 {
+			folded = append(folded, ci.Collapsed...)
+		} else {
+			folded = append(folded, ci.Commit)
+		}
+		if ci.References != nil {
+			refs = refs.Union(ci.References)
+		}
+		for _, p := range ci.Commit.ParentHashes {
+			if !side.Contains(p) && seenForks.Add(p) {
+				forks = append(forks, p)
+			}
+		}
+	}
+	sort.Slice(folded, func(i, j int) bool {
+		if folded[i].Committer.When.Equal(folded[j].Committer.When) {
+			return folded[i].Hash.String() < folded[j].Hash.String()
+		}
+		return folded[i].Committer.When.After(folded[j].Committer.When)
+	})
+	sort.Slice(forks, func(i, j int) bool { return forks[i].String() < forks[j].String() })
+
+	node := *commits[tip].Commit
+	node.Hash = plumbing.Hash(sha1.Sum([]byte("bubble\x00" + tip.String())))
+	node.ParentHashes = forks
+	node.Message = fmt.Sprintf("%s (%d commits)", label, len(folded))
+	return &structs.CommitInfo{
+		Commit:     &node,
+		References: refs,
+		Collapsed:  folded,
+		Badges: []structs.Badge{{
+			Text:   fmt.Sprintf("⊕ %s · %d", label, len(folded)),
+			Detail: fmt.Sprintf("%d commits merged from %s", len(folded), label),
+		}},
+	}
+}
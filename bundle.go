@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/anton-dovnar/git-tree/structs"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// writeBundle writes a v2 git bundle holding exactly commits with their trees
+// and blobs, and the refs among heads and tags that point into them. Parents
+// left out of commits become the bundle's prerequisites, so a trimmed view
+// unbundles only into a repository that already has its boundary.
+func writeBundle(
+	repo *git.Repository,
+	path string,
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	heads, tags map[plumbing.Hash][]*plumbing.Reference,
+) error {
+	objects := mapset.NewThreadUnsafeSet[plumbing.Hash]()
+	prerequisites := mapset.NewThreadUnsafeSet[plumbing.Hash]()
+	for h := range commits {
+		if _, err := repo.Storer.EncodedObject(plumbing.CommitObject, h); err != nil {
+			continue // Synthetic node of a rewritten view
+		}
+		commit, err := repo.CommitObject(h)
+		if err != nil {
+			return fmt.Errorf("read commit %s: %w", h, err)
+		}
+		objects.Add(h)
+		// The parents of commits may have been rewritten past the ones
+		// the view leaves out; the bundle needs the commit's own.
+		for _, p := range commit.ParentHashes {
+			if _, ok := commits[p]; !ok {
+				prerequisites.Add(p)
+			}
+		}
+		tree, err := commit.Tree()
+		if err != nil {
+			return fmt.Errorf("read tree of %s: %w", h, err)
+		}
+		if err := addTreeObjects(tree, objects); err != nil {
+			return err
+		}
+	}
+
+	var refs []*plumbing.Reference
+	for _, m := range []map[plumbing.Hash][]*plumbing.Reference{heads, tags} {
+		for h, rs := range m {
+			if objects.Contains(h) {
+				refs = append(refs, rs...)
+			}
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name() < refs[j].Name() })
+	for _, ref := range refs {
+		objects.Add(ref.Hash()) // Annotated tag objects
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+
+	fmt.Fprintln(w, "# v2 git bundle")
+	sortedPrerequisites := prerequisites.ToSlice()
+	sort.Slice(sortedPrerequisites, func(i, j int) bool { return sortedPrerequisites[i].String() < sortedPrerequisites[j].String() })
+	for _, h := range sortedPrerequisites {
+		fmt.Fprintf(w, "-%s\n", h)
+	}
+	if head, err := repo.Head(); err == nil && objects.Contains(head.Hash()) {
+		fmt.Fprintf(w, "%s HEAD\n", head.Hash())
+	}
+	for _, ref := range refs {
+		fmt.Fprintf(w, "%s %s\n", ref.Hash(), ref.Name())
+	}
+	fmt.Fprintln(w)
+
+	if _, err := packfile.NewEncoder(w, repo.Storer, false).Encode(objects.ToSlice(), 10); err != nil {
+		return fmt.Errorf("write pack: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// addTreeObjects adds tree and everything below it to objects. Submodule
+// commits live in another repository and are skipped.
+func addTreeObjects(tree *object.Tree, objects mapset.Set[plumbing.Hash]) error {
+	if !objects.Add(tree.Hash) {
+		return nil
+	}
+	for _, entry := range tree.Entries {
+		switch entry.Mode {
+		case filemode.Submodule:
+		case filemode.Dir:
+			sub, err := tree.Tree(entry.Name)
+			if err != nil {
+				return fmt.Errorf("read tree %s: %w", entry.Name, err)
+			}
+			if err := addTreeObjects(sub, objects); err != nil {
+				return err
+			}
+		default:
+			objects.Add(entry.Hash)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// TestBundleAfterSample fetches a bundle of a sampled view into a repository
+// holding only its prerequisites: the commits sampled out must be named
+// there, with their own parents, rather than skipped over.
+func TestBundleAfterSample(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst.git")
+	run := func(dir string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(cmd.Environ(), "GIT_AUTHOR_NAME=a", "GIT_AUTHOR_EMAIL=a@x", "GIT_COMMITTER_NAME=a", "GIT_COMMITTER_EMAIL=a@x")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return string(out)
+	}
+	run(dir, "init", "-q", "-b", "main", src)
+	for i := range 12 {
+		run(src, "commit", "-q", "--allow-empty", "-m", fmt.Sprintf("commit %d", i), "--date", fmt.Sprintf("2024-01-%02dT12:00:00", i+1))
+	}
+
+	repo, err := git.PlainOpen(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits, children, err := collectCommits(repo, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	heads, tags, err := getRefs(repo, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits, _ = sampleCommits(commits, children, heads, tags, 5)
+	if len(commits) >= 12 {
+		t.Fatalf("sampled %d commits, want fewer than 12", len(commits))
+	}
+	bundle := filepath.Join(dir, "s.bundle")
+	if err := writeBundle(repo, bundle, commits, heads, tags); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, _, _ := strings.Cut(string(data), "\n\n")
+	run(dir, "init", "-q", "--bare", dst)
+	run(src, "config", "uploadpack.allowAnySHA1InWant", "true")
+	prerequisites := 0
+	for _, line := range strings.Split(header, "\n") {
+		if h, ok := strings.CutPrefix(line, "-"); ok {
+			run(dst, "fetch", "-q", src, fmt.Sprintf("%s:refs/prerequisites/%d", h, prerequisites))
+			prerequisites++
+		}
+	}
+	if prerequisites == 0 {
+		t.Fatal("bundle of a sampled view has no prerequisites")
+	}
+	run(dst, "fetch", "-q", bundle, "refs/*:refs/*")
+	if got := strings.TrimSpace(run(dst, "rev-list", "--count", "main")); got != "12" {
+		t.Errorf("main has %s commits after fetching the bundle, want 12", got)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/anton-dovnar/git-tree/structs"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// cacheGraph is set by -cache.
+var cacheGraph bool
+
+// graphCacheVersion changes whenever graphCache or what walkCommits
+// collects changes, so caches written by other versions are ignored.
+const graphCacheVersion = 1
+
+// graphCache is the collected graph as stored by -cache. Commits are kept
+// as the raw objects git stores, which are quick to decode compared to
+// finding them in packfiles, and decode into commits that can still read
+// their trees from the repository.
+type graphCache struct {
+	Key     string
+	Commits []cachedCommit
+}
+
+type cachedCommit struct {
+	Raw  []byte
+	Refs []string // See structs.CommitInfo.References
+}
+
+// collectCommits walks the commits reachable from the refs, or with -cache
+// loads them from the cache when no ref has moved since it was written.
+func collectCommits(repo *git.Repository, all bool) (
+	map[plumbing.Hash]*structs.CommitInfo,
+	map[plumbing.Hash]mapset.Set[plumbing.Hash],
+	error,
+) {
+	if !cacheGraph {
+		return walkCommits(repo, all)
+	}
+	fs := structs.GitDirFS(repo)
+	path, key, err := graphCacheKey(repo, all)
+	if err != nil {
+		log.Printf("Not caching the commit graph: %v", err)
+		return walkCommits(repo, all)
+	}
+	if commits, children, err := loadGraphCache(fs, path, key, repo); err == nil {
+		log.Printf("Loaded %d commits from %s", len(commits), fs.Join(fs.Root(), path))
+		return commits, children, nil
+	} else if !os.IsNotExist(err) {
+		log.Printf("Ignoring the commit graph cache: %v", err)
+	}
+
+	commits, children, err := walkCommits(repo, all)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := saveGraphCache(fs, path, key, repo, commits); err != nil {
+		log.Printf("Failed to cache the commit graph: %v", err)
+	}
+	return commits, children, nil
+}
+
+// graphCacheKey is where the cache lives in the git directory and the key
+// that tells whether it is current: a digest of HEAD and every ref.
+func graphCacheKey(repo *git.Repository, all bool) (string, string, error) {
+	refIter, err := repo.References()
+	if err != nil {
+		return "", "", err
+	}
+	var refs []string
+	refIter.ForEach(func(ref *plumbing.Reference) error {
+		refs = append(refs, ref.String())
+		return nil
+	})
+	refIter.Close()
+	sort.Strings(refs)
+
+	h := sha1.New()
+	fmt.Fprintf(h, "v%d all=%t pulls=%t reflog=%s/%d include=%q exclude=%q\n",
+		graphCacheVersion, all, pullRequests, reflogLabels, reflogMaxEntries, refIncludes, refExcludes)
+	if head, err := repo.Head(); err == nil {
+		fmt.Fprintln(h, head.String())
+	}
+	for _, ref := range refs {
+		fmt.Fprintln(h, ref)
+	}
+	return filepath.Join("git-tree", "graph.gob"), hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func loadGraphCache(fs billy.Filesystem, path, key string, repo *git.Repository) (
+	map[plumbing.Hash]*structs.CommitInfo,
+	map[plumbing.Hash]mapset.Set[plumbing.Hash],
+	error,
+) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	var cache graphCache
+	if err := gob.NewDecoder(f).Decode(&cache); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if cache.Key != key {
+		return nil, nil, fmt.Errorf("%s is out of date", path)
+	}
+
+	commits := make(map[plumbing.Hash]*structs.CommitInfo, len(cache.Commits))
+	children := make(map[plumbing.Hash]mapset.Set[plumbing.Hash])
+	for _, c := range cache.Commits {
+		obj := &plumbing.MemoryObject{}
+		obj.SetType(plumbing.CommitObject)
+		obj.Write(c.Raw)
+		commit, err := object.DecodeCommit(repo.Storer, obj)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		commits[commit.Hash] = &structs.CommitInfo{Commit: commit, References: mapset.NewSet(c.Refs...)}
+		for _, parent := range commit.ParentHashes {
+			if _, ok := children[parent]; !ok {
+				children[parent] = mapset.NewSet[plumbing.Hash]()
+			}
+			children[parent].Add(commit.Hash)
+		}
+	}
+	return commits, children, nil
+}
+
+func saveGraphCache(fs billy.Filesystem, path, key string, repo *git.Repository, commits map[plumbing.Hash]*structs.CommitInfo) error {
+	cache := graphCache{Key: key, Commits: make([]cachedCommit, 0, len(commits))}
+	for h, ci := range commits {
+		obj, err := repo.Storer.EncodedObject(plumbing.CommitObject, h)
+		if err != nil {
+			return err
+		}
+		r, err := obj.Reader()
+		if err != nil {
+			return err
+		}
+		raw, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+		cache.Commits = append(cache.Commits, cachedCommit{Raw: raw, Refs: ci.References.ToSlice()})
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(cache); err != nil {
+		return err
+	}
+	if err := fs.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// Written aside and renamed, so a concurrent run never reads half a cache.
+	tmp := path + ".tmp"
+	if err := util.WriteFile(fs, tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return fs.Rename(tmp, path)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/anton-dovnar/git-tree/structs"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// canvasLimits are the sizes past which a drawing gets too big to open
+// comfortably, set with -limit-rows and -limit-lanes; 0 means no limit.
+type canvasLimits struct {
+	rows, lanes int
+}
+
+// canvasSize is how many rows and lanes the graph would be drawn over. Rows
+// are counted without arranging; lanes need an arrangement, which is only
+// made when there are more commits than the lane limit.
+func canvasSize(
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	children map[plumbing.Hash]mapset.Set[plumbing.Hash],
+	heads map[plumbing.Hash][]*plumbing.Reference,
+	limits canvasLimits,
+) (rows, lanes int) {
+	rows = len(commits)
+	if limits.lanes == 0 || len(commits) <= limits.lanes {
+		return rows, 0
+	}
+	positions, err := layouter.Arrange(context.Background(), Graph{Commits: commits, Children: children, Heads: heads})
+	if err != nil {
+		return rows, 0
+	}
+	for _, pos := range positions {
+		lanes = max(lanes, pos[0]+1)
+	}
+	return rows, lanes
+}
+
+func (l canvasLimits) exceeded(rows, lanes int) bool {
+	return l.rows > 0 && rows > l.rows || l.lanes > 0 && lanes > l.lanes
+}
+
+// checkComplexity warns when the graph exceeds the limits, suggesting ways
+// to cut it down. With simplify it cuts it down itself instead: it
+// collapses merged branches unless that was done already, then samples
+// linear runs until the rows fit.
+func checkComplexity(
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	children map[plumbing.Hash]mapset.Set[plumbing.Hash],
+	heads, tags map[plumbing.Hash][]*plumbing.Reference,
+	limits canvasLimits,
+	simplify, collapsed bool,
+) (map[plumbing.Hash]*structs.CommitInfo, map[plumbing.Hash]mapset.Set[plumbing.Hash]) {
+	rows, lanes := canvasSize(commits, children, heads, limits)
+	if !limits.exceeded(rows, lanes) {
+		return commits, children
+	}
+	if !simplify {
+		log.Printf("⚠️ The graph spans %d rows and %s lanes, over the limits of %d rows and %d lanes (-limit-rows, -limit-lanes); the output may be too big to open.",
+			rows, lanesText(lanes), limits.rows, limits.lanes)
+		sample := limits.rows
+		if sample == 0 {
+			sample = 1000
+		}
+		log.Printf("   Narrow it down with a revision range such as HEAD~1000.., -mode releases, -collapse-merges or -sample %d, or pass -auto-simplify.", sample)
+		return commits, children
+	}
+
+	if !collapsed {
+		commits, children = collapseMerges(commits, heads, tags)
+		log.Printf("Auto-simplify: collapsed merges down to %d nodes", len(commits))
+	}
+	if limits.rows > 0 && len(commits) > limits.rows {
+		commits, children = sampleCommits(commits, children, onlyCommits(heads, commits), onlyCommits(tags, commits), limits.rows)
+		log.Printf("Auto-simplify: sampled down to %d commits", len(commits))
+	}
+	if rows, lanes := canvasSize(commits, children, onlyCommits(heads, commits), limits); limits.exceeded(rows, lanes) {
+		log.Printf("⚠️ Even simplified, the graph spans %d rows and %s lanes; narrow down the refs or revisions shown.", rows, lanesText(lanes))
+	}
+	return commits, children
+}
+
+// lanesText is a lane count, or "an unmeasured number of" when the lanes
+// were not counted.
+func lanesText(lanes int) string {
+	if lanes == 0 {
+		return "an unmeasured number of"
+	}
+	return fmt.Sprint(lanes)
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/anton-dovnar/git-tree/structs"
+	"github.com/anton-dovnar/git-tree/view"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+type conflict struct {
+	Path string
+	Kind string // content, add/add, modify/delete, rename/rename
+}
+
+// sideChange is what one side of a merge did to a path of the merge base.
+type sideChange struct {
+	path string        // Path on this side, empty when deleted
+	hash plumbing.Hash // Blob on this side, zero when deleted
+	tree *object.Tree
+}
+
+// predictConflicts performs an in-memory three-way merge of ours and theirs
+// against base and reports the paths git would stop on. Files changed by
+// both sides are merged line by line; different changes touching
+// overlapping or adjacent base lines conflict, as they do in git.
+func predictConflicts(base, ours, theirs *object.Commit) ([]conflict, error) {
+	baseTree, err := base.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("read tree of %s: %w", base.Hash, err)
+	}
+	oursChanges, err := sideChanges(baseTree, ours)
+	if err != nil {
+		return nil, err
+	}
+	theirsChanges, err := sideChanges(baseTree, theirs)
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []conflict
+	for key, o := range oursChanges {
+		t, ok := theirsChanges[key]
+		if !ok || (o.path == t.path && o.hash == t.hash) {
+			continue
+		}
+		switch {
+		case o.hash.IsZero() || t.hash.IsZero():
+			conflicts = append(conflicts, conflict{Path: key, Kind: "modify/delete"})
+		case o.path != key && t.path != key && o.path != t.path:
+			conflicts = append(conflicts, conflict{Path: key, Kind: "rename/rename"})
+		default:
+			baseText := ""
+			if entry, err := baseTree.FindEntry(key); err == nil {
+				if baseText, err = blobText(baseTree, key, entry.Hash); err != nil {
+					return nil, err
+				}
+			} else {
+				conflicts = append(conflicts, conflict{Path: key, Kind: "add/add"})
+				continue
+			}
+			oursText, err := blobText(o.tree, o.path, o.hash)
+			if err != nil {
+				return nil, err
+			}
+			theirsText, err := blobText(t.tree, t.path, t.hash)
+			if err != nil {
+				return nil, err
+			}
+			if hunksConflict(changedHunks(baseText, oursText), changedHunks(baseText, theirsText)) {
+				conflicts = append(conflicts, conflict{Path: key, Kind: "content"})
+			}
+		}
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Path < conflicts[j].Path })
+	return conflicts, nil
+}
+
+// sideChanges maps every base path touched by commit to its outcome. Added
+// files are keyed by their new path.
+func sideChanges(baseTree *object.Tree, commit *object.Commit) (map[string]sideChange, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("read tree of %s: %w", commit.Hash, err)
+	}
+	changes, err := object.DiffTreeWithOptions(context.Background(), baseTree, tree, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return nil, fmt.Errorf("diff %s: %w", commit.Hash, err)
+	}
+
+	out := make(map[string]sideChange, len(changes))
+	for _, c := range changes {
+		key := c.From.Name
+		if key == "" {
+			key = c.To.Name
+		}
+		out[key] = sideChange{path: c.To.Name, hash: c.To.TreeEntry.Hash, tree: tree}
+	}
+	return out, nil
+}
+
+func blobText(tree *object.Tree, path string, hash plumbing.Hash) (string, error) {
+	file, err := tree.TreeEntryFile(&object.TreeEntry{Name: path, Hash: hash})
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", path, err)
+	}
+	return file.Contents()
+}
+
+// hunk is a run of base lines [start, end] that one side replaced with
+// text. Pure insertions are empty ranges at their position.
+type hunk struct {
+	start, end int
+	text       string
+}
+
+// changedHunks lists the hunks of the diff from base to text, each deletion
+// joined with the insertion next to it.
+func changedHunks(base, text string) []hunk {
+	var hunks []hunk
+	line := 0
+	open := false // Whether the last hunk ends here and grows with the next change
+	for _, d := range diff.Do(base, text) {
+		n := strings.Count(d.Text, "\n")
+		if !strings.HasSuffix(d.Text, "\n") {
+			n++
+		}
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			line += n
+			open = false
+		case diffmatchpatch.DiffDelete:
+			if open {
+				hunks[len(hunks)-1].end = line + n
+			} else {
+				hunks = append(hunks, hunk{start: line, end: line + n})
+			}
+			line += n
+			open = true
+		case diffmatchpatch.DiffInsert:
+			if open {
+				hunks[len(hunks)-1].text += d.Text
+			} else {
+				hunks = append(hunks, hunk{start: line, end: line, text: d.Text})
+			}
+			open = true
+		}
+	}
+	return hunks
+}
+
+// hunksConflict reports whether a hunk of a touches or overlaps one of b
+// that makes a different change. Both sides making the same change merges
+// cleanly, as in git.
+func hunksConflict(a, b []hunk) bool {
+	for _, ha := range a {
+		for _, hb := range b {
+			if ha.start <= hb.end && hb.start <= ha.end && ha != hb {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func runConflicts(args []string) {
+	fs := flag.NewFlagSet("conflicts", flag.ExitOnError)
+	repoPath := fs.String("path", ".", "Path to Git repository (any subdirectory is OK)")
+	all := fs.Bool("all", false, "Include remote refs")
+	htmlOut := fs.String("html", "tree.html", "Generate HTML output file")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: git-tree conflicts [flags] <ours> <theirs>\n\nPredict which files would conflict when merging <theirs> into <ours>.\nExits with status 8 when conflicts are found.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	repo, err := git.PlainOpenWithOptions(*repoPath, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		fail(openRepoCode(err), err)
+	}
+	ours, err := resolveCommit(repo, fs.Arg(0))
+	if err != nil {
+		fail(exitFailure, err)
+	}
+	theirs, err := resolveCommit(repo, fs.Arg(1))
+	if err != nil {
+		fail(exitFailure, err)
+	}
+	bases, err := ours.MergeBase(theirs)
+	if err != nil {
+		fail(exitFailure, fmt.Errorf("Failed to find merge base: %w", err))
+	}
+	if len(bases) == 0 {
+		fail(exitFailure, fmt.Errorf("%s and %s have no common ancestor", fs.Arg(0), fs.Arg(1)))
+	}
+
+	conflicts, err := predictConflicts(bases[0], ours, theirs)
+	if err != nil {
+		fail(exitFailure, fmt.Errorf("Failed to merge: %w", err))
+	}
+	for _, c := range conflicts {
+		fmt.Printf("CONFLICT (%s): %s\n", c.Kind, c.Path)
+	}
+	if len(conflicts) == 0 {
+		fmt.Printf("%s merges cleanly into %s\n", fs.Arg(1), fs.Arg(0))
+	}
+
+	commits, children, err := collectCommits(repo, *all)
+	if err != nil {
+		fail(exitFailure, fmt.Errorf("Failed to collect commits: %w", err))
+	}
+	heads, tags, err := getRefs(repo, *all)
+	if err != nil {
+		fail(exitFailure, fmt.Errorf("Failed to collect refs: %w", err))
+	}
+	annotateConflicts(commits, bases[0].Hash, ours.Hash, theirs.Hash, fs.Arg(0), fs.Arg(1), conflicts)
+	svgOpts := view.SVGOptions{Aliases: branchAliases(repo, heads)}
+	writeGraph(repo, repoTitle(*repoPath), *htmlOut, commits, children, heads, tags, view.HTMLOptions{}, svgOpts)
+
+	if len(conflicts) > 0 {
+		os.Exit(exitConflicts)
+	}
+}
+
+func annotateConflicts(
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	base, ours, theirs plumbing.Hash,
+	oursName, theirsName string,
+	conflicts []conflict,
+) {
+	lines := make([]string, 0, len(conflicts))
+	for _, c := range conflicts {
+		lines = append(lines, fmt.Sprintf("%s (%s)", c.Path, c.Kind))
+	}
+	detail := strings.Join(lines, "\n")
+
+	badge := func(other string) structs.Badge {
+		if len(conflicts) == 0 {
+			return structs.Badge{Text: "✔ merges cleanly", Detail: "No conflicts with " + other}
+		}
+		return structs.Badge{
+			Text:   fmt.Sprintf("⚠ %d conflicts", len(conflicts)),
+			Detail: fmt.Sprintf("Conflicts with %s:\n%s", other, detail),
+		}
+	}
+	if ci, ok := commits[ours]; ok {
+		ci.Badges = append(ci.Badges, badge(theirsName))
+	}
+	if ci, ok := commits[theirs]; ok && theirs != ours {
+		ci.Badges = append(ci.Badges, badge(oursName))
+	}
+	if ci, ok := commits[base]; ok {
+		ci.Badges = append(ci.Badges, structs.Badge{
+			Text:   "merge base",
+			Detail: fmt.Sprintf("Merge base of %s and %s", oursName, theirsName),
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/anton-dovnar/git-tree/structs"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// Exit codes, so wrapper scripts can tell failures apart without parsing
+// the log. 2 is for bad arguments, as the flag package uses it.
+const (
+	exitFailure       = 1
+	exitUsage         = 2
+	exitNotRepo       = 3
+	exitEmptyRepo     = 4
+	exitWriteFailed   = 5
+	exitPartialRender = 6
+	exitNotLinear     = 7
+	exitConflicts     = 8
+)
+
+var exitKinds = map[int]string{
+	exitFailure:       "failure",
+	exitUsage:         "usage",
+	exitNotRepo:       "not_a_repository",
+	exitEmptyRepo:     "empty_repository",
+	exitWriteFailed:   "write_failed",
+	exitPartialRender: "partial_render",
+	exitNotLinear:     "not_linear",
+	exitConflicts:     "conflicts",
+}
+
+// jsonErrors is set by -errors json.
+var jsonErrors bool
+
+// setErrorFormat parses the -errors flag value.
+func setErrorFormat(format string) error {
+	switch format {
+	case "text":
+		jsonErrors = false
+	case "json":
+		jsonErrors = true
+	default:
+		return fmt.Errorf("unknown error format %q (want text or json)", format)
+	}
+	return nil
+}
+
+// fail reports err and exits with code. With -errors json the report is a
+// single JSON object on stderr instead of a log line.
+func fail(code int, err error) {
+	if !jsonErrors {
+		warnings.summarize()
+		log.Print(err)
+		os.Exit(code)
+	}
+	report := struct {
+		Error    string   `json:"error"`
+		Message  string   `json:"message"`
+		ExitCode int      `json:"exit_code"`
+		Warnings []string `json:"warnings,omitempty"`
+	}{exitKinds[code], err.Error(), code, warnings.all()}
+	data, _ := json.Marshal(report)
+	fmt.Fprintln(os.Stderr, string(data))
+	os.Exit(code)
+}
+
+// openRepoCode picks the exit code for a failed PlainOpen.
+func openRepoCode(err error) int {
+	if errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, transport.ErrRepositoryNotFound) {
+		return exitNotRepo
+	}
+	return exitFailure
+}
+
+// keepGoing is set by -keep-going.
+var keepGoing bool
+
+// refsUnlisted is set when -keep-going made do with HEAD.
+var refsUnlisted bool
+
+// listRefs lists the refs of repo. When they cannot be read, as with a
+// damaged packed-refs file, it fails, or with -keep-going notes why and
+// lists HEAD alone, so the history it reaches is still drawn.
+func listRefs(repo *git.Repository) (storer.ReferenceIter, error) {
+	iter, err := repo.References()
+	if err == nil {
+		return iter, nil
+	}
+	if !keepGoing {
+		return nil, refsError(err)
+	}
+	warnings.add("Could not list the refs, so only HEAD is drawn: %v", err)
+	refsUnlisted = true
+	var refs []*plumbing.Reference
+	if head, err := repo.Head(); err == nil {
+		refs = append(refs, head)
+	}
+	return storer.NewReferenceSliceIter(refs), nil
+}
+
+// refsError explains a failure to read the refs, without which there is
+// nothing to draw.
+func refsError(err error) error {
+	return fmt.Errorf("could not list the refs: %w (look for a damaged .git/packed-refs or file under .git/refs, or pass -keep-going to draw what HEAD reaches)", err)
+}
+
+// missingParents counts the parents referenced by commits that could not be
+// loaded, as in repositories with missing objects. The parents cut off at
+// the shallow boundary are expected to be absent and are not counted.
+func missingParents(commits map[plumbing.Hash]*structs.CommitInfo, shallow map[plumbing.Hash]bool) int {
+	missing := map[plumbing.Hash]bool{}
+	for h, info := range commits {
+		if shallow[h] {
+			continue
+		}
+		for _, parent := range info.Commit.ParentHashes {
+			if _, ok := commits[parent]; !ok && !shallow[parent] {
+				missing[parent] = true
+			}
+		}
+	}
+	return len(missing)
+}
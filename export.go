@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/anton-dovnar/git-tree/view"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// writeExport writes the commits as placed by the main output in the -export
+// format kind to base plus the format's extension, returning the path.
+func writeExport(kind, base string, g view.Graph, positions map[plumbing.Hash][2]int) (string, error) {
+	var r view.Renderer
+	path := base + "." + kind
+	switch kind {
+	case "csv":
+		r = view.CSVRenderer{Comma: ','}
+	case "tsv":
+		r = view.CSVRenderer{Comma: '\t'}
+	case "sql":
+		r = view.SQLRenderer{}
+	case "sqlite":
+		path = base + ".db"
+		return path, writeSQLite(path, g, positions)
+	default:
+		return path, fmt.Errorf("unknown export %q (want csv, tsv, sql or sqlite)", kind)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return path, err
+	}
+	err = r.Render(context.Background(), g, positions, file)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return path, err
+}
+
+// writeSQLite builds a fresh database at path by running the script of
+// -export sql through the sqlite3 command, so no database driver has to be
+// built in.
+func writeSQLite(path string, g view.Graph, positions map[plumbing.Hash][2]int) error {
+	sqlite, err := exec.LookPath("sqlite3")
+	if err != nil {
+		return fmt.Errorf("the sqlite3 command is needed to create databases; use -export sql for the script instead")
+	}
+	var script bytes.Buffer
+	if err := (view.SQLRenderer{}).Render(context.Background(), g, positions, &script); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	cmd := exec.Command(sqlite, "-bail", path)
+	cmd.Stdin = &script
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("sqlite3: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return nil
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anton-dovnar/git-tree/structs"
+	"github.com/anton-dovnar/git-tree/view"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+type fileVisit struct {
+	parents []plumbing.Hash // Parents the walk continued into
+	changed bool
+	stat    structs.FileStat
+}
+
+// fileHistory walks history from HEAD following path across renames, like
+// `git log --follow`. Only commits that modified the file are returned, with
+// their parents rewritten to the nearest modifying ancestors so the graph
+// stays connected. References are taken from the fully collected commits.
+func fileHistory(
+	repo *git.Repository,
+	path string,
+	collected map[plumbing.Hash]*structs.CommitInfo,
+) (
+	map[plumbing.Hash]*structs.CommitInfo,
+	map[plumbing.Hash]mapset.Set[plumbing.Hash],
+	error,
+) {
+	head, err := repo.Head()
+	if err != nil {
+		return nil, nil, fmt.Errorf("resolve HEAD: %w", err)
+	}
+	headCommit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, nil, fmt.Errorf("read HEAD commit: %w", err)
+	}
+	if _, ok, err := blobAt(headCommit, path); err != nil {
+		return nil, nil, err
+	} else if !ok {
+		return nil, nil, fmt.Errorf("%s does not exist at HEAD", path)
+	}
+
+	visits := make(map[plumbing.Hash]*fileVisit)
+	pending := []*object.Commit{headCommit}
+	paths := map[plumbing.Hash]string{headCommit.Hash: path}
+
+	for len(pending) > 0 {
+		commit := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if _, ok := visits[commit.Hash]; ok {
+			continue
+		}
+
+		visit, parents, parentPaths, err := visitFileCommit(commit, paths[commit.Hash])
+		if err != nil {
+			return nil, nil, err
+		}
+		visits[commit.Hash] = visit
+
+		for i, parent := range parents {
+			if _, ok := paths[parent.Hash]; !ok {
+				paths[parent.Hash] = parentPaths[i]
+			}
+			pending = append(pending, parent)
+		}
+	}
+
+	// nearest resolves the closest ancestors that changed the file, skipping
+	// over the commits that left it untouched.
+	memo := make(map[plumbing.Hash][]plumbing.Hash)
+	var nearest func(h plumbing.Hash) []plumbing.Hash
+	nearest = func(h plumbing.Hash) []plumbing.Hash {
+		if res, ok := memo[h]; ok {
+			return res
+		}
+		memo[h] = nil // Guard against revisiting while resolving
+		var res []plumbing.Hash
+		seen := mapset.NewSet[plumbing.Hash]()
+		for _, p := range visits[h].parents {
+			candidates := []plumbing.Hash{p}
+			if !visits[p].changed {
+				candidates = nearest(p)
+			}
+			for _, c := range candidates {
+				if seen.Add(c) {
+					res = append(res, c)
+				}
+			}
+		}
+		memo[h] = res
+		return res
+	}
+
+	commits := make(map[plumbing.Hash]*structs.CommitInfo)
+	children := make(map[plumbing.Hash]mapset.Set[plumbing.Hash])
+	for h, visit := range visits {
+		if !visit.changed {
+			continue
+		}
+		original, err := repo.CommitObject(h)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read commit %s: %w", h, err)
+		}
+		rewritten := *original
+		rewritten.ParentHashes = nearest(h)
+
+		refs := mapset.NewSet[string]()
+		if info, ok := collected[h]; ok && info.References != nil {
+			refs = info.References.Clone()
+		}
+		commits[h] = &structs.CommitInfo{
+			Commit:     &rewritten,
+			References: refs,
+			Files:      []structs.FileStat{visit.stat},
+		}
+
+		for _, p := range rewritten.ParentHashes {
+			if _, ok := children[p]; !ok {
+				children[p] = mapset.NewSet[plumbing.Hash]()
+			}
+			children[p].Add(h)
+		}
+	}
+
+	return commits, children, nil
+}
+
+// visitFileCommit decides whether commit changed the file at path and which
+// parents the walk should continue into, together with the file's path in
+// each of them. A commit identical to one of its parents for the file follows
+// only that parent, mirroring git's default history simplification.
+func visitFileCommit(commit *object.Commit, path string) (
+	*fileVisit,
+	[]*object.Commit,
+	[]string,
+	error,
+) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("read tree of %s: %w", commit.Hash, err)
+	}
+	blob, _, err := blobAt(commit, path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	type candidate struct {
+		commit *object.Commit
+		tree   *object.Tree
+		path   string
+	}
+	var candidates []candidate
+	treesame := false
+	err = commit.Parents().ForEach(func(parent *object.Commit) error {
+		parentTree, err := parent.Tree()
+		if err != nil {
+			return fmt.Errorf("read tree of %s: %w", parent.Hash, err)
+		}
+		parentBlob, ok, err := blobAt(parent, path)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if parentBlob == blob {
+				candidates = []candidate{{commit: parent, tree: parentTree, path: path}}
+				treesame = true
+				return storer.ErrStop
+			}
+			candidates = append(candidates, candidate{commit: parent, tree: parentTree, path: path})
+			return nil
+		}
+		oldPath, err := renamedFrom(parentTree, tree, path)
+		if err != nil {
+			return err
+		}
+		candidates = append(candidates, candidate{commit: parent, tree: parentTree, path: oldPath})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	visit := &fileVisit{changed: !treesame}
+
+	var parents []*object.Commit
+	var parentPaths []string
+	for _, c := range candidates {
+		if c.path == "" {
+			continue
+		}
+		visit.parents = append(visit.parents, c.commit.Hash)
+		parents = append(parents, c.commit)
+		parentPaths = append(parentPaths, c.path)
+	}
+
+	if visit.changed {
+		var fromTree *object.Tree
+		fromPath := ""
+		if len(candidates) > 0 && candidates[0].path != "" {
+			fromTree, fromPath = candidates[0].tree, candidates[0].path
+		}
+		visit.stat, err = fileStat(fromTree, tree, fromPath, path)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	return visit, parents, parentPaths, nil
+}
+
+// blobAt returns the blob hash of path in commit's tree and whether it exists.
+func blobAt(commit *object.Commit, path string) (plumbing.Hash, bool, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return plumbing.ZeroHash, false, fmt.Errorf("read tree of %s: %w", commit.Hash, err)
+	}
+	entry, err := tree.FindEntry(path)
+	if err != nil {
+		if errors.Is(err, object.ErrEntryNotFound) || errors.Is(err, object.ErrDirectoryNotFound) {
+			return plumbing.ZeroHash, false, nil
+		}
+		return plumbing.ZeroHash, false, fmt.Errorf("find %s in %s: %w", path, commit.Hash, err)
+	}
+	return entry.Hash, true, nil
+}
+
+// renamedFrom returns the path that path was renamed from between the two
+// trees, or an empty string when the file was newly added.
+func renamedFrom(from, to *object.Tree, path string) (string, error) {
+	changes, err := object.DiffTreeWithOptions(context.Background(), from, to, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return "", fmt.Errorf("detect renames: %w", err)
+	}
+	for _, change := range changes {
+		if change.To.Name == path && change.From.Name != "" && change.From.Name != path {
+			return change.From.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// fileStat counts the lines added and removed for a single file between two
+// trees. A nil from tree means the file was added.
+func fileStat(from, to *object.Tree, fromPath, toPath string) (structs.FileStat, error) {
+	stat := structs.FileStat{Name: toPath}
+	if fromPath != toPath {
+		stat.OldName = fromPath
+	}
+
+	change := &object.Change{}
+	if from != nil {
+		entry, err := from.FindEntry(fromPath)
+		if err != nil {
+			return stat, fmt.Errorf("find %s: %w", fromPath, err)
+		}
+		change.From = object.ChangeEntry{Name: fromPath, Tree: from, TreeEntry: *entry}
+	}
+	entry, err := to.FindEntry(toPath)
+	if err != nil {
+		return stat, fmt.Errorf("find %s: %w", toPath, err)
+	}
+	change.To = object.ChangeEntry{Name: toPath, Tree: to, TreeEntry: *entry}
+
+	patch, err := change.Patch()
+	if err != nil {
+		return stat, fmt.Errorf("diff %s: %w", toPath, err)
+	}
+	for _, fs := range patch.Stats() {
+		stat.Additions += fs.Addition
+		stat.Deletions += fs.Deletion
+	}
+	return stat, nil
+}
+
+func runFileHistory(args []string) {
+	fs := flag.NewFlagSet("file", flag.ExitOnError)
+	repoPath := fs.String("path", ".", "Path to Git repository (any subdirectory is OK)")
+	htmlOut := fs.String("html", "tree.html", "Generate HTML output file")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: git-tree file [flags] <file>\n\nRender the commits that modified <file>, following renames.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	repo, err := git.PlainOpenWithOptions(*repoPath, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		fail(openRepoCode(err), err)
+	}
+	target := repoRelativePath(repo, fs.Arg(0))
+
+	collected, _, err := collectCommits(repo, false)
+	if err != nil {
+		fail(exitFailure, fmt.Errorf("Failed to collect commits: %w", err))
+	}
+	commits, children, err := fileHistory(repo, target, collected)
+	if err != nil {
+		fail(exitFailure, fmt.Errorf("Failed to read history of %s: %w", target, err))
+	}
+	log.Printf("Collected %d commits modifying %s", len(commits), target)
+
+	heads, tags, err := getRefs(repo, false)
+	if err != nil {
+		fail(exitFailure, fmt.Errorf("Failed to collect refs: %w", err))
+	}
+	heads = onlyCommits(heads, commits)
+	svgOpts := view.SVGOptions{Aliases: branchAliases(repo, heads)}
+	writeGraph(repo, repoTitle(*repoPath)+": "+target, *htmlOut, commits, children,
+		heads, onlyCommits(tags, commits), view.HTMLOptions{}, svgOpts)
+}
+
+// repoRelativePath converts a path given on the command line into a path
+// relative to the repository root. Paths outside the worktree are kept as is.
+func repoRelativePath(repo *git.Repository, path string) string {
+	wt, err := repo.Worktree()
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	rel, err := filepath.Rel(wt.Filesystem.Root(), abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func onlyCommits(
+	refs map[plumbing.Hash][]*plumbing.Reference,
+	commits map[plumbing.Hash]*structs.CommitInfo,
+) map[plumbing.Hash][]*plumbing.Reference {
+	out := make(map[plumbing.Hash][]*plumbing.Reference)
+	for h, rs := range refs {
+		if _, ok := commits[h]; ok {
+			out[h] = rs
+		}
+	}
+	return out
+}
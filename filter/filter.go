@@ -0,0 +1,175 @@
+// Package filter narrows a collected commit graph before it is laid out.
+// A Filter decides which commits stay; Apply runs filters and rewrites the
+// parents of the commits kept past the ones dropped, as `git log` does when
+// limiting history to paths, so the graph stays connected.
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/anton-dovnar/git-tree/structs"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// Filter decides whether a commit stays in the graph.
+type Filter interface {
+	Keep(ci *structs.CommitInfo) (bool, error)
+}
+
+// Func turns a function into a Filter.
+type Func func(ci *structs.CommitInfo) (bool, error)
+
+func (f Func) Keep(ci *structs.CommitInfo) (bool, error) { return f(ci) }
+
+// Apply keeps the commits every filter keeps and returns them with their
+// children. A kept commit's parents are rewritten to its nearest kept
+// ancestors; parents outside commits are left as they are. The commits
+// kept are copies, so commits itself is not modified.
+func Apply(commits map[plumbing.Hash]*structs.CommitInfo, filters ...Filter) (
+	map[plumbing.Hash]*structs.CommitInfo,
+	map[plumbing.Hash]mapset.Set[plumbing.Hash],
+	error,
+) {
+	keep := make(map[plumbing.Hash]bool, len(commits))
+	for h, ci := range commits {
+		keep[h] = true
+		for _, f := range filters {
+			ok, err := f.Keep(ci)
+			if err != nil {
+				return nil, nil, fmt.Errorf("filter %s: %w", h, err)
+			}
+			if !ok {
+				keep[h] = false
+				break
+			}
+		}
+	}
+
+	memo := make(map[plumbing.Hash][]plumbing.Hash)
+	var nearest func(h plumbing.Hash) []plumbing.Hash
+	nearest = func(h plumbing.Hash) []plumbing.Hash {
+		if res, ok := memo[h]; ok {
+			return res
+		}
+		memo[h] = nil // Guard against revisiting while resolving
+		var res []plumbing.Hash
+		seen := mapset.NewSet[plumbing.Hash]()
+		for _, p := range commits[h].Commit.ParentHashes {
+			candidates := []plumbing.Hash{p}
+			if _, ok := commits[p]; ok && !keep[p] {
+				candidates = nearest(p)
+			}
+			for _, c := range candidates {
+				if seen.Add(c) {
+					res = append(res, c)
+				}
+			}
+		}
+		memo[h] = res
+		return res
+	}
+
+	out := make(map[plumbing.Hash]*structs.CommitInfo)
+	children := make(map[plumbing.Hash]mapset.Set[plumbing.Hash])
+	for h, ci := range commits {
+		if !keep[h] {
+			continue
+		}
+		rewritten := *ci.Commit
+		rewritten.ParentHashes = nearest(h)
+		copied := *ci
+		copied.Commit = &rewritten
+		out[h] = &copied
+		for _, p := range rewritten.ParentHashes {
+			if _, ok := children[p]; !ok {
+				children[p] = mapset.NewSet[plumbing.Hash]()
+			}
+			children[p].Add(h)
+		}
+	}
+	return out, children, nil
+}
+
+// Paths keeps the commits that changed something under one of paths, given
+// relative to the top of the repository, compared with every one of their
+// parents, or with the empty tree for a root commit. "." matches any path.
+func Paths(paths ...string) Filter {
+	return Func(func(ci *structs.CommitInfo) (bool, error) {
+		return touchesPaths(ci.Commit, paths)
+	})
+}
+
+func touchesPaths(commit *object.Commit, paths []string) (bool, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return false, err
+	}
+	var parentTrees []*object.Tree
+	if commit.NumParents() == 0 {
+		parentTrees = []*object.Tree{nil}
+	}
+	for i, h := range commit.ParentHashes {
+		parent, err := commit.Parent(i)
+		if err != nil {
+			return false, fmt.Errorf("read parent %s: %w", h, err)
+		}
+		parentTree, err := parent.Tree()
+		if err != nil {
+			return false, err
+		}
+		parentTrees = append(parentTrees, parentTree)
+	}
+	for _, parentTree := range parentTrees {
+		changes, err := object.DiffTree(parentTree, tree)
+		if err != nil {
+			return false, err
+		}
+		if !changesUnder(changes, paths) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func changesUnder(changes object.Changes, paths []string) bool {
+	for _, change := range changes {
+		for _, name := range []string{change.From.Name, change.To.Name} {
+			for _, path := range paths {
+				if path == "." || name == path || strings.HasPrefix(name, strings.TrimSuffix(path, "/")+"/") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Author keeps the commits whose author, as "Name <email>", matches re,
+// like `git log --author`.
+func Author(re *regexp.Regexp) Filter {
+	return Func(func(ci *structs.CommitInfo) (bool, error) {
+		a := ci.Commit.Author
+		return re.MatchString(a.Name + " <" + a.Email + ">"), nil
+	})
+}
+
+// Since keeps the commits committed at t or later, like `git log --since`.
+func Since(t time.Time) Filter {
+	return Func(func(ci *structs.CommitInfo) (bool, error) {
+		return !ci.Commit.Committer.When.Before(t), nil
+	})
+}
+
+// Until keeps the commits committed at t or earlier, like `git log --until`.
+func Until(t time.Time) Filter {
+	return Func(func(ci *structs.CommitInfo) (bool, error) {
+		return !ci.Commit.Committer.When.After(t), nil
+	})
+}
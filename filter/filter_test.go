@@ -0,0 +1,49 @@
+package filter
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/anton-dovnar/git-tree/structs"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestApplyRewritesParentsPastDroppedCommits(t *testing.T) {
+	// a ← b ← d, a ← c ← d: dropping b and c leaves d a child of a, once.
+	hash := func(s string) plumbing.Hash { return plumbing.NewHash(s + "000000000000000000000000000000000000000") }
+	a, b, c, d, outside := hash("a"), hash("b"), hash("c"), hash("d"), hash("f")
+	commit := func(h plumbing.Hash, parents ...plumbing.Hash) *structs.CommitInfo {
+		return &structs.CommitInfo{Commit: &object.Commit{Hash: h, ParentHashes: parents}}
+	}
+	commits := map[plumbing.Hash]*structs.CommitInfo{
+		a: commit(a, outside),
+		b: commit(b, a),
+		c: commit(c, a),
+		d: commit(d, b, c),
+	}
+	dropBC := Func(func(ci *structs.CommitInfo) (bool, error) {
+		return ci.Commit.Hash != b && ci.Commit.Hash != c, nil
+	})
+
+	kept, children, err := Apply(commits, dropBC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 2 {
+		t.Fatalf("kept %d commits, want 2", len(kept))
+	}
+	if got := kept[d].Commit.ParentHashes; !slices.Equal(got, []plumbing.Hash{a}) {
+		t.Errorf("d's parents = %v, want [a]", got)
+	}
+	if got := kept[a].Commit.ParentHashes; !slices.Equal(got, []plumbing.Hash{outside}) {
+		t.Errorf("a's parents = %v, want the parent outside the graph kept", got)
+	}
+	if !children[a].Contains(d) || children[a].Cardinality() != 1 {
+		t.Errorf("children of a = %v, want [d]", children[a])
+	}
+	if len(commits[d].Commit.ParentHashes) != 2 {
+		t.Error("Apply modified the commits it was given")
+	}
+}
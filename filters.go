@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/anton-dovnar/git-tree/filter"
+)
+
+// filterDateLayouts are the forms -since and -until take.
+var filterDateLayouts = []string{time.RFC3339, "2006-01-02 15:04", time.DateOnly}
+
+// parseFilterDate reads a -since or -until date, in local time unless it
+// gives a zone.
+func parseFilterDate(value string) (time.Time, error) {
+	for _, layout := range filterDateLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date like 2024-05-01, 2024-05-01 15:04 or 2024-05-01T15:04:05Z", value)
+}
+
+// commitFilters builds the filters -author, -since and -until ask for.
+func commitFilters(author, since, until string) ([]filter.Filter, error) {
+	var filters []filter.Filter
+	if author != "" {
+		re, err := regexp.Compile(author)
+		if err != nil {
+			return nil, fmt.Errorf("-author: %w", err)
+		}
+		filters = append(filters, filter.Author(re))
+	}
+	if since != "" {
+		t, err := parseFilterDate(since)
+		if err != nil {
+			return nil, fmt.Errorf("-since: %w", err)
+		}
+		filters = append(filters, filter.Since(t))
+	}
+	if until != "" {
+		t, err := parseFilterDate(until)
+		if err != nil {
+			return nil, fmt.Errorf("-until: %w", err)
+		}
+		filters = append(filters, filter.Until(t))
+	}
+	return filters, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/anton-dovnar/git-tree/structs"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// fsckLite cross-checks the commits named by parents and reflog entries
+// against the object database. Missing commits get a placeholder node so
+// the edges pointing at them stay visible; commits whose tree cannot be
+// read are kept and badged. The parents a shallow clone left out are not
+// checked. It returns the hashes to mark as broken.
+func fsckLite(
+	repo *git.Repository,
+	commits map[plumbing.Hash]*structs.CommitInfo,
+) map[string]bool {
+	broken := make(map[string]bool)
+	problem := func(h plumbing.Hash, text, detail string) {
+		broken[h.String()] = true
+		if ci, ok := commits[h]; ok {
+			ci.Badges = append(ci.Badges, structs.Badge{Text: text, Detail: detail})
+			return
+		}
+		commits[h] = &structs.CommitInfo{
+			Commit:     &object.Commit{Hash: h, Message: detail},
+			References: mapset.NewSet[string](),
+			Badges:     []structs.Badge{{Text: text, Detail: detail}},
+		}
+	}
+
+	shallow := shallowCommits(repo)
+	check := func(h plumbing.Hash, source string) {
+		if _, ok := commits[h]; ok || shallow[h] {
+			return
+		}
+		_, err := repo.CommitObject(h)
+		switch {
+		case err == nil:
+		case errors.Is(err, plumbing.ErrObjectNotFound):
+			problem(h, "✗ missing", fmt.Sprintf("Commit %s referenced by %s is not in the object database", h, source))
+		default:
+			problem(h, "✗ corrupt", fmt.Sprintf("Commit %s referenced by %s cannot be read: %v", h, source, err))
+		}
+	}
+
+	hashes := make([]plumbing.Hash, 0, len(commits))
+	for h := range commits {
+		hashes = append(hashes, h)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i].String() < hashes[j].String() })
+	// Trees a partial clone left out are not broken, only not downloaded.
+	checkTrees := !lacksTrees(partialCloneFilter(repo))
+	for _, h := range hashes {
+		ci := commits[h]
+		if checkTrees {
+			if _, err := repo.TreeObject(ci.Commit.TreeHash); err != nil {
+				problem(h, "✗ tree", fmt.Sprintf("Tree %s of this commit cannot be read: %v", ci.Commit.TreeHash, err))
+			}
+		}
+		if shallow[h] {
+			continue // Its parents were never fetched
+		}
+		for _, p := range ci.Commit.ParentHashes {
+			check(p, "commit "+h.String()[:7])
+		}
+	}
+
+	gitDir := structs.GitDirFS(repo)
+	refIter, err := repo.References()
+	if err != nil {
+		return broken
+	}
+	defer refIter.Close()
+	var refNames []string
+	refIter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Name().IsBranch() || ref.Name().IsRemote() {
+			refNames = append(refNames, ref.Name().String())
+		}
+		return nil
+	})
+	sort.Strings(refNames)
+	for _, name := range refNames {
+		reflog, err := structs.ReadReflogNewHashes(gitDir, name)
+		if err != nil {
+			warnings.add("Could not read all of the reflog of %s: %v", plumbing.ReferenceName(name).Short(), err)
+		}
+		for _, h := range reflog {
+			check(h, "the reflog of "+plumbing.ReferenceName(name).Short())
+		}
+	}
+	return broken
+}
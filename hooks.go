@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// maxHookBody bounds how much of a webhook payload is read to check its
+// signature. GitHub caps payloads at 25 MB.
+const maxHookBody = 25 << 20
+
+// hookServer serves the routes of the latest build and, on a webhook, fetches
+// and builds again in the background. Requests keep getting the previous
+// build until the new one is ready.
+type hookServer struct {
+	cfg     serveConfig
+	secret  string
+	current atomic.Pointer[http.ServeMux]
+	refresh chan struct{} // Holds a pending refresh, so a burst of pushes coalesces
+}
+
+func newHookServer(cfg serveConfig, secret string, mux *http.ServeMux) *hookServer {
+	s := &hookServer{cfg: cfg, secret: secret, refresh: make(chan struct{}, 1)}
+	s.current.Store(mux)
+	go s.rebuild()
+	return s
+}
+
+func (s *hookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/hooks/github":
+		s.github(w, r)
+	case "/hooks/refresh":
+		s.generic(w, r)
+	default:
+		s.current.Load().ServeHTTP(w, r)
+	}
+}
+
+// github accepts a GitHub webhook signed with the secret in
+// X-Hub-Signature-256. Pushes trigger a refresh; pings are acknowledged and
+// other events ignored.
+func (s *hookServer) github(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxHookBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mac := hmac.New(sha256.New, []byte(s.secret))
+	mac.Write(body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(r.Header.Get("X-Hub-Signature-256")), []byte(want)) {
+		http.Error(w, "bad signature", http.StatusUnauthorized)
+		return
+	}
+	switch event := r.Header.Get("X-GitHub-Event"); event {
+	case "push", "create", "delete":
+		s.queue(w)
+	default:
+		fmt.Fprintf(w, "ignored %s event\n", event)
+	}
+}
+
+// generic accepts a refresh from anything that can send the secret as a
+// bearer token.
+func (s *hookServer) generic(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.secret)) != 1 {
+		http.Error(w, "bad token", http.StatusUnauthorized)
+		return
+	}
+	s.queue(w)
+}
+
+// queue asks for a refresh without waiting for it: fetching and rendering
+// can outlast the hosting provider's webhook timeout.
+func (s *hookServer) queue(w http.ResponseWriter) {
+	select {
+	case s.refresh <- struct{}{}:
+	default: // One is already pending and will see this push too
+	}
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintln(w, "refresh queued")
+}
+
+func (s *hookServer) rebuild() {
+	for range s.refresh {
+		if err := fetchAll(s.cfg.repoPath); err != nil {
+			log.Printf("Failed to fetch: %v", err)
+		}
+		mux, err := s.cfg.build()
+		if err != nil {
+			log.Printf("Failed to re-render: %v", err)
+			continue
+		}
+		s.current.Store(mux)
+		log.Printf("🔄 Re-rendered after webhook")
+	}
+}
+
+// fetchAll fetches every remote of the repository at path, pruning refs
+// deleted upstream.
+func fetchAll(path string) error {
+	repo, err := git.PlainOpenWithOptions(path, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return err
+	}
+	remotes, err := repo.Remotes()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, remote := range remotes {
+		err := remote.Fetch(&git.FetchOptions{Prune: true})
+		if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+			errs = append(errs, fmt.Errorf("%s: %w", remote.Config().Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"path"
+	"sort"
+
+	"github.com/anton-dovnar/git-tree/structs"
+	"github.com/anton-dovnar/git-tree/view"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// hotspotDirs and hotspotFiles cap the -hotspots treemap at the hottest
+// directories and the hottest files in each.
+const hotspotDirs, hotspotFiles = 12, 8
+
+// collectHotspots counts how often the commits changed each file, merges
+// left out as `git log` leaves them out, and returns the directories
+// holding the most changed files, hottest first, with their hottest files.
+func collectHotspots(repo *git.Repository, commits map[plumbing.Hash]*structs.CommitInfo) []view.Hotspot {
+	if filter := partialCloneFilter(repo); lacksTrees(filter) {
+		log.Printf("Skipping -hotspots: this partial clone (filter %s) may be missing the trees it compares", filter)
+		return nil
+	}
+
+	files := make(map[string]*view.Hotspot)
+	missing := 0
+	for h, ci := range commits {
+		if ci.Commit.NumParents() > 1 {
+			continue
+		}
+		names, err := changedFiles(ci)
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			missing++
+			continue
+		}
+		if err != nil {
+			log.Printf("Could not list the files %s changed: %v", h.String()[:7], err)
+			continue
+		}
+		for _, name := range names {
+			f := files[name]
+			if f == nil {
+				f = &view.Hotspot{Path: name}
+				files[name] = f
+			}
+			f.Changes++
+			f.Commits = append(f.Commits, h.String())
+		}
+	}
+	if missing > 0 {
+		log.Printf("Skipped the changes of %d commits: %v", missing, notFetched(plumbing.ErrObjectNotFound))
+	}
+
+	dirs := make(map[string]*view.Hotspot)
+	for _, f := range files {
+		name := path.Dir(f.Path)
+		d := dirs[name]
+		if d == nil {
+			d = &view.Hotspot{Path: name}
+			dirs[name] = d
+		}
+		d.Changes += f.Changes
+		d.Commits = append(d.Commits, f.Commits...)
+		d.Files = append(d.Files, *f)
+	}
+
+	out := make([]view.Hotspot, 0, len(dirs))
+	for _, d := range dirs {
+		hottestFirst(d.Files)
+		d.Files = d.Files[:min(len(d.Files), hotspotFiles)]
+		for i := range d.Files {
+			sort.Strings(d.Files[i].Commits)
+		}
+		sort.Strings(d.Commits)
+		d.Commits = uniqueSorted(d.Commits)
+		out = append(out, *d)
+	}
+	hottestFirst(out)
+	return out[:min(len(out), hotspotDirs)]
+}
+
+// hottestFirst sorts hotspots by their changes, then by path.
+func hottestFirst(hotspots []view.Hotspot) {
+	sort.Slice(hotspots, func(i, j int) bool {
+		if hotspots[i].Changes != hotspots[j].Changes {
+			return hotspots[i].Changes > hotspots[j].Changes
+		}
+		return hotspots[i].Path < hotspots[j].Path
+	})
+}
+
+func uniqueSorted(s []string) []string {
+	out := s[:0]
+	for i, v := range s {
+		if i == 0 || v != s[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// changedFiles lists the files a commit changed from its first parent,
+// taken from its diffstat when one was computed.
+func changedFiles(ci *structs.CommitInfo) ([]string, error) {
+	if ci.Files != nil {
+		names := make([]string, len(ci.Files))
+		for i, f := range ci.Files {
+			names[i] = f.Name
+		}
+		return names, nil
+	}
+	tree, err := ci.Commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	var parentTree *object.Tree
+	if ci.Commit.NumParents() > 0 {
+		parent, err := ci.Commit.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+		if parentTree, err = parent.Tree(); err != nil {
+			return nil, err
+		}
+	}
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(changes))
+	for _, change := range changes {
+		name := change.To.Name
+		if name == "" {
+			name = change.From.Name
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/anton-dovnar/git-tree/structs"
+	"github.com/anton-dovnar/git-tree/view"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// mergedName matches the branch a merge message names: "Merge branch 'x'",
+// "Merge remote-tracking branch 'origin/x'" and "Merge pull request #1 from
+// owner/x".
+var mergedName = regexp.MustCompile(`^Merge (?:(?:remote-tracking )?branch '([^']+)'|pull request (#[0-9]+) from (\S+))`)
+
+// mergeLatencies measures, for each merge, how long the branch it merged
+// took from its first commit to the merge: from the earliest author date of
+// the commits the merge brought in to its own committer date. Each merge is
+// badged with the time taken.
+func mergeLatencies(commits map[plumbing.Hash]*structs.CommitInfo) []view.MergeLatency {
+	var merges []plumbing.Hash
+	for h, ci := range commits {
+		if ci.Commit.NumParents() > 1 {
+			merges = append(merges, h)
+		}
+	}
+	sort.Slice(merges, func(i, j int) bool { return merges[i].String() < merges[j].String() })
+
+	var latencies []view.MergeLatency
+	for _, h := range merges {
+		merge := commits[h].Commit
+		merged := mergedCommits(commits, merge.ParentHashes)
+		if len(merged) == 0 {
+			continue
+		}
+		first := merged[0]
+		for _, c := range merged[1:] {
+			if commits[c].Commit.Author.When.Before(commits[first].Commit.Author.When) {
+				first = c
+			}
+		}
+		latency := max(merge.Committer.When.Sub(commits[first].Commit.Author.When), 0)
+		branch := merge.ParentHashes[1].String()[:7]
+		if m := mergedName.FindStringSubmatch(merge.Message); m != nil {
+			branch = m[1]
+			if m[2] != "" {
+				branch = m[3] + " (" + m[2] + ")"
+			}
+		}
+		latencies = append(latencies, view.MergeLatency{Merge: h.String(), Branch: branch, Commits: len(merged), Latency: latency})
+		commits[h].Badges = append(commits[h].Badges, structs.Badge{
+			Text: "⏱ " + view.FormatLatency(latency),
+			Detail: fmt.Sprintf("%s took %s from its first commit, %s, to this merge, over %d commits",
+				branch, view.FormatLatency(latency), commits[first].Commit.Author.When.Format(time.DateTime), len(merged)),
+		})
+	}
+	return latencies
+}
+
+// mergedCommits lists the commits a merge with parents brought in: those
+// reachable from its later parents but not from its first, like
+// `git rev-list parents[1:] --not parents[0]`. It walks newest first and
+// stops once only commits the first parent reaches are left to walk, so
+// only as far back as the branch forked.
+func mergedCommits(commits map[plumbing.Hash]*structs.CommitInfo, parents []plumbing.Hash) []plumbing.Hash {
+	const mainline, branch = 1, 2
+	paint := make(map[plumbing.Hash]int)
+	queue := &commitHeap{commits: commits, newest: true}
+	for i, p := range parents {
+		if _, ok := commits[p]; !ok {
+			continue
+		}
+		side := branch
+		if i == 0 {
+			side = mainline
+		}
+		if paint[p] == 0 {
+			heap.Push(queue, p)
+		}
+		paint[p] |= side
+	}
+
+	pending := 0 // Queued commits only the branch reaches so far
+	for _, h := range queue.hashes {
+		if paint[h] == branch {
+			pending++
+		}
+	}
+	var merged []plumbing.Hash
+	for pending > 0 {
+		h := heap.Pop(queue).(plumbing.Hash)
+		side := paint[h]
+		if side == branch {
+			pending--
+			merged = append(merged, h)
+		}
+		for _, p := range commits[h].Commit.ParentHashes {
+			if _, ok := commits[p]; !ok || paint[p]|side == paint[p] {
+				continue
+			}
+			switch {
+			case paint[p] == 0:
+				heap.Push(queue, p)
+				if side == branch {
+					pending++
+				}
+			case paint[p] == branch:
+				pending-- // Reached by the first parent after all
+			}
+			paint[p] |= side
+		}
+	}
+	return merged
+}
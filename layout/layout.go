@@ -0,0 +1,335 @@
+// Package layout places the commits of a graph on a grid of lanes and
+// rows. It works on plain data, with commits named by strings, so the
+// arrangement can be tested without a repository.
+package layout
+
+import (
+	"container/heap"
+	"slices"
+	"sort"
+	"time"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// Commit is what the layout needs to know of a commit.
+type Commit struct {
+	ID       string
+	Parents  []string  // May name commits outside the graph
+	Children []string  // May name commits outside the graph
+	Time     time.Time // Committer date
+	Refs     []string  // Refs the commit is reachable from
+	Tips     []string  // Refs pointing at the commit
+}
+
+// Arrange places the commits oldest first, one row each, and returns the
+// lane and row of every commit. Row 0 holds the oldest commit and every
+// commit is placed above its parents. emit, when not nil, is called as
+// soon as a commit's position is final.
+func Arrange(commits []Commit, emit func(id string, pos [2]int)) map[string][2]int {
+	if emit == nil {
+		emit = func(string, [2]int) {}
+	}
+
+	byID := make(map[string]*Commit, len(commits))
+	refSets := make(map[string]mapset.Set[string], len(commits))
+	for i := range commits {
+		c := &commits[i]
+		byID[c.ID] = c
+		refSets[c.ID] = mapset.NewSet(c.Refs...)
+	}
+
+	sortedCommits := Chronological(commits)
+	if len(sortedCommits) == 0 {
+		return nil
+	}
+
+	first := sortedCommits[0]
+	refsLevels := make(map[string]int)
+	for ref := range refSets[first.ID].Iter() {
+		refsLevels[ref] = 0
+	}
+
+	locations := make(map[string][2]int, len(sortedCommits))
+	locations[first.ID] = [2]int{0, 0}
+	emit(first.ID, locations[first.ID])
+
+	for i := 0; i < len(sortedCommits)-1; i++ {
+		c := sortedCommits[i+1]
+		refs := refSets[c.ID]
+
+		x := -1
+
+		activeRefs := mapset.NewSet[string]()
+		for r := range refsLevels {
+			activeRefs.Add(r)
+		}
+
+		if refs.Cardinality() == 0 {
+			type pxPair struct {
+				parent string
+				x      int
+			}
+			parentPositions := make([]pxPair, 0, len(c.Parents))
+			for _, p := range c.Parents {
+				if pos, ok := locations[p]; ok {
+					parentPositions = append(parentPositions, pxPair{parent: p, x: pos[0]})
+				}
+			}
+			sort.Slice(parentPositions, func(a, b int) bool { return parentPositions[a].x < parentPositions[b].x })
+
+			if len(parentPositions) > 0 {
+				p := parentPositions[0].parent
+				x = parentPositions[0].x
+
+				futureChildren := mapset.NewSet[string]()
+				if pc, ok := byID[p]; ok && len(pc.Children) > 0 {
+					remaining := mapset.NewSet[string]()
+					for k := i + 2; k < len(sortedCommits); k++ {
+						remaining.Add(sortedCommits[k].ID)
+					}
+					for _, child := range pc.Children {
+						if remaining.Contains(child) {
+							futureChildren.Add(child)
+						}
+					}
+				}
+				if futureChildren.Cardinality() > 0 {
+					x = gap(refsLevels, false)
+				}
+			} else {
+				x = gap(refsLevels, false)
+			}
+
+		} else if refs.Intersect(activeRefs).Cardinality() == 0 {
+			x = gap(refsLevels, true)
+
+		} else {
+			px := make(map[string]int)
+			currentRefs := refs.Intersect(activeRefs) // current tracked refs on this commit
+			levelRefs := make(map[int]mapset.Set[string])
+			for r, lvl := range refsLevels {
+				rs := levelRefs[lvl]
+				if rs == nil {
+					rs = mapset.NewSet[string]()
+					levelRefs[lvl] = rs
+				}
+				rs.Add(r)
+			}
+
+			for _, p := range c.Parents {
+				parent, ok := byID[p]
+				if !ok {
+					continue
+				}
+				parentTracked := refSets[parent.ID].Intersect(activeRefs)
+
+				xForParent := -1
+
+				if parentTracked.IsSubset(currentRefs) {
+					if pos, ok := locations[p]; ok {
+						xForParent = pos[0]
+					}
+				} else {
+					diverged := false
+					for _, lr := range levelRefs {
+						curAtLevel := lr.Intersect(currentRefs)
+						if curAtLevel.IsSubset(parentTracked) && !parentTracked.IsSubset(curAtLevel) {
+							diverged = true
+							break
+						}
+					}
+
+					if diverged {
+						minX := -1
+						for r := range currentRefs.Iter() {
+							if lvl, ok := refsLevels[r]; ok {
+								if minX == -1 || lvl < minX {
+									minX = lvl
+								}
+							}
+						}
+						if minX == -1 {
+							minX = gap(refsLevels, true)
+						}
+						xForParent = minX
+
+						if pos, ok := locations[p]; ok {
+							if xForParent == pos[0] && len(parent.Children) != 1 {
+								xForParent = gap(refsLevels, true)
+							}
+						}
+					} else if parentTracked.Cardinality() == 0 {
+						if pos, ok := locations[p]; ok {
+							xForParent = pos[0]
+						}
+					} else {
+						reuseTracked := false
+						for _, lr := range levelRefs {
+							curAtLevel := lr.Intersect(currentRefs)
+							if curAtLevel.IsSubset(currentRefs) && currentRefs.IsSubset(curAtLevel) {
+								reuseTracked = true
+								break
+							}
+						}
+						if reuseTracked {
+							for _, r := range sortedSet(currentRefs) {
+								if lvl, ok := refsLevels[r]; ok {
+									xForParent = lvl
+									break
+								}
+							}
+						} else {
+							xForParent = gap(refsLevels, true)
+						}
+					}
+				}
+
+				if xForParent < 0 {
+					xForParent = gap(refsLevels, true)
+				}
+
+				px[p] = xForParent
+			}
+
+			lowest := -1
+			for _, v := range px {
+				if v >= 0 && (lowest == -1 || v < lowest) {
+					lowest = v
+				}
+			}
+			if lowest != -1 {
+				x = lowest
+			} else {
+				x = gap(refsLevels, true)
+			}
+		}
+
+		if x < 0 {
+			x = 0
+		}
+
+		locations[c.ID] = [2]int{x, len(locations)}
+		emit(c.ID, locations[c.ID])
+
+		for r := range refs.Iter() {
+			refsLevels[r] = x
+		}
+		// A branch ends at its tip, freeing its lane.
+		for _, r := range c.Tips {
+			delete(refsLevels, r)
+		}
+	}
+
+	return locations
+}
+
+// Chronological orders the commits oldest first, by date and then ID, never
+// placing a commit before one of its parents. Parents outside the graph, as
+// shallow and filtered histories have, are ignored.
+func Chronological(commits []Commit) []*Commit {
+	byID := make(map[string]*Commit, len(commits))
+	for i := range commits {
+		byID[commits[i].ID] = &commits[i]
+	}
+	pending := make(map[string]int, len(commits))
+	ready := &commitHeap{}
+	for i := range commits {
+		c := &commits[i]
+		for k, p := range c.Parents {
+			if _, ok := byID[p]; ok && !slices.Contains(c.Parents[:k], p) {
+				pending[c.ID]++
+			}
+		}
+		if pending[c.ID] == 0 {
+			ready.commits = append(ready.commits, c)
+		}
+	}
+	heap.Init(ready)
+
+	result := make([]*Commit, 0, len(commits))
+	for ready.Len() > 0 {
+		c := heap.Pop(ready).(*Commit)
+		result = append(result, c)
+		for _, id := range c.Children {
+			child, ok := byID[id]
+			if !ok {
+				continue
+			}
+			if pending[id]--; pending[id] == 0 {
+				heap.Push(ready, child)
+			}
+		}
+	}
+	// Parents and Children that do not match up leave commits waiting;
+	// they come last, in date order, so every commit is placed.
+	if len(result) < len(commits) {
+		left := &commitHeap{}
+		for i := range commits {
+			if pending[commits[i].ID] > 0 {
+				left.commits = append(left.commits, &commits[i])
+			}
+		}
+		sort.Sort(left)
+		result = append(result, left.commits...)
+	}
+	return result
+}
+
+// commitHeap pops the oldest commit first, by date and then ID.
+type commitHeap struct{ commits []*Commit }
+
+func (h *commitHeap) Len() int { return len(h.commits) }
+
+func (h *commitHeap) Less(i, j int) bool {
+	ti, tj := h.commits[i].Time, h.commits[j].Time
+	if ti.Equal(tj) {
+		return h.commits[i].ID < h.commits[j].ID
+	}
+	return ti.Before(tj)
+}
+
+func (h *commitHeap) Swap(i, j int) { h.commits[i], h.commits[j] = h.commits[j], h.commits[i] }
+
+func (h *commitHeap) Push(x any) { h.commits = append(h.commits, x.(*Commit)) }
+
+func (h *commitHeap) Pop() any {
+	c := h.commits[len(h.commits)-1]
+	h.commits = h.commits[:len(h.commits)-1]
+	return c
+}
+
+// gap returns the lowest free lane between the lanes refs hold, or the one
+// after them. With no lanes held, a commit on no ref goes to lane 1, out
+// of the way of branches starting at lane 0.
+func gap(refsLevels map[string]int, refs bool) int {
+	if len(refsLevels) == 0 {
+		if refs {
+			return 0
+		}
+		return 1
+	}
+	levelsSet := mapset.NewSet[int]()
+	for _, l := range refsLevels {
+		levelsSet.Add(l)
+	}
+	levels := make([]int, 0, levelsSet.Cardinality())
+	for l := range levelsSet.Iter() {
+		levels = append(levels, l)
+	}
+	sort.Ints(levels)
+	for i := 0; i < len(levels)-1; i++ {
+		if levels[i+1]-levels[i] > 1 {
+			return levels[i] + 1
+		}
+	}
+	return levels[len(levels)-1] + 1
+}
+
+// sortedSet lists the members of set in order, for the places where the
+// layout must not depend on iteration order.
+func sortedSet(set mapset.Set[string]) []string {
+	out := set.ToSlice()
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,159 @@
+package layout
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"slices"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+// dag is a random commit graph: each commit has up to three parents among
+// the commits before it, a date that may run ahead of or behind its
+// parents' as skewed clocks make them, and the refs of a few random tips.
+type dag []Commit
+
+func (dag) Generate(r *rand.Rand, size int) reflect.Value {
+	n := 1 + r.Intn(size+1)
+	commits := make([]Commit, n)
+	base := time.Unix(1700000000, 0)
+	for i := range commits {
+		c := &commits[i]
+		c.ID = fmt.Sprintf("%040x", r.Uint64())
+		// Few distinct seconds, so many commits tie on their date.
+		c.Time = base.Add(time.Duration(i/3+r.Intn(3)-1) * time.Second)
+		if i > 0 {
+			for k := r.Intn(4); k > 0 || len(c.Parents) == 0 && r.Intn(8) > 0; k-- {
+				if p := commits[r.Intn(i)].ID; !slices.Contains(c.Parents, p) {
+					c.Parents = append(c.Parents, p)
+				}
+			}
+		}
+	}
+	index := make(map[string]int, n)
+	for i, c := range commits {
+		index[c.ID] = i
+	}
+	for i := range commits {
+		for _, p := range commits[i].Parents {
+			parent := &commits[index[p]]
+			parent.Children = append(parent.Children, commits[i].ID)
+		}
+	}
+
+	for t := r.Intn(5); t >= 0; t-- {
+		tip := r.Intn(n)
+		ref := fmt.Sprintf("refs/heads/b%d", t)
+		commits[tip].Tips = append(commits[tip].Tips, ref)
+		seen := make(map[int]bool)
+		for pending := []int{tip}; len(pending) > 0; {
+			i := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+			if seen[i] {
+				continue
+			}
+			seen[i] = true
+			commits[i].Refs = append(commits[i].Refs, ref)
+			for _, p := range commits[i].Parents {
+				pending = append(pending, index[p])
+			}
+		}
+	}
+	r.Shuffle(n, func(i, j int) { commits[i], commits[j] = commits[j], commits[i] })
+	return reflect.ValueOf(dag(commits))
+}
+
+func check(t *testing.T, property func(dag) bool) {
+	t.Helper()
+	if err := quick.Check(property, &quick.Config{MaxCount: 500}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEveryCommitGetsItsOwnRow(t *testing.T) {
+	check(t, func(g dag) bool {
+		positions := Arrange(g, nil)
+		if len(positions) != len(g) {
+			return false
+		}
+		rows := make([]bool, len(g))
+		for _, c := range g {
+			pos, ok := positions[c.ID]
+			if !ok || pos[1] < 0 || pos[1] >= len(g) || rows[pos[1]] {
+				return false
+			}
+			rows[pos[1]] = true
+		}
+		return true
+	})
+}
+
+func TestNoTwoCommitsShareACell(t *testing.T) {
+	check(t, func(g dag) bool {
+		cells := make(map[[2]int]bool)
+		for _, pos := range Arrange(g, nil) {
+			if pos[0] < 0 || cells[pos] {
+				return false
+			}
+			cells[pos] = true
+		}
+		return true
+	})
+}
+
+func TestChildrenAboveParents(t *testing.T) {
+	check(t, func(g dag) bool {
+		positions := Arrange(g, nil)
+		for _, c := range g {
+			for _, p := range c.Parents {
+				if positions[c.ID][1] <= positions[p][1] {
+					return false
+				}
+			}
+		}
+		return true
+	})
+}
+
+func TestEmitMatchesResult(t *testing.T) {
+	check(t, func(g dag) bool {
+		emitted := make(map[string][2]int)
+		row := 0
+		inOrder := true
+		positions := Arrange(g, func(id string, pos [2]int) {
+			inOrder = inOrder && pos[1] == row
+			row++
+			emitted[id] = pos
+		})
+		return inOrder && reflect.DeepEqual(emitted, positions)
+	})
+}
+
+func TestDeterministic(t *testing.T) {
+	check(t, func(g dag) bool {
+		want := Arrange(g, nil)
+		shuffled := append(dag(nil), g...)
+		rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+		return reflect.DeepEqual(Arrange(shuffled, nil), want)
+	})
+}
+
+// TestParentsOutsideTheGraph checks a commit whose parent was left out, as
+// at a shallow boundary, takes its place by date rather than coming last.
+func TestParentsOutsideTheGraph(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	commits := []Commit{
+		{ID: "a", Time: base, Children: []string{"c"}},
+		{ID: "b", Time: base.Add(time.Second), Parents: []string{"outside"}},
+		{ID: "c", Time: base.Add(2 * time.Second), Parents: []string{"a"}},
+	}
+	var got []string
+	for _, c := range Chronological(commits) {
+		got = append(got, c.ID)
+	}
+	if want := []string{"a", "b", "c"}; !slices.Equal(got, want) {
+		t.Errorf("Chronological = %q, want %q", got, want)
+	}
+}
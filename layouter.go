@@ -0,0 +1,603 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/anton-dovnar/git-tree/layout"
+	"github.com/anton-dovnar/git-tree/structs"
+	"github.com/anton-dovnar/git-tree/view"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// Graph is what a Layouter arranges.
+type Graph struct {
+	Commits  map[plumbing.Hash]*structs.CommitInfo
+	Children map[plumbing.Hash]mapset.Set[plumbing.Hash]
+	Heads    map[plumbing.Hash][]*plumbing.Reference
+}
+
+// Positions maps every commit to its lane and row. Row 0 holds the oldest
+// commit and every commit is placed below all of its children.
+type Positions = map[plumbing.Hash][2]int
+
+// Layouter is a strategy for placing commits, selected with -layout.
+type Layouter interface {
+	Arrange(ctx context.Context, g Graph) (Positions, error)
+}
+
+// rowLayouter is implemented by layouters that can hand out each row as
+// soon as it is placed, so drawing can run alongside the arrangement.
+type rowLayouter interface {
+	ArrangeRows(ctx context.Context, g Graph, emit func(plumbing.Hash, [2]int)) (Positions, error)
+}
+
+var layouters = map[string]Layouter{
+	"heuristic": heuristicLayout{},
+	"lanes":     laneLayout{},
+}
+
+// layouter is the Layouter chosen with -layout.
+var layouter Layouter = heuristicLayout{}
+
+// setLayout parses the -layout flag value.
+func setLayout(name string) error {
+	l, ok := layouters[name]
+	if !ok {
+		names := make([]string, 0, len(layouters))
+		for n := range layouters {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown layout %q (want %s)", name, strings.Join(names, " or "))
+	}
+	layouter = l
+	return nil
+}
+
+// heuristicLayout is the default arrangement, which keeps each reference in
+// the lane it started in for as long as it stays alive.
+type heuristicLayout struct{}
+
+func (heuristicLayout) Arrange(ctx context.Context, g Graph) (Positions, error) {
+	return heuristicLayout{}.ArrangeRows(ctx, g, nil)
+}
+
+func (heuristicLayout) ArrangeRows(ctx context.Context, g Graph, emit func(plumbing.Hash, [2]int)) (Positions, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return arrangeRows(g.Commits, g.Heads, g.Children, emit), ctx.Err()
+}
+
+// laneLayout gives every branch a lane of its own, holding the commits on
+// its first-parent history that no earlier branch claimed. The default
+// branch comes first, then the others by name. Commits left over, like
+// merged side branches, share the remaining lanes wherever their rows do
+// not overlap.
+type laneLayout struct{}
+
+func (laneLayout) Arrange(ctx context.Context, g Graph) (Positions, error) {
+	order := chronological(g.Commits, g.Children)
+	row := make(map[plumbing.Hash]int, len(order))
+	for i, h := range order {
+		row[h] = i
+	}
+
+	var branches []*plumbing.Reference
+	for h, refs := range g.Heads {
+		if _, ok := g.Commits[h]; ok {
+			branches = append(branches, refs...)
+		}
+	}
+	sort.Slice(branches, func(i, j int) bool {
+		di, dj := isDefaultBranch(branches[i].Name()), isDefaultBranch(branches[j].Name())
+		if di != dj {
+			return di
+		}
+		return branches[i].Name() < branches[j].Name()
+	})
+
+	// chain lists the first-parent history of tip down to the first commit
+	// another lane already claimed.
+	lane := make(map[plumbing.Hash]int, len(order))
+	chain := func(tip plumbing.Hash) []plumbing.Hash {
+		var out []plumbing.Hash
+		for h := tip; ; {
+			ci, ok := g.Commits[h]
+			if !ok {
+				return out
+			}
+			if _, taken := lane[h]; taken {
+				return out
+			}
+			out = append(out, h)
+			if ci.Commit.NumParents() == 0 {
+				return out
+			}
+			h = ci.Commit.ParentHashes[0]
+		}
+	}
+
+	lanes := 0
+	for _, branch := range branches {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		commits := chain(branch.Hash())
+		if len(commits) == 0 {
+			continue
+		}
+		for _, h := range commits {
+			lane[h] = lanes
+		}
+		lanes++
+	}
+
+	// Leftover chains, newest first, take the first spare lane that is free
+	// from the row they fork off at up to their tip.
+	occupied := make(map[int][][2]int)
+	for i := len(order) - 1; i >= 0; i-- {
+		commits := chain(order[i])
+		if len(commits) == 0 {
+			continue
+		}
+		last := commits[len(commits)-1]
+		span := [2]int{row[last], row[commits[0]]}
+		if parents := g.Commits[last].Commit.ParentHashes; len(parents) > 0 {
+			if r, ok := row[parents[0]]; ok {
+				span[0] = r
+			}
+		}
+		l := lanes
+		for overlaps(occupied[l], span) {
+			l++
+		}
+		occupied[l] = append(occupied[l], span)
+		for _, h := range commits {
+			lane[h] = l
+		}
+	}
+
+	positions := make(Positions, len(order))
+	for _, h := range order {
+		positions[h] = [2]int{lane[h], row[h]}
+	}
+	return positions, ctx.Err()
+}
+
+// compactRows wraps a Layouter and moves commits made in the same second
+// onto a shared row, as long as they sit in different lanes and none of
+// their rails, which run between a commit's lane and its parents' and
+// children's lanes, share a lane. Scripted commits and rebases otherwise
+// make graphs needlessly tall.
+type compactRows struct {
+	Layouter
+}
+
+func (c compactRows) Arrange(ctx context.Context, g Graph) (Positions, error) {
+	positions, err := c.Layouter.Arrange(ctx, g)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]plumbing.Hash, 0, len(positions))
+	for h := range positions {
+		hashes = append(hashes, h)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		pi, pj := positions[hashes[i]], positions[hashes[j]]
+		if pi[1] != pj[1] {
+			return pi[1] < pj[1]
+		}
+		return hashes[i].String() < hashes[j].String()
+	})
+
+	// spans lists the lane ranges a commit's rails cover, its own lane
+	// included.
+	spans := func(h plumbing.Hash) [][2]int {
+		x := positions[h][0]
+		out := [][2]int{{x, x}}
+		add := func(other plumbing.Hash) {
+			if pos, ok := positions[other]; ok {
+				out = append(out, [2]int{min(x, pos[0]), max(x, pos[0])})
+			}
+		}
+		for _, p := range g.Commits[h].Commit.ParentHashes {
+			add(p)
+		}
+		if cs, ok := g.Children[h]; ok {
+			for child := range cs.Iter() {
+				add(child)
+			}
+		}
+		return out
+	}
+	disjoint := func(a, b [][2]int) bool {
+		for _, sa := range a {
+			for _, sb := range b {
+				if sa[0] <= sb[1] && sb[0] <= sa[1] {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	compacted := make(Positions, len(positions))
+	row := -1
+	var group [][2]int
+	var groupTime int64
+	for _, h := range hashes {
+		ci := g.Commits[h]
+		when := ci.Commit.Committer.When.Unix()
+		own := spans(h)
+		if row >= 0 && when == groupTime && disjoint(group, own) {
+			group = append(group, own...)
+		} else {
+			row++
+			group, groupTime = own, when
+		}
+		compacted[h] = [2]int{positions[h][0], row}
+	}
+	return compacted, nil
+}
+
+// pinnedLanes wraps a Layouter and reorders whole lanes so that each pinned
+// ref's tip lands in the lane it is pinned to, keeping the trunk in the same
+// place from one render to the next. The remaining lanes fill the free
+// slots in their original order. A pin past the last lane pins to the last
+// lane. A pin is ignored when its lane is taken by an earlier pin or its tip
+// shares a lane with an already pinned ref.
+type pinnedLanes struct {
+	Layouter
+	pins map[string]int
+}
+
+func (p pinnedLanes) Arrange(ctx context.Context, g Graph) (Positions, error) {
+	positions, err := p.Layouter.Arrange(ctx, g)
+	if err != nil {
+		return nil, err
+	}
+
+	type pin struct {
+		tip  plumbing.Hash
+		name string
+		lane int
+	}
+	var pins []pin
+	for h, refs := range g.Heads {
+		if _, ok := positions[h]; !ok {
+			continue
+		}
+		for _, ref := range refs {
+			lane, ok := p.pins[ref.Name().String()]
+			if !ok {
+				lane, ok = p.pins[ref.Name().Short()]
+			}
+			if ok {
+				pins = append(pins, pin{h, ref.Name().String(), lane})
+			}
+		}
+	}
+	sort.Slice(pins, func(i, j int) bool {
+		if pins[i].lane != pins[j].lane {
+			return pins[i].lane < pins[j].lane
+		}
+		return pins[i].name < pins[j].name
+	})
+
+	maxLane := 0
+	for _, pos := range positions {
+		maxLane = max(maxLane, pos[0])
+	}
+	moved := make(map[int]int, maxLane+1)
+	taken := make(map[int]bool, maxLane+1)
+	for _, pin := range pins {
+		// A pin past the lanes there are would leave empty ones before it.
+		lane := min(pin.lane, maxLane)
+		if lane != pin.lane {
+			log.Printf("Lane pin of %s to lane %d moved to lane %d, the last of the graph", pin.name, pin.lane, lane)
+		}
+		from := positions[pin.tip][0]
+		if _, ok := moved[from]; ok || taken[lane] {
+			log.Printf("Lane pin of %s to lane %d ignored, the lane is already pinned", pin.name, lane)
+			continue
+		}
+		moved[from] = lane
+		taken[lane] = true
+	}
+	free := 0
+	for lane := 0; lane <= maxLane; lane++ {
+		if _, ok := moved[lane]; ok {
+			continue
+		}
+		for taken[free] {
+			free++
+		}
+		moved[lane] = free
+		taken[free] = true
+	}
+
+	pinned := make(Positions, len(positions))
+	for h, pos := range positions {
+		pinned[h] = [2]int{moved[pos[0]], pos[1]}
+	}
+	return pinned, nil
+}
+
+// bandLanes is set by -lane-bands.
+var bandLanes bool
+
+// Lane bands, left to right.
+const (
+	bandTrunk = iota
+	bandRelease
+	bandOther
+	bandPersonal
+)
+
+var bandNames = [...]string{"trunk", "release branches", "branches", "personal branches"}
+
+var bandFills = [...]string{"#e6f0fa", "#fbf1dc", "", "#efe9f5"}
+
+// refBand sorts a branch, local or remote, into its lane band.
+func refBand(name plumbing.ReferenceName) int {
+	branch := name.Short()
+	if name.IsRemote() {
+		_, branch, _ = strings.Cut(branch, "/")
+	}
+	switch {
+	case branch == "main" || branch == "master" || branch == "trunk" || branch == "develop":
+		return bandTrunk
+	case strings.HasPrefix(branch, "release/") || strings.HasPrefix(branch, "releases/") ||
+		strings.HasPrefix(branch, "release-") || strings.HasPrefix(branch, "hotfix/"):
+		return bandRelease
+	case strings.HasPrefix(branch, "users/") || strings.HasPrefix(branch, "user/"):
+		return bandPersonal
+	}
+	return bandOther
+}
+
+// laneBands maps each lane holding ref tips to the band of those refs, the
+// leftmost band if they differ. Lanes holding no tip are left out.
+func laneBands(positions Positions, heads map[plumbing.Hash][]*plumbing.Reference) map[int]int {
+	bands := make(map[int]int)
+	for h, refs := range heads {
+		pos, ok := positions[h]
+		if !ok {
+			continue
+		}
+		for _, ref := range refs {
+			band := refBand(ref.Name())
+			if b, ok := bands[pos[0]]; !ok || band < b {
+				bands[pos[0]] = band
+			}
+		}
+	}
+	return bands
+}
+
+// Orders of the lanes within a band, set by -lane-order.
+const (
+	laneOrderDiscovery = "discovery" // As the layout found them
+	laneOrderRecency   = "recency"   // Newest commit first
+	laneOrderCommits   = "commits"   // Most commits first
+)
+
+// laneOrder is set by -lane-order.
+var laneOrder = laneOrderDiscovery
+
+// setLaneOrder parses the -lane-order flag value.
+func setLaneOrder(order string) error {
+	switch order {
+	case laneOrderDiscovery, laneOrderRecency, laneOrderCommits:
+		laneOrder = order
+		return nil
+	}
+	return fmt.Errorf("unknown lane order %q (want discovery, recency or commits)", order)
+}
+
+// bandedLanes wraps a Layouter and moves whole lanes so the trunk comes
+// first, then release branches, then other branches and personal branches
+// under users/ last. Within a band, lanes are ordered by the laneOrder in
+// by, keeping their original order on ties.
+type bandedLanes struct {
+	Layouter
+	by string
+}
+
+func (b bandedLanes) Arrange(ctx context.Context, g Graph) (Positions, error) {
+	positions, err := b.Layouter.Arrange(ctx, g)
+	if err != nil {
+		return nil, err
+	}
+	bands := laneBands(positions, g.Heads)
+	band := func(lane int) int {
+		if b, ok := bands[lane]; ok {
+			return b
+		}
+		return bandOther
+	}
+
+	maxLane := 0
+	for _, pos := range positions {
+		maxLane = max(maxLane, pos[0])
+	}
+	lanes := make([]int, maxLane+1)
+	for i := range lanes {
+		lanes[i] = i
+	}
+	newest := make([]int64, len(lanes))
+	counts := make([]int, len(lanes))
+	for h, pos := range positions {
+		counts[pos[0]]++
+		if ci, ok := g.Commits[h]; ok && ci != nil && ci.Commit != nil {
+			newest[pos[0]] = max(newest[pos[0]], ci.Commit.Committer.When.Unix())
+		}
+	}
+	sort.SliceStable(lanes, func(i, j int) bool {
+		x, y := lanes[i], lanes[j]
+		if band(x) != band(y) {
+			return band(x) < band(y)
+		}
+		switch b.by {
+		case laneOrderRecency:
+			return newest[x] > newest[y]
+		case laneOrderCommits:
+			return counts[x] > counts[y]
+		}
+		return false
+	})
+	moved := make(map[int]int, len(lanes))
+	for to, from := range lanes {
+		moved[from] = to
+	}
+
+	banded := make(Positions, len(positions))
+	for h, pos := range positions {
+		banded[h] = [2]int{moved[pos[0]], pos[1]}
+	}
+	return banded, nil
+}
+
+// stripes lists the background stripes for the bands lanes ended up in,
+// one per run of neighbouring lanes in the same band.
+func stripes(positions Positions, heads map[plumbing.Hash][]*plumbing.Reference) []view.LaneBand {
+	bands := laneBands(positions, heads)
+	maxLane := 0
+	for _, pos := range positions {
+		maxLane = max(maxLane, pos[0])
+	}
+	var out []view.LaneBand
+	for lane := 0; lane <= maxLane; lane++ {
+		band, ok := bands[lane]
+		if !ok {
+			band = bandOther
+		}
+		if n := len(out); n > 0 && out[n-1].Name == bandNames[band] && out[n-1].To == lane-1 {
+			out[n-1].To = lane
+			continue
+		}
+		out = append(out, view.LaneBand{Name: bandNames[band], From: lane, To: lane, Fill: bandFills[band]})
+	}
+	return slices.DeleteFunc(out, func(b view.LaneBand) bool { return b.Fill == "" })
+}
+
+// maxLanes is set by -max-lanes.
+var maxLanes int
+
+// foldedLanes wraps a Layouter and draws every lane past the first max in
+// one lane after them, so hundreds of concurrent branches keep the graph
+// max+1 lanes wide. Every commit keeps its own row, so no two share a cell.
+type foldedLanes struct {
+	Layouter
+	max int
+}
+
+func (f foldedLanes) Arrange(ctx context.Context, g Graph) (Positions, error) {
+	positions, err := f.Layouter.Arrange(ctx, g)
+	if err != nil {
+		return nil, err
+	}
+	folded := make(Positions, len(positions))
+	for h, pos := range positions {
+		folded[h] = [2]int{min(pos[0], f.max), pos[1]}
+	}
+	return folded, nil
+}
+
+// foldedTips lists the branches whose tips are in the lane foldedLanes
+// folds into, or returns nil when nothing is drawn in it.
+func foldedTips(positions Positions, heads map[plumbing.Hash][]*plumbing.Reference, lane int) *view.FoldedLanes {
+	var tips []view.FoldedTip
+	for h, refs := range heads {
+		if pos, ok := positions[h]; !ok || pos[0] != lane {
+			continue
+		}
+		for _, ref := range refs {
+			tips = append(tips, view.FoldedTip{Name: ref.Name().Short(), Hash: h.String()})
+		}
+	}
+	if len(tips) == 0 {
+		return nil
+	}
+	sort.Slice(tips, func(i, j int) bool { return tips[i].Name < tips[j].Name })
+	return &view.FoldedLanes{Lane: lane, Tips: tips}
+}
+
+// lanePins reads the lane pins configured for repo.
+func lanePins(repo *git.Repository) map[string]int {
+	cfg, err := repo.Config()
+	if err != nil {
+		return nil
+	}
+	pins, err := structs.LanePins(cfg)
+	if err != nil {
+		log.Printf("Could not read all lane pins: %v", err)
+	}
+	return pins
+}
+
+func overlaps(spans [][2]int, span [2]int) bool {
+	for _, s := range spans {
+		if s[0] < span[1] && span[0] < s[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func isDefaultBranch(name plumbing.ReferenceName) bool {
+	return name == plumbing.Main || name == plumbing.Master
+}
+
+// chronological orders commits oldest first, never placing a commit before
+// one of its parents, as layout.Chronological does.
+func chronological(
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	children map[plumbing.Hash]mapset.Set[plumbing.Hash],
+) []plumbing.Hash {
+	nodes, hashes := layoutCommits(commits, nil, children)
+	sorted := layout.Chronological(nodes)
+	order := make([]plumbing.Hash, len(sorted))
+	for i, c := range sorted {
+		order[i] = hashes[c.ID]
+	}
+	return order
+}
+
+// commitHeap pops the oldest commit first, by committer date and then hash,
+// or the newest first when newest is set.
+type commitHeap struct {
+	commits map[plumbing.Hash]*structs.CommitInfo
+	hashes  []plumbing.Hash
+	newest  bool
+}
+
+func (h *commitHeap) Len() int { return len(h.hashes) }
+
+func (h *commitHeap) Less(i, j int) bool {
+	ti, tj := h.commits[h.hashes[i]].Commit.Committer.When, h.commits[h.hashes[j]].Commit.Committer.When
+	if ti.Equal(tj) {
+		return h.hashes[i].String() < h.hashes[j].String() != h.newest
+	}
+	return ti.Before(tj) != h.newest
+}
+
+func (h *commitHeap) Swap(i, j int) { h.hashes[i], h.hashes[j] = h.hashes[j], h.hashes[i] }
+
+func (h *commitHeap) Push(x any) { h.hashes = append(h.hashes, x.(plumbing.Hash)) }
+
+func (h *commitHeap) Pop() any {
+	last := h.hashes[len(h.hashes)-1]
+	h.hashes = h.hashes[:len(h.hashes)-1]
+	return last
+}
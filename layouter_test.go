@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// fixedLayout places commits where it is told to.
+type fixedLayout Positions
+
+func (f fixedLayout) Arrange(context.Context, Graph) (Positions, error) { return Positions(f), nil }
+
+func TestPinPastLastLaneIsClamped(t *testing.T) {
+	a, b, c := plumbing.NewHash("aa"), plumbing.NewHash("bb"), plumbing.NewHash("cc")
+	g := Graph{Heads: map[plumbing.Hash][]*plumbing.Reference{
+		a: {plumbing.NewHashReference("refs/heads/main", a)},
+		b: {plumbing.NewHashReference("refs/heads/dev", b)},
+		c: {plumbing.NewHashReference("refs/heads/topic", c)},
+	}}
+	base := fixedLayout{a: {0, 2}, b: {1, 1}, c: {2, 0}}
+
+	positions, err := pinnedLanes{base, map[string]int{"main": 10}}.Arrange(context.Background(), g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := positions[a][0]; got != 2 {
+		t.Errorf("main pinned to lane 10 of 3 is in lane %d, want 2", got)
+	}
+	lanes := map[int]bool{}
+	for _, pos := range positions {
+		lanes[pos[0]] = true
+	}
+	for lane := range 3 {
+		if !lanes[lane] {
+			t.Errorf("lane %d is left empty: %v", lane, positions)
+		}
+	}
+}
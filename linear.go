@@ -0,0 +1,30 @@
+package main
+
+import (
+	"github.com/anton-dovnar/git-tree/structs"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// firstParentMerges walks the first-parent history of tip through commits
+// and returns the merge commits on it, newest first. A linear branch has
+// none.
+func firstParentMerges(
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	tip plumbing.Hash,
+) []plumbing.Hash {
+	var merges []plumbing.Hash
+	for h := tip; ; {
+		ci, ok := commits[h]
+		if !ok {
+			return merges
+		}
+		if ci.Commit.NumParents() > 1 {
+			merges = append(merges, h)
+		}
+		if ci.Commit.NumParents() == 0 {
+			return merges
+		}
+		h = ci.Commit.ParentHashes[0]
+	}
+}
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
-	"sort"
 	"strings"
 	"path/filepath"
+	"regexp"
+	"slices"
 
+	"github.com/anton-dovnar/git-tree/filter"
+	"github.com/anton-dovnar/git-tree/layout"
 	"github.com/anton-dovnar/git-tree/structs"
 	"github.com/anton-dovnar/git-tree/view"
 
@@ -17,26 +24,31 @@ import (
 	mapset "github.com/deckarep/golang-set/v2"
 )
 
-func collectCommits(repoPath string, repo *git.Repository, all bool) (
+func walkCommits(repo *git.Repository, all bool) (
 	map[plumbing.Hash]*structs.CommitInfo,
 	map[plumbing.Hash]mapset.Set[plumbing.Hash],
+	error,
 ) {
 	commits := make(map[plumbing.Hash]*structs.CommitInfo)
 	children := make(map[plumbing.Hash]mapset.Set[plumbing.Hash])
 	toProcess := mapset.NewSet[plumbing.Hash]()
 
-	refIter, err := repo.References()
+	refIter, err := listRefs(repo)
 	if err != nil {
-		log.Printf("Error reading references: %v", err)
-		return nil, nil
+		return nil, nil, err
 	}
 	defer refIter.Close()
 
-	refIter.ForEach(func(ref *plumbing.Reference) error {
+	tips := make(map[plumbing.Hash][]plumbing.ReferenceName) // Branch tips, to tell which could not be read
+	err = refIter.ForEach(func(ref *plumbing.Reference) error {
 		name := ref.Name()
+		if !refAllowed(name) {
+			return nil
+		}
 		switch {
 		case name.IsBranch():
 			toProcess.Add(ref.Hash())
+			tips[ref.Hash()] = append(tips[ref.Hash()], name)
 		case name.IsTag():
 			obj, err := repo.TagObject(ref.Hash())
 			if err == nil {
@@ -46,11 +58,25 @@ func collectCommits(repoPath string, repo *git.Repository, all bool) (
 				}
 			}
 			toProcess.Add(ref.Hash()) // fallback for lightweight tag
-		case all && name.IsRemote():
-			toProcess.Add(ref.Hash())
+		case all && name.IsRemote(), pullRequests && view.IsPullRequest(name):
+			if ref.Type() == plumbing.HashReference {
+				toProcess.Add(ref.Hash())
+				tips[ref.Hash()] = append(tips[ref.Hash()], name)
+			}
 		}
 		return nil
 	})
+	if err != nil {
+		return nil, nil, refsError(err)
+	}
+
+	if !all {
+		// Upstreams of local branches are walked even without -all, so the
+		// commits still to be pulled appear next to their branch.
+		for _, remote := range trackedUpstreams(repo) {
+			toProcess.Add(remote.Hash())
+		}
+	}
 
 	for toProcess.Cardinality() > 0 {
 		current, ok := toProcess.Pop()
@@ -80,80 +106,97 @@ func collectCommits(repoPath string, repo *git.Repository, all bool) (
 		}
 	}
 
-	gitDir, err := structs.ResolveGitDir(repoPath)
-	if err != nil {
-		log.Printf("Could not resolve git dir for reflogs (%s): %v", repoPath, err)
-		return commits, children
+	for tip, names := range tips {
+		if _, ok := commits[tip]; ok {
+			continue
+		}
+		_, err := repo.CommitObject(tip)
+		if err == nil {
+			continue
+		}
+		for _, name := range names {
+			if tip.IsZero() {
+				warnings.add("%s is not drawn: it does not hold a commit hash", name)
+				continue
+			}
+			warnings.add("%s is not drawn: it points at %s, which cannot be read as a commit (%v)", name, tip, err)
+		}
+	}
+
+	if reflogLabels == reflogLabelsOff {
+		return commits, children, nil
 	}
+	gitDir := structs.GitDirFS(repo)
 
 	trackedRemotes := map[string]struct{}{}
 	if all {
-		if m, err := structs.TrackedRemoteRefs(gitDir); err == nil {
-			trackedRemotes = m
+		if cfg, err := repo.Config(); err == nil {
+			trackedRemotes = structs.TrackedRemoteRefs(cfg)
 		}
 	}
 
-	refIter2, err := repo.References()
+	refIter2, err := listRefs(repo)
 	if err != nil {
-		return commits, children
+		return commits, children, nil
 	}
 	defer refIter2.Close()
 
+	label := func(refName string) {
+		hashes, err := structs.ReadRecentReflogNewHashes(gitDir, refName, reflogMaxEntries)
+		if err != nil {
+			warnings.add("The reflog of %s only partly labels commits: %v", plumbing.ReferenceName(refName).Short(), err)
+		}
+		for _, h := range hashes {
+			if info, ok := commits[h]; ok {
+				info.References.Add(refName)
+			}
+		}
+	}
 	refIter2.ForEach(func(ref *plumbing.Reference) error {
 		refName := ref.Name().String()
+		if !refAllowed(ref.Name()) {
+			return nil
+		}
 
 		if ref.Name().IsBranch() {
-			hashes, err := structs.ReadReflogNewHashes(gitDir, refName)
-			if err != nil {
-				return nil
-			}
-			for _, h := range hashes {
-				if info, ok := commits[h]; ok {
-					info.References.Add(refName)
-				}
-			}
+			label(refName)
 			return nil
 		}
 
-		if all && ref.Name().IsRemote() {
+		if all && reflogLabels == reflogLabelsAll && ref.Name().IsRemote() {
 			if strings.HasSuffix(refName, "/HEAD") {
 				return nil
 			}
 			if _, ok := trackedRemotes[refName]; ok {
 				return nil
 			}
-
-			hashes, err := structs.ReadReflogNewHashes(gitDir, refName)
-			if err != nil {
-				return nil
-			}
-			for _, h := range hashes {
-				if info, ok := commits[h]; ok {
-					info.References.Add(refName)
-				}
-			}
+			label(refName)
 		}
 		return nil
 	})
 
-	return commits, children
+	return commits, children, nil
 }
 
 func getRefs(repo *git.Repository, all bool) (
 	map[plumbing.Hash][]*plumbing.Reference,
 	map[plumbing.Hash][]*plumbing.Reference,
+	error,
 ) {
 	heads := make(map[plumbing.Hash][]*plumbing.Reference)
 	tags := make(map[plumbing.Hash][]*plumbing.Reference)
 
-	refIter, err := repo.References()
+	refIter, err := listRefs(repo)
 	if err != nil {
-		return nil, nil
+		return nil, nil, err
 	}
 	defer refIter.Close()
 
-	refIter.ForEach(func(ref *plumbing.Reference) error {
+	err = refIter.ForEach(func(ref *plumbing.Reference) error {
 		name := ref.Name()
+		if !refAllowed(name) {
+			return nil
+		}
 		switch {
 		case name.IsBranch():
 			hash := ref.Hash()
@@ -169,14 +212,69 @@ func getRefs(repo *git.Repository, all bool) (
 			}
 			tags[ref.Hash()] = append(tags[ref.Hash()], ref)
 
-		case all && name.IsRemote():
+		case all && name.IsRemote(), pullRequests && view.IsPullRequest(name):
 			hash := ref.Hash()
 			heads[hash] = append(heads[hash], ref)
 		}
 		return nil
 	})
+	if err != nil {
+		return nil, nil, refsError(err)
+	}
+	return heads, tags, nil
+}
 
-	return heads, tags
+// buildChildren indexes the parent links of commits the other way around.
+func buildChildren(commits map[plumbing.Hash]*structs.CommitInfo) map[plumbing.Hash]mapset.Set[plumbing.Hash] {
+	children := make(map[plumbing.Hash]mapset.Set[plumbing.Hash])
+	for h, ci := range commits {
+		if ci == nil || ci.Commit == nil {
+			continue
+		}
+		for _, parent := range ci.Commit.ParentHashes {
+			if _, ok := children[parent]; !ok {
+				children[parent] = mapset.NewSet[plumbing.Hash]()
+			}
+			children[parent].Add(h)
+		}
+	}
+	return children
+}
+
+// addDiffstats fills in per-file line changes of every commit against its
+// first parent. Diffing every tree is expensive, so it only runs on request.
+// Commits whose trees or blobs are missing, as in partial clones, are
+// skipped with one note for them all.
+func addDiffstats(commits map[plumbing.Hash]*structs.CommitInfo) {
+	missing := 0
+	defer func() {
+		if missing > 0 {
+			log.Printf("Skipped the diffstat of %d commits: %v", missing, notFetched(plumbing.ErrObjectNotFound))
+		}
+	}()
+	for h, ci := range commits {
+		if ci == nil || ci.Commit == nil {
+			continue
+		}
+		stats, err := ci.Commit.Stats()
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			missing++
+			continue
+		}
+		if err != nil {
+			log.Printf("Could not compute diffstat of %s: %v", h, err)
+			continue
+		}
+		files := make([]structs.FileStat, 0, len(stats))
+		for _, fs := range stats {
+			files = append(files, structs.FileStat{
+				Name:      fs.Name,
+				Additions: fs.Addition,
+				Deletions: fs.Deletion,
+			})
+		}
+		ci.Files = files
+	}
 }
 
 func arrangeCommits(
@@ -184,429 +282,886 @@ func arrangeCommits(
 	heads map[plumbing.Hash][]*plumbing.Reference,
 	children map[plumbing.Hash]mapset.Set[plumbing.Hash],
 ) map[plumbing.Hash][2]int {
+	return arrangeRows(commits, heads, children, nil)
+}
 
-	type commitPair struct {
-		Hash plumbing.Hash
-		Ci   *structs.CommitInfo
+// arrangeRows places the commits oldest first, one row each, calling emit
+// (when not nil) as soon as a commit's position is final.
+func arrangeRows(
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	heads map[plumbing.Hash][]*plumbing.Reference,
+	children map[plumbing.Hash]mapset.Set[plumbing.Hash],
+	emit func(plumbing.Hash, [2]int),
+) map[plumbing.Hash][2]int {
+	nodes, hashes := layoutCommits(commits, heads, children)
+	var emitID func(string, [2]int)
+	if emit != nil {
+		emitID = func(id string, pos [2]int) { emit(hashes[id], pos) }
+	}
+	rows := layout.Arrange(nodes, emitID)
+	if rows == nil {
+		return nil
+	}
+	locations := make(map[plumbing.Hash][2]int, len(rows))
+	for id, pos := range rows {
+		locations[hashes[id]] = pos
 	}
+	return locations
+}
 
-	ctsort := func() []commitPair {
-		sortedCommits := make([]commitPair, 0, len(commits))
-		for h, ci := range commits {
-			if ci != nil && ci.Commit != nil {
-				sortedCommits = append(sortedCommits, commitPair{Hash: h, Ci: ci})
+// layoutCommits turns commits into what the layout package works on, and
+// maps its IDs back to the hashes.
+func layoutCommits(
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	heads map[plumbing.Hash][]*plumbing.Reference,
+	children map[plumbing.Hash]mapset.Set[plumbing.Hash],
+) ([]layout.Commit, map[string]plumbing.Hash) {
+	nodes := make([]layout.Commit, 0, len(commits))
+	hashes := make(map[string]plumbing.Hash, len(commits))
+	for h, ci := range commits {
+		if ci == nil || ci.Commit == nil {
+			continue
+		}
+		id := h.String()
+		hashes[id] = h
+		node := layout.Commit{ID: id, Time: ci.Commit.Committer.When}
+		for _, p := range ci.Commit.ParentHashes {
+			node.Parents = append(node.Parents, p.String())
+		}
+		if cs, ok := children[h]; ok {
+			for c := range cs.Iter() {
+				node.Children = append(node.Children, c.String())
 			}
 		}
-		sort.Slice(sortedCommits, func(i, j int) bool {
-			return sortedCommits[i].Ci.Commit.Committer.When.Before(sortedCommits[j].Ci.Commit.Committer.When)
-		})
-
-		parents := make(map[plumbing.Hash]mapset.Set[plumbing.Hash], len(commits))
-		for h, ci := range commits {
-			ps := mapset.NewSet[plumbing.Hash]()
-			if ci != nil && ci.Commit != nil {
-				for _, p := range ci.Commit.ParentHashes {
-					ps.Add(p)
-				}
+		if ci.References != nil {
+			node.Refs = ci.References.ToSlice()
+		}
+		for _, r := range heads[h] {
+			if r != nil {
+				node.Tips = append(node.Tips, r.Name().String())
 			}
-			parents[h] = ps
 		}
+		nodes = append(nodes, node)
+	}
+	return nodes, hashes
+}
 
-		result := make([]commitPair, 0, len(sortedCommits))
-		for len(sortedCommits) > 0 {
-			i := 0
-			for {
-				if i >= len(sortedCommits) {
-					result = append(result, sortedCommits...)
-					sortedCommits = sortedCommits[:0]
-					break
-				}
-				h := sortedCommits[i].Hash
-				if parents[h].Cardinality() == 0 {
-					c := sortedCommits[i]
-					sortedCommits = append(sortedCommits[:i], sortedCommits[i+1:]...)
-					result = append(result, c)
-					if cs, ok := children[h]; ok {
-						for child := range cs.Iter() {
-							if ps, ok := parents[child]; ok {
-								ps.Remove(h)
-							}
-						}
-					}
-					break
-				}
-				i++
+// branchAliases finds the former names of every renamed branch in heads.
+func branchAliases(repo *git.Repository, heads map[plumbing.Hash][]*plumbing.Reference) map[string][]string {
+	aliases := make(map[string][]string)
+	gitDir := structs.GitDirFS(repo)
+	for _, refs := range heads {
+		for _, ref := range refs {
+			if !ref.Name().IsBranch() {
+				continue
+			}
+			names, err := structs.ReadReflogRenames(gitDir, ref.Name().String())
+			if err != nil {
+				log.Printf("Could not read renames of %s: %v", ref.Name(), err)
+				continue
+			}
+			for _, name := range names {
+				aliases[ref.Name().String()] = append(aliases[ref.Name().String()], plumbing.ReferenceName(name).Short())
 			}
 		}
-		return result
 	}
+	return aliases
+}
 
-	isHeadRef := func(r *plumbing.Reference) bool {
-		if r == nil {
-			return false
-		}
-		name := r.Name().String()
-		return len(name) >= len("refs/heads/") && name[:len("refs/heads/")] == "refs/heads/"
+// maxRefs is set by -max-refs.
+var maxRefs int
+
+// headDecoration is what HEAD points at, as SVGOptions.Head takes it: the
+// full name of its branch, or the commit hash when it is detached.
+func headDecoration(repo *git.Repository) string {
+	head, err := repo.Reference(plumbing.HEAD, false)
+	if err != nil {
+		return ""
 	}
+	if head.Type() == plumbing.SymbolicReference {
+		return head.Target().String()
+	}
+	return head.Hash().String()
+}
 
-	buildHeadChildren := func() (map[plumbing.Hash]mapset.Set[plumbing.Hash], map[plumbing.Hash]mapset.Set[plumbing.Hash]) {
-		headChildren := make(map[plumbing.Hash]mapset.Set[plumbing.Hash])
-		for h, refSlice := range heads {
-			hasHead := false
-			for _, r := range refSlice {
-				if isHeadRef(r) {
-					hasHead = true
-					break
-				}
-			}
-			if hasHead {
-				cs := mapset.NewSet[plumbing.Hash]()
-				if ch, ok := children[h]; ok {
-					for c := range ch.Iter() {
-						cs.Add(c)
+func getGitHubSlug(repo *git.Repository) string {
+	remotes, err := repo.Remotes()
+	if err != nil {
+		return ""
+	}
+
+	for _, remote := range remotes {
+		for _, url := range remote.Config().URLs {
+			if strings.Contains(url, "github.com") {
+				url = strings.TrimSuffix(url, ".git")
+				if idx := strings.Index(url, "github.com/"); idx >= 0 {
+					slug := url[idx+len("github.com/"):]
+					if strings.HasPrefix(slug, ":") {
+						slug = slug[1:]
 					}
+					return slug
 				}
-				headChildren[h] = cs
 			}
 		}
+	}
+	return ""
+}
 
-		childrenHead := make(map[plumbing.Hash]mapset.Set[plumbing.Hash])
-		for head, cs := range headChildren {
-			for c := range cs.Iter() {
-				set := childrenHead[c]
-				if set == nil {
-					set = mapset.NewSet[plumbing.Hash]()
-					childrenHead[c] = set
-				}
-				set.Add(head)
-			}
+func repoTitle(repoPath string) string {
+	title := repoPath
+	if title == "." {
+		wd, err := os.Getwd()
+		if err == nil {
+			title = wd
 		}
-		return headChildren, childrenHead
 	}
+	title = strings.TrimSuffix(title, "/")
+	if idx := strings.LastIndex(title, "/"); idx >= 0 {
+		title = title[idx+1:]
+	}
+	return title
+}
 
-	gap := func(refsLevels map[string]int, refs bool) int {
-		if len(refsLevels) == 0 {
-			if refs {
-				return 0
-			}
-			return 1
-		}
-		levelsSet := mapset.NewSet[int]()
-		for _, l := range refsLevels {
-			levelsSet.Add(l)
-		}
-		levels := make([]int, 0, levelsSet.Cardinality())
-		for l := range levelsSet.Iter() {
-			levels = append(levels, l)
-		}
-		sort.Ints(levels)
-		for i := 0; i < len(levels)-1; i++ {
-			if levels[i+1]-levels[i] > 1 {
-				return levels[i] + 1
+func renderGraph(
+	w io.Writer,
+	repo *git.Repository,
+	title string,
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	children map[plumbing.Hash]mapset.Set[plumbing.Hash],
+	heads map[plumbing.Hash][]*plumbing.Reference,
+	tags map[plumbing.Hash][]*plumbing.Reference,
+	opts view.HTMLOptions,
+	svgOpts view.SVGOptions,
+) (map[plumbing.Hash][2]int, error) {
+	// The commit data does not depend on the layout, so it is prepared while
+	// the rows are arranged and drawn.
+	if svgOpts.Head == "" {
+		svgOpts.Head = headDecoration(repo)
+	}
+	if svgOpts.MaxRefs == 0 {
+		svgOpts.MaxRefs = maxRefs
+	}
+	ghSlug := getGitHubSlug(repo)
+	commitDataDone := make(chan map[string]view.CommitData, 1)
+	go func() {
+		commitDataDone <- view.GenerateCommitData(commits, ghSlug)
+	}()
+
+	svgString, positions, err := drawGraph(commits, children, heads, tags, svgOpts)
+	commitData := <-commitDataDone
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Arranged %d commits", len(positions))
+	if svgOpts.Rows != nil {
+		for h := range commitData {
+			if _, ok := positions[plumbing.NewHash(h)]; !ok {
+				delete(commitData, h)
 			}
 		}
-		return levels[len(levels)-1] + 1
 	}
 
-	sortedCommits := ctsort()
-	if len(sortedCommits) == 0 {
-		return nil
+	if opts.Assets != "" {
+		if err := view.WriteAssets(assetsDir, svgString, commitData, opts); err != nil {
+			return nil, fmt.Errorf("failed to write assets to %s: %w", assetsDir, err)
+		}
 	}
 
-	first := sortedCommits[0]
-	h0 := first.Hash
-	initialRefs := first.Ci.References
-	headChildren, childrenHead := buildHeadChildren()
-	refsLevels := make(map[string]int)
-	for ref := range initialRefs.Iter() {
-		refsLevels[ref] = 0
+	if err := view.WriteHTML(w, svgString, commitData, title, opts); err != nil {
+		return nil, fmt.Errorf("failed to write HTML: %w", err)
 	}
-	seenHeads := mapset.NewSet[plumbing.Hash]()
-
-	locations := make(map[plumbing.Hash][2]int, len(sortedCommits))
-	locations[h0] = [2]int{0, 0}
-
-	for i := 0; i < len(sortedCommits)-1; i++ {
-		curPair := sortedCommits[i+1]
-		h := curPair.Hash
-		ci := curPair.Ci
-		c := ci.Commit
-		refs := ci.References
-
-		x := -1
+	return positions, nil
+}
 
-		activeRefs := mapset.NewSet[string]()
-		for r := range refsLevels {
-			activeRefs.Add(r)
+// drawGraph arranges and draws the graph. Layouters that hand out rows run
+// as a pipeline: every row goes to the drawing as soon as it is placed, so
+// drawing runs alongside the rest of the arrangement.
+func drawGraph(
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	children map[plumbing.Hash]mapset.Set[plumbing.Hash],
+	heads map[plumbing.Hash][]*plumbing.Reference,
+	tags map[plumbing.Hash][]*plumbing.Reference,
+	svgOpts view.SVGOptions,
+) (string, map[plumbing.Hash][2]int, error) {
+	g := Graph{Commits: commits, Children: children, Heads: heads}
+	rl, ok := layouter.(rowLayouter)
+	// A slice of the rows is only known once all of them are arranged.
+	if !ok || svgOpts.Rows != nil {
+		positions, err := layouter.Arrange(context.Background(), g)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to arrange commits: %w", err)
 		}
-
-		if refs == nil || refs.Cardinality() == 0 {
-			type pxPair struct {
-				parent plumbing.Hash
-				x      int
-			}
-			parentPositions := make([]pxPair, 0, len(c.ParentHashes))
-			for _, p := range c.ParentHashes {
-				if pos, ok := locations[p]; ok {
-					parentPositions = append(parentPositions, pxPair{parent: p, x: pos[0]})
-				}
-			}
-			sort.Slice(parentPositions, func(a, b int) bool { return parentPositions[a].x < parentPositions[b].x })
-
-			if len(parentPositions) > 0 {
-				p := parentPositions[0].parent
-				x = parentPositions[0].x
-
-				futureChildren := mapset.NewSet[plumbing.Hash]()
-				if cs, ok := children[p]; ok {
-					remaining := mapset.NewSet[plumbing.Hash]()
-					for k := i + 2; k < len(sortedCommits); k++ {
-						remaining.Add(sortedCommits[k].Hash)
-					}
-					for child := range cs.Iter() {
-						if remaining.Contains(child) {
-							futureChildren.Add(child)
-						}
-					}
-				}
-				if futureChildren.Cardinality() > 0 {
-					x = gap(refsLevels, false)
-				}
-			} else {
-				x = gap(refsLevels, false)
-			}
-
-		} else if refs.Intersect(activeRefs).Cardinality() == 0 {
-			x = gap(refsLevels, true)
-
-		} else {
-			px := make(map[plumbing.Hash]int)
-			currentRefs := refs.Intersect(activeRefs) // current tracked refs on this commit
-			levelRefs := make(map[int]mapset.Set[string])
-			for r, lvl := range refsLevels {
-				rs := levelRefs[lvl]
-				if rs == nil {
-					rs = mapset.NewSet[string]()
-					levelRefs[lvl] = rs
-				}
-				rs.Add(r)
+		if bandLanes {
+			svgOpts.Bands = stripes(positions, heads)
+		}
+		if maxLanes > 0 {
+			svgOpts.Folded = foldedTips(positions, heads, maxLanes)
+		}
+		drawn := positions
+		if svgOpts.Rows != nil {
+			if drawn, err = sliceRows(positions, svgOpts.Rows); err != nil {
+				return "", nil, err
 			}
+		}
+		svgString, err := view.GenerateSVGString(commits, positions, heads, tags, children, svgOpts)
+		return svgString, drawn, err
+	}
 
-			for _, p := range c.ParentHashes {
-				parentInfo, ok := commits[p]
-				if !ok || parentInfo == nil {
-					continue
-				}
-				parentRefs := parentInfo.References
-				parentTracked := mapset.NewSet[string]()
-				if parentRefs != nil {
-					parentTracked = parentRefs.Intersect(activeRefs)
-				}
+	type row struct {
+		hash plumbing.Hash
+		pos  [2]int
+	}
+	rows := make(chan row, 256)
+	var arrangeErr error
+	go func() {
+		defer close(rows)
+		_, arrangeErr = rl.ArrangeRows(context.Background(), g, func(h plumbing.Hash, pos [2]int) {
+			rows <- row{h, pos}
+		})
+	}()
 
-				xForParent := -1
+	arranged := 0
+	for _, ci := range commits {
+		if ci != nil && ci.Commit != nil {
+			arranged++
+		}
+	}
+	stream := view.NewRailwayStream(commits, heads, tags, children, svgOpts, max(arranged-1, 0))
+	positions := make(map[plumbing.Hash][2]int, arranged)
+	for r := range rows {
+		positions[r.hash] = r.pos
+		stream.AddRow(r.hash, r.pos)
+	}
+	if arrangeErr != nil {
+		return "", nil, fmt.Errorf("failed to arrange commits: %w", arrangeErr)
+	}
+	return stream.String(), positions, nil
+}
 
-				if parentTracked.IsSubset(currentRefs) {
-					if pos, ok := locations[p]; ok {
-						xForParent = pos[0]
-					}
-				} else {
-					diverged := false
-					for _, lr := range levelRefs {
-						curAtLevel := lr.Intersect(currentRefs)
-						if curAtLevel.IsSubset(parentTracked) && !parentTracked.IsSubset(curAtLevel) {
-							diverged = true
-							break
-						}
-					}
+// writeWidget renders the graph as the embeddable widget, writing its script
+// and data next to each other as <name>.js and <name>.json.
+func writeWidget(
+	repo *git.Repository,
+	title string,
+	name string,
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	children map[plumbing.Hash]mapset.Set[plumbing.Hash],
+	heads map[plumbing.Hash][]*plumbing.Reference,
+	tags map[plumbing.Hash][]*plumbing.Reference,
+	svgOpts view.SVGOptions,
+	reproducible bool,
+) map[plumbing.Hash][2]int {
+	svgString, positions, err := drawGraph(commits, children, heads, tags, svgOpts)
+	if err != nil {
+		fail(exitFailure, err)
+	}
+	commitData := view.GenerateCommitData(commits, getGitHubSlug(repo))
+	if reproducible {
+		view.FixedDates(commitData)
+	}
 
-					if diverged {
-						minX := -1
-						for r := range currentRefs.Iter() {
-							if lvl, ok := refsLevels[r]; ok {
-								if minX == -1 || lvl < minX {
-									minX = lvl
-								}
-							}
-						}
-						if minX == -1 {
-							minX = gap(refsLevels, true)
-						}
-						xForParent = minX
-
-						if pos, ok := locations[p]; ok {
-							if xForParent == pos[0] {
-								childCount := 0
-								if cs, ok := children[p]; ok {
-									childCount = cs.Cardinality()
-								}
-								if childCount != 1 {
-									xForParent = gap(refsLevels, true)
-								}
-							}
-						}
-					} else if parentTracked.Cardinality() == 0 {
-						if pos, ok := locations[p]; ok {
-							xForParent = pos[0]
-						}
-					} else {
-						reuseTracked := false
-						for _, lr := range levelRefs {
-							curAtLevel := lr.Intersect(currentRefs)
-							if curAtLevel.IsSubset(currentRefs) && currentRefs.IsSubset(curAtLevel) {
-								reuseTracked = true
-								break
-							}
-						}
-						if reuseTracked {
-							for r := range currentRefs.Iter() {
-								if lvl, ok := refsLevels[r]; ok {
-									xForParent = lvl
-									break
-								}
-							}
-						} else {
-							xForParent = gap(refsLevels, true)
-						}
-					}
-				}
+	scriptFile, err := os.Create(name + ".js")
+	if err != nil {
+		fail(exitWriteFailed, fmt.Errorf("Failed to create widget script: %w", err))
+	}
+	defer scriptFile.Close()
+	dataFile, err := os.Create(name + ".json")
+	if err != nil {
+		fail(exitWriteFailed, fmt.Errorf("Failed to create widget data: %w", err))
+	}
+	defer dataFile.Close()
+	if err := view.WriteWidget(scriptFile, dataFile, svgString, commitData, title); err != nil {
+		fail(exitWriteFailed, fmt.Errorf("Failed to write widget: %w", err))
+	}
 
-				if xForParent < 0 {
-					xForParent = gap(refsLevels, true)
-				}
+	absPath, _ := filepath.Abs(name + ".js")
+	log.Printf("✨ Widget generated: %s (data in %s.json)", absPath, filepath.Base(name))
+	return positions
+}
 
-				px[p] = xForParent
-			}
+// writeBadge writes a README badge with the branch count, the age of the
+// newest commit and a micro-graph of the last 30 commits.
+func writeBadge(
+	path string,
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	heads map[plumbing.Hash][]*plumbing.Reference,
+	reproducible bool,
+) map[plumbing.Hash][2]int {
+	recent := newestCommits(commits, 30)
+	branches := 0
+	for _, refs := range heads {
+		branches += len(refs)
+	}
+	g := view.Graph{Commits: recent, Children: buildChildren(recent), Heads: onlyCommits(heads, recent)}
+	return writeRendered(path, "Badge", view.BadgeRenderer{Branches: branches, Reproducible: reproducible}, g)
+}
 
-			if len(px) > 0 {
-				min := -1
-				for _, v := range px {
-					if v >= 0 && (min == -1 || v < min) {
-						min = v
-					}
-				}
-				if min != -1 {
-					x = min
-				} else {
-					x = gap(refsLevels, true)
-				}
-			} else {
-				x = gap(refsLevels, true)
-			}
-		}
+// writeLayout writes the arranged graph as the versioned layout JSON.
+func writeLayout(
+	repo *git.Repository,
+	path string,
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	children map[plumbing.Hash]mapset.Set[plumbing.Hash],
+	heads map[plumbing.Hash][]*plumbing.Reference,
+	tags map[plumbing.Hash][]*plumbing.Reference,
+	reproducible bool,
+) map[plumbing.Hash][2]int {
+	r := view.LayoutRenderer{GitHubSlug: getGitHubSlug(repo), Reproducible: reproducible}
+	return writeRendered(path, "Layout", r, view.Graph{Commits: commits, Children: children, Heads: heads, Tags: tags})
+}
 
-		if x < 0 {
-			x = 0
-		}
+// writeRendered arranges the graph and writes it to path with r, what
+// naming the output in messages.
+func writeRendered(path, what string, r view.Renderer, g view.Graph) map[plumbing.Hash][2]int {
+	positions, err := layouter.Arrange(context.Background(), Graph{Commits: g.Commits, Children: g.Children, Heads: g.Heads})
+	if err != nil {
+		fail(exitFailure, fmt.Errorf("Failed to arrange commits: %w", err))
+	}
 
-		locations[h] = [2]int{x, len(locations)}
+	file, err := os.Create(path)
+	if err != nil {
+		fail(exitWriteFailed, fmt.Errorf("Failed to create %s file %s: %w", strings.ToLower(what), path, err))
+	}
+	defer file.Close()
+	if err := r.Render(context.Background(), g, positions, file); err != nil {
+		fail(exitWriteFailed, fmt.Errorf("Failed to write %s: %w", strings.ToLower(what), err))
+	}
 
-		for r := range refs.Iter() {
-			refsLevels[r] = x
-		}
+	absPath, _ := filepath.Abs(path)
+	log.Printf("✨ %s generated: %s", what, absPath)
+	return positions
+}
 
-		if _, ok := heads[h]; ok {
-			seenHeads.Add(h)
-		} else if ch, ok := childrenHead[h]; ok {
-			for head := range ch.Iter() {
-				if set, ok2 := headChildren[head]; ok2 {
-					set.Remove(h)
-				}
-			}
+// extraHTMLOptions reads the -extra-css and -extra-js files, either of which
+// may be empty.
+func extraHTMLOptions(cssPath, jsPath string) view.HTMLOptions {
+	var opts view.HTMLOptions
+	if cssPath != "" {
+		css, err := os.ReadFile(cssPath)
+		if err != nil {
+			fail(exitFailure, fmt.Errorf("Failed to read extra CSS: %w", err))
 		}
-
-		for _, head := range seenHeads.ToSlice() {
-			seenHeads.Remove(head) // Head in set(seen_heads): seen_heads.remove(head)
-			if refSlice, ok := heads[head]; ok {
-				for _, r := range refSlice {
-					if r == nil {
-						continue
-					}
-					name := r.Name().String()
-					delete(refsLevels, name)
-				}
-			}
+		opts.ExtraCSS = string(css)
+	}
+	if jsPath != "" {
+		js, err := os.ReadFile(jsPath)
+		if err != nil {
+			fail(exitFailure, fmt.Errorf("Failed to read extra JS: %w", err))
 		}
+		opts.ExtraJS = string(js)
 	}
-
-	return locations
+	return opts
 }
 
+// assetsDir is set by -assets-dir.
+var assetsDir string
 
-func getGitHubSlug(repo *git.Repository) string {
-	remotes, err := repo.Remotes()
+func writeGraph(
+	repo *git.Repository,
+	title string,
+	htmlOut string,
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	children map[plumbing.Hash]mapset.Set[plumbing.Hash],
+	heads map[plumbing.Hash][]*plumbing.Reference,
+	tags map[plumbing.Hash][]*plumbing.Reference,
+	opts view.HTMLOptions,
+	svgOpts view.SVGOptions,
+) map[plumbing.Hash][2]int {
+	htmlFile, err := os.Create(htmlOut)
 	if err != nil {
-		return ""
+		fail(exitWriteFailed, fmt.Errorf("Failed to create HTML file %s: %w", htmlOut, err))
 	}
+	defer htmlFile.Close()
 
-	for _, remote := range remotes {
-		for _, url := range remote.Config().URLs {
-			if strings.Contains(url, "github.com") {
-				url = strings.TrimSuffix(url, ".git")
-				if idx := strings.Index(url, "github.com/"); idx >= 0 {
-					slug := url[idx+len("github.com/"):]
-					if strings.HasPrefix(slug, ":") {
-						slug = slug[1:]
-					}
-					return slug
-				}
-			}
+	opts.Trees = collectTrees(repo, commits, browseTreeLimit)
+	if assetsDir != "" {
+		rel, err := filepath.Rel(filepath.Dir(htmlOut), assetsDir)
+		if err != nil {
+			rel, _ = filepath.Abs(assetsDir)
 		}
+		opts.Assets = filepath.ToSlash(rel)
 	}
-	return ""
+	var w io.Writer = htmlFile
+	var page strings.Builder
+	if opts.SingleFile {
+		w = io.MultiWriter(htmlFile, &page)
+	}
+	positions, err := renderGraph(w, repo, title, commits, children, heads, tags, opts, svgOpts)
+	if err != nil {
+		fail(exitWriteFailed, err)
+	}
+	for _, url := range view.RemoteLoads(page.String()) {
+		log.Printf("⚠️ %s still loads %s when opened, from -extra-css, -extra-js or the commit messages", htmlOut, url)
+	}
+
+	absPath, _ := filepath.Abs(htmlOut)
+	log.Printf("✨ HTML generated: file://%s", absPath)
+	if opts.Assets != "" {
+		log.Printf("Graph and commit data written to %s; serve the page over HTTP for it to load them", assetsDir)
+	}
+	return positions
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "file":
+			runFileHistory(os.Args[2:])
+			return
+		case "conflicts":
+			runConflicts(os.Args[2:])
+			return
+		case "bisect-run":
+			runBisect(os.Args[2:])
+			return
+		case "rebase-preview":
+			runRebasePreview(os.Args[2:])
+			return
+		case "export-patches":
+			runExportPatches(os.Args[2:])
+			return
+		case "serve":
+			runServe(os.Args[2:])
+			return
+		case "render":
+			runRender(os.Args[2:])
+			return
+		case "preview":
+			runPreview(os.Args[2:])
+			return
+		case "profile":
+			runProfile(os.Args[2:])
+			return
+		case "snapshot":
+			runSnapshot(os.Args[2:])
+			return
+		case "version":
+			runVersion(os.Args[2:])
+			return
+		case "self-update":
+			runSelfUpdate(os.Args[2:])
+			return
+		}
+	}
+
 	repoPath := flag.String("path", ".", "Path to Git repository (any subdirectory is OK)")
 	all := flag.Bool("all", false, "Include remote refs")
 	htmlOut := flag.String("html", "tree.html", "Generate HTML output file (instead of SVG to stdout)")
-	flag.Parse()
-
-	repo, err := git.PlainOpenWithOptions(*repoPath, &git.PlainOpenOptions{DetectDotGit: true})
+	diffstat := flag.Bool("diffstat", false, "Compute and show lines added/removed per commit (slow on large repos)")
+	mode := flag.String("mode", "", "View mode: releases (only tagged commits and the merges joining them, other commits collapsed)")
+	collapse := flag.Bool("collapse-merges", false, "Fold branches merged by pull request or `git merge` into one node each")
+	squashes := flag.Bool("squash-merges", false, "Link branches to the trunk commits they were squash-merged as")
+	bundleOut := flag.String("export-bundle", "", "Also write a git bundle of the commits and refs shown")
+	format := flag.String("format", "html", "Output format: html, widget (<name>.js and <name>.json for embedding), json (<name>.json layout for frontends) badge (<name>.svg summary for READMEs), tikz (<name>.tex standalone LaTeX picture), dot (<name>.dot Graphviz digraph pinned to the layout, for neato -n2), ascii (<name>.txt plain-text diagram) or md (<name>.md snippet with the graph and a commit table), named after -html")
+	mdInline := flag.Bool("md-inline", false, "Put the <svg> itself in -format md output, for notebooks, instead of an image with a data URI")
+	asciiWidth := flag.Int("ascii-width", 0, "Cut the lines of -format ascii to this many columns (0 leaves them whole)")
+	reproducible := flag.Bool("reproducible", false, "Produce byte-identical output for the same repository state in every format and export (absolute instead of relative dates)")
+	anon := flag.Bool("anonymize", false, "Replace names, emails and branch names with numbered pseudonyms and drop message bodies (not with -export-bundle)")
+	var redactions []*regexp.Regexp
+	flag.Func("redact", "Regular expression whose matches are hidden in commit messages (repeatable)", func(expr string) error {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return err
+		}
+		redactions = append(redactions, re)
+		return nil
+	})
+	extraCSS := flag.String("extra-css", "", "CSS file whose contents are appended to the HTML output's styles")
+	extraJS := flag.String("extra-js", "", "JavaScript file whose contents are appended to the HTML output's scripts")
+	author := flag.String("author", "", "Draw only commits whose author (\"Name <email>\") matches this regular expression, like git log --author")
+	since := flag.String("since", "", "Draw only commits made on or after this date, e.g. 2024-05-01")
+	until := flag.String("until", "", "Draw only commits made on or before this date, e.g. 2024-05-01 18:00")
+	highlight := flag.String("highlight", "", "Revisions (and -- paths) to emphasize, e.g. \"main..feature\", dimming the rest of the graph")
+	assertLinear := flag.String("assert-linear", "", "Branch whose first-parent history must have no merge commits; violations are highlighted and the exit code is 7")
+	fsck := flag.Bool("fsck-lite", false, "Check that the commits named by parents and reflogs exist and are readable, marking broken ones with a red cross")
+	hotspots := flag.Bool("hotspots", false, "Chart the directories and files changed most often as a treemap in the HTML; clicking a file lights up the commits that changed it")
+	latency := flag.Bool("merge-latency", false, "Badge each merge with how long the branch it merged took from its first commit, and chart how those times are spread in the HTML")
+	sessions := flag.Duration("author-sessions", 0, "Fold runs of consecutive commits by one author, each within this long of the last (e.g. 2h), into one node with a count; the HTML lists them on click")
+	tipsOnly := flag.Bool("tips-only", false, "Draw only the commits refs point at and the merge bases and merges connecting them, for an overview of the topology")
+	sample := flag.Int("sample", 0, "Above this many commits, keep ref tips, tags and merges but only every Nth commit of linear runs (0 disables)")
+	export := flag.String("export", "", "Also export the commits: csv (<name>.csv) or tsv (<name>.tsv) with a row each, sql (<name>.sql script) or sqlite (<name>.db, made with the sqlite3 command) with tables of commits, edges and refs, named after -html")
+	imageMapOut := flag.String("image-map", "", "Also write a JSON file with the pixel box of every commit in the rendered image")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: git-tree [flags] [<revision range>...] [-- <path>...]\n\n"+
+			"Render the commits selected by gitrevisions syntax (HEAD~20.., main..feature,\n"+
+			"main...feature, ^main, --not main), or every branch and tag when none is\n"+
+			"given; with only exclusions, every branch and tag minus those. Installed on\n"+
+			"the PATH it also runs as `git tree`.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Func("layout", "Layout strategy: heuristic (default) or lanes (one lane per branch)", setLayout)
+	flag.Func("lane-order", "Order of the lanes after the trunk and release branches: discovery (as the layout finds them, the default), recency (newest commit first) or commits (most commits first)", setLaneOrder)
+	flag.BoolVar(&bandLanes, "lane-bands", false, "Group lanes into bands over colored stripes: trunk, release branches, other branches, then personal branches under users/")
+	font := flag.String("font", "", `CSS font stack for labels, e.g. "'JetBrains Mono', monospace" (default "Ubuntu Mono")`)
+	embedFont := flag.String("embed-font", "", "WOFF2, WOFF, TTF or OTF file to embed for labels; subset it to keep the output small")
+	printMode := flag.Bool("print", false, "Print-friendly black on white rendering that tells refs apart by dash pattern and stop shape instead of color")
+	dates := flag.Bool("dates", false, "Print each commit's date in a gutter left of the rows, once per run of rows sharing it")
+	dateFormat := flag.String("date-format", "2006-01-02", "Go time layout of the dates -dates prints, e.g. \"2006-01-02 15:04\"")
+	halo := flag.String("halo", "", "Outline all text in this CSS color, or auto for the page background, so labels stay legible over rails")
+	flag.IntVar(&maxRefs, "max-refs", 4, "Most ref labels beside a commit, HEAD's branch first, then local branches, tags and remote refs; the rest go in a \"+N more\" list (0 draws them all)")
+	swimlanes := flag.Bool("swimlanes", false, "Tint each branch's lane behind the rows the branch spans")
+	flag.StringVar(&assetsDir, "assets-dir", "", "Write the graph and commit data to files in this directory, loaded by the HTML output, instead of embedding them (the page then has to be served over HTTP)")
+	flag.BoolVar(&cacheGraph, "cache", false, "Keep the collected commit graph in .git/git-tree/graph.gob and reuse it until a ref or HEAD moves")
+	var limits canvasLimits
+	flag.IntVar(&limits.rows, "limit-rows", 20000, "Warn when the graph would be drawn over more rows than this (0 disables)")
+	flag.IntVar(&maxLanes, "max-lanes", 0, "Fold the branches past this many lanes into one \"other branches\" lane, listed when clicked in the HTML, keeping the graph narrow (0 disables)")
+	flag.IntVar(&limits.lanes, "limit-lanes", 200, "Warn when the graph would be drawn over more lanes than this (0 disables)")
+	simplify := flag.Bool("auto-simplify", false, "Past -limit-rows or -limit-lanes, collapse merges and sample linear history instead of just warning")
+	statsOnly := flag.Bool("stats-only", false, "Print layout statistics (lanes, rows, crossings, widest row, longest branch) instead of rendering")
+	singleFile := flag.Bool("single-file", false, "Make the HTML output work offline: load no fonts or other assets from the web (labels use local fonts unless -embed-font is given)")
+	var rows *view.RowRange
+	flag.Func("rows", "Draw only this slice of rows, counted from the newest at 0 with the last excluded, e.g. 0..500; rails to commits outside it end in arrows at its edges", func(s string) (err error) {
+		rows, err = parseRows(s)
+		return err
+	})
+	page := flag.Int("page", 0, "Draw only this page of -page-size rows, counting from 1 at the newest commits, like -rows")
+	pageSize := flag.Int("page-size", 500, "Rows per -page")
+	flag.Func("ref-include", "Regular expression a ref's full name must match to be drawn, e.g. ^refs/heads/ (repeatable; any one match keeps the ref)", addRefPattern(&refIncludes))
+	flag.Func("ref-exclude", "Regular expression of refs to leave out entirely, e.g. ^refs/heads/dependabot/ or ^refs/remotes/[^/]+/renovate/ (repeatable)", addRefPattern(&refExcludes))
+	flag.BoolVar(&pullRequests, "pull-requests", false, "Draw the pull and merge requests fetched to refs/pull/<n>/head or refs/merge-requests/<n>/head as branches labeled PR #<n> or MR !<n>")
+	groupTrailer := flag.String("group-by-trailer", "", "Fill each commit's stop in a color for the value of this trailer, e.g. Team or Change-Id, to show which group authored each part of the history")
+	pushLag := flag.Duration("push-lag", 0, "Mark commits that appeared on a remote, going by the reflogs of remote-tracking refs, further than this from their author date (e.g. 720h), exposing long-lived local work and backdated commits")
+	policyFile := flag.String("policy", "", "JSON file of protected branches and their rules, or github:owner/repo to read them from GitHub (with $GITHUB_TOKEN); protected branches get a lock badge and commits that seem to break the rules are flagged")
+	notesRef := flag.String("notes", "", "Notes ref, e.g. git-tree for refs/notes/git-tree, whose notes badge the commits they are on; a note holds a JSON badge, {\"text\": ..., \"detail\": ...} or just the text, or an array of them")
+	flag.Func("reflog-labels", "Reflogs that label commits with the branches they passed through, which colors their rails and keeps them in the branch's lane: off, heads (local branches) or all (default; with -all also untracked remote branches)", setReflogLabels)
+	flag.IntVar(&reflogMaxEntries, "reflog-max-entries", 0, "Read only this many of the newest entries of each reflog (0 reads them all)")
+	compact := flag.Bool("compact-rows", false, "Put unrelated commits made in the same second on one row when their lanes and rails do not overlap")
+	remoteURL := flag.String("url", "", "Render the repository at this URL, cloned into memory instead of read from -path")
+	depth := flag.Int("depth", 0, "With -url, clone only this many of the newest commits of each branch (0 clones them all)")
+	branch := flag.String("branch", "", "With -url, clone only this branch")
+	flag.Func("errors", "Error output: text (log lines) or json (one object on stderr with error, message and exit_code)", setErrorFormat)
+	flag.BoolVar(&keepGoing, "keep-going", false, "When the refs cannot be read, draw the history of HEAD alone and exit with code 6 instead of failing")
+	// The flag package swallows "--" and rejects "--not", so both are split
+	// off first and handed back to the revision parser with what follows.
+	args, paths := os.Args[1:], []string(nil)
+	if i := slices.IndexFunc(args, func(arg string) bool { return arg == "--" || arg == "--not" }); i >= 0 {
+		args, paths = args[:i], args[i:]
+	}
+	flag.CommandLine.Parse(args)
+	revisions := append(flag.Args(), paths...)
+	filters, err := commitFilters(*author, *since, *until)
+	if err != nil {
+		fail(exitUsage, err)
+	}
+	if *anon && *bundleOut != "" {
+		fail(exitUsage, errors.New("-anonymize cannot be used with -export-bundle, which writes the real commits"))
+	}
+	if *page != 0 {
+		if rows != nil {
+			fail(exitUsage, errors.New("-rows and -page cannot be used together"))
+		}
+		var err error
+		if rows, err = pageRows(*page, *pageSize); err != nil {
+			fail(exitUsage, err)
+		}
+	}
+	source, title := *repoPath, repoTitle(*repoPath)
+	var repo *git.Repository
+	if *remoteURL != "" {
+		source, title = *remoteURL, remoteTitle(*remoteURL)
+		repo, err = cloneRemote(*remoteURL, *depth, *branch)
+	} else {
+		repo, err = git.PlainOpenWithOptions(*repoPath, &git.PlainOpenOptions{DetectDotGit: true})
+	}
 	if err != nil {
-		log.Fatal(err)
+		fail(openRepoCode(err), err)
+	}
+	notePartialClone(repo)
+	if bandLanes || laneOrder != laneOrderDiscovery {
+		layouter = bandedLanes{layouter, laneOrder}
+	}
+	if pins := lanePins(repo); len(pins) > 0 {
+		layouter = pinnedLanes{layouter, pins}
+	}
+	if maxLanes > 0 {
+		layouter = foldedLanes{layouter, maxLanes}
+	}
+	if *compact {
+		layouter = compactRows{layouter}
 	}
 
-	commits, children := collectCommits(*repoPath, repo, *all)
+	// Statistics and badges show positions only, which labels do not
+	// change unless the layout places commits by them.
+	if (*statsOnly || *format == "badge") && !usesRefLabels(layouter) {
+		reflogLabels = reflogLabelsOff
+	}
+	commits, children, err := collectCommits(repo, *all)
+	if err != nil {
+		fail(exitFailure, fmt.Errorf("Failed to collect commits: %w", err))
+	}
+	if len(commits) == 0 {
+		fail(exitEmptyRepo, fmt.Errorf("no commits found in %s", source))
+	}
+	missing := missingParents(commits, shallowCommits(repo))
+	if len(revisions) > 0 {
+		sel, err := parseRevisionArgs(repo, revisions)
+		if err != nil {
+			fail(exitUsage, fmt.Errorf("Failed to parse revisions: %w", err))
+		}
+		if commits, children, err = selectCommits(repo, commits, sel); err != nil {
+			fail(exitFailure, fmt.Errorf("Failed to select commits: %w", err))
+		}
+	}
+	if len(filters) > 0 {
+		if commits, children, err = filter.Apply(commits, filters...); err != nil {
+			fail(exitFailure, fmt.Errorf("Failed to filter commits: %w", notFetched(err)))
+		}
+		if len(commits) == 0 {
+			fail(exitFailure, errors.New("No commits match -author, -since and -until"))
+		}
+	}
 	log.Printf("Collected %d commits", len(commits))
 	log.Printf("Collected %d child relationships", len(children))
 
-	heads, tags := getRefs(repo, *all)
-	log.Printf("Collected %d heads", len(heads))
-	log.Printf("Collected %d tags", len(tags))
-
-	positions := arrangeCommits(commits, heads, children)
-	log.Printf("Arranged %d commits", len(positions))
+	if *diffstat {
+		addDiffstats(commits)
+	}
 
-	ghSlug := getGitHubSlug(repo)
-	commitData := view.GenerateCommitData(commits, ghSlug)
+	var pseudonyms *anonymizer
+	if *anon {
+		pseudonyms = newAnonymizer()
+		pseudonyms.anonymize(commits)
+	}
+	if len(redactions) > 0 {
+		redact(commits, redactions)
+	}
 
-	svgString, err := view.GenerateSVGString(commits, positions, heads, tags, children)
+	heads, tags, err := getRefs(repo, *all)
 	if err != nil {
-		log.Fatalf("Failed to generate SVG: %v", err)
+		fail(exitFailure, fmt.Errorf("Failed to collect refs: %w", err))
 	}
-
-	title := *repoPath
-	if title == "." {
-		wd, err := os.Getwd()
-		if err == nil {
-			title = wd
+	if len(revisions) > 0 || len(filters) > 0 {
+		heads, tags = onlyCommits(heads, commits), onlyCommits(tags, commits)
+	}
+	log.Printf("Collected %d heads", len(heads))
+	log.Printf("Collected %d tags", len(tags))
+	if pullRequests {
+		if n := countPullRequests(heads); n > 0 {
+			log.Printf("Collected %d pull and merge requests", n)
+		} else {
+			log.Printf("No pull or merge requests found; fetch them with git fetch origin '+refs/pull/*/head:refs/pull/*/head' (GitHub) or '+refs/merge-requests/*/head:refs/merge-requests/*/head' (GitLab)")
 		}
 	}
-	title = strings.TrimSuffix(title, "/")
-	if idx := strings.LastIndex(title, "/"); idx >= 0 {
-		title = title[idx+1:]
+	var latencies []view.MergeLatency
+	if *latency {
+		latencies = mergeLatencies(commits)
+		log.Printf("Measured the latency of %d merges", len(latencies))
+	}
+	var hot []view.Hotspot
+	if *hotspots {
+		hot = collectHotspots(repo, commits)
+		log.Printf("Found changes in %d directories", len(hot))
+	}
+	if *sessions > 0 {
+		commits, children = authorSessions(commits, children, heads, tags, *sessions)
+		log.Printf("Grouped author sessions down to %d commits", len(commits))
+	}
+	if *tipsOnly {
+		commits, children = refSkeleton(commits, children, heads, tags)
+		log.Printf("Reduced to %d ref tips, merge bases and merges", len(commits))
+	}
+	if *sample > 0 && len(commits) > *sample {
+		commits, children = sampleCommits(commits, children, heads, tags, *sample)
+		log.Printf("Sampled down to %d commits", len(commits))
 	}
 
-	htmlFile, err := os.Create(*htmlOut)
-	if err != nil {
-		log.Fatalf("Failed to create HTML file %s: %v", *htmlOut, err)
+	svgOpts := view.SVGOptions{Aliases: branchAliases(repo, heads), Swimlanes: *swimlanes, Print: *printMode, Font: *font, Rows: rows}
+	if *dates {
+		svgOpts.Dates = *dateFormat
+	}
+	svgOpts.Halo = *halo
+	var groups []view.CommitGroup
+	if *groupTrailer != "" {
+		svgOpts.Groups, groups = trailerGroups(commits, *groupTrailer)
+		log.Printf("Grouped %d commits into %d groups by their %s trailer", len(svgOpts.Groups), len(groups), *groupTrailer)
+	}
+	if *embedFont != "" {
+		format := view.FontFormat(*embedFont)
+		if format == "" {
+			fail(exitUsage, fmt.Errorf("Unknown font type %s (want .woff2, .woff, .ttf or .otf)", *embedFont))
+		}
+		data, err := os.ReadFile(*embedFont)
+		if err != nil {
+			fail(exitFailure, fmt.Errorf("Failed to read font: %w", err))
+		}
+		svgOpts.FontFace = &view.FontFace{Data: data, Format: format}
+	}
+	if !*all {
+		svgOpts.Upstreams = markUpstreams(repo, commits, trackedUpstreams(repo), pseudonyms)
+	}
+	markFoxtrots(repo, commits, trackedUpstreams(repo), pseudonyms)
+	if *notesRef != "" {
+		if err := addNoteBadges(repo, *notesRef, commits); err != nil {
+			fail(exitFailure, fmt.Errorf("Failed to read notes: %w", err))
+		}
+	}
+	if *pushLag > 0 {
+		log.Printf("Found %d commits pushed long after or before their author date", markPushLag(repo, commits, *pushLag, pseudonyms))
+	}
+	if *policyFile != "" {
+		p, err := readPolicy(*policyFile)
+		if err != nil {
+			fail(exitFailure, fmt.Errorf("Failed to read policy: %w", err))
+		}
+		log.Printf("Found %d commits that seem to break the branch policy", len(applyPolicy(repo, p, commits, heads, pseudonyms)))
+	}
+	if *highlight != "" {
+		sel, err := parseRevisionArgs(repo, strings.Fields(*highlight))
+		if err != nil {
+			fail(exitUsage, fmt.Errorf("Failed to parse -highlight: %w", err))
+		}
+		selected, _, err := selectCommits(repo, commits, sel)
+		if err != nil {
+			fail(exitFailure, fmt.Errorf("Failed to select highlighted commits: %w", err))
+		}
+		svgOpts.Highlight = make(map[string]bool, len(selected))
+		for h := range selected {
+			svgOpts.Highlight[h.String()] = true
+		}
+	}
+	var nonLinear []plumbing.Hash
+	linearBranch := *assertLinear
+	if *assertLinear != "" {
+		tip, err := resolveCommit(repo, *assertLinear)
+		if err != nil {
+			fail(exitFailure, fmt.Errorf("Failed to resolve -assert-linear branch: %w", err))
+		}
+		nonLinear = firstParentMerges(commits, tip.Hash)
+		if len(nonLinear) > 0 && svgOpts.Highlight == nil {
+			svgOpts.Highlight = make(map[string]bool, len(nonLinear))
+		}
+		linearBranch = pseudonyms.revision(repo, *assertLinear, tip.Hash)
+		for _, h := range nonLinear {
+			commits[h].Badges = append(commits[h].Badges, structs.Badge{
+				Text:   "✗ merge on " + linearBranch,
+				Detail: "Merge commit in the first-parent history of " + linearBranch + ", which must be linear",
+			})
+			svgOpts.Highlight[h.String()] = true
+		}
+	}
+	if *squashes {
+		links, err := correlateSquashes(repo, commits, heads, pseudonyms)
+		if err != nil {
+			log.Printf("Could not correlate squash merges: %v", err)
+		}
+		svgOpts.Links = links
+	}
+	if *bundleOut != "" {
+		if err := writeBundle(repo, *bundleOut, commits, heads, tags); err != nil {
+			fail(exitWriteFailed, fmt.Errorf("Failed to write bundle %s: %w", *bundleOut, err))
+		}
+		log.Printf("📦 Bundle written: %s", *bundleOut)
+	}
+	if *fsck {
+		svgOpts.Broken = fsckLite(repo, commits)
+		children = buildChildren(commits)
+		log.Printf("Found %d missing or unreadable objects", len(svgOpts.Broken))
+	}
+	// Branches keep their names until here, as the annotations above look
+	// them up in the repository and print them through pseudonyms.
+	if pseudonyms != nil {
+		heads = pseudonyms.refs(heads, commits)
+		svgOpts.Aliases = nil
+		svgOpts.Head = pseudonyms.refName(plumbing.ReferenceName(headDecoration(repo))).String()
+	}
+	switch *mode {
+	case "":
+	case "releases":
+		commits, children = releaseTrain(commits, tags)
+		heads = onlyCommits(heads, commits)
+		log.Printf("Reduced to %d releases and merges", len(commits))
+	default:
+		fail(exitUsage, fmt.Errorf("Unknown mode %q (want releases)", *mode))
+	}
+	if *collapse {
+		commits, children = collapseMerges(commits, heads, tags)
+		log.Printf("Collapsed merges down to %d nodes", len(commits))
+	}
+	if !*statsOnly {
+		commits, children = checkComplexity(commits, children, heads, tags, limits, *simplify, *collapse)
+		if *simplify {
+			heads = onlyCommits(heads, commits)
+		}
+	}
+	if *statsOnly {
+		positions, err := layouter.Arrange(context.Background(), Graph{Commits: commits, Children: children, Heads: heads})
+		if err != nil {
+			fail(exitFailure, fmt.Errorf("Failed to arrange commits: %w", err))
+		}
+		printLayoutStats(os.Stdout, measureLayout(commits, positions, heads))
+		return
+	}
+	var positions map[plumbing.Hash][2]int
+	switch *format {
+	case "html":
+		opts := extraHTMLOptions(*extraCSS, *extraJS)
+		opts.Reproducible = *reproducible
+		opts.Print = *printMode
+		opts.SingleFile = *singleFile
+		opts.Warnings = warnings.all()
+		opts.MergeLatencies = latencies
+		opts.Hotspots = hot
+		opts.Groups, opts.GroupsLabel = groups, *groupTrailer
+		positions = writeGraph(repo, title, *htmlOut, commits, children, heads, tags, opts, svgOpts)
+	case "widget":
+		name := strings.TrimSuffix(*htmlOut, filepath.Ext(*htmlOut))
+		positions = writeWidget(repo, title, name, commits, children, heads, tags, svgOpts, *reproducible)
+	case "json":
+		name := strings.TrimSuffix(*htmlOut, filepath.Ext(*htmlOut))
+		positions = writeLayout(repo, name+".json", commits, children, heads, tags, *reproducible)
+	case "badge":
+		name := strings.TrimSuffix(*htmlOut, filepath.Ext(*htmlOut))
+		positions = writeBadge(name+".svg", commits, heads, *reproducible)
+	case "ascii":
+		name := strings.TrimSuffix(*htmlOut, filepath.Ext(*htmlOut))
+		g := view.Graph{Commits: commits, Children: children, Heads: heads, Tags: tags}
+		positions = writeRendered(name+".txt", "ASCII diagram", view.ASCIIRenderer{Width: *asciiWidth}, g)
+	case "md":
+		name := strings.TrimSuffix(*htmlOut, filepath.Ext(*htmlOut))
+		g := view.Graph{Commits: commits, Children: children, Heads: heads, Tags: tags}
+		positions = writeRendered(name+".md", "Markdown snippet", view.MarkdownRenderer{SVG: svgOpts, Inline: *mdInline}, g)
+	case "tikz":
+		name := strings.TrimSuffix(*htmlOut, filepath.Ext(*htmlOut))
+		g := view.Graph{Commits: commits, Children: children, Heads: heads, Tags: tags}
+		positions = writeRendered(name+".tex", "TikZ picture", view.TikZRenderer{}, g)
+	case "dot":
+		name := strings.TrimSuffix(*htmlOut, filepath.Ext(*htmlOut))
+		g := view.Graph{Commits: commits, Children: children, Heads: heads, Tags: tags}
+		positions = writeRendered(name+".dot", "Graphviz digraph", view.DOTRenderer{}, g)
+	default:
+		fail(exitUsage, fmt.Errorf("Unknown format %q (want html, widget, json, badge, tikz, dot, ascii or md)", *format))
 	}
-	defer htmlFile.Close()
 
-	if err := view.WriteHTML(htmlFile, svgString, commitData, title); err != nil {
-		log.Fatalf("Failed to write HTML: %v", err)
+	if *export != "" {
+		base := strings.TrimSuffix(*htmlOut, filepath.Ext(*htmlOut))
+		g := view.Graph{Commits: commits, Children: children, Heads: heads, Tags: tags}
+		path, err := writeExport(*export, base, g, positions)
+		if err != nil {
+			fail(exitWriteFailed, fmt.Errorf("Failed to write %s: %w", path, err))
+		}
+		log.Printf("Exported the commits to %s", path)
+	}
+	if *imageMapOut != "" {
+		mapFile, err := os.Create(*imageMapOut)
+		if err != nil {
+			fail(exitWriteFailed, fmt.Errorf("Failed to create image map %s: %w", *imageMapOut, err))
+		}
+		err = view.WriteImageMap(mapFile, positions, view.DateGutter(commits, positions, svgOpts.Dates))
+		mapFile.Close()
+		if err != nil {
+			fail(exitWriteFailed, fmt.Errorf("Failed to write image map: %w", err))
+		}
 	}
 
-	absPath, _ := filepath.Abs(*htmlOut)
-	log.Printf("✨ HTML generated: file://%s", absPath)
+	warnings.summarize()
+	if len(nonLinear) > 0 {
+		fail(exitNotLinear, fmt.Errorf("%s is not linear: %d merge commits in its first-parent history, newest %s",
+			linearBranch, len(nonLinear), nonLinear[0].String()[:7]))
+	}
+	if missing > 0 {
+		fail(exitPartialRender, fmt.Errorf("%d parent commits could not be read and are missing from the graph", missing))
+	}
+	if refsUnlisted {
+		fail(exitPartialRender, errors.New("the refs could not be listed, so only the history of HEAD was drawn"))
+	}
 }
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/anton-dovnar/git-tree/view"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// TestStreamedDrawingMatchesWholeDrawing draws a graph with a branch, a
+// merge and a tag both ways drawGraph can: streamed row by row as the
+// layout places them, and all at once from the finished layout. The two
+// must give the same SVG, and the streamed rows must run densely from 0,
+// as the stream sizes its canvas before it sees them.
+func TestStreamedDrawingMatchesWholeDrawing(t *testing.T) {
+	repo, err := git.Init(memory.NewStorage(), memfs.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	when := time.Unix(1700000000, 0)
+	commit := func(msg string, parents ...plumbing.Hash) plumbing.Hash {
+		t.Helper()
+		if err := util.WriteFile(wt.Filesystem, "file", []byte(msg), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := wt.Add("file"); err != nil {
+			t.Fatal(err)
+		}
+		when = when.Add(time.Minute)
+		sig := &object.Signature{Name: "a", Email: "a@x", When: when}
+		h, err := wt.Commit(msg, &git.CommitOptions{Author: sig, Parents: parents})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	checkout := func(branch string, create bool) {
+		t.Helper()
+		if err := wt.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName(branch), Create: create}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first := commit("first")
+	if _, err := repo.CreateTag("v1.0", first, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkout("topic", true)
+	topic := commit("topic work")
+	commit("more topic work")
+	checkout("master", false)
+	trunk := commit("trunk work")
+	commit("merge topic", trunk, topic)
+
+	commits, children, err := collectCommits(repo, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	heads, tags, err := getRefs(repo, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := layouter.(rowLayouter); !ok {
+		t.Fatalf("layout %T does not stream its rows", layouter)
+	}
+	svgOpts := view.SVGOptions{Head: headDecoration(repo), MaxRefs: 4}
+	streamed, positions, err := drawGraph(commits, children, heads, tags, svgOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := make(map[int]bool, len(positions))
+	for _, pos := range positions {
+		rows[pos[1]] = true
+	}
+	for row := range len(commits) {
+		if !rows[row] {
+			t.Errorf("no commit in row %d of %d", row, len(commits))
+		}
+	}
+
+	arranged, err := layouter.Arrange(context.Background(), Graph{Commits: commits, Children: children, Heads: heads})
+	if err != nil {
+		t.Fatal(err)
+	}
+	whole, err := view.GenerateSVGString(commits, arranged, heads, tags, children, svgOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if streamed != whole {
+		t.Errorf("streamed SVG differs from the one drawn at once:\nstreamed: %s\nat once:  %s", streamed, whole)
+	}
+}
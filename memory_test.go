@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anton-dovnar/git-tree/view"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// TestInMemoryRepository renders a repository that never touches disk.
+func TestInMemoryRepository(t *testing.T) {
+	repo, err := git.Init(memory.NewStorage(), memfs.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := func(msg string) {
+		t.Helper()
+		if err := util.WriteFile(wt.Filesystem, "file", []byte(msg), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := wt.Add("file"); err != nil {
+			t.Fatal(err)
+		}
+		sig := &object.Signature{Name: "a", Email: "a@x", When: time.Unix(1700000000, 0)}
+		if _, err := wt.Commit(msg, &git.CommitOptions{Author: sig}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commit("first")
+	commit("second")
+	if err := wt.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("topic"), Create: true}); err != nil {
+		t.Fatal(err)
+	}
+	commit("third")
+
+	cfg, err := repo.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Raw.Section("git-tree").AddOption("pin", "topic:0")
+	if err := repo.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if pins := lanePins(repo); pins["topic"] != 0 || len(pins) != 1 {
+		t.Errorf("lanePins = %v, want map[topic:0]", pins)
+	}
+
+	commits, children, err := collectCommits(repo, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 3 {
+		t.Fatalf("collected %d commits, want 3", len(commits))
+	}
+	heads, tags, err := getRefs(repo, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var page bytes.Buffer
+	svgOpts := view.SVGOptions{Aliases: branchAliases(repo, heads)}
+	if _, err := renderGraph(&page, repo, "memory", commits, children, heads, tags, view.HTMLOptions{}, svgOpts); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(page.String(), "topic") {
+		t.Error("rendered page does not name the topic branch")
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// repoMetrics is the repository health exposed on /metrics. It is worked out
+// once, when the server has collected the history, like the page it serves;
+// only the staleness of branches is judged again on each scrape.
+type repoMetrics struct {
+	commits    int
+	tips       []time.Time    // Commit time of each branch's tip, zero when unknown
+	staleAfter time.Duration  // Age past which a branch counts as stale
+	unmerged   map[string]int // Branch to commits not reachable from HEAD
+	renderTime time.Duration  // Time spent laying out and drawing the page
+}
+
+// collectMetrics counts g's commits and branches. A branch is stale when its
+// tip was committed more than staleAfter ago, and its unmerged commits are
+// the ones HEAD does not reach. The metrics are best effort: when HEAD is
+// unborn or the history is cut short, as in a shallow clone, the unmerged
+// counts are left out with a warning rather than keeping the server down.
+func collectMetrics(g *repoGraph, staleAfter time.Duration) *repoMetrics {
+	m := &repoMetrics{commits: len(g.commits), staleAfter: staleAfter, unmerged: make(map[string]int)}
+	var trunkAll mapset.Set[plumbing.Hash]
+	if head, err := g.repo.Head(); err != nil {
+		warnings.add("Could not resolve HEAD, so /metrics leaves out unmerged commits: %v", err)
+	} else if trunkAll, err = reachable(g.repo, []plumbing.Hash{head.Hash()}, nil); err != nil {
+		warnings.add("Could not walk the history of HEAD, so /metrics leaves out unmerged commits: %v", err)
+		trunkAll = nil
+	}
+
+	for tip, refs := range g.heads {
+		if tip.IsZero() {
+			continue // Symbolic refs like origin/HEAD
+		}
+		var when time.Time
+		if info, ok := g.commits[tip]; ok {
+			when = info.Commit.Committer.When
+		} else if commit, err := g.repo.CommitObject(tip); err == nil {
+			when = commit.Committer.When
+		}
+		ahead := -1
+		if trunkAll != nil {
+			ahead = 0
+			if !trunkAll.Contains(tip) {
+				only, err := reachable(g.repo, []plumbing.Hash{tip}, trunkAll)
+				if err != nil {
+					warnings.add("Could not count the unmerged commits of %s for /metrics: %v", refs[0].Name().Short(), err)
+					ahead = -1
+				} else {
+					ahead = only.Cardinality()
+				}
+			}
+		}
+		for _, ref := range refs {
+			m.tips = append(m.tips, when)
+			if ahead >= 0 {
+				m.unmerged[ref.Name().Short()] = ahead
+			}
+		}
+	}
+	return m
+}
+
+// stale counts the branches whose tip is older than m.staleAfter at now.
+func (m *repoMetrics) stale(now time.Time) int {
+	n := 0
+	for _, when := range m.tips {
+		if !when.IsZero() && now.Sub(when) > m.staleAfter {
+			n++
+		}
+	}
+	return n
+}
+
+// write puts m in the Prometheus text exposition format as of now.
+func (m *repoMetrics) write(w *bytes.Buffer, now time.Time) {
+	gauge := func(name, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	}
+	gauge("git_tree_commits", "Commits in the collected history.")
+	fmt.Fprintf(w, "git_tree_commits %d\n", m.commits)
+	gauge("git_tree_branches", "Branches drawn in the graph.")
+	fmt.Fprintf(w, "git_tree_branches %d\n", len(m.tips))
+	gauge("git_tree_stale_branches", "Branches whose tip is older than -stale-after.")
+	fmt.Fprintf(w, "git_tree_stale_branches %d\n", m.stale(now))
+
+	gauge("git_tree_unmerged_commits", "Commits on a branch that HEAD does not reach.")
+	names := make([]string, 0, len(m.unmerged))
+	for name := range m.unmerged {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "git_tree_unmerged_commits{branch=\"%s\"} %d\n", promLabel(name), m.unmerged[name])
+	}
+
+	gauge("git_tree_render_duration_seconds", "Time taken to lay out and draw the graph.")
+	fmt.Fprintf(w, "git_tree_render_duration_seconds %g\n", m.renderTime.Seconds())
+}
+
+// promLabel escapes a label value for the Prometheus text format.
+func promLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func metricsHandler(m *repoMetrics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body bytes.Buffer
+		m.write(&body, time.Now())
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(body.Bytes())
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// servedRepo is a repository served under /r/<name>/.
+type servedRepo struct {
+	name string
+	path string
+}
+
+// repoName is what a repository name may be made of, so it can be used in a
+// URL path as is.
+var repoName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// addServedRepo parses a -repo flag value of the form name=path.
+func addServedRepo(repos *[]servedRepo) func(string) error {
+	return func(value string) error {
+		name, path, ok := strings.Cut(value, "=")
+		if !ok || name == "" || path == "" {
+			return fmt.Errorf("want name=path, got %q", value)
+		}
+		if !repoName.MatchString(name) || name == "." || name == ".." {
+			return fmt.Errorf("repository name %q may only use letters, digits, '.', '-' and '_'", name)
+		}
+		for _, r := range *repos {
+			if r.name == name {
+				return fmt.Errorf("repository %q given twice", name)
+			}
+		}
+		*repos = append(*repos, servedRepo{name, path})
+		return nil
+	}
+}
+
+// readServedRepos adds the repositories listed in a -repos file, one
+// name=path per line. Blank lines and lines starting with # are skipped, and
+// relative paths are taken from the file's directory.
+func readServedRepos(file string, repos *[]servedRepo) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	add := addServedRepo(repos)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if name, path, ok := strings.Cut(line, "="); ok && !filepath.IsAbs(path) {
+			line = name + "=" + filepath.Join(filepath.Dir(file), path)
+		}
+		if err := add(line); err != nil {
+			return fmt.Errorf("%s:%d: %w", file, n, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// repoIndex routes /r/<name>/ to each repository's handler and lists them
+// on /.
+func repoIndex(repos []servedRepo, handlers []http.Handler) *http.ServeMux {
+	var page strings.Builder
+	page.WriteString("<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>Repositories</title></head>\n<body>\n<h1>Repositories</h1>\n<ul>\n")
+	mux := http.NewServeMux()
+	for i, r := range repos {
+		prefix := "/r/" + r.name
+		mux.Handle(prefix+"/", http.StripPrefix(prefix, handlers[i]))
+		fmt.Fprintf(&page, "<li><a href=\"%s/\">%s</a></li>\n", html.EscapeString(prefix), html.EscapeString(r.name))
+	}
+	page.WriteString("</ul>\n</body></html>\n")
+
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page.String()))
+	})
+	return mux
+}
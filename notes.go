@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/anton-dovnar/git-tree/structs"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// noteBadge is a badge as written in a note: an object with text and an
+// optional detail, or just the text as a string.
+type noteBadge structs.Badge
+
+func (b *noteBadge) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &b.Text); err == nil {
+		return nil
+	}
+	var badge struct{ Text, Detail string }
+	if err := json.Unmarshal(data, &badge); err != nil {
+		return err
+	}
+	if badge.Text == "" {
+		return fmt.Errorf("badge without text")
+	}
+	b.Text, b.Detail = badge.Text, badge.Detail
+	return nil
+}
+
+// parseNote reads the badges of a note: one badge or a JSON array of them,
+// e.g. [{"text": "deployed", "detail": "production, 2026-10-01"}, "audited"].
+func parseNote(data []byte) ([]structs.Badge, error) {
+	var many []noteBadge
+	if err := json.Unmarshal(data, &many); err != nil {
+		var one noteBadge
+		if json.Unmarshal(data, &one) != nil {
+			return nil, err
+		}
+		many = []noteBadge{one}
+	}
+	badges := make([]structs.Badge, len(many))
+	for i, b := range many {
+		badges[i] = structs.Badge(b)
+	}
+	return badges, nil
+}
+
+// addNoteBadges badges commits with the labels the notes under notesRef
+// define for them, as added by `git notes --ref=git-tree add -m '"deployed"'`.
+// A name without "refs/" is taken to be under refs/notes/.
+func addNoteBadges(repo *git.Repository, notesRef string, commits map[plumbing.Hash]*structs.CommitInfo) error {
+	name := plumbing.ReferenceName(notesRef)
+	if !strings.HasPrefix(notesRef, "refs/") {
+		name = plumbing.ReferenceName("refs/notes/" + notesRef)
+	}
+	ref, err := repo.Reference(name, true)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	notes, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	tree, err := notes.Tree()
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	added := 0
+	err = tree.Files().ForEach(func(f *object.File) error {
+		// Notes are kept under the annotated commit's hash, split into
+		// directories ("ab/cdef...") once there are many of them.
+		h := plumbing.NewHash(strings.ReplaceAll(f.Name, "/", ""))
+		ci, ok := commits[h]
+		if !ok || h.String() != strings.ReplaceAll(f.Name, "/", "") {
+			return nil
+		}
+		r, err := f.Reader()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+		badges, err := parseNote(data)
+		if err != nil {
+			log.Printf("Ignoring the note on %s in %s: %v", h.String()[:7], name, err)
+			return nil
+		}
+		ci.Badges = append(ci.Badges, badges...)
+		added += len(badges)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	log.Printf("Added %d badges from %s", added, name)
+	return nil
+}
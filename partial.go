@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// partialCloneFilter returns the object filter repo was cloned with, like
+// blob:none or tree:0, "unknown" for a promisor remote that does not record
+// one, or "" for a full clone. Partial clones leave objects for git to fetch
+// on demand, which git-tree never does: it draws from commits alone unless
+// an option asks for more.
+func partialCloneFilter(repo *git.Repository) string {
+	cfg, err := repo.Config()
+	if err != nil {
+		return ""
+	}
+	filter := ""
+	for _, sec := range cfg.Raw.Sections {
+		if !sec.IsName("remote") {
+			continue
+		}
+		for _, remote := range sec.Subsections {
+			if f := remote.Options.Get("partialclonefilter"); f != "" {
+				return f
+			}
+			if strings.EqualFold(remote.Options.Get("promisor"), "true") {
+				filter = "unknown"
+			}
+		}
+	}
+	return filter
+}
+
+// lacksTrees reports whether a clone made with filter may be missing trees,
+// as every filter but the blob ones may.
+func lacksTrees(filter string) bool {
+	return filter != "" && !strings.HasPrefix(filter, "blob:")
+}
+
+// notePartialClone says once, when repo is a partial clone, that missing
+// objects stay missing.
+func notePartialClone(repo *git.Repository) {
+	if filter := partialCloneFilter(repo); filter != "" {
+		log.Printf("Partial clone (filter %s): objects left out are never fetched, so -diffstat, paths and file listings may be incomplete", filter)
+	}
+}
+
+// notFetched explains err when it is an object the repository does not
+// have, the usual reason being a partial clone.
+func notFetched(err error) error {
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		return fmt.Errorf("%w (left out of this partial clone? git-tree never fetches missing objects)", err)
+	}
+	return err
+}
+
+// shallowCommits returns the commits listed in .git/shallow: the boundary of
+// a shallow clone, whose parents were never fetched. Their absence is the
+// history the clone asked to leave out, not damage.
+func shallowCommits(repo *git.Repository) map[plumbing.Hash]bool {
+	hashes, err := repo.Storer.Shallow()
+	if err != nil {
+		warnings.add("Could not read .git/shallow: %v", err)
+		return nil
+	}
+	shallow := make(map[plumbing.Hash]bool, len(hashes))
+	for _, h := range hashes {
+		shallow[h] = true
+	}
+	return shallow
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// rangeCommits resolves revisions to their non-merge commits, oldest first.
+// It takes the revision syntax of the main command, such as "A..B", "A...B"
+// and "^A B", with paths after "--"; a single revision means just that
+// commit, like `git format-patch -1`.
+func rangeCommits(repo *git.Repository, args []string) ([]*object.Commit, error) {
+	if len(args) == 1 && !strings.Contains(args[0], "..") && !strings.HasPrefix(args[0], "^") {
+		commit, err := resolveCommit(repo, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return []*object.Commit{commit}, nil
+	}
+	sel, err := parseRevisionArgs(repo, args)
+	if err != nil {
+		return nil, err
+	}
+	selected, children, err := selectCommits(repo, nil, sel)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*object.Commit
+	for _, h := range chronological(selected, children) {
+		// Paths rewrite parents, and patches are taken against the real ones.
+		commit, err := repo.CommitObject(h)
+		if err != nil {
+			return nil, fmt.Errorf("read commit %s: %w", h, err)
+		}
+		if commit.NumParents() <= 1 {
+			out = append(out, commit)
+		}
+	}
+	return out, nil
+}
+
+// commitPatch diffs a commit against its first parent, or against the empty
+// tree for a root commit.
+func commitPatch(commit *object.Commit) (*object.Patch, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("read tree of %s: %w", commit.Hash, err)
+	}
+	var parentTree *object.Tree
+	if commit.NumParents() > 0 {
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return nil, fmt.Errorf("read parent of %s: %w", commit.Hash, err)
+		}
+		if parentTree, err = parent.Tree(); err != nil {
+			return nil, fmt.Errorf("read tree of %s: %w", parent.Hash, err)
+		}
+	}
+	changes, err := object.DiffTreeWithOptions(context.Background(), parentTree, tree, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return nil, fmt.Errorf("diff %s: %w", commit.Hash, err)
+	}
+	return changes.Patch()
+}
+
+// patchFileName mirrors the names `git format-patch` picks: the sequence
+// number followed by the subject with runs of other characters turned into
+// single dashes.
+func patchFileName(n int, subject string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range subject {
+		if r < 128 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.') {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+		if b.Len() >= 52 {
+			break
+		}
+	}
+	slug := strings.TrimRight(b.String(), ".")
+	return fmt.Sprintf("%04d-%s.patch", n, slug)
+}
+
+// writePatch writes commit in mbox form, as `git format-patch` does.
+func writePatch(path string, commit *object.Commit, n, total int) error {
+	patch, err := commitPatch(commit)
+	if err != nil {
+		return err
+	}
+	subject, body, _ := strings.Cut(strings.TrimSpace(commit.Message), "\n")
+	prefix := "[PATCH]"
+	if total > 1 {
+		prefix = fmt.Sprintf("[PATCH %d/%d]", n, total)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From %s Mon Sep 17 00:00:00 2001\n", commit.Hash)
+	fmt.Fprintf(&b, "From: %s <%s>\n", commit.Author.Name, commit.Author.Email)
+	fmt.Fprintf(&b, "Date: %s\n", commit.Author.When.Format("Mon, 2 Jan 2006 15:04:05 -0700"))
+	fmt.Fprintf(&b, "Subject: %s %s\n\n", prefix, subject)
+	if body = strings.TrimSpace(body); body != "" {
+		b.WriteString(body + "\n\n")
+	}
+	b.WriteString("---\n")
+
+	additions, deletions := 0, 0
+	stats := patch.Stats()
+	for _, s := range stats {
+		additions += s.Addition
+		deletions += s.Deletion
+	}
+	b.WriteString(stats.String())
+	fmt.Fprintf(&b, " %d files changed, %d insertions(+), %d deletions(-)\n\n", len(stats), additions, deletions)
+	b.WriteString(patch.String())
+	b.WriteString("-- \ngit-tree\n\n")
+
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+func runExportPatches(args []string) {
+	fs := flag.NewFlagSet("export-patches", flag.ExitOnError)
+	repoPath := fs.String("path", ".", "Path to Git repository (any subdirectory is OK)")
+	rangeExpr := fs.String("range", "", "Commits to export, as A..B or a single revision; revisions can also follow the flags")
+	outDir := fs.String("out", ".", "Directory to write the patch files to")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: git-tree export-patches [flags] <revisions> [-- <paths>]\n\nWrite `git format-patch`-style files for the non-merge commits selected, as in `git tree main..feature`.\n\n")
+		fs.PrintDefaults()
+	}
+	// The flag package swallows "--", so it and the paths after it are
+	// split off first, as the main command does.
+	args, paths := args, []string(nil)
+	if i := slices.Index(args, "--"); i >= 0 {
+		args, paths = args[:i], args[i:]
+	}
+	fs.Parse(args)
+	revisions := append(append(strings.Fields(*rangeExpr), fs.Args()...), paths...)
+	if len(revisions) == 0 || revisions[0] == "--" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	what := strings.Join(revisions, " ")
+
+	repo, err := git.PlainOpenWithOptions(*repoPath, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		fail(openRepoCode(err), err)
+	}
+	commits, err := rangeCommits(repo, revisions)
+	if err != nil {
+		fail(exitFailure, fmt.Errorf("Failed to resolve %s: %w", what, err))
+	}
+	if len(commits) == 0 {
+		fail(exitFailure, fmt.Errorf("No commits in %s", what))
+	}
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		fail(exitWriteFailed, fmt.Errorf("Failed to create %s: %w", *outDir, err))
+	}
+
+	for i, commit := range commits {
+		subject, _, _ := strings.Cut(strings.TrimSpace(commit.Message), "\n")
+		path := filepath.Join(*outDir, patchFileName(i+1, subject))
+		if err := writePatch(path, commit, i+1, len(commits)); err != nil {
+			fail(exitWriteFailed, fmt.Errorf("Failed to write %s: %w", path, err))
+		}
+		fmt.Println(path)
+	}
+}
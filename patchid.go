@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/sha1"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// patchID hashes the changes a commit introduces against its first parent,
+// ignoring whitespace and line numbers, in the spirit of `git patch-id`. Two
+// commits with the same patch ID apply the same change. Merge and root
+// commits have no patch ID.
+func patchID(commit *object.Commit) (plumbing.Hash, bool, error) {
+	if commit.NumParents() != 1 {
+		return plumbing.ZeroHash, false, nil
+	}
+	parent, err := commit.Parent(0)
+	if err != nil {
+		return plumbing.ZeroHash, false, err
+	}
+	id, err := rangePatchID(parent, commit)
+	return id, err == nil, err
+}
+
+// rangePatchID is the patch ID of the combined change from one commit to
+// another, such as a whole branch squashed into a single commit.
+func rangePatchID(from, to *object.Commit) (plumbing.Hash, error) {
+	patch, err := from.Patch(to)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	h := sha1.New()
+	for _, fp := range patch.FilePatches() {
+		from, to := fp.Files()
+		if from != nil {
+			h.Write([]byte("-" + from.Path() + "\n"))
+		}
+		if to != nil {
+			h.Write([]byte("+" + to.Path() + "\n"))
+		}
+		if fp.IsBinary() {
+			if to != nil {
+				blob := to.Hash()
+				h.Write(blob[:])
+			}
+			continue
+		}
+		for _, chunk := range fp.Chunks() {
+			var sign string
+			switch chunk.Type() {
+			case diff.Add:
+				sign = "+"
+			case diff.Delete:
+				sign = "-"
+			default:
+				continue
+			}
+			for _, line := range strings.SplitAfter(chunk.Content(), "\n") {
+				if line = strings.Join(strings.Fields(line), ""); line != "" {
+					h.Write([]byte(sign + line + "\n"))
+				}
+			}
+		}
+	}
+
+	var id plumbing.Hash
+	copy(id[:], h.Sum(nil))
+	return id, nil
+}
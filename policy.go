@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anton-dovnar/git-tree/structs"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// branchPolicy declares which branches are protected and how, as read from
+// a -policy file:
+//
+//	{"protected": [
+//	  {"branch": "main", "linear_history": true, "required_reviews": 1, "since": "2024-01-01"},
+//	  {"branch": "release/*", "required_reviews": 2, "merge_committer": "bot@example.com"}
+//	]}
+type branchPolicy struct {
+	Protected []protectedBranch `json:"protected"`
+}
+
+type protectedBranch struct {
+	Branch          string `json:"branch"` // Name or path.Match pattern
+	LinearHistory   bool   `json:"linear_history"`
+	RequiredReviews int    `json:"required_reviews"`
+	Since           string `json:"since"`           // Date the rules took effect, YYYY-MM-DD; empty means always
+	MergeCommitter  string `json:"merge_committer"` // Email committing reviewed merges; GitHub's for repositories on GitHub
+}
+
+// githubCommitter is the committer GitHub records on what it merges.
+const githubCommitter = "noreply@github.com"
+
+// rules describes the rules of p for a badge.
+func (p protectedBranch) rules() string {
+	var rules []string
+	if p.LinearHistory {
+		rules = append(rules, "linear history")
+	}
+	if p.RequiredReviews > 0 {
+		rules = append(rules, fmt.Sprintf("%d required reviews", p.RequiredReviews))
+	}
+	if len(rules) == 0 {
+		return "protected"
+	}
+	return "protected: " + strings.Join(rules, ", ")
+}
+
+// readPolicy reads the policy in file, or fetches the protected branches of
+// a GitHub repository given as github:owner/repo.
+func readPolicy(file string) (*branchPolicy, error) {
+	if repo, ok := strings.CutPrefix(file, "github:"); ok {
+		return githubPolicy(repo)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var p branchPolicy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	for _, b := range p.Protected {
+		if _, err := path.Match(b.Branch, ""); err != nil || b.Branch == "" {
+			return nil, fmt.Errorf("%s: bad branch pattern %q", file, b.Branch)
+		}
+		if _, err := policyStart(b); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", file, b.Branch, err)
+		}
+	}
+	return &p, nil
+}
+
+// policyStart parses when the rules of b took effect.
+func policyStart(b protectedBranch) (time.Time, error) {
+	if b.Since == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("2006-01-02", b.Since)
+}
+
+const githubAPI = "https://api.github.com/repos/"
+
+// githubPolicy reads the protected branches of the GitHub repository
+// owner/repo, authenticating with $GITHUB_TOKEN when it is set. Reading the
+// rules of a branch needs admin rights; without them the branch is still
+// known to be protected.
+func githubPolicy(repo string) (*branchPolicy, error) {
+	var branches []struct {
+		Name string `json:"name"`
+	}
+	if err := githubGet(githubAPI+repo+"/branches?protected=true&per_page=100", &branches); err != nil {
+		return nil, err
+	}
+	p := &branchPolicy{}
+	for _, b := range branches {
+		var protection struct {
+			Linear struct {
+				Enabled bool `json:"enabled"`
+			} `json:"required_linear_history"`
+			Reviews *struct {
+				Count int `json:"required_approving_review_count"`
+			} `json:"required_pull_request_reviews"`
+		}
+		rule := protectedBranch{Branch: b.Name, MergeCommitter: githubCommitter}
+		if err := githubGet(githubAPI+repo+"/branches/"+url.PathEscape(b.Name)+"/protection", &protection); err != nil {
+			log.Printf("Could not read the protection rules of %s: %v", b.Name, err)
+		} else {
+			rule.LinearHistory = protection.Linear.Enabled
+			if protection.Reviews != nil {
+				rule.RequiredReviews = max(protection.Reviews.Count, 1)
+			}
+		}
+		p.Protected = append(p.Protected, rule)
+	}
+	return p, nil
+}
+
+func githubGet(u string, v any) error {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// branchName is the name a local or remote-tracking branch has on its
+// remote, e.g. main for both refs/heads/main and refs/remotes/origin/main.
+func branchName(name plumbing.ReferenceName) (string, bool) {
+	switch {
+	case name.IsBranch():
+		return name.Short(), true
+	case name.IsRemote():
+		_, branch, ok := strings.Cut(strings.TrimPrefix(name.String(), "refs/remotes/"), "/")
+		return branch, ok && branch != "HEAD"
+	}
+	return "", false
+}
+
+// applyPolicy badges the tips of the protected branches with a lock and
+// flags the commits that seem to break their rules: merges in the
+// first-parent history of a branch that must be linear, and, where reviews
+// are required, commits that did not arrive through a reviewed pull request.
+// Those are the commits the reflogs show were committed on the branch
+// itself or pushed to it from here, and first-parent commits not committed
+// by the rule's merge committer, by default GitHub, which commits whatever
+// it merges. Off GitHub, without a merge committer, that last check is
+// skipped. Committers are read from the repository, as -anonymize has
+// replaced them in commits by then, and branches are printed through names.
+// It returns the flagged commits.
+func applyPolicy(
+	repo *git.Repository,
+	p *branchPolicy,
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	heads map[plumbing.Hash][]*plumbing.Reference,
+	names *anonymizer,
+) []plumbing.Hash {
+	var refs []*plumbing.Reference
+	for _, rs := range heads {
+		refs = append(refs, rs...)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name() < refs[j].Name() })
+
+	gitDir := structs.GitDirFS(repo)
+	onGitHub := getGitHubSlug(repo) != ""
+	locks := make(map[plumbing.Hash][]string)
+	flagged := make(map[plumbing.Hash]map[string]bool)
+	var violations []plumbing.Hash
+	flag := func(h plumbing.Hash, since time.Time, text, detail string) {
+		ci, ok := commits[h]
+		if !ok || ci.Commit.Committer.When.Before(since) || flagged[h][text] {
+			return
+		}
+		if flagged[h] == nil {
+			flagged[h] = make(map[string]bool)
+			violations = append(violations, h)
+		}
+		flagged[h][text] = true
+		ci.Badges = append(ci.Badges, structs.Badge{Text: text, Detail: detail})
+	}
+
+	for _, ref := range refs {
+		branch, ok := branchName(ref.Name())
+		if !ok {
+			continue
+		}
+		i := ruleFor(p, branch)
+		if i < 0 {
+			continue
+		}
+		rule := p.Protected[i]
+		since, _ := policyStart(rule)
+		label := names.label(ref.Name())
+		locks[ref.Hash()] = append(locks[ref.Hash()], label+" is "+rule.rules())
+		branch = names.label(plumbing.NewBranchReferenceName(branch))
+
+		if rule.LinearHistory {
+			for _, h := range firstParentMerges(commits, ref.Hash()) {
+				flag(h, since, "✗ merge on "+branch, "Merge commit in the first-parent history of "+branch+", which requires linear history")
+			}
+		}
+		if rule.RequiredReviews == 0 {
+			continue
+		}
+		direct := fmt.Sprintf("Reached %s without the %d required reviews", branch, rule.RequiredReviews)
+		committed, _ := structs.ReadReflogUpdates(gitDir, ref.Name().String(), "commit")
+		for _, h := range committed {
+			flag(h, since, "✗ direct commit", direct+": committed on "+label+" itself")
+		}
+		pushed, _ := structs.ReadReflogUpdates(gitDir, ref.Name().String(), "update by push")
+		for _, h := range pushed {
+			flag(h, since, "✗ direct push", direct+": pushed to "+label+" from this clone")
+		}
+		merger := rule.MergeCommitter
+		if merger == "" && onGitHub {
+			merger = githubCommitter
+		}
+		if merger == "" {
+			continue
+		}
+		for h := ref.Hash(); ; {
+			ci, ok := commits[h]
+			if !ok {
+				break
+			}
+			committer := ci.Commit.Committer.Email
+			if original, err := repo.CommitObject(h); err == nil {
+				committer = original.Committer.Email
+			}
+			if !strings.EqualFold(committer, merger) {
+				by := "not merged by " + merger
+				if merger == githubCommitter {
+					by = "not merged by GitHub"
+				}
+				flag(h, since, "✗ direct push", direct+": committed by "+ci.Commit.Committer.Name+", "+by)
+			}
+			if ci.Commit.NumParents() == 0 {
+				break
+			}
+			h = ci.Commit.ParentHashes[0]
+		}
+	}
+
+	for h, why := range locks {
+		if ci, ok := commits[h]; ok {
+			ci.Badges = append(ci.Badges, structs.Badge{Text: "🔒", Detail: strings.Join(why, "; ")})
+		}
+	}
+	return violations
+}
+
+// ruleFor returns the index of the first rule of p protecting branch, or -1.
+func ruleFor(p *branchPolicy, branch string) int {
+	for i, b := range p.Protected {
+		if ok, _ := path.Match(b.Branch, branch); ok {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/anton-dovnar/git-tree/structs"
+	"github.com/anton-dovnar/git-tree/view"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// newestCommits keeps the n most recently committed commits. Their parent
+// links are left alone, so links to older commits point out of the set.
+func newestCommits(commits map[plumbing.Hash]*structs.CommitInfo, n int) map[plumbing.Hash]*structs.CommitInfo {
+	hashes := make([]plumbing.Hash, 0, len(commits))
+	for h := range commits {
+		hashes = append(hashes, h)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		ti, tj := commits[hashes[i]].Commit.Committer.When, commits[hashes[j]].Commit.Committer.When
+		if ti.Equal(tj) {
+			return hashes[i].String() < hashes[j].String()
+		}
+		return ti.After(tj)
+	})
+	out := make(map[plumbing.Hash]*structs.CommitInfo, n)
+	for _, h := range hashes[:min(n, len(hashes))] {
+		out[h] = commits[h]
+	}
+	return out
+}
+
+func runPreview(args []string) {
+	fs := flag.NewFlagSet("preview", flag.ExitOnError)
+	repoPath := fs.String("path", ".", "Path to Git repository (any subdirectory is OK)")
+	all := fs.Bool("all", false, "Include remote refs")
+	out := fs.String("out", "", "PNG file to write")
+	count := fs.Int("commits", 15, "Number of recent commits to show")
+	title := fs.String("title", "", "Text to overlay (default: the repository name)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: git-tree preview -out <file.png> [flags]\n\nWrite a %dx%d image of recent history, for use as a social preview or dashboard tile.\n\n",
+			view.PreviewWidth, view.PreviewHeight)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *out == "" || *count < 1 || fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	repo, err := git.PlainOpenWithOptions(*repoPath, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		fail(openRepoCode(err), err)
+	}
+	collected, _, err := collectCommits(repo, *all)
+	if err != nil {
+		fail(exitFailure, fmt.Errorf("Failed to collect commits: %w", err))
+	}
+	if len(collected) == 0 {
+		fail(exitEmptyRepo, fmt.Errorf("no commits found in %s", *repoPath))
+	}
+	heads, _, err := getRefs(repo, *all)
+	if err != nil {
+		fail(exitFailure, fmt.Errorf("Failed to collect refs: %w", err))
+	}
+	if *title == "" {
+		*title = repoTitle(*repoPath)
+	}
+	branches := 0
+	for _, refs := range heads {
+		branches += len(refs)
+	}
+	subtitle := fmt.Sprintf("%d commits, %d branches", len(collected), branches)
+
+	commits := newestCommits(collected, *count)
+	children := buildChildren(commits)
+	positions := arrangeCommits(commits, onlyCommits(heads, commits), children)
+
+	f, err := os.Create(*out)
+	if err != nil {
+		fail(exitWriteFailed, fmt.Errorf("Failed to create preview file %s: %w", *out, err))
+	}
+	if err := view.RenderPreview(f, *title, subtitle, commits, positions); err != nil {
+		f.Close()
+		fail(exitWriteFailed, fmt.Errorf("Failed to write preview: %w", err))
+	}
+	if err := f.Close(); err != nil {
+		fail(exitWriteFailed, fmt.Errorf("Failed to write preview: %w", err))
+	}
+	log.Printf("✨ Preview generated: %s", *out)
+}
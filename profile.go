@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"time"
+
+	"github.com/anton-dovnar/git-tree/structs"
+	"github.com/anton-dovnar/git-tree/view"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+type phase struct {
+	name string
+	took time.Duration
+}
+
+// runProfile renders the repository like the default command does, with
+// the CPU profiled throughout, then writes a heap profile and prints how
+// long every phase took: the data a performance bug report needs.
+func runProfile(args []string) {
+	fs := flag.NewFlagSet("profile", flag.ExitOnError)
+	repoPath := fs.String("path", ".", "Path to Git repository (any subdirectory is OK)")
+	all := fs.Bool("all", false, "Include remote refs")
+	out := fs.String("out", "git-tree-profile", "Directory to write cpu.pprof, heap.pprof and the rendered tree.html to")
+	fs.Func("layout", "Layout strategy: heuristic (default) or lanes (one lane per branch)", setLayout)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: git-tree profile [flags]\n\nRender the repository with profiling enabled and print a timing breakdown by phase.\nAttach the output and the profiles to performance bug reports.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		fail(exitWriteFailed, fmt.Errorf("Failed to create %s: %w", *out, err))
+	}
+
+	cpuPath := filepath.Join(*out, "cpu.pprof")
+	cpuFile, err := os.Create(cpuPath)
+	if err != nil {
+		fail(exitWriteFailed, fmt.Errorf("Failed to create CPU profile %s: %w", cpuPath, err))
+	}
+	if err := pprof.StartCPUProfile(cpuFile); err != nil {
+		fail(exitWriteFailed, fmt.Errorf("Failed to start CPU profile: %w", err))
+	}
+
+	var phases []phase
+	start := time.Now()
+	timed := func(name string, run func()) {
+		began := time.Now()
+		run()
+		phases = append(phases, phase{name, time.Since(began)})
+	}
+
+	var repo *git.Repository
+	timed("open repository", func() {
+		repo, err = git.PlainOpenWithOptions(*repoPath, &git.PlainOpenOptions{DetectDotGit: true})
+	})
+	if err != nil {
+		pprof.StopCPUProfile()
+		fail(openRepoCode(err), err)
+	}
+	var commits map[plumbing.Hash]*structs.CommitInfo
+	var children map[plumbing.Hash]mapset.Set[plumbing.Hash]
+	timed("collect commits", func() { commits, children, err = collectCommits(repo, *all) })
+	if err != nil {
+		pprof.StopCPUProfile()
+		fail(exitFailure, fmt.Errorf("Failed to collect commits: %w", err))
+	}
+	if len(commits) == 0 {
+		pprof.StopCPUProfile()
+		fail(exitEmptyRepo, fmt.Errorf("no commits found in %s", *repoPath))
+	}
+	var heads, tags map[plumbing.Hash][]*plumbing.Reference
+	timed("collect refs", func() { heads, tags, err = getRefs(repo, *all) })
+	if err != nil {
+		pprof.StopCPUProfile()
+		fail(exitFailure, fmt.Errorf("Failed to collect refs: %w", err))
+	}
+
+	var positions Positions
+	timed("arrange", func() {
+		positions, err = layouter.Arrange(context.Background(), Graph{Commits: commits, Children: children, Heads: heads})
+	})
+	if err != nil {
+		pprof.StopCPUProfile()
+		fail(exitWriteFailed, fmt.Errorf("Failed to arrange commits: %w", err))
+	}
+	var svgString string
+	timed("draw SVG", func() {
+		svgString, err = view.GenerateSVGString(commits, positions, heads, tags, children, view.SVGOptions{})
+	})
+	if err != nil {
+		pprof.StopCPUProfile()
+		fail(exitWriteFailed, fmt.Errorf("Failed to generate SVG: %w", err))
+	}
+	var commitData map[string]view.CommitData
+	timed("commit data", func() { commitData = view.GenerateCommitData(commits, getGitHubSlug(repo)) })
+	var trees map[string][]view.TreeEntry
+	timed("tree listings", func() { trees = collectTrees(repo, commits, browseTreeLimit) })
+
+	htmlPath := filepath.Join(*out, "tree.html")
+	timed("write HTML", func() {
+		var f *os.File
+		if f, err = os.Create(htmlPath); err != nil {
+			return
+		}
+		err = view.WriteHTML(f, svgString, commitData, repoTitle(*repoPath), view.HTMLOptions{Trees: trees})
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	})
+	total := time.Since(start)
+	pprof.StopCPUProfile()
+	cpuFile.Close()
+	if err != nil {
+		fail(exitWriteFailed, fmt.Errorf("Failed to write %s: %w", htmlPath, err))
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	heapPath := filepath.Join(*out, "heap.pprof")
+	heapFile, err := os.Create(heapPath)
+	if err != nil {
+		fail(exitWriteFailed, fmt.Errorf("Failed to create heap profile %s: %w", heapPath, err))
+	}
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(heapFile); err != nil {
+		fail(exitWriteFailed, fmt.Errorf("Failed to write heap profile: %w", err))
+	}
+	heapFile.Close()
+
+	printProfile(os.Stdout, phases, total, len(commits), len(positions), mem)
+	fmt.Printf("\nProfiles written to %s and %s; inspect them with `go tool pprof`.\n", cpuPath, heapPath)
+}
+
+func printProfile(w io.Writer, phases []phase, total time.Duration, collected, arranged int, mem runtime.MemStats) {
+	build := version
+	if rev, _ := buildInfo(); rev != "" {
+		build += " " + rev
+	}
+	fmt.Fprintf(w, "git-tree %s, %s %s/%s, %d CPUs\n", build, runtime.Version(), runtime.GOOS, runtime.GOARCH, runtime.GOMAXPROCS(0))
+	fmt.Fprintf(w, "%d commits collected, %d arranged (layout %T)\n\n", collected, arranged, layouter)
+	for _, p := range phases {
+		fmt.Fprintf(w, "%-16s %10s %5.1f%%\n", p.name, p.took.Round(time.Microsecond), 100*p.took.Seconds()/total.Seconds())
+	}
+	fmt.Fprintf(w, "%-16s %10s\n\n", "total", total.Round(time.Microsecond))
+	fmt.Fprintf(w, "allocated %d MiB in total, %d MiB obtained from the OS, %d GC cycles\n", mem.TotalAlloc>>20, mem.Sys>>20, mem.NumGC)
+}
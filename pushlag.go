@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anton-dovnar/git-tree/structs"
+	"github.com/anton-dovnar/git-tree/view"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// firstSeenOnRemote dates when each commit first appeared on a remote, as
+// far as the reflogs of the remote-tracking refs tell: the time of the
+// first entry whose new commit reaches it. The commits a reflog starts out
+// with were there before it began, so they stay undated, unless it starts
+// with this clone pushing the branch.
+func firstSeenOnRemote(repo *git.Repository, commits map[plumbing.Hash]*structs.CommitInfo, names *anonymizer) (map[plumbing.Hash]time.Time, map[plumbing.Hash]string) {
+	refs, err := repo.References()
+	if err != nil {
+		return nil, nil
+	}
+	var remotes []plumbing.ReferenceName
+	refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Name().IsRemote() && ref.Type() == plumbing.HashReference {
+			remotes = append(remotes, ref.Name())
+		}
+		return nil
+	})
+	sort.Slice(remotes, func(i, j int) bool { return remotes[i] < remotes[j] })
+
+	type arrival struct {
+		ref     plumbing.ReferenceName
+		entry   structs.ReflogEntry
+		undated bool
+	}
+	var arrivals []arrival
+	gitDir := structs.GitDirFS(repo)
+	for _, name := range remotes {
+		entries, _ := structs.ReadReflogEntries(gitDir, name.String())
+		for i, e := range entries {
+			arrivals = append(arrivals, arrival{name, e, i == 0 && !strings.HasPrefix(e.Message, "update by push")})
+		}
+	}
+	sort.SliceStable(arrivals, func(i, j int) bool { return arrivals[i].entry.When.Before(arrivals[j].entry.When) })
+
+	seen := make(map[plumbing.Hash]bool)
+	when := make(map[plumbing.Hash]time.Time)
+	where := make(map[plumbing.Hash]string)
+	for _, a := range arrivals {
+		for pending := []plumbing.Hash{a.entry.New}; len(pending) > 0; {
+			h := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+			ci, ok := commits[h]
+			if !ok || seen[h] {
+				continue
+			}
+			seen[h] = true
+			if !a.undated {
+				when[h], where[h] = a.entry.When, names.label(a.ref)
+			}
+			pending = append(pending, ci.Commit.ParentHashes...)
+		}
+	}
+	return when, where
+}
+
+// markPushLag badges the commits whose author date and the time they first
+// appeared on a remote are further apart than lag: work kept local for long,
+// or backdated commits. It returns how many it marked.
+func markPushLag(repo *git.Repository, commits map[plumbing.Hash]*structs.CommitInfo, lag time.Duration, names *anonymizer) int {
+	when, where := firstSeenOnRemote(repo, commits, names)
+	marked := 0
+	for h, seen := range when {
+		ci := commits[h]
+		authored := ci.Commit.Author.When
+		gap := seen.Sub(authored)
+		switch {
+		case gap > lag:
+			ci.Badges = append(ci.Badges, structs.Badge{
+				Text: "⌛ " + view.FormatLatency(gap),
+				Detail: fmt.Sprintf("Authored %s but first seen on %s %s, %s later",
+					authored.Format(time.DateTime), where[h], seen.Format(time.DateTime), view.FormatLatency(gap)),
+			})
+		case -gap > lag:
+			ci.Badges = append(ci.Badges, structs.Badge{
+				Text: "⌛ -" + view.FormatLatency(-gap),
+				Detail: fmt.Sprintf("Seen on %s %s, %s before its author date %s",
+					where[h], seen.Format(time.DateTime), view.FormatLatency(-gap), authored.Format(time.DateTime)),
+			})
+		default:
+			continue
+		}
+		marked++
+	}
+	return marked
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+type reachability struct {
+	From      string   `json:"from"`
+	To        string   `json:"to"`
+	Reachable bool     `json:"reachable"`
+	Path      []string `json:"path,omitempty"` // Full hashes from to down to from, when reachable
+}
+
+// reachableHandler answers whether commit from is contained in to, a branch,
+// tag or any other revision, along with the shortest chain of parents
+// leading there so the page can draw it.
+func reachableHandler(g *repoGraph) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		from, err := resolveCommit(g.repo, q.Get("from"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		to, err := resolveCommit(g.repo, q.Get("to"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result := reachability{From: from.Hash.String(), To: to.Hash.String()}
+		path, err := g.parentPath(to.Hash, from.Hash)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if path != nil {
+			result.Reachable = true
+			for _, h := range path {
+				result.Path = append(result.Path, h.String())
+			}
+		}
+		writeJSON(w, result)
+	}
+}
+
+// parentPath finds the shortest chain of parents from tip down to target,
+// both included, or nil when target is not an ancestor of tip. Commits not
+// collected for the graph are read from the repository.
+func (g *repoGraph) parentPath(tip, target plumbing.Hash) ([]plumbing.Hash, error) {
+	via := map[plumbing.Hash]plumbing.Hash{tip: plumbing.ZeroHash}
+	for queue := []plumbing.Hash{tip}; len(queue) > 0; queue = queue[1:] {
+		h := queue[0]
+		if h == target {
+			var path []plumbing.Hash
+			for c := h; c != plumbing.ZeroHash; c = via[c] {
+				path = append([]plumbing.Hash{c}, path...)
+			}
+			return path, nil
+		}
+		var parents []plumbing.Hash
+		if ci, ok := g.commits[h]; ok {
+			parents = ci.Commit.ParentHashes
+		} else {
+			commit, err := g.repo.CommitObject(h)
+			if errors.Is(err, plumbing.ErrObjectNotFound) {
+				continue // Beyond a shallow boundary
+			}
+			if err != nil {
+				return nil, err
+			}
+			parents = commit.ParentHashes
+		}
+		for _, p := range parents {
+			if _, seen := via[p]; !seen {
+				via[p] = h
+				queue = append(queue, p)
+			}
+		}
+	}
+	return nil, nil
+}
+
+type containingTag struct {
+	Name string `json:"name"`
+	Hash string `json:"hash"` // The tagged commit
+	Date string `json:"date"`
+}
+
+// containingTagsHandler lists the tags whose history contains a commit,
+// earliest first, so the first entry is the release that shipped it.
+func containingTagsHandler(g *repoGraph) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		commit, err := resolveCommit(g.repo, r.URL.Query().Get("commit"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		descendants := map[plumbing.Hash]bool{commit.Hash: true}
+		for queue := []plumbing.Hash{commit.Hash}; len(queue) > 0; queue = queue[1:] {
+			if cs, ok := g.children[queue[0]]; ok {
+				for c := range cs.Iter() {
+					if !descendants[c] {
+						descendants[c] = true
+						queue = append(queue, c)
+					}
+				}
+			}
+		}
+
+		type found struct {
+			containingTag
+			when time.Time
+		}
+		var tags []found
+		for h, refs := range g.tags {
+			ci, ok := g.commits[h]
+			if !ok || !descendants[h] {
+				continue
+			}
+			for _, ref := range refs {
+				tags = append(tags, found{containingTag{
+					Name: ref.Name().Short(),
+					Hash: h.String(),
+					Date: ci.Commit.Committer.When.Format(time.RFC3339),
+				}, ci.Commit.Committer.When})
+			}
+		}
+		sort.Slice(tags, func(i, j int) bool {
+			if !tags[i].when.Equal(tags[j].when) {
+				return tags[i].when.Before(tags[j].when)
+			}
+			return tags[i].Name < tags[j].Name
+		})
+		out := make([]containingTag, len(tags))
+		for i, t := range tags {
+			out[i] = t.containingTag
+		}
+		writeJSON(w, out)
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"crypto/sha1"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/anton-dovnar/git-tree/structs"
+	"github.com/anton-dovnar/git-tree/view"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+type rebaseStep struct {
+	Commit   *object.Commit
+	Dropped  bool
+	Upstream plumbing.Hash // Upstream commit with the same patch ID, when dropped
+}
+
+type rebasePlan struct {
+	Base  plumbing.Hash
+	Steps []rebaseStep // Oldest first
+}
+
+// planRebase predicts what `git rebase upstream branch` does: every
+// non-merge commit of branch missing from upstream is replayed in
+// topological order, except those whose change upstream already contains.
+func planRebase(repo *git.Repository, branch, upstream *object.Commit) (*rebasePlan, error) {
+	bases, err := branch.MergeBase(upstream)
+	if err != nil {
+		return nil, fmt.Errorf("find merge base: %w", err)
+	}
+	if len(bases) == 0 {
+		return nil, fmt.Errorf("no common ancestor")
+	}
+
+	upstreamAll, err := reachable(repo, []plumbing.Hash{upstream.Hash}, nil)
+	if err != nil {
+		return nil, err
+	}
+	branchAll, err := reachable(repo, []plumbing.Hash{branch.Hash}, nil)
+	if err != nil {
+		return nil, err
+	}
+	branchOnly := branchAll.Difference(upstreamAll)
+	upstreamOnly := upstreamAll.Difference(branchAll)
+
+	upstreamIDs := make(map[plumbing.Hash]plumbing.Hash)
+	for h := range upstreamOnly.Iter() {
+		commit, err := repo.CommitObject(h)
+		if err != nil {
+			return nil, fmt.Errorf("read commit %s: %w", h, err)
+		}
+		if id, ok, err := patchID(commit); err != nil {
+			return nil, fmt.Errorf("patch ID of %s: %w", h, err)
+		} else if ok {
+			upstreamIDs[id] = h
+		}
+	}
+
+	plan := &rebasePlan{Base: bases[0].Hash}
+	ordered, err := topoOrder(repo, branch.Hash, branchOnly)
+	if err != nil {
+		return nil, err
+	}
+	for _, commit := range ordered {
+		if commit.NumParents() > 1 {
+			continue
+		}
+		step := rebaseStep{Commit: commit}
+		if id, ok, err := patchID(commit); err != nil {
+			return nil, fmt.Errorf("patch ID of %s: %w", commit.Hash, err)
+		} else if ok {
+			step.Upstream, step.Dropped = upstreamIDs[id]
+		}
+		plan.Steps = append(plan.Steps, step)
+	}
+	return plan, nil
+}
+
+// topoOrder lists the commits of set reachable from tip, parents first.
+func topoOrder(repo *git.Repository, tip plumbing.Hash, set mapset.Set[plumbing.Hash]) ([]*object.Commit, error) {
+	var out []*object.Commit
+	done := mapset.NewThreadUnsafeSet[plumbing.Hash]()
+	type frame struct {
+		commit *object.Commit
+		next   int
+	}
+	var stack []frame
+	push := func(h plumbing.Hash) error {
+		if !set.Contains(h) || done.Contains(h) {
+			return nil
+		}
+		commit, err := repo.CommitObject(h)
+		if err != nil {
+			return fmt.Errorf("read commit %s: %w", h, err)
+		}
+		done.Add(h)
+		stack = append(stack, frame{commit: commit})
+		return nil
+	}
+	if err := push(tip); err != nil {
+		return nil, err
+	}
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		if top.next < len(top.commit.ParentHashes) {
+			p := top.commit.ParentHashes[top.next]
+			top.next++
+			if err := push(p); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		out = append(out, top.commit)
+		stack = stack[:len(stack)-1]
+	}
+	return out, nil
+}
+
+func runRebasePreview(args []string) {
+	fs := flag.NewFlagSet("rebase-preview", flag.ExitOnError)
+	repoPath := fs.String("path", ".", "Path to Git repository (any subdirectory is OK)")
+	htmlOut := fs.String("html", "tree.html", "Generate HTML output file")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: git-tree rebase-preview [flags] <branch> <upstream>\n\nShow the current layout next to the one `git rebase <upstream> <branch>` would produce.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	branchName, upstreamName := fs.Arg(0), fs.Arg(1)
+
+	repo, err := git.PlainOpenWithOptions(*repoPath, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		fail(openRepoCode(err), err)
+	}
+	branch, err := resolveCommit(repo, branchName)
+	if err != nil {
+		fail(exitFailure, err)
+	}
+	upstream, err := resolveCommit(repo, upstreamName)
+	if err != nil {
+		fail(exitFailure, err)
+	}
+	plan, err := planRebase(repo, branch, upstream)
+	if err != nil {
+		fail(exitFailure, fmt.Errorf("Failed to plan rebase of %s onto %s: %w", branchName, upstreamName, err))
+	}
+
+	for _, step := range plan.Steps {
+		summary := strings.SplitN(step.Commit.Message, "\n", 2)[0]
+		if step.Dropped {
+			fmt.Printf("drop %s %s (already upstream as %s)\n", step.Commit.Hash.String()[:7], summary, step.Upstream.String()[:7])
+		} else {
+			fmt.Printf("pick %s %s\n", step.Commit.Hash.String()[:7], summary)
+		}
+	}
+
+	collected, _, err := collectCommits(repo, false)
+	if err != nil {
+		fail(exitFailure, fmt.Errorf("Failed to collect commits: %w", err))
+	}
+	heads, tags, err := getRefs(repo, false)
+	if err != nil {
+		fail(exitFailure, fmt.Errorf("Failed to collect refs: %w", err))
+	}
+
+	baseAncestors, err := reachable(repo, []plumbing.Hash{plan.Base}, nil)
+	if err != nil {
+		fail(exitFailure, err)
+	}
+	baseAncestors.Remove(plan.Base)
+	current, err := reachable(repo, []plumbing.Hash{branch.Hash, upstream.Hash}, baseAncestors)
+	if err != nil {
+		fail(exitFailure, err)
+	}
+	onto, err := reachable(repo, []plumbing.Hash{upstream.Hash}, baseAncestors)
+	if err != nil {
+		fail(exitFailure, err)
+	}
+
+	before := subsetCommits(repo, collected, current)
+	after := subsetCommits(repo, collected, onto)
+	for _, step := range plan.Steps {
+		if step.Dropped {
+			before[step.Commit.Hash].Badges = append(before[step.Commit.Hash].Badges, structs.Badge{
+				Text:   "✂ dropped",
+				Detail: fmt.Sprintf("Already in %s as %s", upstreamName, step.Upstream.String()[:7]),
+			})
+		}
+	}
+
+	branchRef := plumbing.NewBranchReferenceName(branchName)
+	if _, err := repo.Reference(branchRef, false); err != nil {
+		branchRef = plumbing.ReferenceName(branchName)
+	}
+	newTip := replaySteps(plan.Steps, upstream.Hash, collected, after)
+
+	afterHeads := onlyCommits(heads, after)
+	if newTip != upstream.Hash {
+		afterHeads[newTip] = append(afterHeads[newTip], plumbing.NewHashReference(branchRef, newTip))
+	}
+
+	ghSlug := getGitHubSlug(repo)
+	data := view.GenerateCommitData(before, ghSlug)
+	for h, d := range view.GenerateCommitData(after, ghSlug) {
+		data[h] = d
+	}
+
+	svgOpts := view.SVGOptions{Aliases: branchAliases(repo, heads)}
+	var svgs []string
+	// Both panes draw the commits they share, so their ids are prefixed
+	// to stay unique on the page.
+	for _, g := range []struct {
+		prefix  string
+		commits map[plumbing.Hash]*structs.CommitInfo
+		heads   map[plumbing.Hash][]*plumbing.Reference
+	}{{"before-", before, onlyCommits(heads, before)}, {"after-", after, afterHeads}} {
+		children := buildChildren(g.commits)
+		positions := arrangeCommits(g.commits, g.heads, children)
+		svgOpts.IDPrefix = g.prefix
+		svgString, err := view.GenerateSVGString(g.commits, positions, g.heads, onlyCommits(tags, g.commits), children, svgOpts)
+		if err != nil {
+			fail(exitFailure, fmt.Errorf("Failed to generate SVG: %w", err))
+		}
+		svgs = append(svgs, svgString)
+	}
+	content := view.SideBySide([]string{
+		"Current",
+		fmt.Sprintf("After rebasing %s onto %s", branchName, upstreamName),
+	}, svgs)
+
+	htmlFile, err := os.Create(*htmlOut)
+	if err != nil {
+		fail(exitWriteFailed, fmt.Errorf("Failed to create HTML file %s: %w", *htmlOut, err))
+	}
+	defer htmlFile.Close()
+	if err := view.WriteHTML(htmlFile, content, data, repoTitle(*repoPath), view.HTMLOptions{}); err != nil {
+		fail(exitWriteFailed, fmt.Errorf("Failed to write HTML: %w", err))
+	}
+	absPath, _ := filepath.Abs(*htmlOut)
+	log.Printf("✨ HTML generated: file://%s", absPath)
+}
+
+// subsetCommits copies the commits of set out of collected, reading the ones
+// the reflog walk did not reach directly from the repository.
+func subsetCommits(
+	repo *git.Repository,
+	collected map[plumbing.Hash]*structs.CommitInfo,
+	set mapset.Set[plumbing.Hash],
+) map[plumbing.Hash]*structs.CommitInfo {
+	out := make(map[plumbing.Hash]*structs.CommitInfo, set.Cardinality())
+	for h := range set.Iter() {
+		if ci, ok := collected[h]; ok {
+			copied := *ci
+			out[h] = &copied
+			continue
+		}
+		commit, err := repo.CommitObject(h)
+		if err != nil {
+			continue
+		}
+		out[h] = &structs.CommitInfo{Commit: commit, References: mapset.NewSet[string]()}
+	}
+	return out
+}
+
+// replaySteps adds a synthetic copy of every picked commit to commits,
+// chained onto onto, and returns the hash of the last one. The copies are
+// committed a second apart after the newest collected commit, so the
+// preview is the same on every run.
+func replaySteps(
+	steps []rebaseStep,
+	onto plumbing.Hash,
+	collected map[plumbing.Hash]*structs.CommitInfo,
+	commits map[plumbing.Hash]*structs.CommitInfo,
+) plumbing.Hash {
+	tip := onto
+	now := newestCommitTime(collected)
+	for i, step := range steps {
+		if step.Dropped {
+			continue
+		}
+		replayed := *step.Commit
+		replayed.Hash = plumbing.Hash(sha1.Sum([]byte("rebase\x00" + step.Commit.Hash.String() + tip.String())))
+		replayed.ParentHashes = []plumbing.Hash{tip}
+		replayed.Committer.When = now.Add(time.Duration(i+1) * time.Second)
+
+		refs := mapset.NewSet[string]()
+		if ci, ok := collected[step.Commit.Hash]; ok && ci.References != nil {
+			refs = ci.References.Clone()
+		}
+		commits[replayed.Hash] = &structs.CommitInfo{
+			Commit:     &replayed,
+			References: refs,
+			Badges: []structs.Badge{{
+				Text:   "rebased",
+				Detail: "Replayed from " + step.Commit.Hash.String()[:7],
+			}},
+		}
+		tip = replayed.Hash
+	}
+	return tip
+}
+
+// newestCommitTime is the latest committer date in commits, which synthetic
+// commits are dated after rather than at the wall clock.
+func newestCommitTime(commits map[plumbing.Hash]*structs.CommitInfo) time.Time {
+	var newest time.Time
+	for _, ci := range commits {
+		if ci != nil && ci.Commit != nil && ci.Commit.Committer.When.After(newest) {
+			newest = ci.Commit.Committer.When
+		}
+	}
+	return newest
+}
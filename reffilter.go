@@ -0,0 +1,59 @@
+package main
+
+import (
+	"regexp"
+
+	"github.com/anton-dovnar/git-tree/view"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// pullRequests is set by -pull-requests.
+var pullRequests bool
+
+// refIncludes and refExcludes are set by -ref-include and -ref-exclude.
+var refIncludes, refExcludes []*regexp.Regexp
+
+// addRefPattern parses a -ref-include or -ref-exclude flag value.
+func addRefPattern(patterns *[]*regexp.Regexp) func(string) error {
+	return func(expr string) error {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return err
+		}
+		*patterns = append(*patterns, re)
+		return nil
+	}
+}
+
+// refAllowed reports whether a ref is kept: it must match one of
+// -ref-include, when any is given, and none of -ref-exclude. Refs dropped
+// are left out as if they did not exist, so commits only they reach are
+// not drawn and their reflogs label nothing.
+func refAllowed(name plumbing.ReferenceName) bool {
+	matches := func(patterns []*regexp.Regexp) bool {
+		for _, re := range patterns {
+			if re.MatchString(name.String()) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(refIncludes) > 0 && !matches(refIncludes) {
+		return false
+	}
+	return !matches(refExcludes)
+}
+
+// countPullRequests counts the pull and merge request heads among heads.
+func countPullRequests(heads map[plumbing.Hash][]*plumbing.Reference) int {
+	n := 0
+	for _, refs := range heads {
+		for _, ref := range refs {
+			if view.IsPullRequest(ref.Name()) {
+				n++
+			}
+		}
+	}
+	return n
+}
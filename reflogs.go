@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Which reflogs label commits with the branches they were on, see
+// structs.CommitInfo.References.
+const (
+	reflogLabelsOff   = "off"   // None; rails take their colors from the refs at tips only
+	reflogLabelsHeads = "heads" // Local branches
+	reflogLabelsAll   = "all"   // Local branches, and with -all remote ones no local branch tracks
+)
+
+// reflogLabels is set by -reflog-labels.
+var reflogLabels = reflogLabelsAll
+
+// reflogMaxEntries is set by -reflog-max-entries.
+var reflogMaxEntries int
+
+// setReflogLabels parses the -reflog-labels flag value.
+func setReflogLabels(mode string) error {
+	switch mode {
+	case reflogLabelsOff, reflogLabelsHeads, reflogLabelsAll:
+		reflogLabels = mode
+	default:
+		return fmt.Errorf("unknown reflog labeling %q (want off, heads or all)", mode)
+	}
+	return nil
+}
+
+// usesRefLabels reports whether l places commits by the branches their
+// reflogs label them with.
+func usesRefLabels(l Layouter) bool {
+	switch l := l.(type) {
+	case heuristicLayout:
+		return true
+	case compactRows:
+		return usesRefLabels(l.Layouter)
+	case pinnedLanes:
+		return usesRefLabels(l.Layouter)
+	case bandedLanes:
+		return usesRefLabels(l.Layouter)
+	case foldedLanes:
+		return usesRefLabels(l.Layouter)
+	}
+	return false
+}
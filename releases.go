@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/anton-dovnar/git-tree/structs"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// parentsFirst orders commits so every commit comes after its parents.
+func parentsFirst(commits map[plumbing.Hash]*structs.CommitInfo) []plumbing.Hash {
+	hashes := make([]plumbing.Hash, 0, len(commits))
+	for h := range commits {
+		hashes = append(hashes, h)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i].String() < hashes[j].String() })
+
+	order := make([]plumbing.Hash, 0, len(commits))
+	done := make(map[plumbing.Hash]bool, len(commits))
+	type frame struct {
+		hash plumbing.Hash
+		next int
+	}
+	for _, start := range hashes {
+		if done[start] {
+			continue
+		}
+		done[start] = true
+		stack := []frame{{hash: start}}
+		for len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			parents := commits[top.hash].Commit.ParentHashes
+			if top.next < len(parents) {
+				p := parents[top.next]
+				top.next++
+				if _, ok := commits[p]; ok && !done[p] {
+					done[p] = true
+					stack = append(stack, frame{hash: p})
+				}
+				continue
+			}
+			order = append(order, top.hash)
+			stack = stack[:len(stack)-1]
+		}
+	}
+	return order
+}
+
+// releaseTrain reduces the graph to its tagged commits and the merges that
+// join separately released lines. Every kept commit hangs off the nearest
+// kept ancestors and lists the commits it is the first release of as its
+// collapsed commits, newest first.
+func releaseTrain(
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	tags map[plumbing.Hash][]*plumbing.Reference,
+) (map[plumbing.Hash]*structs.CommitInfo, map[plumbing.Hash]mapset.Set[plumbing.Hash]) {
+	tagged := func(h plumbing.Hash) bool { return len(tags[h]) > 0 }
+	return skeleton(commits, tagged, "%d commits since the previous release")
+}
+
+// skeleton reduces the graph to the commits fixed keeps and the merges that
+// join lines of them, as releaseTrain does for tags. Each kept commit is
+// badged with how many commits it folds in, described by detail.
+func skeleton(
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	fixed func(plumbing.Hash) bool,
+	detail string,
+) (map[plumbing.Hash]*structs.CommitInfo, map[plumbing.Hash]mapset.Set[plumbing.Hash]) {
+	order := parentsFirst(commits)
+
+	// near holds the nearest kept commits reachable from each commit, and
+	// below the kept commits reachable from each kept commit.
+	near := make(map[plumbing.Hash][]plumbing.Hash, len(commits))
+	below := make(map[plumbing.Hash]mapset.Set[plumbing.Hash])
+	reduce := func(candidates []plumbing.Hash) []plumbing.Hash {
+		var out []plumbing.Hash
+		seen := mapset.NewThreadUnsafeSet[plumbing.Hash]()
+		for _, c := range candidates {
+			if !seen.Add(c) {
+				continue
+			}
+			redundant := false
+			for _, other := range candidates {
+				if other != c && below[other].Contains(c) {
+					redundant = true
+					break
+				}
+			}
+			if !redundant {
+				out = append(out, c)
+			}
+		}
+		return out
+	}
+
+	parents := make(map[plumbing.Hash][]plumbing.Hash)
+	for _, h := range order {
+		var perParent [][]plumbing.Hash
+		var all []plumbing.Hash
+		for _, p := range commits[h].Commit.ParentHashes {
+			perParent = append(perParent, near[p])
+			all = append(all, near[p]...)
+		}
+		frontier := reduce(all)
+
+		keep := fixed(h)
+		if !keep && len(perParent) > 1 {
+			contributing := 0
+			for _, ps := range perParent {
+				for _, k := range ps {
+					if containsHash(frontier, k) {
+						contributing++
+						break
+					}
+				}
+			}
+			keep = contributing > 1
+		}
+		if !keep {
+			near[h] = frontier
+			continue
+		}
+
+		near[h] = []plumbing.Hash{h}
+		parents[h] = frontier
+		below[h] = mapset.NewThreadUnsafeSet[plumbing.Hash]()
+		for _, k := range frontier {
+			below[h].Add(k)
+			below[h] = below[h].Union(below[k])
+		}
+	}
+
+	out := make(map[plumbing.Hash]*structs.CommitInfo, len(parents))
+	claimed := mapset.NewThreadUnsafeSet[plumbing.Hash]()
+	for _, h := range order {
+		frontier, ok := parents[h]
+		if !ok {
+			continue
+		}
+		var folded []*object.Commit
+		pending := append([]plumbing.Hash(nil), commits[h].Commit.ParentHashes...)
+		for len(pending) > 0 {
+			c := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+			ci, ok := commits[c]
+			if !ok || below[c] != nil || !claimed.Add(c) {
+				continue
+			}
+			folded = append(folded, ci.Commit)
+			pending = append(pending, ci.Commit.ParentHashes...)
+		}
+		sort.Slice(folded, func(i, j int) bool {
+			if folded[i].Committer.When.Equal(folded[j].Committer.When) {
+				return folded[i].Hash.String() < folded[j].Hash.String()
+			}
+			return folded[i].Committer.When.After(folded[j].Committer.When)
+		})
+
+		rewritten := *commits[h].Commit
+		rewritten.ParentHashes = frontier
+		kept := *commits[h]
+		kept.Commit = &rewritten
+		kept.Collapsed = nil
+		if len(folded) > 0 {
+			kept.Collapsed = append([]*object.Commit{commits[h].Commit}, folded...)
+			kept.Badges = append(append([]structs.Badge(nil), kept.Badges...), structs.Badge{
+				Text:   fmt.Sprintf("+%d", len(folded)),
+				Detail: fmt.Sprintf(detail, len(folded)),
+			})
+		}
+		out[h] = &kept
+	}
+	return out, buildChildren(out)
+}
+
+func containsHash(hashes []plumbing.Hash, h plumbing.Hash) bool {
+	for _, x := range hashes {
+		if x == h {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// cloneRemote clones the repository at url into memory, for -url. A depth
+// above 0 makes the clone shallow and a branch limits it to that branch.
+// The remote's branches are fetched as local ones, so the graph reads as it
+// would in a fresh checkout, and HEAD follows the remote's when it can.
+func cloneRemote(url string, depth int, branch string) (*git.Repository, error) {
+	spec := config.RefSpec("+refs/heads/*:refs/heads/*")
+	if branch != "" {
+		spec = config.RefSpec(fmt.Sprintf("+refs/heads/%[1]s:refs/heads/%[1]s", branch))
+	}
+	repo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := repo.CreateRemote(&config.RemoteConfig{
+		Name:  git.DefaultRemoteName,
+		URLs:  []string{url},
+		Fetch: []config.RefSpec{spec},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Cloning %s into memory", url)
+	if err := remote.Fetch(&git.FetchOptions{Depth: depth, Tags: git.AllTags}); err != nil {
+		return nil, fmt.Errorf("clone %s: %w", url, err)
+	}
+
+	head := plumbing.NewBranchReferenceName(branch)
+	if branch == "" {
+		// Cloning does not insist the remote's HEAD exists, as git does not.
+		if refs, err := remote.List(&git.ListOptions{}); err == nil {
+			for _, ref := range refs {
+				if ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference {
+					head = ref.Target()
+				}
+			}
+		}
+	}
+	if _, err := repo.Reference(head, false); err == nil {
+		if err := repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, head)); err != nil {
+			return nil, err
+		}
+	}
+	return repo, nil
+}
+
+// remoteTitle names the repository at url after its last path element.
+func remoteTitle(url string) string {
+	return strings.TrimSuffix(repoTitle(strings.TrimSuffix(url, "/")), ".git")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/anton-dovnar/git-tree/structs"
+	"github.com/anton-dovnar/git-tree/view"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// ancestry returns the commits of collected reachable from tip, following
+// the parent links already in memory instead of reading the repository.
+func ancestry(
+	collected map[plumbing.Hash]*structs.CommitInfo,
+	tip plumbing.Hash,
+) map[plumbing.Hash]*structs.CommitInfo {
+	out := make(map[plumbing.Hash]*structs.CommitInfo)
+	pending := []plumbing.Hash{tip}
+	for len(pending) > 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		ci, ok := collected[h]
+		if _, seen := out[h]; seen || !ok {
+			continue
+		}
+		out[h] = ci
+		pending = append(pending, ci.Commit.ParentHashes...)
+	}
+	return out
+}
+
+func runRender(args []string) {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	repoPath := fs.String("path", ".", "Path to Git repository (any subdirectory is OK)")
+	all := fs.Bool("all", false, "Include remote refs")
+	perBranch := fs.String("per-branch", "", "Directory to write one SVG per branch to, named after the branch")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: git-tree render -per-branch <dir> [flags]\n\nWrite one SVG per branch showing the branch and the history it is based on.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *perBranch == "" || fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	repo, err := git.PlainOpenWithOptions(*repoPath, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		fail(openRepoCode(err), err)
+	}
+	collected, _, err := collectCommits(repo, *all)
+	if err != nil {
+		fail(exitFailure, fmt.Errorf("Failed to collect commits: %w", err))
+	}
+	if len(collected) == 0 {
+		fail(exitEmptyRepo, fmt.Errorf("no commits found in %s", *repoPath))
+	}
+	heads, tags, err := getRefs(repo, *all)
+	if err != nil {
+		fail(exitFailure, fmt.Errorf("Failed to collect refs: %w", err))
+	}
+	aliases := branchAliases(repo, heads)
+
+	var branches []*plumbing.Reference
+	for _, refs := range heads {
+		branches = append(branches, refs...)
+	}
+	sort.Slice(branches, func(i, j int) bool { return branches[i].Name() < branches[j].Name() })
+
+	for _, branch := range branches {
+		commits := ancestry(collected, branch.Hash())
+		if len(commits) == 0 {
+			log.Printf("Skipping %s: its commits were not collected", branch.Name().Short())
+			continue
+		}
+		children := buildChildren(commits)
+		branchHeads := onlyCommits(heads, commits)
+		positions := arrangeCommits(commits, branchHeads, children)
+		svgString, err := view.GenerateSVGString(commits, positions, branchHeads, onlyCommits(tags, commits),
+			children, view.SVGOptions{Aliases: aliases})
+		if err != nil {
+			fail(exitFailure, fmt.Errorf("Failed to generate SVG for %s: %w", branch.Name().Short(), err))
+		}
+
+		path := filepath.Join(*perBranch, filepath.FromSlash(branch.Name().Short())+".svg")
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			fail(exitWriteFailed, fmt.Errorf("Failed to create %s: %w", filepath.Dir(path), err))
+		}
+		if err := os.WriteFile(path, []byte(svgString), 0o644); err != nil {
+			fail(exitWriteFailed, fmt.Errorf("Failed to write %s: %w", path, err))
+		}
+		fmt.Println(path)
+	}
+}
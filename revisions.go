@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/anton-dovnar/git-tree/filter"
+	"github.com/anton-dovnar/git-tree/structs"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// revisionArgs is a selection in gitrevisions syntax given after the flags,
+// as in `git tree main..feature -- src/`.
+type revisionArgs struct {
+	include []plumbing.Hash
+	exclude []plumbing.Hash
+	paths   []string
+}
+
+// parseRevisionArgs resolves revisions and ranges ("A..B", "A...B", "A..",
+// "..B") up to an optional "--", after which every argument is a path.
+// "^A" excludes the commits reachable from A, and "--not" flips whether the
+// revisions after it are included or excluded, as in `git rev-list`.
+func parseRevisionArgs(repo *git.Repository, args []string) (*revisionArgs, error) {
+	sel := &revisionArgs{}
+	not := false
+	add := func(h plumbing.Hash, exclude bool) {
+		if exclude != not {
+			sel.exclude = append(sel.exclude, h)
+		} else {
+			sel.include = append(sel.include, h)
+		}
+	}
+	resolve := func(rev string) (*object.Commit, error) {
+		if rev == "" {
+			rev = "HEAD"
+		}
+		return resolveCommit(repo, rev)
+	}
+	for i, arg := range args {
+		if arg == "--" {
+			for _, path := range args[i+1:] {
+				sel.paths = append(sel.paths, repoRelativePath(repo, path))
+			}
+			break
+		}
+		if arg == "--not" {
+			not = !not
+			continue
+		}
+		if from, to, ok := strings.Cut(arg, "..."); ok {
+			a, err := resolve(from)
+			if err != nil {
+				return nil, err
+			}
+			b, err := resolve(to)
+			if err != nil {
+				return nil, err
+			}
+			bases, err := a.MergeBase(b)
+			if err != nil {
+				return nil, fmt.Errorf("merge base of %s: %w", arg, err)
+			}
+			add(a.Hash, false)
+			add(b.Hash, false)
+			for _, base := range bases {
+				add(base.Hash, true)
+			}
+			continue
+		}
+		if from, to, ok := strings.Cut(arg, ".."); ok {
+			a, err := resolve(from)
+			if err != nil {
+				return nil, err
+			}
+			b, err := resolve(to)
+			if err != nil {
+				return nil, err
+			}
+			add(a.Hash, true)
+			add(b.Hash, false)
+			continue
+		}
+		rev, exclude := strings.CutPrefix(arg, "^")
+		commit, err := resolve(rev)
+		if err != nil {
+			return nil, err
+		}
+		add(commit.Hash, exclude)
+	}
+	return sel, nil
+}
+
+// selectCommits narrows the collected graph to sel. Without included
+// revisions every collected commit is a candidate, so `--not main` alone
+// shows the work on all other branches that has not landed on main. With paths, only the commits changing one
+// of them are kept and parents are rewritten to the nearest kept ancestors,
+// like `git log -- <paths>`.
+func selectCommits(
+	repo *git.Repository,
+	collected map[plumbing.Hash]*structs.CommitInfo,
+	sel *revisionArgs,
+) (
+	map[plumbing.Hash]*structs.CommitInfo,
+	map[plumbing.Hash]mapset.Set[plumbing.Hash],
+	error,
+) {
+	excluded, err := reachable(repo, sel.exclude, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var set mapset.Set[plumbing.Hash]
+	if len(sel.include) > 0 {
+		if set, err = reachable(repo, sel.include, excluded); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		set = mapset.NewThreadUnsafeSet[plumbing.Hash]()
+		for h := range collected {
+			if !excluded.Contains(h) {
+				set.Add(h)
+			}
+		}
+	}
+	commits := subsetCommits(repo, collected, set)
+	if len(sel.paths) > 0 {
+		commits, children, err := filter.Apply(commits, filter.Paths(sel.paths...))
+		if err != nil {
+			return nil, nil, notFetched(err)
+		}
+		return commits, children, nil
+	}
+	return commits, buildChildren(commits), nil
+}
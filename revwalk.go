@@ -0,0 +1,107 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+
+	"github.com/anton-dovnar/git-tree/structs"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// reachable returns every commit reachable from tips without passing through
+// a commit in exclude, like `git rev-list tips --not exclude`.
+func reachable(
+	repo *git.Repository,
+	tips []plumbing.Hash,
+	exclude mapset.Set[plumbing.Hash],
+) (mapset.Set[plumbing.Hash], error) {
+	out := mapset.NewThreadUnsafeSet[plumbing.Hash]()
+	pending := append([]plumbing.Hash(nil), tips...)
+	for len(pending) > 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if out.Contains(h) || (exclude != nil && exclude.Contains(h)) {
+			continue
+		}
+		commit, err := repo.CommitObject(h)
+		if err != nil {
+			return nil, fmt.Errorf("read commit %s: %w", h, err)
+		}
+		out.Add(h)
+		pending = append(pending, commit.ParentHashes...)
+	}
+	return out, nil
+}
+
+// aheadBehind counts the commits reachable from local but not remote, and
+// from remote but not local, like `git rev-list --left-right --count
+// local...remote`. It walks newest first and stops once every commit left
+// to walk is reachable from both, so only the history since they forked is
+// read.
+func aheadBehind(repo *git.Repository, local, remote plumbing.Hash) (ahead, behind int, err error) {
+	const left, right, both = 1, 2, 3
+	loaded := make(map[plumbing.Hash]*structs.CommitInfo)
+	paint := make(map[plumbing.Hash]int)
+	queue := &commitHeap{commits: loaded, newest: true}
+	queued := make(map[plumbing.Hash]bool)
+	pending := 0 // Queued commits only one side reaches so far
+	visit := func(h plumbing.Hash, side int) error {
+		old := paint[h]
+		if old|side == old {
+			return nil
+		}
+		if old == 0 {
+			commit, err := repo.CommitObject(h)
+			if err != nil {
+				return fmt.Errorf("read commit %s: %w", h, err)
+			}
+			loaded[h] = &structs.CommitInfo{Commit: commit}
+		}
+		paint[h] = old | side
+		switch {
+		case !queued[h]:
+			// New, or walked already when clock skew put it before a child
+			queued[h] = true
+			heap.Push(queue, h)
+			if paint[h] != both {
+				pending++
+			}
+		case paint[h] == both:
+			pending-- // Reached from the other side too
+		}
+		return nil
+	}
+
+	if err := visit(local, left); err != nil {
+		return 0, 0, err
+	}
+	if err := visit(remote, right); err != nil {
+		return 0, 0, err
+	}
+	for pending > 0 {
+		h := heap.Pop(queue).(plumbing.Hash)
+		queued[h] = false
+		side := paint[h]
+		if side != both {
+			pending--
+		}
+		for _, p := range loaded[h].Commit.ParentHashes {
+			if err := visit(p, side); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+	for _, side := range paint {
+		switch side {
+		case left:
+			ahead++
+		case right:
+			behind++
+		}
+	}
+	return ahead, behind, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/anton-dovnar/git-tree/structs"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// sampleCommits thins the graph down to about limit nodes. Ref tips, tag
+// points, merges, forks and roots are always kept; inside linear runs only
+// every Nth commit is, and each kept commit lists the ones skipped below it
+// as collapsed commits. Graphs within limit are returned unchanged.
+func sampleCommits(
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	children map[plumbing.Hash]mapset.Set[plumbing.Hash],
+	heads, tags map[plumbing.Hash][]*plumbing.Reference,
+	limit int,
+) (map[plumbing.Hash]*structs.CommitInfo, map[plumbing.Hash]mapset.Set[plumbing.Hash]) {
+	if len(commits) <= limit {
+		return commits, children
+	}
+
+	linear := func(h plumbing.Hash) bool {
+		ci := commits[h]
+		if ci.Commit.NumParents() != 1 || len(heads[h]) > 0 || len(tags[h]) > 0 {
+			return false
+		}
+		if _, ok := commits[ci.Commit.ParentHashes[0]]; !ok {
+			return false
+		}
+		return children[h] != nil && children[h].Cardinality() == 1
+	}
+
+	order := parentsFirst(commits)
+	linearCount := 0
+	for _, h := range order {
+		if linear(h) {
+			linearCount++
+		}
+	}
+	var step int
+	if fixed := len(commits) - linearCount; fixed < limit {
+		step = (linearCount + limit - fixed - 1) / (limit - fixed)
+	} else {
+		step = linearCount + 1 // Even the fixed points exceed the limit; drop every linear commit
+	}
+	if step <= 1 {
+		return commits, children
+	}
+
+	dropped := make(map[plumbing.Hash]bool)
+	position := make(map[plumbing.Hash]int)
+	for _, h := range order {
+		if !linear(h) {
+			continue
+		}
+		position[h] = position[commits[h].Commit.ParentHashes[0]] + 1
+		if position[h]%step != 0 {
+			dropped[h] = true
+		}
+	}
+
+	out := make(map[plumbing.Hash]*structs.CommitInfo, len(commits)-len(dropped))
+	for h, ci := range commits {
+		if dropped[h] {
+			continue
+		}
+		var folded []*object.Commit
+		parents := make([]plumbing.Hash, len(ci.Commit.ParentHashes))
+		for i, p := range ci.Commit.ParentHashes {
+			for dropped[p] {
+				folded = append(folded, commits[p].Commit)
+				p = commits[p].Commit.ParentHashes[0]
+			}
+			parents[i] = p
+		}
+		if len(folded) == 0 {
+			out[h] = ci
+			continue
+		}
+		sort.Slice(folded, func(i, j int) bool {
+			if folded[i].Committer.When.Equal(folded[j].Committer.When) {
+				return folded[i].Hash.String() < folded[j].Hash.String()
+			}
+			return folded[i].Committer.When.After(folded[j].Committer.When)
+		})
+		rewritten := *ci.Commit
+		rewritten.ParentHashes = parents
+		sampled := *ci
+		sampled.Commit = &rewritten
+		sampled.Collapsed = append([]*object.Commit{ci.Commit}, folded...)
+		out[h] = &sampled
+	}
+	return out, buildChildren(out)
+}
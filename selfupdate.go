@@ -0,0 +1,249 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/semver"
+)
+
+const releasesURL = "https://api.github.com/repos/anton-dovnar/git-tree/releases/latest"
+
+type release struct {
+	TagName string         `json:"tag_name"`
+	Assets  []releaseAsset `json:"assets"`
+}
+
+type releaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// assetPrefix is the GoReleaser archive name for this platform, without its
+// extension, e.g. git-tree_Darwin_arm64.
+func assetPrefix() string {
+	arch := runtime.GOARCH
+	switch arch {
+	case "amd64":
+		arch = "x86_64"
+	case "386":
+		arch = "i386"
+	}
+	goos := runtime.GOOS
+	return "git-tree_" + strings.ToUpper(goos[:1]) + goos[1:] + "_" + arch
+}
+
+func (r *release) asset(match func(name string) bool) *releaseAsset {
+	for i := range r.Assets {
+		if match(r.Assets[i].Name) {
+			return &r.Assets[i]
+		}
+	}
+	return nil
+}
+
+var httpClient = &http.Client{Timeout: 60 * time.Second}
+
+func download(url string) ([]byte, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func latestRelease() (*release, error) {
+	data, err := download(releasesURL)
+	if err != nil {
+		return nil, err
+	}
+	var r release
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("decoding release: %w", err)
+	}
+	return &r, nil
+}
+
+// verifyChecksum checks archive against the release's checksums file. A
+// release without one is refused unless force is set.
+func verifyChecksum(r *release, name string, archive []byte, force bool) error {
+	sums := r.asset(func(n string) bool { return strings.HasSuffix(n, "checksums.txt") })
+	if sums == nil {
+		if force {
+			log.Printf("Release %s has no checksums file; installing %s unverified", r.TagName, name)
+			return nil
+		}
+		return fmt.Errorf("release %s has no checksums file; use -force to install it unverified", r.TagName)
+	}
+	data, err := download(sums.URL)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(archive)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[1] == name {
+			if fields[0] != hex.EncodeToString(sum[:]) {
+				return fmt.Errorf("checksum mismatch for %s", name)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not listed in %s", name, sums.Name)
+}
+
+// extractBinary pulls the git-tree executable out of a .zip or .tar.gz
+// release archive.
+func extractBinary(name string, archive []byte) ([]byte, error) {
+	binary := "git-tree"
+	if runtime.GOOS == "windows" {
+		binary += ".exe"
+	}
+	if strings.HasSuffix(name, ".zip") {
+		zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range zr.File {
+			if filepath.Base(f.Name) != binary {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			return io.ReadAll(rc)
+		}
+		return nil, fmt.Errorf("%s not found in %s", binary, name)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in %s", binary, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if filepath.Base(hdr.Name) == binary {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+// replaceExecutable swaps the running binary for data by renaming a
+// temporary file over it, so a failed write leaves the old binary intact.
+func replaceExecutable(data []byte) (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".git-tree-update-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return "", err
+	}
+	return exe, os.Rename(tmp.Name(), exe)
+}
+
+// newerRelease reports whether the release tagged tag is strictly newer than
+// the running version, by semantic versioning. Builds whose version is not
+// one, like dev builds, are taken to be newer than any release.
+func newerRelease(tag, running string) bool {
+	canon := func(v string) string { return "v" + strings.TrimPrefix(v, "v") }
+	tag, running = canon(tag), canon(running)
+	if !semver.IsValid(running) {
+		return false
+	}
+	return semver.IsValid(tag) && semver.Compare(tag, running) > 0
+}
+
+func runSelfUpdate(args []string) {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	check := fs.Bool("check", false, "Only report whether a newer release exists")
+	force := fs.Bool("force", false, "Install the latest release even if it is not newer than this build, or has no checksums to verify it against")
+	fs.Parse(args)
+
+	if exe, err := os.Executable(); err == nil && strings.Contains(exe, "/Cellar/") {
+		fail(exitFailure, errors.New("git-tree was installed with Homebrew; run `brew upgrade git-tree` instead"))
+	}
+
+	r, err := latestRelease()
+	if err != nil {
+		fail(exitFailure, fmt.Errorf("Failed to check for releases: %w", err))
+	}
+	latest := strings.TrimPrefix(r.TagName, "v")
+	if !newerRelease(r.TagName, version) && !*force {
+		fmt.Printf("git-tree %s is up to date (latest release %s; -force installs it anyway)\n", version, latest)
+		return
+	}
+	if *check {
+		fmt.Printf("git-tree %s is available (running %s)\n", latest, version)
+		return
+	}
+
+	prefix := assetPrefix()
+	asset := r.asset(func(n string) bool {
+		return n == prefix+".zip" || n == prefix+".tar.gz"
+	})
+	if asset == nil {
+		fail(exitFailure, fmt.Errorf("Release %s has no archive for %s/%s", r.TagName, runtime.GOOS, runtime.GOARCH))
+	}
+	archive, err := download(asset.URL)
+	if err != nil {
+		fail(exitFailure, fmt.Errorf("Failed to download %s: %w", asset.Name, err))
+	}
+	if err := verifyChecksum(r, asset.Name, archive, *force); err != nil {
+		fail(exitFailure, fmt.Errorf("Failed to verify %s: %w", asset.Name, err))
+	}
+	binary, err := extractBinary(asset.Name, archive)
+	if err != nil {
+		fail(exitFailure, fmt.Errorf("Failed to extract %s: %w", asset.Name, err))
+	}
+	exe, err := replaceExecutable(binary)
+	if err != nil {
+		fail(exitWriteFailed, fmt.Errorf("Failed to replace the executable: %w", err))
+	}
+	log.Printf("⬆️  Updated %s to %s", exe, latest)
+}
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestNewerRelease(t *testing.T) {
+	for _, c := range []struct {
+		tag, running string
+		want         bool
+	}{
+		{"v1.2.0", "1.1.9", true},
+		{"v1.2.0", "v1.2.0", false},
+		{"v1.2.0", "1.3.0", false},      // Newer than the latest release
+		{"v1.2.0", "1.2.0-rc.1", true},  // Pre-release of the latest
+		{"v1.2.0", "1.3.0-rc.1", false}, // Pre-release past the latest
+		{"v1.10.0", "1.9.0", true},      // Not compared as strings
+		{"v1.2.0", "dev", false},        // Development build
+		{"nightly", "1.2.0", false},     // Not a release version
+	} {
+		if got := newerRelease(c.tag, c.running); got != c.want {
+			t.Errorf("newerRelease(%q, %q) = %v, want %v", c.tag, c.running, got, c.want)
+		}
+	}
+}
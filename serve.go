@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/anton-dovnar/git-tree/structs"
+	"github.com/anton-dovnar/git-tree/view"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+type blameHunk struct {
+	Hash   string   `json:"hash"`
+	Author string   `json:"author"`
+	Date   string   `json:"date"`
+	Start  int      `json:"start"` // 1-based number of the hunk's first line
+	Lines  []string `json:"lines"`
+}
+
+// repoGraph is the collected history a server answers questions about.
+type repoGraph struct {
+	repo     *git.Repository
+	commits  map[plumbing.Hash]*structs.CommitInfo
+	children map[plumbing.Hash]mapset.Set[plumbing.Hash]
+	heads    map[plumbing.Hash][]*plumbing.Reference
+	tags     map[plumbing.Hash][]*plumbing.Reference
+	svgOpts  view.SVGOptions
+	layouter Layouter // The one the page was drawn with, lane pins and all
+}
+
+// serveConfig is what serve needs to collect and render the repository,
+// kept so a webhook can have it done again after a fetch.
+type serveConfig struct {
+	repoPath   string
+	all        bool
+	diffstat   bool
+	extraCSS   string
+	extraJS    string
+	staleAfter time.Duration
+}
+
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	repoPath := fs.String("path", ".", "Path to Git repository (any subdirectory is OK)")
+	var repos []servedRepo
+	fs.Func("repo", "Serve the repository at `name=path` under /r/<name>/, with an index of them on /; repeatable, replaces -path", addServedRepo(&repos))
+	reposFile := fs.String("repos", "", "File listing repositories to serve as with -repo, one name=path per line")
+	all := fs.Bool("all", false, "Include remote refs")
+	addr := fs.String("addr", "localhost:8080", "Address to listen on")
+	diffstat := fs.Bool("diffstat", false, "Compute and show lines added/removed per commit (slow on large repos)")
+	extraCSS := fs.String("extra-css", "", "CSS file whose contents are appended to the page's styles")
+	extraJS := fs.String("extra-js", "", "JavaScript file whose contents are appended to the page's scripts")
+	staleAfter := fs.Duration("stale-after", 90*24*time.Hour, "Age of a branch tip after which /metrics counts the branch as stale")
+	hookSecret := fs.String("hook-secret", os.Getenv("GIT_TREE_HOOK_SECRET"),
+		"Secret for /hooks/github and /hooks/refresh, which fetch and re-render; the hooks are off without one\n"+
+			"(default $GIT_TREE_HOOK_SECRET)")
+	basicAuth := fs.String("basic-auth", os.Getenv("GIT_TREE_BASIC_AUTH"),
+		"Require HTTP basic auth with `user:password` (default $GIT_TREE_BASIC_AUTH)")
+	authHeader := fs.String("auth-header", "",
+		"Require this request header, e.g. X-Forwarded-User from an OIDC proxy; only safe when the proxy is the sole way in")
+	fs.Parse(args)
+	var auth serveAuth
+	if *basicAuth != "" {
+		var ok bool
+		if auth.user, auth.password, ok = parseBasicAuth(*basicAuth); !ok {
+			fmt.Fprintf(fs.Output(), "-basic-auth must be user:password\n")
+			os.Exit(2)
+		}
+	}
+	auth.header = *authHeader
+	if *reposFile != "" {
+		if err := readServedRepos(*reposFile, &repos); err != nil {
+			fail(exitFailure, fmt.Errorf("Failed to read repositories: %w", err))
+		}
+	}
+
+	handler := func(path string) http.Handler {
+		cfg := serveConfig{
+			repoPath:   path,
+			all:        *all,
+			diffstat:   *diffstat,
+			extraCSS:   *extraCSS,
+			extraJS:    *extraJS,
+			staleAfter: *staleAfter,
+		}
+		mux, err := cfg.build()
+		if err != nil {
+			fail(exitFailure, err)
+		}
+		if *hookSecret != "" {
+			return newHookServer(cfg, *hookSecret, mux)
+		}
+		return mux
+	}
+	var root http.Handler
+	if len(repos) == 0 {
+		root = handler(*repoPath)
+	} else {
+		handlers := make([]http.Handler, len(repos))
+		for i, r := range repos {
+			log.Printf("📂 Loading %s from %s", r.name, r.path)
+			handlers[i] = handler(r.path)
+		}
+		root = repoIndex(repos, handlers)
+	}
+
+	log.Printf("🌐 Serving on http://%s", *addr)
+	fail(exitFailure, http.ListenAndServe(*addr, auth.guard(root)))
+}
+
+// buildMu serialises builds, which swap the package's layout for the one
+// with the repository's lane pins.
+var buildMu sync.Mutex
+
+// build collects the history and renders the page, returning the routes
+// that serve it.
+func (c serveConfig) build() (*http.ServeMux, error) {
+	repo, err := git.PlainOpenWithOptions(c.repoPath, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, err
+	}
+	notePartialClone(repo)
+	buildMu.Lock()
+	defer buildMu.Unlock()
+	if pins := lanePins(repo); len(pins) > 0 {
+		defer func(base Layouter) { layouter = base }(layouter)
+		layouter = pinnedLanes{layouter, pins}
+	}
+
+	commits, children, err := collectCommits(repo, c.all)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Collected %d commits", len(commits))
+	if c.diffstat {
+		addDiffstats(commits)
+	}
+	heads, tags, err := getRefs(repo, c.all)
+	if err != nil {
+		return nil, err
+	}
+
+	var page bytes.Buffer
+	opts := extraHTMLOptions(c.extraCSS, c.extraJS)
+	opts.Serve = true
+	opts.Warnings = warnings.all()
+	defer warnings.summarize()
+	svgOpts := view.SVGOptions{Aliases: branchAliases(repo, heads)}
+	if !c.all {
+		svgOpts.Upstreams = markUpstreams(repo, commits, trackedUpstreams(repo), nil)
+	}
+	markFoxtrots(repo, commits, trackedUpstreams(repo), nil)
+	started := time.Now()
+	if _, err := renderGraph(&page, repo, repoTitle(c.repoPath), commits, children, heads, tags, opts, svgOpts); err != nil {
+		return nil, err
+	}
+	rendered := time.Since(started)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(page.Bytes())
+	})
+	mux.HandleFunc("GET /api/blame", blameHandler(repo))
+	mux.HandleFunc("GET /api/tree", treeHandler(repo))
+	g := &repoGraph{repo: repo, commits: commits, children: children, heads: heads, tags: tags, svgOpts: svgOpts, layouter: layouter}
+	mux.HandleFunc("GET /api/refs", refsHandler(g))
+	mux.HandleFunc("GET /api/simulate", simulateHandler(g))
+	mux.HandleFunc("GET /api/reachable", reachableHandler(g))
+	mux.HandleFunc("GET /api/tags", containingTagsHandler(g))
+	metrics := collectMetrics(g, c.staleAfter)
+	metrics.renderTime = rendered
+	mux.HandleFunc("GET /metrics", metricsHandler(metrics))
+	return mux, nil
+}
+
+// resolveCommit accepts anything git understands as a revision: a full or
+// abbreviated hash, a branch or tag name, or an expression like HEAD~2.
+func resolveCommit(repo *git.Repository, rev string) (*object.Commit, error) {
+	if rev == "" {
+		return nil, fmt.Errorf("missing commit")
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s: %w", rev, err)
+	}
+	return repo.CommitObject(*hash)
+}
+
+func blameHandler(repo *git.Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		commit, err := resolveCommit(repo, r.URL.Query().Get("commit"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		path := r.URL.Query().Get("file")
+		if path == "" {
+			http.Error(w, "missing file", http.StatusBadRequest)
+			return
+		}
+
+		result, err := git.Blame(commit, path)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("blame %s: %v", path, notFetched(err)), http.StatusNotFound)
+			return
+		}
+
+		var hunks []blameHunk
+		for i, line := range result.Lines {
+			if n := len(hunks); n > 0 && hunks[n-1].Hash == line.Hash.String() {
+				hunks[n-1].Lines = append(hunks[n-1].Lines, line.Text)
+				continue
+			}
+			hunks = append(hunks, blameHunk{
+				Hash:   line.Hash.String(),
+				Author: line.AuthorName,
+				Date:   line.Date.Format(time.RFC3339),
+				Start:  i + 1,
+				Lines:  []string{line.Text},
+			})
+		}
+		writeJSON(w, hunks)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/anton-dovnar/git-tree/structs"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// authorSessions folds runs of consecutive commits by one author, each
+// authored within window of the one before, into the newest commit of the
+// run. It lists the rest as its collapsed commits and is badged with the
+// count. Commits a ref points at, and ones where history forks or joins,
+// are never folded away.
+func authorSessions(
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	children map[plumbing.Hash]mapset.Set[plumbing.Hash],
+	heads, tags map[plumbing.Hash][]*plumbing.Reference,
+	window time.Duration,
+) (map[plumbing.Hash]*structs.CommitInfo, map[plumbing.Hash]mapset.Set[plumbing.Hash]) {
+	// joins reports whether h continues the session of its only parent.
+	joins := func(h plumbing.Hash) bool {
+		c := commits[h].Commit
+		if c.NumParents() != 1 {
+			return false
+		}
+		p := c.ParentHashes[0]
+		parent, ok := commits[p]
+		if !ok || len(heads[p]) > 0 || len(tags[p]) > 0 || children[p].Cardinality() != 1 {
+			return false
+		}
+		gap := c.Author.When.Sub(parent.Commit.Author.When)
+		return strings.EqualFold(c.Author.Email, parent.Commit.Author.Email) && gap >= -window && gap <= window
+	}
+
+	// A commit is folded into its only child when that child joins it.
+	folded := make(map[plumbing.Hash]bool)
+	for h := range commits {
+		if joins(h) {
+			folded[commits[h].Commit.ParentHashes[0]] = true
+		}
+	}
+	if len(folded) == 0 {
+		return commits, children
+	}
+
+	out := make(map[plumbing.Hash]*structs.CommitInfo, len(commits)-len(folded))
+	for h, ci := range commits {
+		if folded[h] {
+			continue
+		}
+		if !joins(h) {
+			out[h] = ci
+			continue
+		}
+		session := []*object.Commit{ci.Commit}
+		oldest := ci.Commit
+		for {
+			oldest = commits[oldest.ParentHashes[0]].Commit
+			session = append(session, oldest)
+			if !joins(oldest.Hash) {
+				break
+			}
+		}
+		rewritten := *ci.Commit
+		rewritten.ParentHashes = oldest.ParentHashes
+		grouped := *ci
+		grouped.Commit = &rewritten
+		grouped.Collapsed = session
+		grouped.Badges = append(append([]structs.Badge(nil), ci.Badges...), structs.Badge{
+			Text: fmt.Sprintf("×%d", len(session)),
+			Detail: fmt.Sprintf("%d commits by %s, each within %s of the last, from %s to %s",
+				len(session), ci.Commit.Author.Name, window,
+				oldest.Author.When.Format(time.DateTime), ci.Commit.Author.When.Format(time.DateTime)),
+		})
+		out[h] = &grouped
+	}
+	return out, buildChildren(out)
+}
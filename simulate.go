@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"maps"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/anton-dovnar/git-tree/structs"
+	"github.com/anton-dovnar/git-tree/view"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+type simulation struct {
+	Caption string                     `json:"caption"`
+	SVG     string                     `json:"svg"`
+	Data    map[string]view.CommitData `json:"data"`
+}
+
+func refsHandler(g *repoGraph) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		names := []string{}
+		for _, refs := range g.heads {
+			for _, ref := range refs {
+				names = append(names, ref.Name().Short())
+			}
+		}
+		sort.Strings(names)
+		writeJSON(w, names)
+	}
+}
+
+// simulateHandler renders the graph as it would look after merging or
+// rebasing one branch onto another. Nothing is written to the repository:
+// the resulting commits only exist in the returned preview.
+func simulateHandler(g *repoGraph) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		op, sourceName, targetName := q.Get("op"), q.Get("source"), q.Get("target")
+		source, err := resolveCommit(g.repo, sourceName)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		target, err := resolveCommit(g.repo, targetName)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		commits := maps.Clone(g.commits)
+		var caption string
+		var heads map[plumbing.Hash][]*plumbing.Reference
+		switch op {
+		case "merge":
+			// Like git, make no merge commit when there is nothing to merge
+			// or target can fast-forward.
+			upToDate, err := source.IsAncestor(target)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			fastForward, err := target.IsAncestor(source)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			switch {
+			case upToDate:
+				caption = fmt.Sprintf("%s is already up to date with %s: merging changes nothing", targetName, sourceName)
+				heads = g.heads
+			case fastForward:
+				caption = fmt.Sprintf("What if %s is merged into %s: a fast-forward of %s to %s", sourceName, targetName, targetName, sourceName)
+				heads = moveHead(g.heads, targetName, source.Hash)
+			default:
+				caption = fmt.Sprintf("What if %s is merged into %s", sourceName, targetName)
+				merge := simulatedMerge(g.commits, source, target, sourceName, targetName)
+				commits[merge.Commit.Hash] = merge
+				heads = moveHead(g.heads, targetName, merge.Commit.Hash)
+			}
+		case "rebase":
+			caption = fmt.Sprintf("What if %s is rebased onto %s", sourceName, targetName)
+			plan, err := planRebase(g.repo, source, target)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+				return
+			}
+			tip := replaySteps(plan.Steps, target.Hash, g.commits, commits)
+			heads = moveHead(g.heads, sourceName, tip)
+		default:
+			http.Error(w, "op must be merge or rebase", http.StatusBadRequest)
+			return
+		}
+
+		children := buildChildren(commits)
+		// Arranged like the page, so the preview lines up with it.
+		positions, err := g.layouter.Arrange(r.Context(), Graph{Commits: commits, Children: children, Heads: heads})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		svgString, err := view.GenerateSVGString(commits, positions, heads, g.tags, children, g.svgOpts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, simulation{
+			Caption: caption,
+			SVG:     svgString,
+			Data:    view.GenerateCommitData(commits, getGitHubSlug(g.repo)),
+		})
+	}
+}
+
+// simulatedMerge builds the merge commit `git merge source` would create on
+// target, taking over target's branch labels. Neither may be an ancestor of
+// the other, or git would make no merge commit. It is dated a second after
+// the newer of the two, so the preview is the same on every run.
+func simulatedMerge(
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	source, target *object.Commit,
+	sourceName, targetName string,
+) *structs.CommitInfo {
+	now := target.Committer.When
+	if source.Committer.When.After(now) {
+		now = source.Committer.When
+	}
+	now = now.Add(time.Second)
+	merge := &object.Commit{
+		Hash:         plumbing.Hash(sha1.Sum([]byte("merge\x00" + target.Hash.String() + source.Hash.String()))),
+		Author:       object.Signature{Name: "what-if", When: now},
+		Committer:    object.Signature{Name: "what-if", When: now},
+		Message:      fmt.Sprintf("Merge branch '%s' into %s", sourceName, targetName),
+		TreeHash:     target.TreeHash,
+		ParentHashes: []plumbing.Hash{target.Hash, source.Hash},
+	}
+	info := &structs.CommitInfo{
+		Commit: merge,
+		Badges: []structs.Badge{{Text: "what-if", Detail: "Simulated merge, not in the repository"}},
+	}
+	if ci, ok := commits[target.Hash]; ok && ci.References != nil {
+		info.References = ci.References.Clone()
+	} else {
+		info.References = mapset.NewSet[string]()
+	}
+	return info
+}
+
+// moveHead returns a copy of heads with the branch called name pointing at to.
+func moveHead(
+	heads map[plumbing.Hash][]*plumbing.Reference,
+	name string,
+	to plumbing.Hash,
+) map[plumbing.Hash][]*plumbing.Reference {
+	out := make(map[plumbing.Hash][]*plumbing.Reference, len(heads)+1)
+	for h, refs := range heads {
+		for _, ref := range refs {
+			if ref.Name().Short() == name {
+				out[to] = append(out[to], plumbing.NewHashReference(ref.Name(), to))
+				continue
+			}
+			out[h] = append(out[h], ref)
+		}
+	}
+	return out
+}
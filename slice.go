@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/anton-dovnar/git-tree/view"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// parseRows parses -rows: "from..to", rows counted from the newest commit
+// at 0, to excluded.
+func parseRows(s string) (*view.RowRange, error) {
+	from, to, ok := strings.Cut(s, "..")
+	if !ok {
+		return nil, fmt.Errorf("want from..to, e.g. 0..500")
+	}
+	var r view.RowRange
+	var err error
+	if r.From, err = strconv.Atoi(from); err != nil {
+		return nil, fmt.Errorf("bad first row %q", from)
+	}
+	if r.To, err = strconv.Atoi(to); err != nil {
+		return nil, fmt.Errorf("bad last row %q", to)
+	}
+	if r.From < 0 || r.To <= r.From {
+		return nil, fmt.Errorf("%s is an empty range", s)
+	}
+	return &r, nil
+}
+
+// pageRows is the RowRange of the 1-based -page.
+func pageRows(page, size int) (*view.RowRange, error) {
+	if page < 1 || size < 1 {
+		return nil, fmt.Errorf("-page and -page-size count from 1")
+	}
+	return &view.RowRange{From: (page - 1) * size, To: page * size}, nil
+}
+
+// sliceRows keeps the positions of the rows in r, renumbered from the
+// oldest row of the slice as view.DrawRailway draws them, so that an image
+// map of the slice matches its drawing.
+func sliceRows(positions map[plumbing.Hash][2]int, r *view.RowRange) (map[plumbing.Hash][2]int, error) {
+	maxY := 0
+	for _, pos := range positions {
+		maxY = max(maxY, pos[1])
+	}
+	if r.From > maxY {
+		return nil, fmt.Errorf("rows %d..%d are past the last row, %d", r.From, r.To, maxY)
+	}
+	lo, hi := max(maxY-r.To+1, 0), maxY-r.From
+	sliced := make(map[plumbing.Hash][2]int, hi-lo+1)
+	for h, pos := range positions {
+		if pos[1] >= lo && pos[1] <= hi {
+			sliced[h] = [2]int{pos[0], pos[1] - lo}
+		}
+	}
+	return sliced, nil
+}
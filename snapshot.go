@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/anton-dovnar/git-tree/structs"
+	"github.com/anton-dovnar/git-tree/view"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// staleLock is how old a snapshot lock must be before it is taken to be
+// left behind by a run that died, rather than held by one still going. A
+// run holding the lock touches it every staleLock/4, however long it takes.
+const staleLock = 10 * time.Minute
+
+// runSnapshot regenerates the HTML and JSON artifacts of a repository into
+// a directory, for post-commit and post-merge hooks: nothing is printed
+// unless it fails, the commit graph is cached between runs, and a run that
+// finds another one in progress leaves the work to it, asking it to go over
+// the repository again once it is done.
+func runSnapshot(args []string) {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	repoPath := fs.String("path", ".", "Path to Git repository (any subdirectory is OK)")
+	all := fs.Bool("all", false, "Include remote refs")
+	out := fs.String("out", "", "Directory to write the artifacts to (default .git/git-tree/snapshot)")
+	formats := fs.String("formats", "html,json", "Comma-separated artifacts to write: html (tree.html) and json (tree.json layout)")
+	fs.BoolVar(&cacheGraph, "cache", true, "Keep the collected commit graph in .git/git-tree/graph.gob and reuse it until a ref or HEAD moves")
+	verbose := fs.Bool("verbose", false, "Log progress like the default command does")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: git-tree snapshot [flags]\n\nQuietly regenerate tree.html and tree.json, e.g. from a post-commit hook:\n\n    git tree snapshot -out docs/graph &\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var html, layoutJSON bool
+	for _, f := range strings.Split(*formats, ",") {
+		switch strings.TrimSpace(f) {
+		case "html":
+			html = true
+		case "json":
+			layoutJSON = true
+		default:
+			fmt.Fprintf(fs.Output(), "unknown artifact %q (want html or json)\n", f)
+			os.Exit(2)
+		}
+	}
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+	// Failures are reported even when quiet.
+	failLoud := func(code int, err error) {
+		log.SetOutput(os.Stderr)
+		fail(code, err)
+	}
+
+	repo, err := git.PlainOpenWithOptions(*repoPath, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		failLoud(openRepoCode(err), err)
+	}
+	if *out == "" {
+		gitDir, err := structs.ResolveGitDir(*repoPath)
+		if err != nil {
+			failLoud(exitFailure, err)
+		}
+		*out = filepath.Join(gitDir, "git-tree", "snapshot")
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		failLoud(exitWriteFailed, fmt.Errorf("Failed to create %s: %w", *out, err))
+	}
+	lock, rerun := filepath.Join(*out, ".lock"), filepath.Join(*out, ".rerun")
+	unlock, err := lockSnapshot(lock)
+	if errors.Is(err, os.ErrExist) {
+		// The run in progress may have collected the commits before the
+		// newest one landed: ask it for another pass, unless it finished
+		// in the meantime and this run can take over.
+		if err := os.WriteFile(rerun, nil, 0o644); err != nil {
+			failLoud(exitWriteFailed, fmt.Errorf("Failed to mark %s for another run: %w", *out, err))
+		}
+		if unlock, err = lockSnapshot(lock); err != nil {
+			log.Printf("Another snapshot of %s is in progress; it will run again", *out)
+			return
+		}
+	} else if err != nil {
+		failLoud(exitWriteFailed, fmt.Errorf("Failed to lock %s: %w", *out, err))
+	}
+
+	for pass := 0; ; pass++ {
+		os.Remove(rerun)
+		// A fresh repository sees the packs written since the last pass,
+		// which the storer's caches would miss.
+		if pass > 0 {
+			if repo, err = git.PlainOpenWithOptions(*repoPath, &git.PlainOpenOptions{DetectDotGit: true}); err != nil {
+				unlock()
+				failLoud(openRepoCode(err), err)
+			}
+		}
+		if code, err := writeSnapshot(repo, *repoPath, *all, *out, html, layoutJSON); err != nil {
+			unlock()
+			failLoud(code, err)
+		}
+		if _, err := os.Stat(rerun); err == nil {
+			log.Printf("Commits landed during the snapshot; running again")
+			continue
+		}
+		unlock()
+		// A run may have asked for another pass just before the lock was
+		// released.
+		if _, err := os.Stat(rerun); err != nil {
+			break
+		}
+		if unlock, err = lockSnapshot(lock); err != nil {
+			break
+		}
+	}
+	log.Printf("✨ Snapshot written to %s", *out)
+}
+
+// writeSnapshot collects the graph of repo and writes the artifacts asked
+// for to out, returning the exit code to fail with on error.
+func writeSnapshot(repo *git.Repository, repoPath string, all bool, out string, html, layoutJSON bool) (int, error) {
+	commits, children, err := collectCommits(repo, all)
+	if err != nil {
+		return exitFailure, fmt.Errorf("Failed to collect commits: %w", err)
+	}
+	if len(commits) == 0 {
+		return exitEmptyRepo, fmt.Errorf("no commits found in %s", repoPath)
+	}
+	heads, tags, err := getRefs(repo, all)
+	if err != nil {
+		return exitFailure, fmt.Errorf("Failed to collect refs: %w", err)
+	}
+	title := repoTitle(repoPath)
+
+	// Artifacts are written aside and renamed into place, so pages serving
+	// them never see half of one.
+	write := func(name string, render func(io.Writer) error) error {
+		var buf bytes.Buffer
+		if err := render(&buf); err != nil {
+			return err
+		}
+		path := filepath.Join(out, name)
+		if err := os.WriteFile(path+".tmp", buf.Bytes(), 0o644); err != nil {
+			return err
+		}
+		return os.Rename(path+".tmp", path)
+	}
+	if html {
+		err = write("tree.html", func(w io.Writer) error {
+			opts := view.HTMLOptions{Trees: collectTrees(repo, commits, browseTreeLimit)}
+			_, err := renderGraph(w, repo, title, commits, children, heads, tags, opts,
+				view.SVGOptions{Aliases: branchAliases(repo, heads)})
+			return err
+		})
+	}
+	if err == nil && layoutJSON {
+		err = write("tree.json", func(w io.Writer) error {
+			positions, err := layouter.Arrange(context.Background(), Graph{Commits: commits, Children: children, Heads: heads})
+			if err != nil {
+				return fmt.Errorf("failed to arrange commits: %w", err)
+			}
+			g := view.Graph{Commits: commits, Children: children, Heads: heads, Tags: tags}
+			return view.LayoutRenderer{GitHubSlug: getGitHubSlug(repo)}.Render(context.Background(), g, positions, w)
+		})
+	}
+	if err != nil {
+		return exitWriteFailed, fmt.Errorf("Failed to write the snapshot to %s: %w", out, err)
+	}
+	return 0, nil
+}
+
+// lockSnapshot takes the lock file at path, failing with os.ErrExist while
+// another run holds it. A lock older than staleLock is taken over, so the
+// lock is kept fresh until unlock.
+func lockSnapshot(path string) (unlock func(), err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		if info, serr := os.Stat(path); serr == nil && time.Since(info.ModTime()) > staleLock {
+			os.Remove(path)
+			f, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(f, os.Getpid())
+	f.Close()
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(staleLock / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				os.Chtimes(path, now, now)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		os.Remove(path)
+	}, nil
+}
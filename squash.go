@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/anton-dovnar/git-tree/structs"
+	"github.com/anton-dovnar/git-tree/view"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// correlateSquashes finds branches that landed on the trunk as a single
+// squashed commit: the combined change from a branch's fork point to its tip
+// has the same patch ID as a trunk commit made after the fork. Both ends are
+// badged, and the returned links let the renderer connect them.
+func correlateSquashes(
+	repo *git.Repository,
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	heads map[plumbing.Hash][]*plumbing.Reference,
+	names *anonymizer,
+) ([]view.Link, error) {
+	head, err := repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("resolve HEAD: %w", err)
+	}
+	trunk, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("read HEAD commit: %w", err)
+	}
+	trunkAll, err := reachable(repo, []plumbing.Hash{trunk.Hash}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	trunkIDs := make(map[plumbing.Hash]plumbing.Hash) // Trunk commit to its patch ID
+	tips := make([]plumbing.Hash, 0, len(heads))
+	for tip := range heads {
+		tips = append(tips, tip)
+	}
+	sort.Slice(tips, func(i, j int) bool { return tips[i].String() < tips[j].String() })
+
+	var links []view.Link
+	for _, tip := range tips {
+		refs := heads[tip]
+		if trunkAll.Contains(tip) {
+			continue // Merged normally, or the trunk itself
+		}
+		branch, err := repo.CommitObject(tip)
+		if err != nil {
+			continue
+		}
+		bases, err := branch.MergeBase(trunk)
+		if err != nil || len(bases) == 0 {
+			continue
+		}
+		id, err := rangePatchID(bases[0], branch)
+		if err != nil {
+			return nil, fmt.Errorf("patch ID of %s: %w", refs[0].Name().Short(), err)
+		}
+
+		baseAll, err := reachable(repo, []plumbing.Hash{bases[0].Hash}, nil)
+		if err != nil {
+			return nil, err
+		}
+		var squash plumbing.Hash
+		candidates := trunkAll.Difference(baseAll).ToSlice()
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i].String() < candidates[j].String() })
+		for _, h := range candidates {
+			trunkID, ok := trunkIDs[h]
+			if !ok {
+				commit, err := repo.CommitObject(h)
+				if err != nil {
+					return nil, fmt.Errorf("read commit %s: %w", h, err)
+				}
+				if trunkID, ok, err = patchID(commit); err != nil {
+					return nil, fmt.Errorf("patch ID of %s: %w", h, err)
+				}
+				trunkIDs[h] = trunkID
+			}
+			if trunkID == id {
+				squash = h
+				break
+			}
+		}
+		if squash.IsZero() {
+			continue
+		}
+
+		name := names.label(refs[0].Name())
+		if ci, ok := commits[squash]; ok {
+			ci.Badges = append(ci.Badges, structs.Badge{
+				Text:   "⇠ squashed " + name,
+				Detail: fmt.Sprintf("Same change as %s from %s to %s", name, bases[0].Hash.String()[:7], tip.String()[:7]),
+			})
+		}
+		if ci, ok := commits[tip]; ok {
+			ci.Badges = append(ci.Badges, structs.Badge{
+				Text:   "landed as " + squash.String()[:7],
+				Detail: fmt.Sprintf("%s was squash-merged into %s as %s", name, names.label(head.Name()), squash.String()[:7]),
+			})
+		}
+		links = append(links, view.Link{From: tip.String(), To: squash.String()})
+	}
+
+	return links, nil
+}
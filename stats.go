@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/anton-dovnar/git-tree/structs"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// layoutStats measures an arrangement, for -stats-only.
+type layoutStats struct {
+	Commits, Lanes, Rows int
+
+	WidestRow   int // Row with the most lanes in use, counted from the newest
+	WidestLanes int
+
+	Crossings int // Rails hopping lanes over another rail, estimated
+
+	LongestBranch string // Branch with the longest first-parent run in its own lane
+	LongestRun    int
+}
+
+// measureLayout takes the measurements of -stats-only. A rail is taken to
+// run in the lane of whichever end sits further out, which is what the
+// drawing does for most rails, so the lanes in use and the crossings are
+// estimates.
+func measureLayout(
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	positions map[plumbing.Hash][2]int,
+	heads map[plumbing.Hash][]*plumbing.Reference,
+) layoutStats {
+	stats := layoutStats{Commits: len(positions)}
+	maxY := 0
+	rows := make(map[int]bool)
+	for _, pos := range positions {
+		stats.Lanes = max(stats.Lanes, pos[0]+1)
+		maxY = max(maxY, pos[1])
+		rows[pos[1]] = true
+	}
+	stats.Rows = len(rows)
+
+	inUse := make(map[int]map[int]bool) // Row to lanes
+	use := func(y, x int) {
+		if inUse[y] == nil {
+			inUse[y] = make(map[int]bool)
+		}
+		inUse[y][x] = true
+	}
+	type hop struct{ y, from, to int }
+	var hops []hop
+	for h, pos := range positions {
+		use(pos[1], pos[0])
+		ci, ok := commits[h]
+		if !ok || ci.Commit == nil {
+			continue
+		}
+		for _, p := range ci.Commit.ParentHashes {
+			ppos, ok := positions[p]
+			if !ok {
+				continue
+			}
+			// The rail hops lanes next to the end whose lane it leaves.
+			lane, hopY := pos[0], ppos[1]+1
+			if ppos[0] > lane {
+				lane, hopY = ppos[0], pos[1]-1
+			}
+			for y := ppos[1] + 1; y < pos[1]; y++ {
+				use(y, lane)
+			}
+			if ppos[0] != pos[0] {
+				hops = append(hops, hop{hopY, min(pos[0], ppos[0]), max(pos[0], ppos[0])})
+			}
+		}
+	}
+
+	stats.WidestRow = -1
+	for y := maxY; y >= 0; y-- {
+		if n := len(inUse[y]); n > stats.WidestLanes {
+			stats.WidestRow, stats.WidestLanes = maxY-y, n
+		}
+	}
+	for _, hop := range hops {
+		for x := hop.from + 1; x < hop.to; x++ {
+			if inUse[hop.y][x] {
+				stats.Crossings++
+			}
+		}
+	}
+
+	var branches []*plumbing.Reference
+	for _, refs := range heads {
+		branches = append(branches, refs...)
+	}
+	sort.Slice(branches, func(i, j int) bool { return branches[i].Name() < branches[j].Name() })
+	for _, branch := range branches {
+		pos, ok := positions[branch.Hash()]
+		if !ok {
+			continue
+		}
+		run := 0
+		for h := branch.Hash(); ; {
+			p, ok := positions[h]
+			if !ok || p[0] != pos[0] {
+				break
+			}
+			run++
+			ci, ok := commits[h]
+			if !ok || ci.Commit == nil || ci.Commit.NumParents() == 0 {
+				break
+			}
+			h = ci.Commit.ParentHashes[0]
+		}
+		if run > stats.LongestRun {
+			stats.LongestBranch, stats.LongestRun = branch.Name().Short(), run
+		}
+	}
+	return stats
+}
+
+func printLayoutStats(w io.Writer, stats layoutStats) {
+	fmt.Fprintf(w, "commits:        %d\n", stats.Commits)
+	fmt.Fprintf(w, "lanes:          %d\n", stats.Lanes)
+	fmt.Fprintf(w, "rows:           %d\n", stats.Rows)
+	if stats.WidestRow >= 0 {
+		fmt.Fprintf(w, "widest row:     %d lanes in use, row %d from the top\n", stats.WidestLanes, stats.WidestRow+1)
+	}
+	fmt.Fprintf(w, "crossings:      ~%d\n", stats.Crossings)
+	if stats.LongestBranch != "" {
+		fmt.Fprintf(w, "longest branch: %s, %d commits in its lane\n", stats.LongestBranch, stats.LongestRun)
+	}
+}
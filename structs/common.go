@@ -8,4 +8,20 @@ import (
 type CommitInfo struct {
 	Commit     *object.Commit
 	References mapset.Set[string]
+	Files      []FileStat // Per-file changes, filled only by modes that compute them
+	Badges     []Badge    // Annotations drawn next to the commit
+
+	Collapsed []*object.Commit // Commits folded into this node by -collapse-merges, newest first
+}
+
+type Badge struct {
+	Text   string // Short label drawn in the graph
+	Detail string // Longer explanation shown on hover and in the commit panel
+}
+
+type FileStat struct {
+	Name      string
+	OldName   string // Previous path when the change is a rename
+	Additions int
+	Deletions int
 }
@@ -0,0 +1,38 @@
+package structs
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/config"
+)
+
+// LanePins reads the lanes refs are pinned to from the repository config,
+// given as "<ref>:<lane>" values of git-tree.pin, e.g.
+//
+//	git config --add git-tree.pin main:0
+//	git config --add git-tree.pin develop:1
+//
+// Refs may be full or short names. Malformed values are reported together
+// with the pins that did parse.
+func LanePins(cfg *config.Config) (map[string]int, error) {
+	out := make(map[string]int)
+	var errs []error
+	for _, sec := range cfg.Raw.Sections {
+		if !sec.IsName("git-tree") {
+			continue
+		}
+		for _, val := range sec.Options.GetAll("pin") {
+			ref, lane, ok := strings.Cut(strings.TrimSpace(val), ":")
+			n, err := strconv.Atoi(strings.TrimSpace(lane))
+			if !ok || err != nil || n < 0 || strings.TrimSpace(ref) == "" {
+				errs = append(errs, fmt.Errorf("git-tree.pin %q: want <ref>:<lane>", val))
+				continue
+			}
+			out[strings.TrimSpace(ref)] = n
+		}
+	}
+	return out, errors.Join(errs...)
+}
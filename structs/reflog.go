@@ -2,12 +2,20 @@ package structs
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 )
 
@@ -52,12 +60,30 @@ func ResolveGitDir(startPath string) (string, error) {
 	return "", fmt.Errorf("could not find .git starting at %s", startPath)
 }
 
-func ReadReflogNewHashes(gitDir, refName string) ([]plumbing.Hash, error) {
-	if gitDir == "" || refName == "" {
-		return nil, errors.New("empty gitDir or refName")
+// GitDirFS is the git directory of repo as a filesystem, for the files
+// go-git does not read itself, like reflogs. Repositories stored elsewhere,
+// such as in memory, get an empty one.
+func GitDirFS(repo *git.Repository) billy.Filesystem {
+	if s, ok := repo.Storer.(interface{ Filesystem() billy.Filesystem }); ok {
+		return s.Filesystem()
 	}
-	path := filepath.Join(gitDir, "logs", filepath.FromSlash(refName))
-	f, err := os.Open(path)
+	return memfs.New()
+}
+
+func ReadReflogNewHashes(fs billy.Filesystem, refName string) ([]plumbing.Hash, error) {
+	return ReadRecentReflogNewHashes(fs, refName, 0)
+}
+
+// ReadRecentReflogNewHashes is ReadReflogNewHashes limited to the newest
+// limit entries, read from the end of the file; 0 reads them all.
+// Lines that do not parse are skipped and reported by a
+// *MalformedReflogError.
+func ReadRecentReflogNewHashes(fs billy.Filesystem, refName string, limit int) ([]plumbing.Hash, error) {
+	if refName == "" {
+		return nil, errors.New("empty refName")
+	}
+	path := fs.Join("logs", refName)
+	f, err := fs.Open(path)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return nil, nil
@@ -66,23 +92,33 @@ func ReadReflogNewHashes(gitDir, refName string) ([]plumbing.Hash, error) {
 	}
 	defer f.Close()
 
+	var r io.Reader = f
+	if limit > 0 {
+		tail, err := readTailLines(f, limit)
+		if err != nil {
+			return nil, fmt.Errorf("read reflog %s: %w", path, err)
+		}
+		r = bytes.NewReader(tail)
+	}
+
 	var out []plumbing.Hash
+	var malformed *MalformedReflogError
 	seen := make(map[plumbing.Hash]struct{})
-	sc := bufio.NewScanner(f)
+	sc := scanReflog(r)
 	for sc.Scan() {
 		line := strings.TrimSpace(sc.Text())
 		if line == "" {
 			continue
 		}
 		fields := strings.Fields(line)
-		if len(fields) < 2 {
-			continue
-		}
-		newHex := fields[1]
-		if len(newHex) != 40 {
+		if len(fields) < 2 || !plumbing.IsHash(fields[1]) {
+			if malformed == nil {
+				malformed = &MalformedReflogError{Path: path, First: line[:min(len(line), 200)]}
+			}
+			malformed.Lines++
 			continue
 		}
-		h := plumbing.NewHash(newHex)
+		h := plumbing.NewHash(fields[1])
 		if h.IsZero() {
 			continue
 		}
@@ -95,83 +131,225 @@ func ReadReflogNewHashes(gitDir, refName string) ([]plumbing.Hash, error) {
 	if err := sc.Err(); err != nil {
 		return nil, fmt.Errorf("scan reflog %s: %w", path, err)
 	}
+	if malformed != nil {
+		return out, malformed
+	}
 	return out, nil
 }
 
-func TrackedRemoteRefs(gitDir string) (map[string]struct{}, error) {
-	out := make(map[string]struct{})
-	if gitDir == "" {
-		return out, errors.New("empty gitDir")
-	}
+// MalformedReflogError reports reflog lines that could not be parsed. It is
+// returned along with the hashes of the lines that could.
+type MalformedReflogError struct {
+	Path  string
+	Lines int    // How many lines were skipped
+	First string // The first of them, cut at 200 bytes
+}
+
+func (e *MalformedReflogError) Error() string {
+	return fmt.Sprintf("%s: skipped %d malformed lines, the first being %q", e.Path, e.Lines, e.First)
+}
+
+// maxReflogLine is as much of a reflog line as is read. Only a message can
+// make a line longer, and its start is all anyone looks at.
+const maxReflogLine = 64 << 10
+
+// scanReflog scans the lines of a reflog, cutting longer ones short at
+// maxReflogLine rather than giving up on the whole file.
+func scanReflog(r io.Reader) *bufio.Scanner {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, maxReflogLine)
+	skipping := false
+	sc.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if skipping {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				return len(data), nil, nil
+			}
+			skipping = false
+			return i + 1, nil, nil
+		}
+		if len(data) >= maxReflogLine && bytes.IndexByte(data, '\n') < 0 {
+			skipping = true
+			return len(data), data, nil
+		}
+		return bufio.ScanLines(data, atEOF)
+	})
+	return sc
+}
 
-	cfgPath := filepath.Join(gitDir, "config")
-	b, err := os.ReadFile(cfgPath)
+// readTailLines reads the last n lines of f, a block at a time from the
+// end, so the size of the file does not matter.
+func readTailLines(f billy.File, n int) ([]byte, error) {
+	const block = 64 << 10
+	end, err := f.Seek(0, io.SeekEnd)
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return out, nil
+		return nil, err
+	}
+	var tail []byte
+	for off := end; off > 0; {
+		size := min(int64(block), off)
+		off -= size
+		buf := make([]byte, size)
+		if _, err := f.ReadAt(buf, off); err != nil {
+			return nil, err
+		}
+		tail = append(buf, tail...)
+		// The file's final newline ends the last line rather than
+		// starting one, hence n+1.
+		if lines := bytes.Count(tail, []byte{'\n'}); lines > n {
+			trimmed := bytes.TrimSuffix(tail, []byte{'\n'})
+			for i := 0; i < n; i++ {
+				trimmed = trimmed[:max(bytes.LastIndexByte(trimmed, '\n'), 0)]
+			}
+			return tail[len(trimmed):], nil
 		}
-		return nil, fmt.Errorf("read git config %s: %w", cfgPath, err)
 	}
+	return tail, nil
+}
 
-	type branchCfg struct {
-		remote string
-		merge  string
+func TrackedRemoteRefs(cfg *config.Config) map[string]struct{} {
+	upstreams := TrackedUpstreams(cfg)
+	out := make(map[string]struct{}, len(upstreams))
+	for _, remote := range upstreams {
+		out[remote] = struct{}{}
 	}
+	return out
+}
 
-	branches := make(map[string]*branchCfg)
-	var curBranch string
-
-	lines := strings.Split(string(b), "\n")
-	for _, raw := range lines {
-		line := strings.TrimSpace(raw)
-		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+// TrackedUpstreams maps each local branch with a configured upstream to the
+// remote-tracking ref it follows, e.g. refs/heads/main to
+// refs/remotes/origin/main.
+func TrackedUpstreams(cfg *config.Config) map[string]string {
+	out := make(map[string]string)
+	for name, bc := range cfg.Branches {
+		if bc == nil || bc.Remote == "" || bc.Merge == "" {
 			continue
 		}
-		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
-			curBranch = ""
-			sec := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "["), "]"))
-			if strings.HasPrefix(sec, "branch ") {
-				rest := strings.TrimSpace(strings.TrimPrefix(sec, "branch "))
-				rest = strings.Trim(rest, `"`)
-				if rest != "" {
-					curBranch = rest
-					if branches[curBranch] == nil {
-						branches[curBranch] = &branchCfg{}
-					}
-				}
-			}
+		merge := strings.TrimPrefix(bc.Merge.String(), "refs/heads/")
+		if merge == "" {
 			continue
 		}
+		out["refs/heads/"+name] = fmt.Sprintf("refs/remotes/%s/%s", bc.Remote, merge)
+	}
+	return out
+}
+
+// ReadReflogRenames returns the names a ref had before being renamed, oldest
+// first, taken from the "Branch: renamed <old> to <new>" entries git appends
+// to the reflog it moves along with the branch.
+func ReadReflogRenames(fs billy.Filesystem, refName string) ([]string, error) {
+	if refName == "" {
+		return nil, errors.New("empty refName")
+	}
+	path := fs.Join("logs", refName)
+	f, err := fs.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("open reflog %s: %w", path, err)
+	}
+	defer f.Close()
 
-		if curBranch == "" {
+	const prefix = "Branch: renamed "
+	var out []string
+	sc := scanReflog(f)
+	for sc.Scan() {
+		_, msg, ok := strings.Cut(sc.Text(), "\t")
+		if !ok || !strings.HasPrefix(msg, prefix) {
 			continue
 		}
-		key, val, ok := strings.Cut(line, "=")
-		if !ok {
+		from, to, ok := strings.Cut(strings.TrimPrefix(msg, prefix), " to ")
+		if !ok || from == "" || from == to {
 			continue
 		}
-		key = strings.TrimSpace(key)
-		val = strings.TrimSpace(val)
-		bc := branches[curBranch]
-		switch key {
-		case "remote":
-			bc.remote = val
-		case "merge":
-			bc.merge = val
+		out = append(out, strings.TrimSpace(from))
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("scan reflog %s: %w", path, err)
+	}
+	return out, nil
+}
+
+// ReadReflogUpdates returns the new hashes of the reflog entries whose
+// message starts with prefix, oldest first, such as the "commit" entries of
+// commits made on a branch or the "update by push" ones of a remote-tracking
+// ref moved by pushing to it.
+func ReadReflogUpdates(fs billy.Filesystem, refName, prefix string) ([]plumbing.Hash, error) {
+	if refName == "" {
+		return nil, errors.New("empty refName")
+	}
+	path := fs.Join("logs", refName)
+	f, err := fs.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
 		}
+		return nil, fmt.Errorf("open reflog %s: %w", path, err)
 	}
+	defer f.Close()
 
-	for _, bc := range branches {
-		if bc == nil || bc.remote == "" || bc.merge == "" {
+	var out []plumbing.Hash
+	sc := scanReflog(f)
+	for sc.Scan() {
+		entry, msg, ok := strings.Cut(sc.Text(), "\t")
+		fields := strings.Fields(entry)
+		if !ok || len(fields) < 2 || !plumbing.IsHash(fields[1]) || !strings.HasPrefix(msg, prefix) {
 			continue
 		}
-		merge := bc.merge
-		merge = strings.TrimPrefix(merge, "refs/heads/")
-		if merge == "" {
-			continue
+		out = append(out, plumbing.NewHash(fields[1]))
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("scan reflog %s: %w", path, err)
+	}
+	return out, nil
+}
+
+// ReflogEntry is one line of a reflog: a ref moving from Old to New.
+type ReflogEntry struct {
+	Old, New plumbing.Hash
+	When     time.Time
+	Message  string
+}
+
+// ReadReflogEntries returns the entries of the reflog of refName, oldest
+// first. Lines that do not parse are skipped.
+func ReadReflogEntries(fs billy.Filesystem, refName string) ([]ReflogEntry, error) {
+	if refName == "" {
+		return nil, errors.New("empty refName")
+	}
+	path := fs.Join("logs", refName)
+	f, err := fs.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
 		}
-		out[fmt.Sprintf("refs/remotes/%s/%s", bc.remote, merge)] = struct{}{}
+		return nil, fmt.Errorf("open reflog %s: %w", path, err)
 	}
+	defer f.Close()
 
+	var out []ReflogEntry
+	sc := scanReflog(f)
+	for sc.Scan() {
+		line, msg, _ := strings.Cut(sc.Text(), "\t")
+		fields := strings.Fields(line)
+		// <old> <new> <name> <email> <seconds> <zone>; the name may hold spaces.
+		if len(fields) < 5 || !plumbing.IsHash(fields[0]) || !plumbing.IsHash(fields[1]) {
+			continue
+		}
+		secs, err := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+		if err != nil {
+			continue
+		}
+		out = append(out, ReflogEntry{
+			Old:     plumbing.NewHash(fields[0]),
+			New:     plumbing.NewHash(fields[1]),
+			When:    time.Unix(secs, 0),
+			Message: msg,
+		})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("scan reflog %s: %w", path, err)
+	}
 	return out, nil
 }
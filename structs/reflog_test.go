@@ -0,0 +1,67 @@
+package structs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5/config"
+)
+
+const reflogSeed = "0000000000000000000000000000000000000000 1966d2b50638f2903a83cecefe4c596de47aa7f5 Ann Dev <a@b.c> 1704103200 +0000\tcommit (initial): feat(core): initial\n" +
+	"1966d2b50638f2903a83cecefe4c596de47aa7f5 fe85fc45530e1b88e9584daeb87fb93e21829bee Ann Dev <a@b.c> 1704189600 +0000\tcommit: fix: add c\n" +
+	"fe85fc45530e1b88e9584daeb87fb93e21829bee 1966d2b50638f2903a83cecefe4c596de47aa7f5 Ann Dev <a@b.c> 1704189700 +0000\tBranch: renamed refs/heads/old to refs/heads/main\n"
+
+// FuzzReadReflogNewHashes feeds reflogs of any shape, whole and by their
+// last lines, and checks every hash returned comes from the file, once.
+func FuzzReadReflogNewHashes(f *testing.F) {
+	f.Add(reflogSeed, 0)
+	f.Add(reflogSeed, 2)
+	f.Add("\n\n", 1)
+	f.Add("not a reflog\r\n", 3)
+	f.Add(strings.Repeat("x", 70<<10)+"\n"+reflogSeed, 0)
+	f.Add(strings.Repeat("x", 70<<10)+"\n"+reflogSeed, 1)
+	f.Fuzz(func(t *testing.T, data string, limit int) {
+		fs := memfs.New()
+		if err := util.WriteFile(fs, "logs/refs/heads/main", []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		hashes, err := ReadRecentReflogNewHashes(fs, "refs/heads/main", limit%8)
+		var malformed *MalformedReflogError
+		if err != nil && !errors.As(err, &malformed) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		seen := make(map[string]bool)
+		for _, h := range hashes {
+			if h.IsZero() || seen[h.String()] || !strings.Contains(strings.ToLower(data), h.String()) {
+				t.Fatalf("hash %s should be non-zero, unique and in the reflog", h)
+			}
+			seen[h.String()] = true
+		}
+
+		// The other readers share the format and must cope with it too.
+		ReadReflogRenames(fs, "refs/heads/main")
+		ReadReflogEntries(fs, "refs/heads/main")
+	})
+}
+
+// FuzzTrackedRemoteRefs checks whatever branch sections a config has, the
+// refs it tracks are remote-tracking refs.
+func FuzzTrackedRemoteRefs(f *testing.F) {
+	f.Add("[remote \"origin\"]\n\turl = /tmp/x.git\n[branch \"main\"]\n\tremote = origin\n\tmerge = refs/heads/main\n")
+	f.Add("[branch \"a\"]\n\tremote = origin\n\tmerge = refs/heads/\n")
+	f.Add("[branch \"\"]\n\tremote =\n\tmerge = x\n")
+	f.Fuzz(func(t *testing.T, data string) {
+		cfg := config.NewConfig()
+		if err := cfg.Unmarshal([]byte(data)); err != nil {
+			return
+		}
+		for ref := range TrackedRemoteRefs(cfg) {
+			if !strings.HasPrefix(ref, "refs/remotes/") {
+				t.Fatalf("tracked ref %q is not a remote-tracking ref", ref)
+			}
+		}
+	})
+}
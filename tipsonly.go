@@ -0,0 +1,82 @@
+package main
+
+import (
+	"slices"
+
+	"github.com/anton-dovnar/git-tree/structs"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// refSkeleton reduces the graph to the commits refs point at and the skeleton
+// connecting them, for -tips-only: the merge bases where their histories
+// part and the merges where they join again.
+func refSkeleton(
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	children map[plumbing.Hash]mapset.Set[plumbing.Hash],
+	heads, tags map[plumbing.Hash][]*plumbing.Reference,
+) (map[plumbing.Hash]*structs.CommitInfo, map[plumbing.Hash]mapset.Set[plumbing.Hash]) {
+	var tips []plumbing.Hash
+	for h := range commits {
+		if len(heads[h]) > 0 || len(tags[h]) > 0 {
+			tips = append(tips, h)
+		}
+	}
+	bases := mergeBases(commits, children, tips)
+	fixed := func(h plumbing.Hash) bool {
+		return len(heads[h]) > 0 || len(tags[h]) > 0 || bases[h]
+	}
+	return skeleton(commits, fixed, "%d commits between this and the next ref or merge base below")
+}
+
+// mergeBases finds the commits that are a merge base of some of tips: the
+// ones where the sets of tips reaching a commit through each of its
+// children stop coinciding, which is where those tips' histories part.
+func mergeBases(
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	children map[plumbing.Hash]mapset.Set[plumbing.Hash],
+	tips []plumbing.Hash,
+) map[plumbing.Hash]bool {
+	words := (len(tips) + 63) / 64
+	reach := make(map[plumbing.Hash][]uint64, len(commits))
+	for i, tip := range tips {
+		if reach[tip] == nil {
+			reach[tip] = make([]uint64, words)
+		}
+		reach[tip][i/64] |= 1 << (i % 64)
+	}
+
+	bases := make(map[plumbing.Hash]bool)
+	order := parentsFirst(commits)
+	for i := len(order) - 1; i >= 0; i-- { // Children first
+		h := order[i]
+		own := reach[h] != nil
+		var reached [][]uint64 // What each child with tips above it brings
+		if children[h] != nil {
+			for _, c := range children[h].ToSlice() {
+				if r := reach[c]; r != nil {
+					reached = append(reached, r)
+				}
+			}
+		}
+		if !own && len(reached) == 0 {
+			continue
+		}
+		union := make([]uint64, words)
+		if own {
+			copy(union, reach[h])
+		}
+		for _, r := range reached {
+			for w := range union {
+				union[w] |= r[w]
+			}
+		}
+		reach[h] = union
+		if !own && len(reached) > 1 && !slices.ContainsFunc(reached, func(r []uint64) bool { return slices.Equal(r, union) }) {
+			bases[h] = true
+		}
+	}
+	return bases
+}
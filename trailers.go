@@ -0,0 +1,58 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/anton-dovnar/git-tree/structs"
+	"github.com/anton-dovnar/git-tree/view"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// trailerLine matches a trailer, "Key: value", as git interpret-trailers
+// reads them.
+var trailerLine = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9-]*)\s*:\s*(.*)$`)
+
+// trailer returns the value of the last key trailer of message, matching
+// the key without regard to case. Trailers are the lines of the message's
+// last paragraph, when that is not its only one and at least one of its
+// lines is a trailer.
+func trailer(message, key string) (string, bool) {
+	paragraphs := strings.Split(strings.TrimSpace(strings.ReplaceAll(message, "\r\n", "\n")), "\n\n")
+	if len(paragraphs) < 2 {
+		return "", false
+	}
+	value, found := "", false
+	for _, line := range strings.Split(paragraphs[len(paragraphs)-1], "\n") {
+		if m := trailerLine.FindStringSubmatch(line); m != nil && strings.EqualFold(m[1], key) && m[2] != "" {
+			value, found = strings.TrimSpace(m[2]), true
+		}
+	}
+	return value, found
+}
+
+// trailerGroups groups the commits by the value of their key trailer, for
+// -group-by-trailer, and returns the groups, largest first.
+func trailerGroups(commits map[plumbing.Hash]*structs.CommitInfo, key string) (map[string]string, []view.CommitGroup) {
+	groups := make(map[string]string)
+	counts := make(map[string]int)
+	for h, ci := range commits {
+		if value, ok := trailer(ci.Commit.Message, key); ok {
+			groups[h.String()] = value
+			counts[value]++
+		}
+	}
+	legend := make([]view.CommitGroup, 0, len(counts))
+	for name, n := range counts {
+		legend = append(legend, view.CommitGroup{Name: name, Commits: n})
+	}
+	sort.Slice(legend, func(i, j int) bool {
+		if legend[i].Commits != legend[j].Commits {
+			return legend[i].Commits > legend[j].Commits
+		}
+		return legend[i].Name < legend[j].Name
+	})
+	return groups, legend
+}
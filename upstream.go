@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/anton-dovnar/git-tree/structs"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// trackedUpstreams resolves the remote-tracking ref every local branch
+// follows. Branches without an upstream, or whose upstream was never
+// fetched, are left out.
+func trackedUpstreams(repo *git.Repository) map[plumbing.ReferenceName]*plumbing.Reference {
+	out := make(map[plumbing.ReferenceName]*plumbing.Reference)
+	cfg, err := repo.Config()
+	if err != nil {
+		return out
+	}
+	for local, remote := range structs.TrackedUpstreams(cfg) {
+		if !refAllowed(plumbing.ReferenceName(local)) || !refAllowed(plumbing.ReferenceName(remote)) {
+			continue
+		}
+		ref, err := repo.Reference(plumbing.ReferenceName(remote), true)
+		if err != nil {
+			continue
+		}
+		out[plumbing.ReferenceName(local)] = ref
+	}
+	return out
+}
+
+// markUpstreams records where each local branch's upstream points so the
+// renderer can draw a marker there, and badges the local tip with how many
+// commits are waiting to be pushed and pulled. It returns the marker names
+// keyed by commit hash.
+func markUpstreams(
+	repo *git.Repository,
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	upstreams map[plumbing.ReferenceName]*plumbing.Reference,
+	names *anonymizer,
+) map[string][]string {
+	markers := make(map[string][]string)
+	locals := make([]plumbing.ReferenceName, 0, len(upstreams))
+	for local := range upstreams {
+		locals = append(locals, local)
+	}
+	sort.Slice(locals, func(i, j int) bool { return locals[i] < locals[j] })
+	for _, local := range locals {
+		remote := upstreams[local]
+		localRef, err := repo.Reference(local, true)
+		if err != nil {
+			continue
+		}
+		markers[remote.Hash().String()] = append(markers[remote.Hash().String()], names.label(remote.Name()))
+		sort.Strings(markers[remote.Hash().String()])
+		if localRef.Hash() == remote.Hash() {
+			continue
+		}
+
+		ahead, behind, err := aheadBehind(repo, localRef.Hash(), remote.Hash())
+		if err != nil {
+			continue
+		}
+
+		if ci, ok := commits[localRef.Hash()]; ok {
+			ci.Badges = append(ci.Badges, structs.Badge{
+				Text:   fmt.Sprintf("↑%d ↓%d", ahead, behind),
+				Detail: fmt.Sprintf("%d commits to push to and %d to pull from %s", ahead, behind, names.label(remote.Name())),
+			})
+		}
+	}
+	return markers
+}
+
+// markFoxtrots badges "foxtrot" merges: merges on a branch's first-parent
+// history whose later parent is a commit its upstream pointed at, as left
+// by a plain `git pull`. Pushing one makes the old upstream history the
+// second parent, so the mainline order readers rely on silently flips.
+func markFoxtrots(
+	repo *git.Repository,
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	upstreams map[plumbing.ReferenceName]*plumbing.Reference,
+	names *anonymizer,
+) {
+	gitDir := structs.GitDirFS(repo)
+	locals := make([]plumbing.ReferenceName, 0, len(upstreams))
+	for local := range upstreams {
+		locals = append(locals, local)
+	}
+	sort.Slice(locals, func(i, j int) bool { return locals[i] < locals[j] })
+
+	flagged := make(map[plumbing.Hash]bool)
+	for _, local := range locals {
+		remote := upstreams[local]
+		localRef, err := repo.Reference(local, true)
+		if err != nil {
+			continue
+		}
+		upstreamTips := map[plumbing.Hash]bool{remote.Hash(): true}
+		// Lines that do not parse are skipped; the rest still count.
+		hashes, _ := structs.ReadReflogNewHashes(gitDir, remote.Name().String())
+		for _, h := range hashes {
+			upstreamTips[h] = true
+		}
+
+		for _, tip := range []plumbing.Hash{localRef.Hash(), remote.Hash()} {
+			for h := tip; ; {
+				ci, ok := commits[h]
+				if !ok || ci.Commit.NumParents() == 0 {
+					break
+				}
+				for _, p := range ci.Commit.ParentHashes[1:] {
+					if upstreamTips[p] && !flagged[h] {
+						flagged[h] = true
+						ci.Badges = append(ci.Badges, structs.Badge{
+							Text:   "⚠ foxtrot",
+							Detail: fmt.Sprintf("Merges %s in as a later parent; pushing it rewrites the first-parent history of %s", names.label(remote.Name()), names.label(remote.Name())),
+						})
+					}
+				}
+				h = ci.Commit.ParentHashes[0]
+			}
+		}
+	}
+}
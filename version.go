@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set by GoReleaser through -ldflags "-X main.version=...".
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
+
+// buildInfo fills in the commit and date from the Go toolchain's VCS stamp
+// for binaries built without GoReleaser, e.g. with go install.
+func buildInfo() (rev, built string) {
+	rev, built = commit, date
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return rev, built
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if rev == "" {
+				rev = setting.Value
+			}
+		case "vcs.time":
+			if built == "" {
+				built = setting.Value
+			}
+		}
+	}
+	return rev, built
+}
+
+func runVersion(args []string) {
+	rev, built := buildInfo()
+	fmt.Printf("git-tree %s\n", version)
+	if rev != "" {
+		fmt.Printf("commit:  %s\n", rev)
+	}
+	if built != "" {
+		fmt.Printf("built:   %s\n", built)
+	}
+	fmt.Printf("go:      %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,159 @@
+package view
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// ASCIIRenderer writes the railway as plain text, one line per commit with
+// its hash, refs and subject, for commit messages, review descriptions and
+// text documents. Lanes are asciiLane columns apart, so that rails
+// detouring around a commit run between two lanes; rails changing lanes
+// get a line of their own between the rows they join.
+type ASCIIRenderer struct {
+	Width int // Lines are cut to this many columns; 0 leaves them whole
+}
+
+const asciiLane = 4
+
+func (r ASCIIRenderer) Render(ctx context.Context, g Graph, positions map[plumbing.Hash][2]int, w io.Writer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	maxX, maxY := 0, 0
+	for _, pos := range positions {
+		maxX, maxY = max(maxX, pos[0]), max(maxY, pos[1])
+	}
+	display := make(map[plumbing.Hash][2]int, len(positions))
+	for h, pos := range positions {
+		display[h] = [2]int{pos[0], maxY - pos[1]}
+	}
+	svgCommits := convertToSVGCommits(g.Commits, display, g.Heads, g.Tags)
+	edges := railEdges(g.Commits, positions, display, maxY, svgCommits, g.Children)
+
+	// Line 2*row holds the commits of a row and line 2*row+1 the rails
+	// between it and the next.
+	width := asciiLane*maxX + 1
+	grid := make([][]byte, 2*maxY+2)
+	for i := range grid {
+		grid[i] = []byte(strings.Repeat(" ", width))
+	}
+	hops := make([]bool, len(grid))
+	set := func(line, col int, c byte) {
+		if line < 0 || line >= len(grid) || col < 0 || col >= width {
+			return
+		}
+		if cur := grid[line][col]; cur == ' ' || cur == '-' || c == '*' {
+			grid[line][col] = c
+		}
+	}
+	vertical := func(col, from, to int) {
+		for line := from; line <= to; line++ {
+			set(line, col, '|')
+		}
+	}
+	hop := func(line, from, to int) {
+		hops[line] = true
+		switch {
+		case to < from:
+			set(line, to+1, '/')
+			for col := to + 2; col < from; col++ {
+				set(line, col, '-')
+			}
+		case to > from:
+			set(line, to-1, '\\')
+			for col := from + 1; col < to-1; col++ {
+				set(line, col, '-')
+			}
+		default:
+			set(line, to, '|')
+		}
+	}
+	for _, e := range edges {
+		if e.PY <= e.Y {
+			continue // Stub to a parent outside the graph
+		}
+		x, px := asciiLane*e.X, asciiLane*e.PX
+		switch {
+		case e.Middle:
+			dl := e.X - e.PX
+			if dl&1 == 0 {
+				dl--
+			}
+			via := x - dl*asciiLane/2
+			hop(2*e.Y+1, x, via)
+			vertical(via, 2*e.Y+2, 2*e.PY-2)
+			hop(2*e.PY-1, via, px)
+		case e.X > e.PX:
+			vertical(x, 2*e.Y+1, 2*e.PY-2)
+			hop(2*e.PY-1, x, px)
+		case e.X < e.PX:
+			hop(2*e.Y+1, x, px)
+			vertical(px, 2*e.Y+2, 2*e.PY-1)
+		default:
+			vertical(x, 2*e.Y+1, 2*e.PY-1)
+		}
+	}
+
+	labels := make(map[int]string, len(svgCommits))
+	for _, c := range svgCommits {
+		set(2*c.Y, asciiLane*c.X, '*')
+		hash := c.Hash
+		if len(hash) > 7 {
+			hash = hash[:7]
+		}
+		var refs []string
+		refs = append(refs, c.Heads...)
+		for _, tag := range c.Tags {
+			refs = append(refs, "tag: "+tag)
+		}
+		label := hash
+		if len(refs) > 0 {
+			label += " (" + strings.Join(refs, ", ") + ")"
+		}
+		if ci := g.Commits[plumbing.NewHash(c.Hash)]; ci != nil && ci.Commit != nil {
+			subject, _, _ := strings.Cut(ci.Commit.Message, "\n")
+			label += " " + strings.TrimSpace(subject)
+		}
+		if labels[c.Y] != "" {
+			label = labels[c.Y] + "; " + label // Rows shared with -compact-rows
+		}
+		labels[c.Y] = label
+	}
+
+	bw := bufio.NewWriter(w)
+	for i, line := range grid {
+		if i%2 == 1 && !hops[i] {
+			continue // Nothing but rails running straight on
+		}
+		text := string(line)
+		if label, ok := labels[i/2]; ok && i%2 == 0 {
+			text += " " + label
+		}
+		text = strings.TrimRightFunc(text, unicode.IsSpace)
+		if r.Width > 0 {
+			text = cutColumns(text, r.Width)
+		}
+		fmt.Fprintln(bw, text)
+	}
+	return bw.Flush()
+}
+
+// cutColumns cuts s down to n columns, see columns.
+func cutColumns(s string, n int) string {
+	used := 0
+	for i, r := range s {
+		c := columns(string(r))
+		if used+c > n {
+			return s[:i]
+		}
+		used += c
+	}
+	return s
+}
@@ -0,0 +1,64 @@
+package view
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Files written by WriteAssets.
+const (
+	AssetSVG   = "graph.svg"
+	AssetData  = "commits.json"
+	AssetTrees = "trees.json"
+)
+
+// WriteAssets writes the drawing, commit data and tree listings to dir, for
+// a page written with HTMLOptions.Assets to load. Keeping them out of the
+// page keeps it small for huge repositories and lets the data be cached on
+// its own.
+func WriteAssets(dir, svgContent string, commitData map[string]CommitData, opts HTMLOptions) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if opts.Reproducible {
+		FixedDates(commitData)
+	}
+	trees := opts.Trees
+	if trees == nil {
+		trees = map[string][]TreeEntry{}
+	}
+	if err := os.WriteFile(filepath.Join(dir, AssetSVG), []byte(railwaySVG(svgContent)), 0o644); err != nil {
+		return err
+	}
+	for name, v := range map[string]any{AssetData: commitData, AssetTrees: trees} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s: %w", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assetsLoader is the script that fetches the assets from the directory at
+// url and then runs the page's scripts, which wait for them.
+func assetsLoader(url string) (string, error) {
+	loader, err := getResource("assets.js")
+	if err != nil {
+		return "", fmt.Errorf("failed to load assets script: %w", err)
+	}
+	urls, err := json.Marshal(map[string]string{
+		"svg":   path.Join(url, AssetSVG),
+		"data":  path.Join(url, AssetData),
+		"trees": path.Join(url, AssetTrees),
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("\n    <script>const assets = %s;\n%s</script>", urls, loader), nil
+}
@@ -0,0 +1,93 @@
+package view
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"sort"
+
+	svg "github.com/ajstarks/svgo"
+	"github.com/anton-dovnar/git-tree/structs"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Size of the README badge.
+const (
+	badgeWidth  = 200
+	badgeHeight = 40
+
+	badgeGraphX = 112 // Left edge of the micro-graph
+)
+
+// GenerateBadge writes a small SVG summing up a repository: its branch
+// count, the age of its newest commit and a micro-graph of the arranged
+// commits, oldest on the left and lanes stacked downwards. Reproducible
+// badges give the newest commit's date instead of its age.
+func GenerateBadge(
+	w io.Writer,
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	positions map[plumbing.Hash][2]int,
+	branches int,
+	reproducible bool,
+) error {
+	var newest *structs.CommitInfo
+	maxX, maxY := 0, 0
+	for h, pos := range positions {
+		maxX, maxY = max(maxX, pos[0]), max(maxY, pos[1])
+		if ci := commits[h]; newest == nil || ci.Commit.Committer.When.After(newest.Commit.Committer.When) {
+			newest = ci
+		}
+	}
+	updated := "no commits"
+	if newest != nil {
+		updated = "updated " + prettyDate(newest.Commit.Committer.When)
+		if reproducible {
+			updated = "updated " + newest.Commit.Committer.When.UTC().Format("2006-01-02")
+		}
+	}
+
+	colW := min(6.0, float64(badgeWidth-badgeGraphX-8)/float64(max(maxY, 1)))
+	laneH := min(6.0, float64(badgeHeight-12)/float64(max(maxX, 1)))
+	point := func(pos [2]int) (float64, float64) {
+		return badgeGraphX + float64(pos[1])*colW, 6 + float64(pos[0])*laneH
+	}
+
+	hashes := make([]plumbing.Hash, 0, len(positions))
+	for h := range positions {
+		hashes = append(hashes, h)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i].String() < hashes[j].String() })
+
+	canvas := svg.New(w)
+	canvas.Start(badgeWidth, badgeHeight)
+	canvas.Roundrect(0, 0, badgeWidth, badgeHeight, 6, 6, `fill="#4e545b"`)
+	fmt.Fprintf(canvas.Writer, `<text x="10" y="17" fill="#dddddd" font-family="Ubuntu Mono, monospace" font-size="12" font-weight="bold">%d %s</text>`,
+		branches, plural(branches, "branch", "branches"))
+	fmt.Fprintf(canvas.Writer, `<text x="10" y="31" fill="#9ca3af" font-family="Ubuntu Mono, monospace" font-size="9">%s</text>`, updated)
+
+	palette := &SVGRailway{colors: make(map[string]color.RGBA)}
+	for _, h := range hashes {
+		x, y := point(positions[h])
+		for _, p := range commits[h].Commit.ParentHashes {
+			px, py := badgeGraphX-2.0, y // Parents left out trail off to the left
+			if pos, ok := positions[p]; ok {
+				px, py = point(pos)
+			}
+			fmt.Fprintf(canvas.Writer, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="1.2"/>`,
+				x, y, px, py, colorToHex(palette.commitColor(commits[h])))
+		}
+	}
+	for _, h := range hashes {
+		x, y := point(positions[h])
+		fmt.Fprintf(canvas.Writer, `<circle cx="%.1f" cy="%.1f" r="1.6" fill="#dbdbdb"/>`, x, y)
+	}
+	canvas.End()
+	return nil
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
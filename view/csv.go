@@ -0,0 +1,113 @@
+package view
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// CSVRenderer writes a table with a row per commit, newest first, for
+// spreadsheets and BI tools. Lanes and rows are numbered like Layout's.
+type CSVRenderer struct {
+	Comma rune // Field separator; 0 means ','
+}
+
+var csvHeader = []string{
+	"hash", "parents", "refs", "author", "author_email", "authored", "committer", "committed",
+	"type", "scope", "breaking", "subject", "lane", "row",
+}
+
+func (r CSVRenderer) Render(ctx context.Context, g Graph, positions map[plumbing.Hash][2]int, w io.Writer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	maxY := 0
+	hashes := make([]plumbing.Hash, 0, len(positions))
+	for h, pos := range positions {
+		maxY = max(maxY, pos[1])
+		if ci := g.Commits[h]; ci != nil && ci.Commit != nil {
+			hashes = append(hashes, h)
+		}
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		pi, pj := positions[hashes[i]], positions[hashes[j]]
+		if pi[1] != pj[1] {
+			return pi[1] > pj[1]
+		}
+		if pi[0] != pj[0] {
+			return pi[0] < pj[0]
+		}
+		return hashes[i].String() < hashes[j].String()
+	})
+
+	cw := csv.NewWriter(w)
+	if r.Comma != 0 {
+		cw.Comma = r.Comma
+	}
+	cw.Write(csvHeader)
+	for _, h := range hashes {
+		commit := g.Commits[h].Commit
+		parents := make([]string, len(commit.ParentHashes))
+		for i, p := range commit.ParentHashes {
+			parents[i] = p.String()
+		}
+		var refs []string
+		for _, ref := range g.Heads[h] {
+			refs = append(refs, ref.Name().String())
+		}
+		for _, ref := range g.Tags[h] {
+			refs = append(refs, ref.Name().String())
+		}
+		sort.Strings(refs)
+		subject, _, _ := strings.Cut(commit.Message, "\n")
+		subject = strings.TrimSpace(subject)
+		commitType, scope, _ := parseCommitMessage(subject)
+		pos := positions[h]
+		cw.Write([]string{
+			h.String(),
+			strings.Join(parents, " "),
+			csvText(strings.Join(refs, " ")),
+			csvText(commit.Author.Name),
+			csvText(commit.Author.Email),
+			commit.Author.When.Format(time.RFC3339),
+			csvText(commit.Committer.Name),
+			commit.Committer.When.Format(time.RFC3339),
+			csvText(strings.TrimSuffix(commitType, "!")),
+			csvText(scope),
+			strconv.FormatBool(breakingChange(commit.Message)),
+			csvText(subject),
+			strconv.Itoa(pos[0]),
+			strconv.Itoa(maxY - pos[1]),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvText keeps spreadsheets from running text taken from commits as a
+// formula: a cell starting with one of = + - @ gets a leading quote.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// breakingChange reports whether a commit message announces a breaking
+// change: with a BREAKING CHANGE footer, or a "!" ending the type and scope
+// of a conventional subject ("feat!: ..." or "feat(api)!: ...").
+func breakingChange(message string) bool {
+	subject, _, _ := strings.Cut(message, "\n")
+	subject = strings.TrimSpace(subject)
+	prefix, _, found := strings.Cut(subject, ": ")
+	if commitType, _, _ := parseCommitMessage(subject); found && commitType != "" && strings.HasSuffix(prefix, "!") {
+		return true
+	}
+	return strings.Contains(message, "BREAKING CHANGE:")
+}
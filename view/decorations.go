@@ -0,0 +1,206 @@
+package view
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+)
+
+// Kinds of ref label, in the order they are drawn beside a stop.
+const (
+	decoHead   = iota // The branch HEAD points at, or HEAD itself when detached
+	decoBranch        // Other local branches
+	decoTag
+	decoRemote // Remote-tracking refs and the heads of pull requests
+)
+
+// decoration is one ref label beside a stop.
+type decoration struct {
+	kind   int
+	ref    string   // Full ref name, "HEAD" for a detached HEAD
+	text   string   // Label: short branch name or tag name
+	head   int      // Index of a branch or remote in SVGCommit.Heads
+	synced []string // Remote refs left out for being on the same commit as this branch
+}
+
+// moreStep is the spacing of the labels in a "+N more" list.
+const moreStep = 12
+
+// decorations orders the ref labels of commit: HEAD first, then the local
+// branches, the tags and the remote refs. A remote ref r/x, or the upstream
+// marker for it, is left out when the local branch x is on the same commit
+// and named in the branch's tooltip instead. Past SVGOptions.MaxRefs the
+// labels are returned as more, for a "+N more" list.
+func (sr *SVGRailway) decorations(commit SVGCommit) (shown, more []decoration) {
+	var out []decoration
+	if sr.opts.Head == commit.Hash {
+		out = append(out, decoration{kind: decoHead, ref: "HEAD", text: "HEAD", head: -1})
+	}
+	locals := make(map[string]int)
+	for i, label := range commit.Heads {
+		ref := label
+		if i < len(commit.HeadRefs) {
+			ref = commit.HeadRefs[i]
+		}
+		d := decoration{kind: decoRemote, ref: ref, text: label, head: i}
+		switch {
+		case ref == sr.opts.Head:
+			d.kind = decoHead
+		case strings.HasPrefix(ref, "refs/heads/") || i >= len(commit.HeadRefs):
+			d.kind = decoBranch
+		}
+		if d.kind != decoRemote {
+			locals[strings.TrimPrefix(ref, "refs/heads/")] = len(out)
+		}
+		out = append(out, d)
+	}
+	for _, tag := range commit.Tags {
+		out = append(out, decoration{kind: decoTag, ref: "refs/tags/" + tag, text: tag, head: -1})
+	}
+
+	// Remote refs matching a local branch fold into its label.
+	drop := make(map[int]bool)
+	for j, d := range out {
+		if i, ok := locals[remoteBranch(d.ref)]; ok && d.kind == decoRemote {
+			out[i].synced = append(out[i].synced, d.text)
+			drop[j] = true
+		}
+	}
+	for _, upstream := range sr.opts.Upstreams[commit.Hash] {
+		if i, ok := locals[remoteBranch("refs/remotes/"+upstream)]; ok && syncedUpstream(commit, upstream) {
+			out[i].synced = append(out[i].synced, upstream)
+		}
+	}
+	kept := make([]decoration, 0, len(out))
+	for j, d := range out {
+		if !drop[j] {
+			kept = append(kept, d)
+		}
+	}
+	out = kept
+	slices.SortStableFunc(out, func(a, b decoration) int { return a.kind - b.kind })
+
+	if sr.opts.MaxRefs > 0 && len(out) > sr.opts.MaxRefs {
+		return out[:sr.opts.MaxRefs], out[sr.opts.MaxRefs:]
+	}
+	return out, nil
+}
+
+// remoteBranch is the branch name of a remote-tracking ref, "x" for
+// refs/remotes/origin/x, or "" for other refs.
+func remoteBranch(ref string) string {
+	rest, ok := strings.CutPrefix(ref, "refs/remotes/")
+	if !ok {
+		return ""
+	}
+	_, branch, _ := strings.Cut(rest, "/")
+	return branch
+}
+
+// syncedUpstream reports whether the upstream marker named upstream, like
+// origin/main, stands at a commit with the local branch it is named after.
+func syncedUpstream(commit SVGCommit, upstream string) bool {
+	branch := remoteBranch("refs/remotes/" + upstream)
+	for i, ref := range commit.HeadRefs {
+		if ref == "refs/heads/"+branch && i < len(commit.Heads) {
+			return true
+		}
+	}
+	return false
+}
+
+// decoration draws d with its left edge at x on baseline ty and returns
+// the width taken.
+func (sr *SVGRailway) decoration(x, ty int, commit SVGCommit, d decoration) int {
+	width := 0
+	if d.kind == decoHead {
+		width = sr.useIcon(x, ty, icons["➜"])
+	}
+	if d.kind == decoTag {
+		width = sr.useIcon(x, ty, icons["🏷"])
+		sr.Writer.Write([]byte(fmt.Sprintf(`<text x="%d" y="%d" class="tag-label"%s>%s </text>`,
+			x+width, ty, sr.labelAttrs(commit.Hash, d.ref), isolate(html.EscapeString(d.text)))))
+		return width + columns(d.text)*6 + 8
+	}
+	if d.head < 0 {
+		sr.detached = true
+		sr.Writer.Write([]byte(fmt.Sprintf(`<text x="%d" y="%d" class="ref-label head-label"%s>HEAD </text>`,
+			x+width, ty, sr.labelAttrs(commit.Hash, "HEAD"))))
+		return width + columns("HEAD")*6 + 10
+	}
+
+	ref, full := d.text, d.ref
+	alias, attr := "", ` class="ref-label"`
+	if d.head < len(commit.HeadRefs) {
+		attr += sr.labelAttrs(commit.Hash, full)
+		if names := sr.opts.Aliases[full]; len(names) > 0 {
+			alias = "(was " + strings.Join(names, ", ") + ")"
+		}
+		attr += refsAttr([]string{full})
+		if sr.opts.Print {
+			shape, _ := printStyle(full)
+			ref = printShapes[shape] + " " + ref
+		}
+	}
+	title := ""
+	if len(d.synced) > 0 {
+		title = "<title>Same commit as " + html.EscapeString(strings.Join(d.synced, ", ")) + "</title>"
+	}
+	class := sr.refClass(full)
+	if alias == "" {
+		sr.Writer.Write([]byte(fmt.Sprintf(`<text x="%d" y="%d"%s>%s<tspan class="%s">%s </tspan></text>`,
+			x+width, ty, attr, title, class, isolate(html.EscapeString(ref)))))
+	} else {
+		sr.Writer.Write([]byte(fmt.Sprintf(`<text x="%d" y="%d"%s>%s<tspan class="%s">%s </tspan><tspan class="%s alias">%s </tspan></text>`,
+			x+width, ty, attr, title, class, isolate(html.EscapeString(ref)), class, isolate(html.EscapeString(alias)))))
+		width += columns(alias)*6 + 6
+	}
+	return width + columns(ref)*6 + 10
+}
+
+// decorationsOf draws the shown decorations of the kinds from to to,
+// starting offset past the start of the labels, and returns the offset
+// they end at.
+func (sr *SVGRailway) decorationsOf(x, y, offset int, commit SVGCommit, shown []decoration, from, to int) int {
+	labelX, ty := labelStart(x), labelBaseline(y)
+	for _, d := range shown {
+		if d.kind >= from && d.kind <= to {
+			offset += sr.decoration(labelX+offset, ty, commit, d)
+		}
+	}
+	return offset
+}
+
+// moreLabels draws "+N more" for the decorations past SVGOptions.MaxRefs,
+// with the list of them it opens in the page, and returns the offset it
+// ends at. Without scripts, its tooltip names them.
+func (sr *SVGRailway) moreLabels(x, y, offset int, commit SVGCommit, more []decoration) int {
+	if len(more) == 0 {
+		return offset
+	}
+	sr.more = true
+	labelX, ty := labelStart(x)+offset, labelBaseline(y)
+	names := make([]string, len(more))
+	for i, d := range more {
+		names[i] = d.text
+	}
+	text := fmt.Sprintf("+%d more", len(more))
+	sr.Writer.Write([]byte(fmt.Sprintf(`<text x="%d" y="%d" class="more-refs" data-commit="%s" data-more="%smore-%s"><title>%s</title>%s </text>`,
+		labelX, ty, commit.Hash, sr.opts.IDPrefix, commit.Hash, html.EscapeString(strings.Join(names, ", ")), text)))
+
+	var list bytes.Buffer
+	w := sr.Writer
+	sr.Writer = &list
+	widest := 0
+	for i, d := range more {
+		widest = max(widest, sr.decoration(labelX+4, ty+(i+1)*moreStep, commit, d))
+	}
+	sr.Writer = w
+	sr.Writer.Write([]byte(fmt.Sprintf(`<g id="%smore-%s" class="more-list" display="none"><rect x="%d" y="%d" width="%d" height="%d" rx="3"/>`,
+		sr.opts.IDPrefix, commit.Hash, labelX, ty+4, widest+4, len(more)*moreStep+4)))
+	sr.Writer.Write(list.Bytes())
+	sr.Writer.Write([]byte(`</g>`))
+	return offset + columns(text)*6 + 10
+}
@@ -0,0 +1,87 @@
+package view
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// DOTRenderer writes the railway as a Graphviz digraph. Every commit is
+// pinned to its lane and row, so `neato -n2` draws the layout as arranged
+// rather than one of its own; dot is free to rearrange it. Rails keep their
+// colors, several refs on one rail becoming parallel strokes.
+type DOTRenderer struct{}
+
+// DOT coordinates are in points, rows growing upwards as Graphviz has it.
+const (
+	dotLane = 18
+	dotRow  = 24
+)
+
+func (DOTRenderer) Render(ctx context.Context, g Graph, positions map[plumbing.Hash][2]int, w io.Writer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	maxY := 0
+	for _, pos := range positions {
+		maxY = max(maxY, pos[1])
+	}
+	display := make(map[plumbing.Hash][2]int, len(positions))
+	for h, pos := range positions {
+		display[h] = [2]int{pos[0], maxY - pos[1]}
+	}
+	svgCommits := convertToSVGCommits(g.Commits, display, g.Heads, g.Tags)
+	edges := railEdges(g.Commits, positions, display, maxY, svgCommits, g.Children)
+	colors := NewSVGRailway(nil, SVGOptions{})
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "// Generated by git-tree. Draw with neato -n2 to keep its layout, e.g. neato -n2 -Tsvg.")
+	fmt.Fprintln(bw, `digraph "git-tree" {`)
+	fmt.Fprintln(bw, `  node [shape=circle, width=0.1, fixedsize=true, label="", style=filled, color="#555555", fontname="monospace", fontsize=9];`)
+	fmt.Fprintln(bw, `  edge [arrowhead=none, penwidth=2, color="#808080"];`)
+	for _, c := range svgCommits {
+		hash := c.Hash
+		if len(hash) > 7 {
+			hash = hash[:7]
+		}
+		label := hash
+		refs := append([]string(nil), c.Heads...)
+		for _, tag := range c.Tags {
+			refs = append(refs, "tag: "+tag)
+		}
+		if len(refs) > 0 {
+			label += " (" + strings.Join(refs, ", ") + ")"
+		}
+		var subject string
+		if ci := g.Commits[plumbing.NewHash(c.Hash)]; ci != nil && ci.Commit != nil {
+			subject, _, _ = strings.Cut(ci.Commit.Message, "\n")
+		}
+		fmt.Fprintf(bw, "  %s [pos=\"%d,%d!\", xlabel=%s, tooltip=%s];\n",
+			dotQuote(c.Hash), c.X*dotLane, (maxY-c.Y)*dotRow, dotQuote(label), dotQuote(strings.TrimSpace(subject)))
+	}
+	for _, e := range edges {
+		if e.PY <= e.Y {
+			continue // Stub to a parent outside the graph
+		}
+		attrs := ""
+		if len(e.Refs) > 0 {
+			strokes := make([]string, len(e.Refs))
+			for i, ref := range e.Refs {
+				strokes[i] = colorToHex(colors.refToColor(ref))
+			}
+			attrs = fmt.Sprintf(" [color=%s]", dotQuote(strings.Join(strokes, ":")))
+		}
+		fmt.Fprintf(bw, "  %s -> %s%s;\n", dotQuote(e.From), dotQuote(e.To), attrs)
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// dotQuote makes s a quoted DOT string.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
@@ -0,0 +1,88 @@
+package view
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// MarkdownRenderer writes a Markdown snippet to paste into design documents,
+// pull request descriptions and notebooks: the railway as an image, then
+// the commits as a table folded away in a <details> section.
+type MarkdownRenderer struct {
+	SVG SVGOptions
+
+	// Inline puts the <svg> element itself in the snippet, which notebooks
+	// render but many Markdown sites strip; otherwise it is an image with a
+	// data URI.
+	Inline bool
+}
+
+func (r MarkdownRenderer) Render(ctx context.Context, g Graph, positions map[plumbing.Hash][2]int, w io.Writer) error {
+	var svgBuf bytes.Buffer
+	if err := (SVGRenderer{r.SVG}).Render(ctx, g, positions, &svgBuf); err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	if r.Inline {
+		// The XML prolog is not HTML, and a blank line would end the HTML
+		// block early.
+		svgText := svgBuf.String()
+		svgText = svgText[strings.Index(svgText, "<svg"):]
+		for _, line := range strings.Split(strings.TrimSpace(svgText), "\n") {
+			if strings.TrimSpace(line) != "" {
+				fmt.Fprintln(bw, line)
+			}
+		}
+	} else {
+		fmt.Fprintf(bw, "![Commit graph](data:image/svg+xml;base64,%s)\n", base64.StdEncoding.EncodeToString(svgBuf.Bytes()))
+	}
+
+	hashes := make([]plumbing.Hash, 0, len(positions))
+	for h := range positions {
+		if ci := g.Commits[h]; ci != nil && ci.Commit != nil {
+			hashes = append(hashes, h)
+		}
+	}
+	// Newest first, as drawn.
+	sort.Slice(hashes, func(i, j int) bool {
+		pi, pj := positions[hashes[i]], positions[hashes[j]]
+		if pi[1] != pj[1] {
+			return pi[1] > pj[1]
+		}
+		if pi[0] != pj[0] {
+			return pi[0] < pj[0]
+		}
+		return hashes[i].String() < hashes[j].String() // Rows shared with -compact-rows
+	})
+	fmt.Fprintf(bw, "\n<details>\n<summary>%d commits</summary>\n\n", len(hashes))
+	fmt.Fprintln(bw, "| Commit | Refs | Author | Date | Subject |")
+	fmt.Fprintln(bw, "|---|---|---|---|---|")
+	for _, h := range hashes {
+		commit := g.Commits[h].Commit
+		var refs []string
+		for _, ref := range g.Heads[h] {
+			refs = append(refs, RefLabel(ref.Name()))
+		}
+		for _, ref := range g.Tags[h] {
+			refs = append(refs, "🏷 "+ref.Name().Short())
+		}
+		sort.Strings(refs)
+		subject, _, _ := strings.Cut(commit.Message, "\n")
+		fmt.Fprintf(bw, "| `%s` | %s | %s | %s | %s |\n", h.String()[:7], mdCell(strings.Join(refs, ", ")),
+			mdCell(commit.Author.Name), commit.Author.When.Format("2006-01-02"), mdCell(strings.TrimSpace(subject)))
+	}
+	fmt.Fprintln(bw, "\n</details>")
+	return bw.Flush()
+}
+
+// mdCell escapes text for a Markdown table cell.
+var mdCell = strings.NewReplacer(`|`, `\|`, "\n", " ", `<`, `&lt;`).Replace
@@ -0,0 +1,53 @@
+package view
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	svg "github.com/ajstarks/svgo"
+)
+
+// FoldedLanes describes the lane the lanes past a cap were folded into.
+type FoldedLanes struct {
+	Lane int         // Lane the others were folded into
+	Tips []FoldedTip // Branches drawn in it
+}
+
+// FoldedTip is a branch drawn in the folded lane.
+type FoldedTip struct {
+	Name string // Short ref name
+	Hash string // Full hash of the commit it points at
+}
+
+// foldedLane draws the stripe marking SVGOptions.Folded, whose tooltip
+// names the branches in it.
+func (s *RailwayStream) foldedLane(canvas *svg.SVG, height int) {
+	f := s.opts.Folded
+	names := make([]string, len(f.Tips))
+	for i, tip := range f.Tips {
+		names[i] = tip.Name
+	}
+	x := paddingX + f.Lane*stepX - stepX/2
+	canvas.Writer.Write([]byte(fmt.Sprintf(`<rect class="folded-lane" x="%d" y="0" width="%d" height="%d" data-more="%sfolded-lanes"><title>Other branches (%d): %s</title></rect>`,
+		x, stepX, height, s.opts.IDPrefix, len(f.Tips), html.EscapeString(strings.Join(names, ", ")))))
+}
+
+// foldedList draws the list of the branches in the folded lane that
+// clicking its stripe opens, each leading to its tip.
+func (s *RailwayStream) foldedList(canvas *svg.SVG) {
+	f := s.opts.Folded
+	x := paddingX + f.Lane*stepX + stepX/2
+	widest := columns("Other branches")
+	for _, tip := range f.Tips {
+		widest = max(widest, columns(tip.Name))
+	}
+	canvas.Writer.Write([]byte(fmt.Sprintf(`<g id="%sfolded-lanes" class="more-list" display="none"><rect x="%d" y="%d" width="%d" height="%d" rx="3"/>`,
+		s.opts.IDPrefix, x, paddingY, widest*6+12, (len(f.Tips)+1)*moreStep+6)))
+	canvas.Writer.Write([]byte(fmt.Sprintf(`<text x="%d" y="%d" class="more-refs">Other branches</text>`, x+4, paddingY+moreStep)))
+	for i, tip := range f.Tips {
+		canvas.Writer.Write([]byte(fmt.Sprintf(`<text x="%d" y="%d" class="ref-label folded-tip" data-commit="%s">%s</text>`,
+			x+4, paddingY+(i+2)*moreStep, tip.Hash, isolate(html.EscapeString(tip.Name)))))
+	}
+	canvas.Writer.Write([]byte(`</g>`))
+}
@@ -0,0 +1,42 @@
+package view
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// CommitGroup is a group of SVGOptions.Groups and how many commits it has.
+type CommitGroup struct {
+	Name    string
+	Commits int
+}
+
+// groupsCSS styles the legend of HTMLOptions.Groups, added only to pages
+// that have one.
+const groupsCSS = `#groups {
+  color: var(--text-primary);
+  background: var(--bg-infobox);
+  border-radius: 8px;
+  padding: 8px 12px;
+}
+#groups summary { cursor: pointer; }
+#groups ul { margin: 8px 0 0; padding: 0; list-style: none; }
+#groups .swatch { display: inline-block; width: 0.8em; height: 0.8em; border-radius: 50%; margin-right: 0.4em; }
+`
+
+// groupsPanel is the legend of the colors stops are filled in by group, or
+// is empty without any groups.
+func groupsPanel(label string, groups []CommitGroup) string {
+	if len(groups) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n            <details id=\"groups\">\n                <summary>%s: %d groups</summary>\n                <ul>\n", html.EscapeString(label), len(groups))
+	for _, g := range groups {
+		fmt.Fprintf(&b, "                    <li><span class=\"swatch\" style=\"background: %s\"></span>%s (%d)</li>\n",
+			GroupColor(g.Name), html.EscapeString(g.Name), g.Commits)
+	}
+	b.WriteString("                </ul>\n            </details>")
+	return b.String()
+}
@@ -0,0 +1,139 @@
+package view
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// Hotspot is a directory or file and the commits that changed it.
+type Hotspot struct {
+	Path    string
+	Changes int       // Changes to the files, counting each file each commit changed
+	Commits []string  // Full hashes of the commits
+	Files   []Hotspot // Hottest files of a directory, hottest first
+}
+
+// hotspotsCSS styles the panel of HTMLOptions.Hotspots, added only to pages
+// that have one.
+const hotspotsCSS = `#hotspots {
+  color: var(--text-primary);
+  background: var(--bg-infobox);
+  border-radius: 8px;
+  padding: 8px 12px;
+}
+#hotspots summary { cursor: pointer; }
+#hotspots svg { display: block; margin-top: 8px; font-size: 10px; }
+#hotspots rect { stroke: var(--bg-infobox); stroke-width: 1; }
+#hotspots .directory > rect { fill: var(--text-primary); fill-opacity: 0.08; }
+#hotspots .file > rect { fill-opacity: 0.6; cursor: pointer; }
+#hotspots .file.active > rect { fill-opacity: 1; }
+#hotspots text { fill: var(--text-primary); pointer-events: none; }
+`
+
+// hotspotsWidth and hotspotsHeight are the size of the treemap.
+const hotspotsWidth, hotspotsHeight = 360, 220
+
+// tile is a rectangle of the treemap.
+type tile struct{ x, y, w, h float64 }
+
+// squarify lays sizes, largest first, out over r in rows of tiles kept as
+// close to square as it can, the squarified treemap of Bruls, Huizing and
+// van Wijk.
+func squarify(sizes []int, r tile) []tile {
+	total := 0
+	for _, s := range sizes {
+		total += s
+	}
+	tiles := make([]tile, len(sizes))
+	if total == 0 {
+		return tiles
+	}
+	scale := r.w * r.h / float64(total)
+	area := func(i int) float64 { return float64(sizes[i]) * scale }
+	// worst is the highest aspect ratio of the tiles i to j laid along side.
+	worst := func(i, j int, side float64) float64 {
+		sum := 0.0
+		for k := i; k < j; k++ {
+			sum += area(k)
+		}
+		return max(side*side*area(i)/(sum*sum), sum*sum/(side*side*area(j-1)))
+	}
+
+	for i := 0; i < len(sizes); {
+		side := min(r.w, r.h)
+		j := i + 1
+		for j < len(sizes) && worst(i, j+1, side) <= worst(i, j, side) {
+			j++
+		}
+		sum := 0.0
+		for k := i; k < j; k++ {
+			sum += area(k)
+		}
+		if r.w >= r.h { // A column on the left
+			width, y := sum/r.h, r.y
+			for k := i; k < j; k++ {
+				tiles[k] = tile{r.x, y, width, area(k) / width}
+				y += area(k) / width
+			}
+			r.x, r.w = r.x+width, r.w-width
+		} else { // A row along the top
+			height, x := sum/r.w, r.x
+			for k := i; k < j; k++ {
+				tiles[k] = tile{x, r.y, area(k) / height, height}
+				x += area(k) / height
+			}
+			r.y, r.h = r.y+height, r.h-height
+		}
+		i = j
+	}
+	return tiles
+}
+
+// hotspotsPanel draws directories as a treemap in the toolbar, each tiled
+// with its hottest files, or is empty without any. Clicking a file lights
+// up the commits that changed it.
+func hotspotsPanel(dirs []Hotspot) string {
+	if len(dirs) == 0 {
+		return ""
+	}
+	sizes := make([]int, len(dirs))
+	for i, d := range dirs {
+		sizes[i] = d.Changes
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n            <details id=\"hotspots\">\n                <summary>🔥 Hotspots: %s</summary>\n", html.EscapeString(dirs[0].Path))
+	fmt.Fprintf(&b, "                <svg width=\"%d\" height=\"%d\">\n", hotspotsWidth, hotspotsHeight)
+	for i, t := range squarify(sizes, tile{0, 0, hotspotsWidth, hotspotsHeight}) {
+		dir := dirs[i]
+		fmt.Fprintf(&b, "                    <g class=\"directory\"><rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\"><title>%s: %d changes in %d commits</title></rect>\n",
+			t.x, t.y, t.w, t.h, html.EscapeString(dir.Path), dir.Changes, len(dir.Commits))
+
+		// Files fill the directory's tile below a line for its name.
+		const header = 12
+		inner := tile{t.x + 1, t.y + header, t.w - 2, t.h - header - 1}
+		files := make([]int, len(dir.Files))
+		for j, f := range dir.Files {
+			files[j] = f.Changes
+		}
+		if inner.w > 0 && inner.h > 0 {
+			hue := (i * 47) % 360
+			for j, ft := range squarify(files, inner) {
+				f := dir.Files[j]
+				fmt.Fprintf(&b, "                        <g class=\"file\" data-commits=\"%s\"><rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" fill=\"hsl(%d, 60%%, 55%%)\"><title>%s: %d changes in %d commits</title></rect>",
+					strings.Join(f.Commits, " "), ft.x, ft.y, ft.w, ft.h, hue, html.EscapeString(f.Path), f.Changes, len(f.Commits))
+				if name := f.Path[strings.LastIndex(f.Path, "/")+1:]; ft.w >= float64(6*len(name)) && ft.h >= 12 {
+					fmt.Fprintf(&b, "<text x=\"%.1f\" y=\"%.1f\">%s</text>", ft.x+2, ft.y+10, html.EscapeString(name))
+				}
+				b.WriteString("</g>\n")
+			}
+		}
+		if t.w >= float64(6*len(dir.Path)) && t.h >= header {
+			fmt.Fprintf(&b, "                        <text x=\"%.1f\" y=\"%.1f\">%s</text>\n", t.x+2, t.y+9, html.EscapeString(dir.Path))
+		}
+		b.WriteString("                    </g>\n")
+	}
+	b.WriteString("                </svg>\n            </details>")
+	return b.String()
+}
@@ -30,15 +30,43 @@ type CommitMessage struct {
 	IsBreaking bool   `json:"is_breaking"`
 }
 
+type FileStat struct {
+	Name      string `json:"name"`
+	OldName   string `json:"old_name,omitempty"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+}
+
+type Badge struct {
+	Text   string `json:"text"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type CollapsedCommit struct {
+	Hash  string `json:"hash"`
+	Title string `json:"title"`
+}
+
+type TreeEntry struct {
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+	Dir  bool   `json:"dir,omitempty"`
+}
+
 type CommitData struct {
-	Hash             string        `json:"hash"`
-	Author           string        `json:"author"`
-	Committer        string        `json:"committer"`
-	Message          CommitMessage `json:"message"`
-	AuthoredDate     string        `json:"authored_date"`
-	CommittedDate    string        `json:"committed_date"`
-	AuthoredDateDelta string       `json:"authored_date_delta"`
-	CommittedDateDelta string      `json:"committed_date_delta"`
+	Hash               string            `json:"hash"`
+	Author             string            `json:"author"`
+	Committer          string            `json:"committer"`
+	Message            CommitMessage     `json:"message"`
+	AuthoredDate       string            `json:"authored_date"`
+	CommittedDate      string            `json:"committed_date"`
+	AuthoredDateDelta  string            `json:"authored_date_delta"`
+	CommittedDateDelta string            `json:"committed_date_delta"`
+	Files              []FileStat        `json:"files,omitempty"`
+	Tree               string            `json:"tree"`
+	Badges             []Badge           `json:"badges,omitempty"`
+	Collapsed          []CollapsedCommit `json:"collapsed,omitempty"`
+	Parents            []string          `json:"parents,omitempty"` // Full parent hashes, first parent first
 }
 
 var issueRegex = regexp.MustCompile(`(\w+)#(\d+)`)
@@ -85,6 +113,8 @@ func prettyDate(t time.Time) string {
 	return fmt.Sprintf("%d years ago", years)
 }
 
+// issueLink turns org#123 references in text into links to GitHub issues.
+// text must already be HTML-escaped; the links are the only markup added.
 func issueLink(text string, ghSlug string) string {
 	if ghSlug == "" {
 		return text
@@ -95,7 +125,7 @@ func issueLink(text string, ghSlug string) string {
 			org := parts[1]
 			num := parts[2]
 			if strings.HasPrefix(ghSlug, org+"/") {
-				return fmt.Sprintf(`<a target="_blank" href="https://github.com/%s/issues/%s">%s#%s</a>`, ghSlug, num, org, num)
+				return fmt.Sprintf(`<a target="_blank" href="https://github.com/%s/issues/%s">%s#%s</a>`, html.EscapeString(ghSlug), num, org, num)
 			}
 			return fmt.Sprintf(`<a target="_blank" href="https://github.com/%s/issues/%s">%s#%s</a>`, org, num, org, num)
 		}
@@ -120,14 +150,14 @@ func parseCommitMessage(message string) (string, string, string) {
 		closeParenIdx := strings.Index(rest, ")")
 		if closeParenIdx >= 0 {
 			scope := strings.TrimSpace(rest[:closeParenIdx])
-			if strings.Contains(commitType, " ") {
+			if commitType == "" || strings.Contains(commitType, " ") {
 				return "", "", message
 			}
 			return commitType, scope, title
 		}
 	}
 
-	if strings.Contains(prefix, " ") {
+	if prefix == "" || strings.Contains(prefix, " ") {
 		return "", "", message
 	}
 	return prefix, "", title
@@ -161,8 +191,8 @@ func GenerateCommitData(
 			body = strings.ReplaceAll(body, " \r\n", " ")
 		}
 
-		title = issueLink(title, ghSlug)
-		body = issueLink(body, ghSlug)
+		title = issueLink(html.EscapeString(title), ghSlug)
+		body = renderMarkdown(body, ghSlug)
 
 		authorHTML := fmt.Sprintf(`<a href="mailto:%s">%s</a>`, html.EscapeString(commit.Author.Email), html.EscapeString(commit.Author.Name))
 		committerHTML := fmt.Sprintf(`<a href="mailto:%s">%s</a>`, html.EscapeString(commit.Committer.Email), html.EscapeString(commit.Committer.Name))
@@ -173,15 +203,43 @@ func GenerateCommitData(
 		committedDateDelta := prettyDate(commit.Committer.When)
 		isBreaking := strings.Contains(fullMessage, "BREAKING CHANGE:")
 
+		var files []FileStat
+		for _, fs := range ci.Files {
+			files = append(files, FileStat{
+				Name:      fs.Name,
+				OldName:   fs.OldName,
+				Additions: fs.Additions,
+				Deletions: fs.Deletions,
+			})
+		}
+
+		var badges []Badge
+		for _, b := range ci.Badges {
+			badges = append(badges, Badge{Text: b.Text, Detail: b.Detail})
+		}
+
+		var collapsed []CollapsedCommit
+		for _, c := range ci.Collapsed {
+			collapsed = append(collapsed, CollapsedCommit{
+				Hash:  c.Hash.String()[:7],
+				Title: issueLink(html.EscapeString(strings.SplitN(c.Message, "\n", 2)[0]), ghSlug),
+			})
+		}
+
+		var parents []string
+		for _, p := range commit.ParentHashes {
+			parents = append(parents, p.String())
+		}
+
 		hashStr := hash.String()
 		if len(hashStr) > 7 {
 			hashStr = hashStr[:7]
 		}
 
 		result[hash.String()] = CommitData{
-			Hash:              hashStr,
-			Author:            authorHTML,
-			Committer:         committerHTML,
+			Hash:      hashStr,
+			Author:    authorHTML,
+			Committer: committerHTML,
 			Message: CommitMessage{
 				Type:       commitType,
 				Scope:      scope,
@@ -189,10 +247,15 @@ func GenerateCommitData(
 				Body:       body,
 				IsBreaking: isBreaking,
 			},
-			AuthoredDate:      authoredDate,
-			CommittedDate:     committedDate,
-			AuthoredDateDelta: authoredDateDelta,
+			AuthoredDate:       authoredDate,
+			CommittedDate:      committedDate,
+			AuthoredDateDelta:  authoredDateDelta,
 			CommittedDateDelta: committedDateDelta,
+			Files:              files,
+			Tree:               commit.TreeHash.String(),
+			Badges:             badges,
+			Collapsed:          collapsed,
+			Parents:            parents,
 		}
 	}
 
@@ -207,13 +270,31 @@ func getResource(name string) (string, error) {
 	return string(data), nil
 }
 
+// replacePlaceholders fills in the ((% key %)) placeholders of text in one
+// pass, so placeholders inside the values, say in a commit subject, are left
+// as they are rather than filled in depending on the order of the keys.
 func replacePlaceholders(text string, placeholders map[string]string) string {
-	result := text
-	for key, value := range placeholders {
-		placeholder := fmt.Sprintf("((%% %s %%))", key)
-		result = strings.ReplaceAll(result, placeholder, value)
+	var result strings.Builder
+	for {
+		start := strings.Index(text, "((% ")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(text[start:], " %))")
+		if end < 0 {
+			break
+		}
+		end += start
+		result.WriteString(text[:start])
+		if value, ok := placeholders[text[start+len("((% "):end]]; ok {
+			result.WriteString(value)
+		} else {
+			result.WriteString(text[start : end+len(" %))")])
+		}
+		text = text[end+len(" %))"):]
 	}
-	return result
+	result.WriteString(text)
+	return result.String()
 }
 
 func replaceReferences(text string) (string, error) {
@@ -258,29 +339,128 @@ func GenerateSVGString(
 	heads map[plumbing.Hash][]*plumbing.Reference,
 	tags map[plumbing.Hash][]*plumbing.Reference,
 	children map[plumbing.Hash]mapset.Set[plumbing.Hash],
+	opts SVGOptions,
 ) (string, error) {
 	var buf bytes.Buffer
 	canvas := svg.New(&buf)
-	DrawRailway(canvas, commits, positions, heads, tags, children)
+	DrawRailway(canvas, commits, positions, heads, tags, children, opts)
 	return buf.String(), nil
 }
 
-func WriteHTML(
-	w io.Writer,
-	svgContent string,
-	commitData map[string]CommitData,
-	title string,
-) error {
-	template, err := getResource("html_template.html")
-	if err != nil {
-		return fmt.Errorf("failed to load HTML template: %w", err)
+type HTMLOptions struct {
+	Serve bool                   // Page is served by `git-tree serve` and may query its API
+	Trees map[string][]TreeEntry // Pre-generated tree listings keyed by tree hash
+
+	ExtraCSS string // Appended to the page's stylesheet
+	ExtraJS  string // Run after the page's own script
+
+	Reproducible bool // Leave out everything that depends on when the page is generated
+	Print        bool // White page to go with SVGOptions.Print
+	SingleFile   bool // Load nothing from other hosts; labels use local fonts unless one is embedded
+
+	// Assets is the URL, relative to the page, of a directory written by
+	// WriteAssets to load the drawing and data from instead of embedding
+	// them. Browsers only allow this for pages served over HTTP.
+	Assets string
+
+	Warnings []string // Problems met collecting the graph, listed in a diagnostics panel
+
+	MergeLatencies []MergeLatency // Charted in a panel of their own
+	Hotspots       []Hotspot      // Directories changed most, hottest first, drawn as a treemap
+
+	// Groups is the legend of SVGOptions.Groups, named GroupsLabel.
+	Groups      []CommitGroup
+	GroupsLabel string
+}
+
+// webFontsCSS loads the page's fonts from Google Fonts.
+const webFontsCSS = `@import url('https://fonts.googleapis.com/css2?family=Ubuntu+Mono:wght@400;700&display=swap');
+@import url('https://fonts.googleapis.com/css2?family=Open+Sans+Condensed:wght@300&family=Ubuntu+Condensed&display=swap');
+`
+
+// remoteLoad matches a URL the browser would fetch on its own: a script or
+// image source, a CSS url() or an @import. JSON-escaped quotes are allowed
+// for so that URLs in the commit data are caught too.
+var remoteLoad = regexp.MustCompile(`(?i)(?:\bsrc\s*=\s*\\?["']?|url\(\s*\\?["']?|@import\s+\\?["'])((?:https?:)?//[^\s"'()\\]+)`)
+
+// RemoteLoads lists the URLs on other hosts that a page fetches when
+// opened, which keep it from working offline.
+func RemoteLoads(page string) []string {
+	var urls []string
+	for _, m := range remoteLoad.FindAllStringSubmatch(page, -1) {
+		urls = append(urls, m[1])
 	}
+	return urls
+}
 
-	commitDataJSON, err := json.Marshal(commitData)
+// printCSS turns the page white for graphs drawn with SVGOptions.Print.
+const printCSS = ":root { --bg-page: #ffffff; }\n"
+
+// diagnosticsCSS styles the panel listing HTMLOptions.Warnings, added only
+// to pages that have one.
+const diagnosticsCSS = `#diagnostics {
+  color: var(--text-primary);
+  background: var(--bg-infobox);
+  border-radius: 8px;
+  padding: 8px 12px;
+  max-width: 40em;
+}
+#diagnostics summary { cursor: pointer; }
+#diagnostics ul { margin: 8px 0 0; padding-left: 1.2em; }
+`
+
+// diagnosticsPanel lists warnings in the toolbar, or is empty without any.
+func diagnosticsPanel(warnings []string) string {
+	if len(warnings) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n            <details id=\"diagnostics\">\n                <summary>⚠ %d warnings</summary>\n                <ul>\n", len(warnings))
+	for _, w := range warnings {
+		fmt.Fprintf(&b, "                    <li>%s</li>\n", html.EscapeString(w))
+	}
+	b.WriteString("                </ul>\n            </details>")
+	return b.String()
+}
+
+// FixedDates replaces the relative "N days ago" dates with the calendar
+// dates they stand for, so the data no longer depends on the current time.
+func FixedDates(commitData map[string]CommitData) {
+	for h, d := range commitData {
+		d.AuthoredDateDelta = fixedDate(d.AuthoredDate)
+		d.CommittedDateDelta = fixedDate(d.CommittedDate)
+		commitData[h] = d
+	}
+}
+
+func fixedDate(rfc3339 string) string {
+	t, err := time.Parse(time.RFC3339, rfc3339)
 	if err != nil {
-		return fmt.Errorf("failed to marshal commit data: %w", err)
+		return rfc3339
 	}
+	return t.Format("2006-01-02")
+}
+
+// SideBySide lays out several rendered graphs next to each other, each under
+// its own caption, as the svg content of a single page.
+func SideBySide(captions []string, svgs []string) string {
+	var b strings.Builder
+	b.WriteString(`<div class="side-by-side">`)
+	for i, svgContent := range svgs {
+		b.WriteString(`<figure>`)
+		if i < len(captions) {
+			fmt.Fprintf(&b, `<figcaption>%s</figcaption>`, html.EscapeString(captions[i]))
+		}
+		b.WriteString(svgContent)
+		b.WriteString(`</figure>`)
+	}
+	b.WriteString(`</div>`)
+	return b.String()
+}
 
+// railwaySVG gives the drawing the id the page's script and style look
+// for, unless it has an id already.
+func railwaySVG(svgContent string) string {
 	if !strings.Contains(svgContent, `id="railway_svg"`) && !strings.Contains(svgContent, `id='railway_svg'`) {
 		svgTagStart := strings.Index(svgContent, "<svg")
 		if svgTagStart >= 0 {
@@ -294,16 +474,95 @@ func WriteHTML(
 			}
 		}
 	}
+	return svgContent
+}
+
+func WriteHTML(
+	w io.Writer,
+	svgContent string,
+	commitData map[string]CommitData,
+	title string,
+	opts HTMLOptions,
+) error {
+	template, err := getResource("html_template.html")
+	if err != nil {
+		return fmt.Errorf("failed to load HTML template: %w", err)
+	}
+
+	if opts.Reproducible {
+		FixedDates(commitData)
+	}
+	commitDataJSON, err := json.Marshal(commitData)
+	if err != nil {
+		return fmt.Errorf("failed to marshal commit data: %w", err)
+	}
+
+	trees := opts.Trees
+	if trees == nil {
+		trees = map[string][]TreeEntry{}
+	}
+	treesJSON, err := json.Marshal(trees)
+	if err != nil {
+		return fmt.Errorf("failed to marshal trees: %w", err)
+	}
+
+	svgContent = railwaySVG(svgContent)
 
 	template, err = replaceReferences(template)
 	if err != nil {
 		return fmt.Errorf("failed to replace resource references: %w", err)
 	}
 
+	extraCSS := opts.ExtraCSS
+	if opts.Print {
+		extraCSS = printCSS + extraCSS
+	}
+	if len(opts.Warnings) > 0 {
+		extraCSS = diagnosticsCSS + extraCSS
+	}
+	if len(opts.MergeLatencies) > 0 {
+		extraCSS = latencyCSS + extraCSS
+	}
+	if len(opts.Hotspots) > 0 {
+		extraCSS = hotspotsCSS + extraCSS
+	}
+	if len(opts.Groups) > 0 {
+		extraCSS = groupsCSS + extraCSS
+	}
+	webFonts := webFontsCSS
+	if opts.SingleFile {
+		webFonts = ""
+	}
 	placeholders := map[string]string{
 		"title": html.EscapeString(title),
 		"svg":   svgContent,
 		"data":  string(commitDataJSON),
+		"serve": fmt.Sprint(opts.Serve),
+		"print": fmt.Sprint(opts.Print),
+		"trees": string(treesJSON),
+
+		"diagnostics": diagnosticsPanel(opts.Warnings),
+		"latency":     latencyPanel(opts.MergeLatencies),
+		"hotspots":    hotspotsPanel(opts.Hotspots),
+		"groups":      groupsPanel(opts.GroupsLabel, opts.Groups),
+
+		"web_fonts": webFonts,
+		"extra_css": extraCSS,
+		"extra_js":  opts.ExtraJS,
+
+		"deferred": "",
+		"loader":   "",
+	}
+	if opts.Assets != "" {
+		loader, err := assetsLoader(opts.Assets)
+		if err != nil {
+			return err
+		}
+		placeholders["svg"] = ""
+		placeholders["data"] = "gitTreeAssets.data"
+		placeholders["trees"] = "gitTreeAssets.trees"
+		placeholders["deferred"] = ` type="text/x-deferred"`
+		placeholders["loader"] = loader
 	}
 	template = replacePlaceholders(template, placeholders)
 	_, err = w.Write([]byte(template))
@@ -0,0 +1,190 @@
+package view
+
+import (
+	"bytes"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anton-dovnar/git-tree/structs"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// XML namespace names look like URLs but are never fetched.
+var namespaceURL = regexp.MustCompile(`http://www\.w3\.org/(2000/svg|1999/xlink)`)
+
+func TestSingleFileHasNoRemoteReferences(t *testing.T) {
+	when := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	sig := object.Signature{Name: "A U Thor", Email: "author@example.com", When: when}
+	root := plumbing.NewHash("1111111111111111111111111111111111111111")
+	tip := plumbing.NewHash("2222222222222222222222222222222222222222")
+	commits := map[plumbing.Hash]*structs.CommitInfo{
+		root: {
+			Commit:     &object.Commit{Hash: root, Author: sig, Committer: sig, Message: "Initial commit"},
+			References: mapset.NewSet("refs/heads/main"),
+		},
+		tip: {
+			Commit:     &object.Commit{Hash: tip, Author: sig, Committer: sig, Message: "feat(ui): add a page\n\nWith **markdown** and `code`.", ParentHashes: []plumbing.Hash{root}},
+			References: mapset.NewSet("refs/heads/main"),
+		},
+	}
+	positions := map[plumbing.Hash][2]int{root: {0, 0}, tip: {0, 1}}
+	heads := map[plumbing.Hash][]*plumbing.Reference{tip: {plumbing.NewHashReference("refs/heads/main", tip)}}
+	tags := map[plumbing.Hash][]*plumbing.Reference{root: {plumbing.NewHashReference("refs/tags/v1.0", root)}}
+	children := map[plumbing.Hash]mapset.Set[plumbing.Hash]{root: mapset.NewSet(tip)}
+
+	svgString, err := GenerateSVGString(commits, positions, heads, tags, children, SVGOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var page bytes.Buffer
+	if err := WriteHTML(&page, svgString, GenerateCommitData(commits, ""), "test", HTMLOptions{SingleFile: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	out := namespaceURL.ReplaceAllString(page.String(), "")
+	if loc := regexp.MustCompile(`https?://`).FindStringIndex(out); loc != nil {
+		t.Errorf("single-file output references %q", out[loc[0]:min(loc[0]+80, len(out))])
+	}
+	if urls := RemoteLoads(page.String()); len(urls) > 0 {
+		t.Errorf("RemoteLoads(single-file output) = %q, want none", urls)
+	}
+}
+
+func TestDecorationsOrderAndFold(t *testing.T) {
+	commit := SVGCommit{
+		Hash:     "2222222222222222222222222222222222222222",
+		Heads:    []string{"origin/main", "feature", "main", "origin/other"},
+		HeadRefs: []string{"refs/remotes/origin/main", "refs/heads/feature", "refs/heads/main", "refs/remotes/origin/other"},
+		Tags:     []string{"v1.0", "v1.1"},
+	}
+	sr := &SVGRailway{opts: SVGOptions{Head: "refs/heads/main", MaxRefs: 4}}
+	shown, more := sr.decorations(commit)
+
+	var got []string
+	for _, d := range append(shown, more...) {
+		got = append(got, d.text)
+	}
+	if want := []string{"main", "feature", "v1.0", "v1.1", "origin/other"}; !slices.Equal(got, want) {
+		t.Errorf("decorations = %q, want %q", got, want)
+	}
+	if len(shown) != 4 || len(more) != 1 {
+		t.Errorf("shown %d and more %d, want 4 and 1", len(shown), len(more))
+	}
+	if !slices.Equal(shown[0].synced, []string{"origin/main"}) {
+		t.Errorf("main is synced with %q, want origin/main", shown[0].synced)
+	}
+}
+
+func TestRemoteLoads(t *testing.T) {
+	page := `<style>@import url('https://fonts.example/a.css'); body { background: url(//cdn.example/b.png) }</style>` +
+		`<script src="https://cdn.example/c.js"></script><a href="https://example.com/">link</a>` +
+		`<script>let data = {"m": "<img src=\"http://img.example/d.png\">"};</script>`
+	want := []string{"https://fonts.example/a.css", "//cdn.example/b.png", "https://cdn.example/c.js", "http://img.example/d.png"}
+	got := RemoteLoads(page)
+	if len(got) != len(want) {
+		t.Fatalf("RemoteLoads = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("RemoteLoads[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestCommitDataEscapesTitles(t *testing.T) {
+	sig := object.Signature{Name: "A U Thor", Email: "author@example.com", When: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	h := plumbing.NewHash("1111111111111111111111111111111111111111")
+	commits := map[plumbing.Hash]*structs.CommitInfo{
+		h: {
+			Commit: &object.Commit{Hash: h, Author: sig, Committer: sig, Message: "fix: <script>alert(1)</script> for git-tree#12"},
+			Collapsed: []*object.Commit{
+				{Hash: h, Message: "<img src=x onerror=alert(1)>"},
+			},
+		},
+	}
+	data := GenerateCommitData(commits, "anton-dovnar/git-tree")[h.String()]
+	wantTitle := `&lt;script&gt;alert(1)&lt;/script&gt; for <a target="_blank" href="https://github.com/anton-dovnar/git-tree/issues/12">git-tree#12</a>`
+	if data.Message.Title != wantTitle {
+		t.Errorf("title = %q, want %q", data.Message.Title, wantTitle)
+	}
+	if got, want := data.Collapsed[0].Title, "&lt;img src=x onerror=alert(1)&gt;"; got != want {
+		t.Errorf("collapsed title = %q, want %q", got, want)
+	}
+}
+
+// TestPlaceholdersInCommitText renders a page whose commit subject spells
+// out template placeholders: they stay as text, and rendering twice gives
+// the same bytes.
+func TestPlaceholdersInCommitText(t *testing.T) {
+	sig := object.Signature{Name: "A U Thor", Email: "author@example.com", When: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	h := plumbing.NewHash("1111111111111111111111111111111111111111")
+	commits := map[plumbing.Hash]*structs.CommitInfo{
+		h: {Commit: &object.Commit{Hash: h, Author: sig, Committer: sig, Message: "docs: explain ((% svg %)) and ((% extra_js %))"}},
+	}
+	positions := map[plumbing.Hash][2]int{h: {0, 0}}
+	render := func() string {
+		t.Helper()
+		svgString, err := GenerateSVGString(commits, positions, nil, nil, nil, SVGOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var page bytes.Buffer
+		opts := HTMLOptions{Reproducible: true, ExtraJS: "window.extraScriptRan = true;"}
+		if err := WriteHTML(&page, svgString, GenerateCommitData(commits, ""), "test", opts); err != nil {
+			t.Fatal(err)
+		}
+		return page.String()
+	}
+
+	first := render()
+	for range 20 {
+		if render() != first {
+			t.Fatal("rendering the same page twice gave different bytes")
+		}
+	}
+	if n := strings.Count(first, "window.extraScriptRan"); n != 1 {
+		t.Errorf("extra JS appears %d times, want once", n)
+	}
+	if !strings.Contains(first, "((% svg %))") {
+		t.Error("placeholder in the commit subject was filled in")
+	}
+}
+
+// FuzzParseCommitMessage checks a conventional commit prefix is only split
+// off a message that has one, and that nothing is made up.
+func FuzzParseCommitMessage(f *testing.F) {
+	for _, seed := range []string{
+		"feat(ui): add a page\n\nWith **markdown** and `code`.",
+		"fix: add c",
+		"Merge branch 'x': y",
+		"(: ",
+		"a(b: c)",
+		"type(scope: title",
+		"",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, message string) {
+		commitType, scope, title := parseCommitMessage(message)
+		if commitType == "" {
+			if scope != "" || title != message {
+				t.Fatalf("no type but scope %q and title %q", scope, title)
+			}
+			return
+		}
+		if strings.Contains(commitType, " ") {
+			t.Fatalf("type %q has a space", commitType)
+		}
+		for _, part := range []string{commitType, scope, title} {
+			if !strings.Contains(message, part) {
+				t.Fatalf("%q is not part of the message", part)
+			}
+		}
+	})
+}
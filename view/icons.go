@@ -0,0 +1,70 @@
+package view
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// icon is a symbol drawn in place of an emoji. Symbols are drawn on a
+// 16×16 grid in currentColor, so a style sheet colors them through their
+// class, icon-<name>.
+type icon struct {
+	name  string
+	path  string // Filled with the even-odd rule
+	color string
+}
+
+// icons are keyed by the emoji they stand for at the start of a badge or
+// label, so badges from notes and other sources get them too.
+var icons = map[string]icon{
+	"🏷": {"tag", "M1 1h6l8 8-6 6-8-8zM4.5 3a1.5 1.5 0 1 0 0 3 1.5 1.5 0 0 0 0-3z", "#dad682"},
+	"🔒": {"lock", "M4 7V5a4 4 0 0 1 8 0v2h1v8H3V7zm2 0h4V5a2 2 0 0 0-4 0z", "#c9bcbc"},
+	"⚠": {"warning", "M8 1l7.5 14h-15zM7 6v5h2V6zm0 6v2h2v-2z", "#f0a35e"},
+	"✓": {"check", "M2 8.5L3.5 7l3 3 6-6L14 5.5 6.5 13z", "#57df6c"},
+	"📦": {"stash", "M1 3h14v3H1zM2 7h12v8H2zm4 2v1.5h4V9z", "#c9bcbc"},
+	"➜": {"head", "M1 6h7V2l7 6-7 6v-4H1z", "#61afef"},
+}
+
+// iconSize is the width and height icons are drawn at, next to 60% text.
+const iconSize = 9
+
+// iconFor splits the icon standing for the emoji text starts with off the
+// rest of text.
+func iconFor(text string) (icon, string, bool) {
+	for glyph, ic := range icons {
+		if rest, ok := strings.CutPrefix(text, glyph); ok {
+			rest = strings.TrimPrefix(rest, "️") // Emoji presentation selector
+			return ic, strings.TrimPrefix(rest, " "), true
+		}
+	}
+	return icon{}, text, false
+}
+
+// useIcon draws ic with its left edge at x, sitting on the text baseline
+// y, and returns the width taken including the gap after it.
+func (sr *SVGRailway) useIcon(x, y int, ic icon) int {
+	if sr.icons == nil {
+		sr.icons = make(map[string]icon)
+	}
+	sr.icons[ic.name] = ic
+	sr.Writer.Write([]byte(fmt.Sprintf(`<use xlink:href="#icon-%s" x="%d" y="%d" width="%d" height="%d" class="icon icon-%s"/>`,
+		ic.name, x, y-iconSize+1, iconSize, iconSize, ic.name)))
+	return iconSize + 3
+}
+
+// iconDefs defines the icons drawn, with a rule coloring each.
+func (sr *SVGRailway) iconDefs() (defs, style string) {
+	names := make([]string, 0, len(sr.icons))
+	for name := range sr.icons {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var d, s strings.Builder
+	for _, name := range names {
+		ic := sr.icons[name]
+		fmt.Fprintf(&d, `<symbol id="icon-%s" viewBox="0 0 16 16"><path d="%s" fill="currentColor" fill-rule="evenodd"/></symbol>`, name, ic.path)
+		fmt.Fprintf(&s, ".icon-%s { color: %s; }\n", name, sr.ink(ic.color))
+	}
+	return d.String(), s.String()
+}
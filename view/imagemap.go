@@ -0,0 +1,59 @@
+package view
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Box is a rectangle in pixels of the rendered image, from its top left.
+type Box struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// ImageMap locates every commit stop in the image the SVG renders to at its
+// natural size, so a static copy of the graph can be made clickable.
+type ImageMap struct {
+	Width   int            `json:"width"`
+	Height  int            `json:"height"`
+	Commits map[string]Box `json:"commits"`
+}
+
+// NewImageMap computes the image map for positions as DrawRailway lays
+// them out, right of a gutter of dates that many units wide, as DateGutter
+// measures it.
+func NewImageMap(positions map[plumbing.Hash][2]int, gutter int) ImageMap {
+	maxX, maxY := 0, 0
+	for _, pos := range positions {
+		maxX = max(maxX, pos[0])
+		maxY = max(maxY, pos[1])
+	}
+	px := func(v int) int { return int(float64(v) * scale) }
+
+	m := ImageMap{
+		Width:   px(gutter + paddingX*2 + (maxX+1)*stepX),
+		Height:  px(paddingY*2 + (maxY+1)*stepY),
+		Commits: make(map[string]Box, len(positions)),
+	}
+	for h, pos := range positions {
+		cx := gutter + paddingX + pos[0]*stepX
+		cy := paddingY + (maxY-pos[1])*stepY
+		m.Commits[h.String()] = Box{
+			X:      px(cx - stopR),
+			Y:      px(cy - stopR),
+			Width:  px(2 * stopR),
+			Height: px(2 * stopR),
+		}
+	}
+	return m
+}
+
+func WriteImageMap(w io.Writer, positions map[plumbing.Hash][2]int, gutter int) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(NewImageMap(positions, gutter))
+}
@@ -0,0 +1,95 @@
+package view
+
+import (
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MergeLatency is how long a merged branch took from its first commit to
+// the merge that brought it in, a common stand-in for review latency.
+type MergeLatency struct {
+	Merge   string // Full hash of the merge commit
+	Branch  string // Branch merged, as the merge message names it
+	Commits int    // Commits the merge brought in
+	Latency time.Duration
+}
+
+// FormatLatency shortens d to its largest unit: 45m, 5h, 3d or 6w.
+func FormatLatency(d time.Duration) string {
+	switch {
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	case d < 14*24*time.Hour:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+	return fmt.Sprintf("%dw", int(d.Hours()/24/7))
+}
+
+// latencyBuckets are the bars of the merge latency chart, each counting the
+// latencies below its limit and above the previous one.
+var latencyBuckets = []struct {
+	label string
+	limit time.Duration
+}{
+	{"< 1 hour", time.Hour},
+	{"< 1 day", 24 * time.Hour},
+	{"< 1 week", 7 * 24 * time.Hour},
+	{"< 1 month", 30 * 24 * time.Hour},
+	{"longer", 1<<63 - 1},
+}
+
+// latencyCSS styles the panel of HTMLOptions.MergeLatencies, added only to
+// pages that have one.
+const latencyCSS = `#latency {
+  color: var(--text-primary);
+  background: var(--bg-infobox);
+  border-radius: 8px;
+  padding: 8px 12px;
+}
+#latency summary { cursor: pointer; }
+#latency svg { display: block; margin-top: 8px; font-size: 12px; }
+#latency rect { fill: var(--text-primary); fill-opacity: 0.5; }
+#latency text { fill: var(--text-primary); }
+`
+
+// latencyPanel charts how merge latencies are distributed in the toolbar,
+// or is empty without any.
+func latencyPanel(latencies []MergeLatency) string {
+	if len(latencies) == 0 {
+		return ""
+	}
+	sorted := make([]time.Duration, len(latencies))
+	for i, l := range latencies {
+		sorted[i] = l.Latency
+	}
+	slices.Sort(sorted)
+	counts := make([]int, len(latencyBuckets))
+	for _, d := range sorted {
+		for i, bucket := range latencyBuckets {
+			if d < bucket.limit {
+				counts[i]++
+				break
+			}
+		}
+	}
+	most := slices.Max(counts)
+
+	const labelWidth, barWidth, rowHeight = 70, 160, 18
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n            <details id=\"latency\">\n                <summary>⏱ Merge latency: median %s over %d merges</summary>\n",
+		FormatLatency(sorted[len(sorted)/2]), len(sorted))
+	fmt.Fprintf(&b, "                <svg width=\"%d\" height=\"%d\">\n", labelWidth+barWidth+40, len(counts)*rowHeight)
+	for i, n := range counts {
+		y := i * rowHeight
+		width := barWidth * n / most
+		fmt.Fprintf(&b, "                    <text x=\"0\" y=\"%d\">%s</text><rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\"><title>%d merges</title></rect><text x=\"%d\" y=\"%d\">%d</text>\n",
+			y+13, html.EscapeString(latencyBuckets[i].label), labelWidth, y+3, width, rowHeight-6, n, labelWidth+width+4, y+13, n)
+	}
+	b.WriteString("                </svg>\n            </details>")
+	return b.String()
+}
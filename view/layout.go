@@ -0,0 +1,182 @@
+package view
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/anton-dovnar/git-tree/structs"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// LayoutVersion is the version of the Layout JSON contract. It changes only
+// when a field is removed or changes meaning; new fields may appear at any
+// time and consumers should ignore the ones they do not know.
+const LayoutVersion = 1
+
+// Layout is the arranged graph in a form meant for rendering outside of Go,
+// for example by a frontend component. Coordinates are grid cells: lane 0 is
+// the leftmost column and row 0 the top row.
+type Layout struct {
+	Lanes   int               `json:"lanes"`
+	Rows    int               `json:"rows"`
+	Commits []LayoutCommit    `json:"commits"` // Top to bottom, left to right
+	Edges   []LayoutEdge      `json:"edges"`   // In drawing order
+	Colors  map[string]string `json:"colors"`  // Color of every reference used by an edge, as #rrggbb
+
+	Geometry Geometry `json:"geometry"`
+}
+
+// Geometry maps grid cells to the coordinates of the SVG renderer, whose
+// viewBox is Width by Height. Commit stops are centered at
+// (PaddingX + lane*StepX, PaddingY + row*StepY); the SVG is shown at Scale
+// times its viewBox size.
+type Geometry struct {
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	StepX      int     `json:"step_x"`
+	StepY      int     `json:"step_y"`
+	PaddingX   int     `json:"padding_x"`
+	PaddingY   int     `json:"padding_y"`
+	StopRadius int     `json:"stop_radius"`
+	RailWidth  int     `json:"rail_width"`
+	Scale      float64 `json:"scale"`
+}
+
+type LayoutCommit struct {
+	Hash    string     `json:"hash"`
+	Lane    int        `json:"lane"`
+	Row     int        `json:"row"`
+	Parents []string   `json:"parents"`
+	Heads   []string   `json:"heads,omitempty"`
+	Tags    []string   `json:"tags,omitempty"`
+	Data    CommitData `json:"data"`
+}
+
+// LayoutEdge is a rail from a commit down to one of its parents. A parent
+// outside the graph gets a stub one row long.
+type LayoutEdge struct {
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	FromLane int      `json:"from_lane"`
+	FromRow  int      `json:"from_row"`
+	ToLane   int      `json:"to_lane"`
+	ToRow    int      `json:"to_row"`
+	Refs     []string `json:"refs"`  // Side by side stripes, left to right; gray when empty
+	Route    string   `json:"route"` // straight, curve or detour (around a commit in the parent's lane)
+
+	// Paths holds the SVG path data the renderer strokes for each stripe,
+	// parallel to Refs (a single gray stripe when Refs is empty), with the
+	// exact S-curve control points so other renderers can reproduce the rails.
+	Paths       []string `json:"paths"`
+	StrokeWidth float64  `json:"stroke_width"` // Width of each stripe
+}
+
+// MarshalJSON stamps the contract version onto the document.
+func (l Layout) MarshalJSON() ([]byte, error) {
+	type plain Layout
+	return json.Marshal(struct {
+		Version int `json:"version"`
+		plain
+	}{LayoutVersion, plain(l)})
+}
+
+// NewLayout arranges the same graph DrawRailway draws.
+func NewLayout(
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	positions map[plumbing.Hash][2]int,
+	heads map[plumbing.Hash][]*plumbing.Reference,
+	tags map[plumbing.Hash][]*plumbing.Reference,
+	children map[plumbing.Hash]mapset.Set[plumbing.Hash],
+	commitData map[string]CommitData,
+) Layout {
+	maxX, maxY := 0, 0
+	for _, pos := range positions {
+		maxX = max(maxX, pos[0])
+		maxY = max(maxY, pos[1])
+	}
+	displayPositions := make(map[plumbing.Hash][2]int, len(positions))
+	for h, pos := range positions {
+		displayPositions[h] = [2]int{pos[0], maxY - pos[1]}
+	}
+
+	svgCommits := convertToSVGCommits(commits, displayPositions, heads, tags)
+	edges := railEdges(commits, positions, displayPositions, maxY, svgCommits, children)
+
+	layout := Layout{
+		Lanes:   maxX + 1,
+		Rows:    maxY + 1,
+		Commits: make([]LayoutCommit, 0, len(svgCommits)),
+		Edges:   make([]LayoutEdge, 0, len(edges)),
+		Colors:  make(map[string]string),
+		Geometry: Geometry{
+			Width:      paddingX*2 + (maxX+1)*stepX,
+			Height:     paddingY*2 + (maxY+1)*stepY,
+			StepX:      stepX,
+			StepY:      stepY,
+			PaddingX:   paddingX,
+			PaddingY:   paddingY,
+			StopRadius: stopR,
+			RailWidth:  railW,
+			Scale:      scale,
+		},
+	}
+	if len(positions) == 0 {
+		layout.Lanes, layout.Rows = 0, 0
+	}
+	for _, c := range svgCommits {
+		parents := make([]string, 0, len(c.Parents))
+		for _, p := range c.Parents {
+			parents = append(parents, p.String())
+		}
+		layout.Commits = append(layout.Commits, LayoutCommit{
+			Hash:    c.Hash,
+			Lane:    c.X,
+			Row:     c.Y,
+			Parents: parents,
+			Heads:   c.Heads,
+			Tags:    c.Tags,
+			Data:    commitData[c.Hash],
+		})
+	}
+
+	colors := NewSVGRailway(nil, SVGOptions{})
+	for _, e := range edges {
+		route := "straight"
+		switch {
+		case e.Middle:
+			route = "detour"
+		case e.X != e.PX:
+			route = "curve"
+		}
+		refs := e.Refs
+		if refs == nil {
+			refs = []string{}
+		}
+		for _, ref := range refs {
+			layout.Colors[ref] = colorToHex(colors.refToColor(ref))
+		}
+		paths, w := railPaths(e.X, e.Y, e.PX, e.PY, max(1, len(refs)), e.Middle)
+		layout.Edges = append(layout.Edges, LayoutEdge{
+			From:     e.From,
+			To:       e.To,
+			FromLane: e.X,
+			FromRow:  e.Y,
+			ToLane:   e.PX,
+			ToRow:    e.PY,
+			Refs:     refs,
+			Route:    route,
+
+			Paths:       paths,
+			StrokeWidth: w,
+		})
+	}
+	return layout
+}
+
+func WriteLayout(w io.Writer, layout Layout) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(layout)
+}
@@ -0,0 +1,136 @@
+package view
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	fenceRegex    = regexp.MustCompile("^\\s*(```|~~~)")
+	headingRegex  = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	bulletRegex   = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	orderedRegex  = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	quoteRegex    = regexp.MustCompile(`^\s*>\s?(.*)$`)
+	linkRegex     = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	strongRegex   = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	emphasisRegex = regexp.MustCompile(`(^|[^\w*])\*([^*\s][^*]*)\*`)
+)
+
+// renderMarkdown renders a commit body written in Markdown as HTML. Only a
+// safe subset is produced: paragraphs, headings, lists, quotes, code and
+// links to http, https and mailto URLs. Everything else is escaped, so raw
+// HTML in a commit message shows up as text.
+func renderMarkdown(text, ghSlug string) string {
+	var b strings.Builder
+	var paragraph []string
+	list := "" // Tag of the open list, if any
+
+	flush := func() {
+		if len(paragraph) > 0 {
+			fmt.Fprintf(&b, "<p>%s</p>", renderInline(strings.Join(paragraph, "\n"), ghSlug))
+			paragraph = nil
+		}
+	}
+	closeList := func() {
+		if list != "" {
+			fmt.Fprintf(&b, "</%s>", list)
+			list = ""
+		}
+	}
+	item := func(tag, content string) {
+		flush()
+		if list != tag {
+			closeList()
+			fmt.Fprintf(&b, "<%s>", tag)
+			list = tag
+		}
+		fmt.Fprintf(&b, "<li>%s</li>", renderInline(content, ghSlug))
+	}
+
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t\r")
+		if m := fenceRegex.FindStringSubmatch(line); m != nil {
+			flush()
+			closeList()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), m[1]); i++ {
+				code = append(code, lines[i])
+			}
+			fmt.Fprintf(&b, "<pre><code>%s</code></pre>", html.EscapeString(strings.Join(code, "\n")))
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			flush()
+			closeList()
+			continue
+		}
+		if m := headingRegex.FindStringSubmatch(line); m != nil {
+			flush()
+			closeList()
+			level := min(len(m[1])+3, 6)
+			fmt.Fprintf(&b, "<h%d>%s</h%d>", level, renderInline(m[2], ghSlug), level)
+			continue
+		}
+		if m := bulletRegex.FindStringSubmatch(line); m != nil {
+			item("ul", m[1])
+			continue
+		}
+		if m := orderedRegex.FindStringSubmatch(line); m != nil {
+			item("ol", m[1])
+			continue
+		}
+		if m := quoteRegex.FindStringSubmatch(line); m != nil {
+			flush()
+			closeList()
+			fmt.Fprintf(&b, "<blockquote>%s</blockquote>", renderInline(m[1], ghSlug))
+			continue
+		}
+		closeList()
+		paragraph = append(paragraph, line)
+	}
+	flush()
+	closeList()
+	return b.String()
+}
+
+// renderInline renders code spans, links and emphasis within a block.
+func renderInline(text, ghSlug string) string {
+	var b strings.Builder
+	parts := strings.Split(text, "`")
+	if len(parts)%2 == 0 { // Unmatched backtick
+		n := len(parts)
+		parts = append(parts[:n-2], parts[n-2]+"`"+parts[n-1])
+	}
+	for i, part := range parts {
+		if i%2 == 1 {
+			fmt.Fprintf(&b, "<code>%s</code>", html.EscapeString(part))
+			continue
+		}
+		last := 0
+		for _, m := range linkRegex.FindAllStringSubmatchIndex(part, -1) {
+			b.WriteString(issueLink(emphasis(html.EscapeString(part[last:m[0]])), ghSlug))
+			label, url := part[m[2]:m[3]], part[m[4]:m[5]]
+			if safeURL(url) {
+				fmt.Fprintf(&b, `<a target="_blank" rel="noopener" href="%s">%s</a>`, html.EscapeString(url), emphasis(html.EscapeString(label)))
+			} else {
+				b.WriteString(html.EscapeString(part[m[0]:m[1]]))
+			}
+			last = m[1]
+		}
+		b.WriteString(issueLink(emphasis(html.EscapeString(part[last:])), ghSlug))
+	}
+	return b.String()
+}
+
+func emphasis(escaped string) string {
+	escaped = strongRegex.ReplaceAllString(escaped, "<strong>$1</strong>")
+	return emphasisRegex.ReplaceAllString(escaped, "$1<em>$2</em>")
+}
+
+func safeURL(url string) bool {
+	lower := strings.ToLower(url)
+	return strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "mailto:")
+}
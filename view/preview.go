@@ -0,0 +1,226 @@
+package view
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/anton-dovnar/git-tree/structs"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Size of the social preview, as GitHub and most link unfurlers expect.
+const (
+	PreviewWidth  = 1200
+	PreviewHeight = 630
+
+	previewStepX   = 44
+	previewStepY   = 38
+	previewStopR   = 9
+	previewRailW   = 4.5
+	previewMarginX = 640
+	previewMarginY = 40
+)
+
+// RenderPreview writes a PNG snapshot of the arranged commits with title and
+// subtitle overlaid in blocky capitals. The newest rows are drawn from the
+// top; rows and lanes that do not fit are cut off, and rails to parents
+// that were left out run off the bottom edge.
+func RenderPreview(
+	w io.Writer,
+	title, subtitle string,
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	positions map[plumbing.Hash][2]int,
+) error {
+	img := image.NewRGBA(image.Rect(0, 0, PreviewWidth, PreviewHeight))
+	top, bottom := color.RGBA{0x2b, 0x30, 0x37, 0xff}, color.RGBA{0x4e, 0x54, 0x5b, 0xff}
+	for y := 0; y < PreviewHeight; y++ {
+		t := float64(y) / PreviewHeight
+		c := mix(top, bottom, t)
+		for x := 0; x < PreviewWidth; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+
+	maxY := 0
+	for _, pos := range positions {
+		maxY = max(maxY, pos[1])
+	}
+	point := func(pos [2]int) (float64, float64) {
+		return previewMarginX + float64(pos[0])*previewStepX, previewMarginY + float64(maxY-pos[1])*previewStepY
+	}
+
+	hashes := make([]plumbing.Hash, 0, len(positions))
+	for h := range positions {
+		hashes = append(hashes, h)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i].String() < hashes[j].String() })
+
+	palette := &SVGRailway{colors: make(map[string]color.RGBA)}
+	commitColor := func(h plumbing.Hash) color.RGBA { return palette.commitColor(commits[h]) }
+
+	for _, h := range hashes {
+		x, y := point(positions[h])
+		c := commitColor(h)
+		for _, p := range commits[h].Commit.ParentHashes {
+			pos, ok := positions[p]
+			if !ok {
+				capsule(img, x, y, x, PreviewHeight+previewRailW, previewRailW, c)
+				continue
+			}
+			px, py := point(pos)
+			if px == x {
+				capsule(img, x, y, px, py, previewRailW, c)
+				continue
+			}
+			// Leave the lane of whichever end sits further out, one row
+			// before the other end.
+			if math.Abs(px-previewMarginX) > math.Abs(x-previewMarginX) {
+				capsule(img, x, y, px, y+previewStepY, previewRailW, commitColor(p))
+				capsule(img, px, y+previewStepY, px, py, previewRailW, commitColor(p))
+			} else {
+				capsule(img, x, y, x, py-previewStepY, previewRailW, c)
+				capsule(img, x, py-previewStepY, px, py, previewRailW, c)
+			}
+		}
+	}
+	for _, h := range hashes {
+		x, y := point(positions[h])
+		capsule(img, x, y, x, y, previewStopR+2, color.RGBA{0x2b, 0x30, 0x37, 0xff})
+		capsule(img, x, y, x, y, previewStopR, color.RGBA{219, 219, 219, 255})
+	}
+
+	// A shade behind the text keeps it readable over busy graphs.
+	shade := color.RGBA{0x1b, 0x1f, 0x24, 0xff}
+	for y := 0; y < PreviewHeight; y++ {
+		for x := 0; x < previewMarginX-40; x++ {
+			blend(img, x, y, shade, 0.55)
+		}
+	}
+	titleScale := min(12, (previewMarginX-120)/(max(utf8.RuneCountInString(title), 1)*6))
+	textY := PreviewHeight/2 - 7*titleScale
+	drawText(img, 60, textY, titleScale, title, color.RGBA{0xdd, 0xdd, 0xdd, 0xff})
+	drawText(img, 60, textY+9*titleScale, 3, subtitle, color.RGBA{0x9c, 0xa3, 0xaf, 0xff})
+
+	return png.Encode(w, img)
+}
+
+// commitColor is the color of the first ref, by name, a commit was on; gray
+// for commits on none or missing from the graph.
+func (sr *SVGRailway) commitColor(ci *structs.CommitInfo) color.RGBA {
+	if ci == nil || ci.References == nil || ci.References.Cardinality() == 0 {
+		return color.RGBA{160, 160, 160, 255}
+	}
+	refs := ci.References.ToSlice()
+	sort.Strings(refs)
+	return sr.refToColor(refs[0])
+}
+
+func mix(a, b color.RGBA, t float64) color.RGBA {
+	lerp := func(x, y uint8) uint8 { return uint8(float64(x) + (float64(y)-float64(x))*t) }
+	return color.RGBA{lerp(a.R, b.R), lerp(a.G, b.G), lerp(a.B, b.B), 0xff}
+}
+
+// blend paints c over the pixel at x, y with the given coverage.
+func blend(img *image.RGBA, x, y int, c color.RGBA, coverage float64) {
+	if !(image.Point{x, y}.In(img.Rect)) || coverage <= 0 {
+		return
+	}
+	img.SetRGBA(x, y, mix(img.RGBAAt(x, y), c, min(coverage, 1)))
+}
+
+// capsule draws a thick, round-capped line from x0, y0 to x1, y1 with
+// antialiased edges; equal ends make a dot.
+func capsule(img *image.RGBA, x0, y0, x1, y1, r float64, c color.RGBA) {
+	minX, maxX := int(math.Floor(min(x0, x1)-r-1)), int(math.Ceil(max(x0, x1)+r+1))
+	minY, maxY := int(math.Floor(min(y0, y1)-r-1)), int(math.Ceil(max(y0, y1)+r+1))
+	dx, dy := x1-x0, y1-y0
+	length := dx*dx + dy*dy
+	for y := max(minY, 0); y <= min(maxY, img.Rect.Max.Y-1); y++ {
+		for x := max(minX, 0); x <= min(maxX, img.Rect.Max.X-1); x++ {
+			px, py := float64(x)+0.5, float64(y)+0.5
+			t := 0.0
+			if length > 0 {
+				t = math.Max(0, math.Min(1, ((px-x0)*dx+(py-y0)*dy)/length))
+			}
+			d := math.Hypot(px-(x0+t*dx), py-(y0+t*dy))
+			blend(img, x, y, c, r-d+0.5)
+		}
+	}
+}
+
+// drawText writes s in a 5x7 pixel font, every font pixel a scale-sized
+// square. Letters are drawn as capitals; characters the font lacks as '?'.
+func drawText(img *image.RGBA, x, y, scale int, s string, c color.RGBA) {
+	for _, ch := range strings.ToUpper(s) {
+		glyph, ok := glyphs[ch]
+		if !ok {
+			glyph = glyphs['?']
+		}
+		for row, bits := range glyph {
+			for col, bit := range bits {
+				if bit != '#' {
+					continue
+				}
+				for dy := 0; dy < scale; dy++ {
+					for dx := 0; dx < scale; dx++ {
+						blend(img, x+col*scale+dx, y+row*scale+dy, c, 1)
+					}
+				}
+			}
+		}
+		x += 6 * scale
+	}
+}
+
+var glyphs = map[rune][7]string{
+	' ': {".....", ".....", ".....", ".....", ".....", ".....", "....."},
+	'A': {".###.", "#...#", "#...#", "#####", "#...#", "#...#", "#...#"},
+	'B': {"####.", "#...#", "#...#", "####.", "#...#", "#...#", "####."},
+	'C': {".###.", "#...#", "#....", "#....", "#....", "#...#", ".###."},
+	'D': {"####.", "#...#", "#...#", "#...#", "#...#", "#...#", "####."},
+	'E': {"#####", "#....", "#....", "####.", "#....", "#....", "#####"},
+	'F': {"#####", "#....", "#....", "####.", "#....", "#....", "#...."},
+	'G': {".###.", "#...#", "#....", "#.###", "#...#", "#...#", ".####"},
+	'H': {"#...#", "#...#", "#...#", "#####", "#...#", "#...#", "#...#"},
+	'I': {".###.", "..#..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	'J': {"..###", "...#.", "...#.", "...#.", "...#.", "#..#.", ".##.."},
+	'K': {"#...#", "#..#.", "#.#..", "##...", "#.#..", "#..#.", "#...#"},
+	'L': {"#....", "#....", "#....", "#....", "#....", "#....", "#####"},
+	'M': {"#...#", "##.##", "#.#.#", "#.#.#", "#...#", "#...#", "#...#"},
+	'N': {"#...#", "#...#", "##..#", "#.#.#", "#..##", "#...#", "#...#"},
+	'O': {".###.", "#...#", "#...#", "#...#", "#...#", "#...#", ".###."},
+	'P': {"####.", "#...#", "#...#", "####.", "#....", "#....", "#...."},
+	'Q': {".###.", "#...#", "#...#", "#...#", "#.#.#", "#..#.", ".##.#"},
+	'R': {"####.", "#...#", "#...#", "####.", "#.#..", "#..#.", "#...#"},
+	'S': {".####", "#....", "#....", ".###.", "....#", "....#", "####."},
+	'T': {"#####", "..#..", "..#..", "..#..", "..#..", "..#..", "..#.."},
+	'U': {"#...#", "#...#", "#...#", "#...#", "#...#", "#...#", ".###."},
+	'V': {"#...#", "#...#", "#...#", "#...#", "#...#", ".#.#.", "..#.."},
+	'W': {"#...#", "#...#", "#...#", "#.#.#", "#.#.#", "#.#.#", ".#.#."},
+	'X': {"#...#", "#...#", ".#.#.", "..#..", ".#.#.", "#...#", "#...#"},
+	'Y': {"#...#", "#...#", ".#.#.", "..#..", "..#..", "..#..", "..#.."},
+	'Z': {"#####", "....#", "...#.", "..#..", ".#...", "#....", "#####"},
+	'0': {".###.", "#...#", "#..##", "#.#.#", "##..#", "#...#", ".###."},
+	'1': {"..#..", ".##..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	'2': {".###.", "#...#", "....#", "...#.", "..#..", ".#...", "#####"},
+	'3': {"#####", "...#.", "..#..", "...#.", "....#", "#...#", ".###."},
+	'4': {"...#.", "..##.", ".#.#.", "#..#.", "#####", "...#.", "...#."},
+	'5': {"#####", "#....", "####.", "....#", "....#", "#...#", ".###."},
+	'6': {"..##.", ".#...", "#....", "####.", "#...#", "#...#", ".###."},
+	'7': {"#####", "....#", "...#.", "..#..", ".#...", ".#...", ".#..."},
+	'8': {".###.", "#...#", "#...#", ".###.", "#...#", "#...#", ".###."},
+	'9': {".###.", "#...#", "#...#", ".####", "....#", "...#.", ".##.."},
+	'-': {".....", ".....", ".....", "#####", ".....", ".....", "....."},
+	'_': {".....", ".....", ".....", ".....", ".....", ".....", "#####"},
+	'.': {".....", ".....", ".....", ".....", ".....", ".##..", ".##.."},
+	',': {".....", ".....", ".....", ".....", ".##..", "..#..", ".#..."},
+	':': {".....", ".##..", ".##..", ".....", ".##..", ".##..", "....."},
+	'/': {".....", "....#", "...#.", "..#..", ".#...", "#....", "....."},
+	'?': {".###.", "#...#", "....#", "...#.", "..#..", ".....", "..#.."},
+}
@@ -0,0 +1,96 @@
+package view
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	svg "github.com/ajstarks/svgo"
+	"github.com/anton-dovnar/git-tree/structs"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// Graph is what a Renderer draws: the commits and refs as collected.
+type Graph struct {
+	Commits  map[plumbing.Hash]*structs.CommitInfo
+	Children map[plumbing.Hash]mapset.Set[plumbing.Hash]
+	Heads    map[plumbing.Hash][]*plumbing.Reference
+	Tags     map[plumbing.Hash][]*plumbing.Reference
+}
+
+// Renderer writes a graph in some output format, given the lane and row of
+// every commit as arranged by a layout: row 0 holds the oldest commit. Any
+// type implementing it can be used as an output format of its own.
+type Renderer interface {
+	Render(ctx context.Context, g Graph, positions map[plumbing.Hash][2]int, w io.Writer) error
+}
+
+// SVGRenderer draws the railway as a standalone SVG.
+type SVGRenderer struct {
+	Options SVGOptions
+}
+
+func (r SVGRenderer) Render(ctx context.Context, g Graph, positions map[plumbing.Hash][2]int, w io.Writer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	DrawRailway(svg.New(w), g.Commits, positions, g.Heads, g.Tags, g.Children, r.Options)
+	return nil
+}
+
+// HTMLRenderer writes the interactive page: the railway with the commit
+// data behind its popups.
+type HTMLRenderer struct {
+	Title      string
+	GitHubSlug string // "owner/repo" to link commits and issues to GitHub; empty links nothing
+	SVG        SVGOptions
+	HTML       HTMLOptions
+}
+
+func (r HTMLRenderer) Render(ctx context.Context, g Graph, positions map[plumbing.Hash][2]int, w io.Writer) error {
+	var buf bytes.Buffer
+	if err := (SVGRenderer{r.SVG}).Render(ctx, g, positions, &buf); err != nil {
+		return err
+	}
+	return WriteHTML(w, buf.String(), GenerateCommitData(g.Commits, r.GitHubSlug), r.Title, r.HTML)
+}
+
+// LayoutRenderer writes the arrangement as JSON for other frontends, see
+// Layout.
+type LayoutRenderer struct {
+	GitHubSlug   string
+	Reproducible bool // Absolute instead of relative dates
+}
+
+func (r LayoutRenderer) Render(ctx context.Context, g Graph, positions map[plumbing.Hash][2]int, w io.Writer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	commitData := GenerateCommitData(g.Commits, r.GitHubSlug)
+	if r.Reproducible {
+		FixedDates(commitData)
+	}
+	return WriteLayout(w, NewLayout(g.Commits, positions, g.Heads, g.Tags, g.Children, commitData))
+}
+
+// BadgeRenderer writes the README badge; see GenerateBadge. Arrange only
+// the newest few dozen commits for it, the micro-graph has no room for more.
+type BadgeRenderer struct {
+	Branches     int // Branch count shown; 0 counts the heads of the graph
+	Reproducible bool
+}
+
+func (r BadgeRenderer) Render(ctx context.Context, g Graph, positions map[plumbing.Hash][2]int, w io.Writer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	branches := r.Branches
+	if branches == 0 {
+		for _, refs := range g.Heads {
+			branches += len(refs)
+		}
+	}
+	return GenerateBadge(w, g.Commits, positions, branches, r.Reproducible)
+}
@@ -0,0 +1,25 @@
+// Fetches the drawing and data that -assets-dir wrote next to the page,
+// then runs the page's scripts, which were held back until they arrive.
+function fetchAsset(url, parse) {
+    return fetch(url).then((response) => {
+        if (!response.ok) throw new Error(url + ": " + response.status + " " + response.statusText);
+        return parse(response);
+    });
+}
+
+Promise.all([
+    fetchAsset(assets.svg, (r) => r.text()),
+    fetchAsset(assets.data, (r) => r.json()),
+    fetchAsset(assets.trees, (r) => r.json()),
+]).then(([svg, data, trees]) => {
+    document.getElementById("railway").innerHTML = svg;
+    window.gitTreeAssets = { data: data, trees: trees };
+    for (const deferred of document.querySelectorAll('script[type="text/x-deferred"]')) {
+        const script = document.createElement("script");
+        script.textContent = deferred.textContent;
+        deferred.replaceWith(script);
+    }
+}).catch((err) => {
+    document.getElementById("railway").textContent =
+        "Failed to load the graph (" + err.message + "). Pages written with -assets-dir have to be opened over HTTP.";
+});
@@ -1,14 +1,26 @@
 let data = ((% data %));
+const serveMode = ((% serve %));
+const trees = ((% trees %));
+const printMode = ((% print %));
 var infoboxTimer;
+var selectedCommit = null;
+
+// stopHash is the commit of a stop, or null for anything else. Stops are
+// found by data-commit, as ids differ between graphs sharing the page.
+function stopHash(el) {
+    if (!el || !el.classList || !el.classList.contains("stop")) return null;
+    return data[el.dataset.commit] ? el.dataset.commit : null;
+}
 
 function showCommitInfo(target) {
-    if (!target || !target.id || !data[target.id]) return;
-    const commit = data[target.id];
+    const hash = stopHash(target);
+    if (!hash) return;
+    const commit = data[hash];
     document.getElementById("hash").innerHTML = commit.hash;
     const typeEl = document.getElementById("type");
     const scopeEl = document.getElementById("scope");
-    if (commit.message.type) { typeEl.style.display = "inline"; typeEl.innerHTML = commit.message.type; } else { typeEl.style.display = "none"; }
-    if (commit.message.scope) { scopeEl.style.display = "inline"; scopeEl.innerHTML = commit.message.scope; } else { scopeEl.style.display = "none"; }
+    if (commit.message.type) { typeEl.style.display = "inline"; typeEl.textContent = commit.message.type; } else { typeEl.style.display = "none"; }
+    if (commit.message.scope) { scopeEl.style.display = "inline"; scopeEl.textContent = commit.message.scope; } else { scopeEl.style.display = "none"; }
     document.getElementById("title").innerHTML = commit.message.title;
     document.getElementById("message").innerHTML = commit.message.body;
     document.getElementById("author").innerHTML = commit.author;
@@ -17,12 +29,63 @@ function showCommitInfo(target) {
     document.getElementById("authored-date").setAttribute("title", commit.authored_date);
     document.getElementById("committed-date").innerHTML = commit.committed_date_delta;
     document.getElementById("committed-date").setAttribute("title", commit.committed_date);
+    showFiles(commit.files || []);
+    showBadges(commit.badges || []);
+    showCollapsed(commit.collapsed || []);
 
     const infobox = document.getElementById("infobox");
     infobox.style.visibility = "visible";
     infobox.style.opacity = "100%";
 }
 
+function showFiles(files) {
+    const filesEl = document.getElementById("files");
+    filesEl.innerHTML = "";
+    filesEl.style.display = files.length ? "block" : "none";
+    for (const f of files) {
+        const li = document.createElement("li");
+        const name = document.createElement("span");
+        name.className = "file-name";
+        name.dir = "auto";
+        name.textContent = f.old_name ? f.old_name + " → " + f.name : f.name;
+        const add = document.createElement("span");
+        add.className = "additions";
+        add.textContent = "+" + f.additions;
+        const del = document.createElement("span");
+        del.className = "deletions";
+        del.textContent = "-" + f.deletions;
+        li.append(name, " ", add, " ", del);
+        filesEl.appendChild(li);
+    }
+}
+
+function showBadges(badges) {
+    const badgesEl = document.getElementById("badges");
+    badgesEl.innerHTML = "";
+    badgesEl.style.display = badges.length ? "block" : "none";
+    for (const b of badges) {
+        const li = document.createElement("li");
+        li.textContent = b.detail ? b.text + ": " + b.detail : b.text;
+        badgesEl.appendChild(li);
+    }
+}
+
+function showCollapsed(collapsed) {
+    const collapsedEl = document.getElementById("collapsed");
+    collapsedEl.innerHTML = "";
+    collapsedEl.style.display = collapsed.length ? "block" : "none";
+    for (const c of collapsed) {
+        const li = document.createElement("li");
+        const hash = document.createElement("span");
+        hash.className = "hash";
+        hash.textContent = c.hash;
+        const title = document.createElement("span");
+        title.innerHTML = c.title;
+        li.append(hash, " ", title);
+        collapsedEl.appendChild(li);
+    }
+}
+
 function hideCommitInfo() {
     if (infoboxTimer != null) { clearTimeout(infoboxTimer); infoboxTimer = null; }
     infoboxTimer = setTimeout(() => {
@@ -33,7 +96,7 @@ function hideCommitInfo() {
 }
 
 window.addEventListener('mouseover', (e) => {
-    if (data[e.target.id]) {
+    if (stopHash(e.target)) {
         if (infoboxTimer != null) { clearTimeout(infoboxTimer); infoboxTimer = null; }
         const infobox = document.getElementById("infobox");
         const maxY = window.innerHeight - infobox.offsetHeight;
@@ -48,7 +111,7 @@ window.addEventListener('mouseover', (e) => {
 });
 
 window.addEventListener('focusin', (e) => {
-    if (data[e.target.id]) {
+    if (stopHash(e.target)) {
         if (infoboxTimer != null) { clearTimeout(infoboxTimer); infoboxTimer = null; }
         const infobox = document.getElementById("infobox");
         const rect = e.target.getBoundingClientRect();
@@ -60,3 +123,655 @@ window.addEventListener('focusin', (e) => {
 });
 
 window.addEventListener('focusout', () => { hideCommitInfo(); });
+
+// The page follows the system's light or dark preference until a theme is
+// picked with the toggle, which is remembered for next time.
+const themeQuery = window.matchMedia("(prefers-color-scheme: light)");
+
+function storedTheme() {
+    try { return localStorage.getItem("git-tree-theme"); } catch (e) { return null; }
+}
+
+function applyTheme() {
+    const theme = storedTheme() || (themeQuery.matches ? "light" : "dark");
+    document.documentElement.dataset.theme = theme;
+    const toggle = document.getElementById("theme-toggle");
+    toggle.textContent = theme === "light" ? "☾ Dark" : "☀ Light";
+    toggle.title = "Switch to the " + (theme === "light" ? "dark" : "light") + " theme";
+}
+
+if (!printMode) {
+    const toggle = document.getElementById("theme-toggle");
+    toggle.hidden = false;
+    toggle.addEventListener("click", () => {
+        const next = document.documentElement.dataset.theme === "light" ? "dark" : "light";
+        try { localStorage.setItem("git-tree-theme", next); } catch (e) { /* Private browsing */ }
+        applyTheme();
+    });
+    themeQuery.addEventListener("change", applyTheme);
+    applyTheme();
+}
+
+// On touch screens pinching the graph zooms it, while panning is left to
+// the browser's own scrolling, and tapping a commit shows its details.
+(function () {
+    const railway = document.getElementById("railway");
+    const touches = new Map();
+    let zoom = 1, pinch = null, moved = false;
+
+    function distance() {
+        const [a, b] = [...touches.values()];
+        return Math.hypot(a.clientX - b.clientX, a.clientY - b.clientY);
+    }
+
+    railway.addEventListener("pointerdown", (e) => {
+        if (e.pointerType !== "touch") return;
+        touches.set(e.pointerId, e);
+        moved = touches.size > 1;
+        if (touches.size === 2) pinch = { distance: distance(), zoom: zoom };
+    });
+    railway.addEventListener("pointermove", (e) => {
+        if (!touches.has(e.pointerId)) return;
+        touches.set(e.pointerId, e);
+        moved = true;
+        if (!pinch || touches.size !== 2) return;
+        const svg = railway.querySelector("svg");
+        if (!svg) return;
+        const [a, b] = [...touches.values()];
+        const box = railway.getBoundingClientRect();
+        const midX = (a.clientX + b.clientX) / 2 - box.left, midY = (a.clientY + b.clientY) / 2 - box.top;
+        const next = Math.min(4, Math.max(0.5, pinch.zoom * distance() / pinch.distance));
+        const ratio = next / zoom;
+        zoom = next;
+        svg.style.width = zoom * 100 + "%";
+        svg.style.height = "auto";
+        railway.scrollLeft = (railway.scrollLeft + midX) * ratio - midX;
+        railway.scrollTop = (railway.scrollTop + midY) * ratio - midY;
+    });
+    function release(e) {
+        if (!touches.delete(e.pointerId)) return;
+        if (touches.size < 2) pinch = null;
+        if (e.type !== "pointerup" || moved || touches.size > 0) return;
+        if (stopHash(e.target)) {
+            if (infoboxTimer != null) { clearTimeout(infoboxTimer); infoboxTimer = null; }
+            showCommitInfo(e.target);
+        } else {
+            hideCommitInfo();
+        }
+    }
+    railway.addEventListener("pointerup", release);
+    railway.addEventListener("pointercancel", release);
+})();
+
+function focusCommit(hash) {
+    const stop = document.querySelector('#railway .stop[data-commit="' + hash + '"]');
+    if (!stop) return;
+    stop.scrollIntoView({ block: "center", inline: "center" });
+    stop.focus();
+}
+
+function selectCommit(hash) {
+    selectedCommit = hash;
+    document.getElementById("panel-hash").textContent = data[hash].hash;
+    document.getElementById("blame").innerHTML = "";
+    browseTree([{ name: "", hash: data[hash].tree }]);
+    if (!document.getElementById("tab-tags").hidden) showContainingTags();
+}
+
+function showTab(name) {
+    for (const tab of document.querySelectorAll(".tab")) {
+        tab.classList.toggle("active", tab.dataset.tab === name);
+    }
+    for (const content of document.querySelectorAll(".tab-content")) {
+        content.hidden = content.id !== "tab-" + name;
+    }
+}
+
+async function loadTree(hash) {
+    if (trees[hash]) return trees[hash];
+    if (!serveMode) return null;
+    const resp = await fetch("api/tree?" + new URLSearchParams({ hash: hash }));
+    if (!resp.ok) return null;
+    trees[hash] = await resp.json() || [];
+    return trees[hash];
+}
+
+// stack holds the directories from the root tree down to the one shown.
+async function browseTree(stack) {
+    const pathEl = document.getElementById("tree-path");
+    const treeEl = document.getElementById("tree");
+    const entries = await loadTree(stack[stack.length - 1].hash);
+    pathEl.innerHTML = "";
+    treeEl.innerHTML = "";
+    if (entries === null) { treeEl.textContent = "File listing is not available."; return; }
+
+    stack.forEach((dir, i) => {
+        const crumb = document.createElement("a");
+        crumb.href = "#";
+        crumb.textContent = (i === 0 ? "/" : dir.name + "/");
+        crumb.addEventListener("click", (e) => { e.preventDefault(); browseTree(stack.slice(0, i + 1)); });
+        pathEl.appendChild(crumb);
+    });
+
+    for (const entry of entries) {
+        const li = document.createElement("li");
+        li.className = entry.dir ? "tree-dir" : "tree-file";
+        if (entry.dir) {
+            const link = document.createElement("a");
+            link.href = "#";
+            link.textContent = entry.name + "/";
+            link.addEventListener("click", (e) => { e.preventDefault(); browseTree(stack.concat([entry])); });
+            li.appendChild(link);
+        } else if (serveMode) {
+            const path = stack.slice(1).map((d) => d.name + "/").join("") + entry.name;
+            const link = document.createElement("a");
+            link.href = "#";
+            link.textContent = entry.name;
+            link.title = "Blame " + path;
+            link.addEventListener("click", (e) => {
+                e.preventDefault();
+                document.getElementById("blame-path").value = path;
+                showTab("blame");
+                document.getElementById("blame-form").requestSubmit();
+            });
+            li.appendChild(link);
+        } else {
+            li.textContent = entry.name;
+        }
+        treeEl.appendChild(li);
+    }
+}
+
+function showBlame(hunks) {
+    const blame = document.getElementById("blame");
+    blame.innerHTML = "";
+    const table = document.createElement("table");
+    for (const hunk of hunks) {
+        hunk.lines.forEach((text, i) => {
+            const row = table.insertRow();
+            const who = row.insertCell();
+            who.className = "blame-commit";
+            if (i === 0) {
+                const link = document.createElement("a");
+                link.href = "#" + hunk.hash;
+                link.textContent = hunk.hash.slice(0, 7) + " " + hunk.author;
+                link.title = hunk.date;
+                if (data[hunk.hash]) {
+                    link.addEventListener("click", (e) => { e.preventDefault(); focusCommit(hunk.hash); });
+                } else {
+                    link.className = "missing";
+                }
+                who.appendChild(link);
+            }
+            const num = row.insertCell();
+            num.className = "blame-line";
+            num.textContent = hunk.start + i;
+            const code = row.insertCell();
+            code.className = "blame-text";
+            code.textContent = text;
+        });
+    }
+    blame.appendChild(table);
+}
+
+// selection lists the selected commits newest first, along first parents;
+// anchor is the commit a shift-click extends the selection from.
+var selection = [];
+var anchor = null;
+
+function firstParentPath(from, to) {
+    const path = [from];
+    for (let h = from; h !== to; ) {
+        const parents = data[h] && data[h].parents;
+        if (!parents || !parents.length || !data[parents[0]]) return null;
+        h = parents[0];
+        path.push(h);
+    }
+    return path;
+}
+
+function selectRange(anchor, hash) {
+    return firstParentPath(anchor, hash) || firstParentPath(hash, anchor) || [hash];
+}
+
+function selectionText(format) {
+    const oldest = selection[selection.length - 1];
+    const newest = data[selection[0]].hash;
+    const hasParent = (data[oldest].parents || []).length > 0;
+    switch (format) {
+    case "hashes":
+        return selection.slice().reverse().map((h) => data[h].hash).join(" ");
+    case "format-patch":
+        return hasParent ? "git format-patch " + data[oldest].hash + "^.." + newest : "git format-patch --root " + newest;
+    default:
+        return hasParent ? data[oldest].hash + "^.." + newest : newest;
+    }
+}
+
+function showSelection() {
+    for (const stop of document.querySelectorAll(".stop.selected")) stop.classList.remove("selected");
+    for (const h of selection) {
+        for (const stop of document.querySelectorAll('#railway .stop[data-commit="' + h + '"]')) stop.classList.add("selected");
+    }
+    const box = document.getElementById("selection");
+    box.hidden = selection.length === 0;
+    if (!selection.length) return;
+    document.getElementById("selection-count").textContent = selection.length + (selection.length === 1 ? " commit" : " commits");
+    document.getElementById("selection-output").value = selectionText(document.getElementById("selection-format").value);
+}
+
+// A Ctrl- or Cmd-click compares the clicked commit with the anchor: the
+// path between them is lit and their relationship shown with the selection.
+function ancestorsOf(hash) {
+    const seen = new Set([hash]);
+    for (const stack = [hash]; stack.length; ) {
+        for (const p of (data[stack.pop()] || {}).parents || []) {
+            if (data[p] && !seen.has(p)) { seen.add(p); stack.push(p); }
+        }
+    }
+    return seen;
+}
+
+// parentPath walks from a commit down to one of its ancestors, returning the
+// commits along the shortest way, both ends included.
+function parentPath(from, to) {
+    const via = new Map([[from, null]]);
+    for (const queue = [from]; queue.length; ) {
+        const h = queue.shift();
+        if (h === to) {
+            const path = [];
+            for (let c = h; c !== null; c = via.get(c)) path.unshift(c);
+            return path;
+        }
+        for (const p of (data[h] || {}).parents || []) {
+            if (data[p] && !via.has(p)) { via.set(p, h); queue.push(p); }
+        }
+    }
+    return null;
+}
+
+function compareCommits(a, b) {
+    const ancestorsA = ancestorsOf(a), ancestorsB = ancestorsOf(b);
+    if (ancestorsA.has(b)) return { relation: "descendant", paths: [parentPath(a, b)] };
+    if (ancestorsB.has(a)) return { relation: "ancestor", paths: [parentPath(b, a)] };
+    const common = [...ancestorsA].filter((h) => ancestorsB.has(h));
+    const inner = new Set(common.flatMap((h) => data[h].parents || []));
+    const bases = common.filter((h) => !inner.has(h));
+    if (!bases.length) return { relation: "unrelated", paths: [] };
+    return { relation: "diverged", bases: bases, paths: [parentPath(a, bases[0]), parentPath(b, bases[0])] };
+}
+
+// lightPaths fades the graph except for the given chains of commits, each
+// listed child first; no chains lights everything again.
+function lightPaths(paths) {
+    for (const svg of document.querySelectorAll("#railway svg")) {
+        for (const el of svg.querySelectorAll(".on-path")) el.classList.remove("on-path");
+        svg.classList.toggle("comparing", paths.length > 0);
+        for (const path of paths) {
+            path.forEach((h, i) => {
+                const stop = svg.querySelector('.stop[data-commit="' + h + '"]');
+                if (stop) stop.classList.add("on-path");
+                if (i + 1 < path.length) {
+                    const rail = svg.querySelector('.rail[data-from="' + h + '"][data-to="' + path[i + 1] + '"]');
+                    if (rail) rail.classList.add("on-path");
+                }
+            });
+        }
+    }
+}
+
+function showComparison(a, b) {
+    const relationEl = document.getElementById("selection-relation");
+    relationEl.hidden = !b;
+    lightPaths([]);
+    if (!b) return;
+
+    const result = compareCommits(a, b);
+    const short = (h) => data[h].hash;
+    switch (result.relation) {
+    case "descendant":
+        relationEl.textContent = short(a) + " descends from " + short(b) + " (" + (result.paths[0].length - 1) + " steps)";
+        break;
+    case "ancestor":
+        relationEl.textContent = short(a) + " is an ancestor of " + short(b) + " (" + (result.paths[0].length - 1) + " steps)";
+        break;
+    case "diverged":
+        relationEl.textContent = "diverged, merge base " + result.bases.map(short).join(", ");
+        break;
+    default:
+        relationEl.textContent = "not related";
+    }
+    lightPaths(result.paths);
+    if (result.relation === "descendant" || result.relation === "ancestor") selection = result.paths[0];
+}
+
+window.addEventListener("click", (e) => {
+    const hash = stopHash(e.target);
+    if (!hash || e.target.closest("#preview")) return;
+    if ((e.ctrlKey || e.metaKey) && anchor && anchor !== hash) {
+        selection = [anchor];
+        showComparison(anchor, hash);
+    } else if (e.shiftKey && anchor) {
+        selection = selectRange(anchor, hash);
+        showComparison(anchor, null);
+    } else {
+        anchor = hash;
+        selection = [anchor];
+        showComparison(anchor, null);
+    }
+    showSelection();
+});
+
+function clearSelection() {
+    selection = [];
+    anchor = null;
+    showComparison(null, null);
+    showSelection();
+}
+
+window.addEventListener("keydown", (e) => {
+    if (e.key === "Escape") clearSelection();
+});
+
+document.getElementById("selection-format").addEventListener("change", showSelection);
+document.getElementById("selection-clear").addEventListener("click", clearSelection);
+document.getElementById("selection-copy").addEventListener("click", () => {
+    const output = document.getElementById("selection-output");
+    if (navigator.clipboard) {
+        navigator.clipboard.writeText(output.value);
+    } else {
+        output.select();
+        document.execCommand("copy");
+    }
+});
+
+// Hovering a commit or a branch label traces the refs it belongs to:
+// their rails and stops stay lit while the rest of the graph fades.
+var tracedRefs = null;
+
+function traceRefs(refs) {
+    const key = refs ? refs.join(" ") : null;
+    if (key === tracedRefs) return;
+    tracedRefs = key;
+    const wanted = new Set(refs || []);
+    for (const svg of document.querySelectorAll("#railway svg")) {
+        svg.classList.toggle("tracing", !!refs);
+        for (const el of svg.querySelectorAll(".traced")) el.classList.remove("traced");
+        if (!refs) continue;
+        for (const el of svg.querySelectorAll(".rail[data-refs], .stop[data-refs]")) {
+            if (el.dataset.refs.split(" ").some((r) => wanted.has(r))) el.classList.add("traced");
+        }
+    }
+}
+
+window.addEventListener("mouseover", (e) => {
+    const el = e.target.closest && e.target.closest(".stop, .ref-label");
+    traceRefs(el && el.dataset.refs ? el.dataset.refs.split(" ") : null);
+});
+
+// Clicking a file in the hotspots treemap lights up the commits that
+// changed it; clicking it again lights everything.
+for (const file of document.querySelectorAll("#hotspots .file")) {
+    file.addEventListener("click", () => {
+        const active = !file.classList.contains("active");
+        for (const other of document.querySelectorAll("#hotspots .file.active")) other.classList.remove("active");
+        file.classList.toggle("active", active);
+        lightPaths(active ? file.dataset.commits.split(" ").map((h) => [h]) : []);
+    });
+}
+
+// Clicking "+N more" beside a commit opens the list of the refs left out,
+// and clicking the stripe of the folded lane the list of its branches,
+// moved last in the drawing so later rows don't cover it.
+for (const more of document.querySelectorAll("#railway .more-refs[data-more], #railway .folded-lane")) {
+    more.addEventListener("click", () => {
+        const list = document.getElementById(more.dataset.more);
+        const open = list.getAttribute("display") === "none";
+        if (open) more.ownerSVGElement.appendChild(list);
+        list.setAttribute("display", open ? "inline" : "none");
+    });
+}
+
+for (const tip of document.querySelectorAll("#railway .folded-tip")) {
+    tip.addEventListener("click", () => {
+        tip.closest(".more-list").setAttribute("display", "none");
+        focusCommit(tip.dataset.commit);
+    });
+}
+
+// One checkbox per layer of the drawing shows or hides it in every graph
+// on the page.
+function toggleLayer(name, shown) {
+    for (const g of document.querySelectorAll('#railway g.layer[data-layer="' + name + '"]')) {
+        g.setAttribute("display", shown ? "inline" : "none");
+    }
+}
+
+(function () {
+    const layers = document.getElementById("layers");
+    const names = [];
+    for (const g of document.querySelectorAll("#railway g.layer")) {
+        if (!names.includes(g.dataset.layer)) names.push(g.dataset.layer);
+    }
+    for (const name of names) {
+        const label = document.createElement("label");
+        const box = document.createElement("input");
+        box.type = "checkbox";
+        box.checked = true;
+        box.addEventListener("change", () => toggleLayer(name, box.checked));
+        label.append(box, " " + name.replace("-", " "));
+        layers.appendChild(label);
+    }
+    layers.hidden = names.length === 0;
+})();
+
+// "Export view" downloads the part of the graph scrolled into view, at its
+// current zoom, with the layers, highlights and lists as they are shown.
+// The page's styles go along, in an outer svg with the id railway so their
+// selectors still match, with the theme's colors filled in.
+function viewSnapshot() {
+    const railway = document.getElementById("railway");
+    const svg = railway.querySelector("svg");
+    const box = svg.getBoundingClientRect(), view = railway.getBoundingClientRect();
+    const left = Math.max(view.left, box.left, 0), top = Math.max(view.top, box.top, 0);
+    const width = Math.round(Math.min(view.right, box.right, window.innerWidth) - left);
+    const height = Math.round(Math.min(view.bottom, box.bottom, window.innerHeight) - top);
+
+    const outer = document.createElementNS(svg.namespaceURI, "svg");
+    outer.id = "railway";
+    outer.setAttribute("width", width);
+    outer.setAttribute("height", height);
+    outer.setAttribute("viewBox", [left - box.left, top - box.top, width, height].join(" "));
+    const root = getComputedStyle(document.documentElement);
+    const vars = [];
+    for (const name of root) {
+        if (name.startsWith("--")) vars.push(name + ": " + root.getPropertyValue(name).trim());
+    }
+    outer.setAttribute("style", vars.join("; "));
+    const bg = document.createElementNS(svg.namespaceURI, "rect");
+    bg.setAttribute("x", left - box.left);
+    bg.setAttribute("y", top - box.top);
+    bg.setAttribute("width", width);
+    bg.setAttribute("height", height);
+    bg.setAttribute("fill", getComputedStyle(document.body).backgroundColor);
+    const style = document.createElementNS(svg.namespaceURI, "style");
+    for (const sheet of document.styleSheets) {
+        try {
+            for (const rule of sheet.cssRules) style.textContent += rule.cssText + "\n";
+        } catch (e) { /* Stylesheets from other origins can't be read */ }
+    }
+    const copy = svg.cloneNode(true);
+    copy.setAttribute("width", box.width);
+    copy.setAttribute("height", box.height);
+    copy.removeAttribute("style");
+    outer.append(style, bg, copy);
+    return { svg: new XMLSerializer().serializeToString(outer), width: width, height: height };
+}
+
+function download(blob, name) {
+    const link = document.createElement("a");
+    link.href = URL.createObjectURL(blob);
+    link.download = name;
+    link.click();
+    setTimeout(() => URL.revokeObjectURL(link.href), 1000);
+}
+
+for (const button of document.querySelectorAll("#export-view button")) {
+    button.addEventListener("click", () => {
+        const shot = viewSnapshot();
+        const name = document.title.replace(/ - Git Tree$/, "").replace(/[^\w.-]+/g, "-") || "git-tree";
+        const blob = new Blob([shot.svg], { type: "image/svg+xml" });
+        button.closest("details").open = false;
+        if (button.dataset.format === "svg") {
+            download(blob, name + ".svg");
+            return;
+        }
+        const image = new Image();
+        image.onload = () => {
+            const scale = window.devicePixelRatio || 1;
+            const canvas = document.createElement("canvas");
+            canvas.width = shot.width * scale;
+            canvas.height = shot.height * scale;
+            const ctx = canvas.getContext("2d");
+            ctx.scale(scale, scale);
+            ctx.drawImage(image, 0, 0);
+            URL.revokeObjectURL(image.src);
+            canvas.toBlob((png) => download(png, name + ".png"), "image/png");
+        };
+        image.src = URL.createObjectURL(blob);
+    });
+}
+
+if (serveMode || Object.keys(trees).length > 0) {
+    document.getElementById("panel").hidden = false;
+
+    window.addEventListener("click", (e) => {
+        const hash = stopHash(e.target);
+        if (hash) selectCommit(hash);
+    });
+
+    for (const tab of document.querySelectorAll(".tab")) {
+        tab.addEventListener("click", () => showTab(tab.dataset.tab));
+    }
+}
+
+async function loadBranches() {
+    const resp = await fetch("api/refs");
+    if (!resp.ok) return;
+    const names = await resp.json();
+    for (const name of names) {
+        const option = document.createElement("option");
+        option.value = name;
+        document.getElementById("reachable-refs").appendChild(option);
+    }
+    for (const id of ["whatif-source", "whatif-target"]) {
+        const select = document.getElementById(id);
+        for (const name of names) {
+            const option = document.createElement("option");
+            option.value = option.textContent = name;
+            select.appendChild(option);
+        }
+    }
+}
+
+// showContainingTags lists the tags containing the selected commit, the
+// earliest, and so the first release to ship it, on top.
+async function showContainingTags() {
+    const answer = document.getElementById("tags-answer");
+    const list = document.getElementById("tags");
+    list.innerHTML = "";
+    if (!selectedCommit) return;
+    const hash = selectedCommit;
+    const resp = await fetch("api/tags?" + new URLSearchParams({ commit: hash }));
+    if (hash !== selectedCommit) return;
+    if (!resp.ok) { answer.textContent = await resp.text(); return; }
+    const tags = await resp.json();
+    answer.textContent = tags.length
+        ? "First released in " + tags[0].name + "."
+        : "No tag contains " + data[hash].hash + " yet.";
+    for (const tag of tags) {
+        const li = document.createElement("li");
+        const link = document.createElement("a");
+        link.href = "#";
+        link.textContent = tag.name;
+        link.title = tag.date;
+        link.addEventListener("click", (e) => { e.preventDefault(); focusCommit(tag.hash); });
+        li.appendChild(link);
+        list.appendChild(li);
+    }
+}
+
+function showPreview(sim) {
+    Object.assign(data, sim.data);
+    document.getElementById("preview-caption").textContent = sim.caption;
+    document.getElementById("preview-svg").innerHTML = sim.svg;
+    document.getElementById("preview").hidden = false;
+}
+
+if (serveMode) {
+    document.querySelector('.tab[data-tab="blame"]').hidden = false;
+    document.querySelector('.tab[data-tab="whatif"]').hidden = false;
+    document.querySelector('.tab[data-tab="reachable"]').hidden = false;
+    document.querySelector('.tab[data-tab="tags"]').hidden = false;
+    loadBranches();
+
+    document.getElementById("whatif-op").addEventListener("change", (e) => {
+        document.getElementById("whatif-preposition").textContent = e.target.value === "merge" ? "into" : "onto";
+    });
+
+    document.getElementById("whatif-form").addEventListener("submit", async (e) => {
+        e.preventDefault();
+        const errorEl = document.getElementById("whatif-error");
+        errorEl.textContent = "";
+        const params = new URLSearchParams({
+            op: document.getElementById("whatif-op").value,
+            source: document.getElementById("whatif-source").value,
+            target: document.getElementById("whatif-target").value,
+        });
+        const resp = await fetch("api/simulate?" + params);
+        if (!resp.ok) { errorEl.textContent = await resp.text(); return; }
+        showPreview(await resp.json());
+    });
+
+    document.getElementById("preview-close").addEventListener("click", () => {
+        document.getElementById("preview").hidden = true;
+        document.getElementById("preview-svg").innerHTML = "";
+    });
+
+    document.querySelector('.tab[data-tab="tags"]').addEventListener("click", showContainingTags);
+
+    document.querySelector('.tab[data-tab="reachable"]').addEventListener("click", () => {
+        const from = document.getElementById("reachable-from");
+        if (selectedCommit && !from.value) from.value = data[selectedCommit].hash;
+    });
+
+    document.getElementById("reachable-form").addEventListener("submit", async (e) => {
+        e.preventDefault();
+        const answer = document.getElementById("reachable-answer");
+        const from = document.getElementById("reachable-from").value.trim();
+        const to = document.getElementById("reachable-to").value.trim();
+        answer.textContent = "";
+        lightPaths([]);
+        const resp = await fetch("api/reachable?" + new URLSearchParams({ from: from, to: to }));
+        if (!resp.ok) { answer.textContent = await resp.text(); return; }
+        const result = await resp.json();
+        if (!result.reachable) {
+            answer.textContent = "No, " + from + " is not contained in " + to + ".";
+            return;
+        }
+        answer.textContent = "Yes, " + from + " is contained in " + to + ", " + (result.path.length - 1) + " commits back.";
+        lightPaths([result.path]);
+        focusCommit(result.path[result.path.length - 1]);
+    });
+
+    document.getElementById("blame-form").addEventListener("submit", async (e) => {
+        e.preventDefault();
+        const blame = document.getElementById("blame");
+        if (!selectedCommit) { blame.textContent = "Select a commit first."; return; }
+        const file = document.getElementById("blame-path").value.trim();
+        const params = new URLSearchParams({ commit: selectedCommit, file: file });
+        const resp = await fetch("api/blame?" + params);
+        if (!resp.ok) { blame.textContent = await resp.text(); return; }
+        showBlame(await resp.json() || []);
+    });
+}
@@ -0,0 +1,80 @@
+// Git Tree widget. Renders a graph exported with `git-tree -format widget`
+// into any element:
+//
+//     <div data-git-tree="tree.json"></div>
+//     <script src="tree.js"></script>
+//
+// or, from a script, GitTree.mount(element, "tree.json").
+(function () {
+    const css = `
+.git-tree-widget { position: relative; overflow: auto; background: #4e545b; font-family: "Ubuntu Mono", monospace; }
+.git-tree-widget svg { display: block; margin: 0 auto; }
+.git-tree-widget .stop { cursor: pointer; }
+.git-tree-widget .git-tree-info { position: absolute; display: none; max-width: 420px; padding: 8px 12px; border-radius: 6px;
+    background: rgba(50, 50, 50, 0.95); color: #dddddd; font-size: 13px; pointer-events: none; z-index: 1; }
+.git-tree-widget .git-tree-hash { color: #d07d49; font-weight: bold; padding-right: .5em; }
+.git-tree-widget .git-tree-title { color: #e8e9a9; font-weight: bold; }
+.git-tree-widget .git-tree-meta { color: #9ca3af; padding-top: 4px; }
+`;
+
+    function injectStyle() {
+        if (document.getElementById("git-tree-widget-style")) return;
+        const style = document.createElement("style");
+        style.id = "git-tree-widget-style";
+        style.textContent = css;
+        document.head.appendChild(style);
+    }
+
+    function render(element, graph) {
+        injectStyle();
+        element.classList.add("git-tree-widget");
+        element.innerHTML = graph.svg;
+        element.setAttribute("aria-label", graph.title);
+
+        const info = document.createElement("div");
+        info.className = "git-tree-info";
+        element.appendChild(info);
+
+        element.addEventListener("mouseover", (e) => {
+            const commit = graph.commits[e.target.id];
+            if (!commit) { info.style.display = "none"; return; }
+            info.innerHTML = "";
+            const hash = document.createElement("span");
+            hash.className = "git-tree-hash";
+            hash.textContent = commit.hash;
+            const title = document.createElement("span");
+            title.className = "git-tree-title";
+            title.innerHTML = commit.message.title;
+            const meta = document.createElement("div");
+            meta.className = "git-tree-meta";
+            meta.innerHTML = commit.author + " · " + commit.authored_date_delta;
+            info.append(hash, title, meta);
+
+            const box = element.getBoundingClientRect();
+            const stop = e.target.getBoundingClientRect();
+            info.style.left = stop.right - box.left + element.scrollLeft + 8 + "px";
+            info.style.top = stop.top - box.top + element.scrollTop + "px";
+            info.style.display = "block";
+        });
+        element.addEventListener("mouseleave", () => { info.style.display = "none"; });
+    }
+
+    async function mount(element, source) {
+        const graph = typeof source === "string" ? await (await fetch(source)).json() : source;
+        render(element, graph);
+        return graph;
+    }
+
+    function mountAll() {
+        for (const element of document.querySelectorAll("[data-git-tree]")) {
+            mount(element, element.dataset.gitTree);
+        }
+    }
+
+    window.GitTree = { mount: mount };
+    if (document.readyState === "loading") {
+        document.addEventListener("DOMContentLoaded", mountAll);
+    } else {
+        mountAll();
+    }
+})();
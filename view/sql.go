@@ -0,0 +1,146 @@
+package view
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// SQLRenderer writes the graph as an SQL script for SQLite, creating and
+// filling these tables:
+//
+//	commits(hash, tree, author, author_email, authored, committer,
+//	        committer_email, committed, type, scope, breaking, subject,
+//	        message, lane, row)
+//	edges(child, parent, parent_index, route, refs)
+//	refs(name, kind, hash)
+//
+// Dates are Unix seconds; lanes and rows are numbered like Layout's, and an
+// edge's route and refs are those of its rail, see LayoutEdge.
+type SQLRenderer struct{}
+
+const sqlSchema = `CREATE TABLE commits (
+  hash TEXT PRIMARY KEY,
+  tree TEXT NOT NULL,
+  author TEXT NOT NULL,
+  author_email TEXT NOT NULL,
+  authored INTEGER NOT NULL,
+  committer TEXT NOT NULL,
+  committer_email TEXT NOT NULL,
+  committed INTEGER NOT NULL,
+  type TEXT,
+  scope TEXT,
+  breaking INTEGER NOT NULL,
+  subject TEXT NOT NULL,
+  message TEXT NOT NULL,
+  lane INTEGER NOT NULL,
+  row INTEGER NOT NULL
+);
+CREATE TABLE edges (
+  child TEXT NOT NULL REFERENCES commits(hash),
+  parent TEXT NOT NULL,
+  parent_index INTEGER NOT NULL,
+  route TEXT NOT NULL,
+  refs TEXT NOT NULL
+);
+CREATE TABLE refs (
+  name TEXT PRIMARY KEY,
+  kind TEXT NOT NULL,
+  hash TEXT NOT NULL
+);
+CREATE INDEX edges_parent ON edges(parent);
+CREATE INDEX refs_hash ON refs(hash);
+`
+
+func (SQLRenderer) Render(ctx context.Context, g Graph, positions map[plumbing.Hash][2]int, w io.Writer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	layout := NewLayout(g.Commits, positions, g.Heads, g.Tags, g.Children, nil)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "BEGIN TRANSACTION;")
+	bw.WriteString(sqlSchema)
+	for _, c := range layout.Commits {
+		ci := g.Commits[plumbing.NewHash(c.Hash)]
+		if ci == nil || ci.Commit == nil {
+			continue
+		}
+		commit := ci.Commit
+		subject, _, _ := strings.Cut(commit.Message, "\n")
+		subject = strings.TrimSpace(subject)
+		commitType, scope, _ := parseCommitMessage(subject)
+		fmt.Fprintf(bw, "INSERT INTO commits VALUES (%s, %s, %s, %s, %d, %s, %s, %d, %s, %s, %d, %s, %s, %d, %d);\n",
+			sqlText(c.Hash), sqlText(commit.TreeHash.String()),
+			sqlText(commit.Author.Name), sqlText(commit.Author.Email), commit.Author.When.Unix(),
+			sqlText(commit.Committer.Name), sqlText(commit.Committer.Email), commit.Committer.When.Unix(),
+			sqlNullable(strings.TrimSuffix(commitType, "!")), sqlNullable(scope), sqlBool(breakingChange(commit.Message)),
+			sqlText(subject), sqlText(commit.Message), c.Lane, c.Row)
+	}
+
+	// Parent order comes from the commits; the layout lists edges in
+	// drawing order.
+	parentIndex := func(child, parent string) int {
+		if ci := g.Commits[plumbing.NewHash(child)]; ci != nil && ci.Commit != nil {
+			for i, p := range ci.Commit.ParentHashes {
+				if p.String() == parent {
+					return i
+				}
+			}
+		}
+		return 0
+	}
+	for _, e := range layout.Edges {
+		fmt.Fprintf(bw, "INSERT INTO edges VALUES (%s, %s, %d, %s, %s);\n",
+			sqlText(e.From), sqlText(e.To), parentIndex(e.From, e.To), sqlText(e.Route), sqlText(strings.Join(e.Refs, " ")))
+	}
+
+	type ref struct{ name, kind, hash string }
+	var refs []ref
+	for h, rs := range g.Heads {
+		for _, r := range rs {
+			kind := "branch"
+			switch {
+			case r.Name().IsRemote():
+				kind = "remote"
+			case IsPullRequest(r.Name()):
+				kind = "pull_request"
+			}
+			refs = append(refs, ref{r.Name().String(), kind, h.String()})
+		}
+	}
+	for h, rs := range g.Tags {
+		for _, r := range rs {
+			refs = append(refs, ref{r.Name().String(), "tag", h.String()})
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].name < refs[j].name })
+	for _, r := range refs {
+		fmt.Fprintf(bw, "INSERT INTO refs VALUES (%s, %s, %s);\n", sqlText(r.name), sqlText(r.kind), sqlText(r.hash))
+	}
+	fmt.Fprintln(bw, "COMMIT;")
+	return bw.Flush()
+}
+
+func sqlText(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func sqlNullable(s string) string {
+	if s == "" {
+		return "NULL"
+	}
+	return sqlText(s)
+}
+
+func sqlBool(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,364 @@
+package view
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"slices"
+	"sort"
+	"unicode/utf8"
+
+	svg "github.com/ajstarks/svgo"
+	"github.com/anton-dovnar/git-tree/structs"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// RailwayStream draws the railway one row at a time, as the arrangement
+// finalizes positions. A row's rails only reach its parents, which are
+// arranged before it, so every row is drawn on arrival and only its SVG
+// fragments are kept until Finish puts them in display order.
+type RailwayStream struct {
+	commits  map[plumbing.Hash]*structs.CommitInfo
+	heads    map[plumbing.Hash][]*plumbing.Reference
+	tags     map[plumbing.Hash][]*plumbing.Reference
+	children map[plumbing.Hash]mapset.Set[plumbing.Hash]
+	opts     SVGOptions
+
+	maxX, maxY int
+	display    map[plumbing.Hash][2]int
+	lanes      *laneIndex
+	rows       []streamRow
+	cut        []cutRail // Rails running off the edge, when drawing a RowRange
+
+	buf     bytes.Buffer
+	railway *SVGRailway
+}
+
+type streamRow struct {
+	commit SVGCommit
+	rails  string
+	labels map[string]string // Stop and label fragments, by layer
+}
+
+// cutRail is a rail leaving the drawing through its top or bottom edge, and
+// the rails of those entering through the top.
+type cutRail struct {
+	lane  float64 // Lane the rail crosses the edge in
+	top   bool
+	rails string
+}
+
+// NewRailwayStream prepares a drawing of maxY+1 rows; the row count must be
+// known up front because rows are numbered from the bottom but displayed
+// from the top.
+func NewRailwayStream(
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	heads map[plumbing.Hash][]*plumbing.Reference,
+	tags map[plumbing.Hash][]*plumbing.Reference,
+	children map[plumbing.Hash]mapset.Set[plumbing.Hash],
+	opts SVGOptions,
+	maxY int,
+) *RailwayStream {
+	s := &RailwayStream{
+		commits:  commits,
+		heads:    heads,
+		tags:     tags,
+		children: children,
+		opts:     opts,
+		maxY:     maxY,
+		display:  make(map[plumbing.Hash][2]int, len(commits)),
+		lanes:    newLaneIndex(maxY),
+	}
+	s.railway = NewSVGRailway(svg.New(&s.buf), opts)
+	return s
+}
+
+// AddRow draws the commit arranged at pos. Rows must arrive in arrangement
+// order, oldest first.
+func (s *RailwayStream) AddRow(hash plumbing.Hash, pos [2]int) {
+	s.maxX = max(s.maxX, pos[0])
+	s.display[hash] = [2]int{pos[0], s.maxY - pos[1]}
+	s.lanes.add(pos)
+	ci, ok := s.commits[hash]
+	if !ok {
+		return
+	}
+
+	commit := newSVGCommit(hash, ci, s.display[hash], s.heads, s.tags)
+	row := streamRow{commit: commit}
+	highlight := s.opts.Highlight
+	for _, e := range commitEdges(commit, s.commits, s.display, s.children, s.lanes) {
+		if s.opts.Rows != nil && e.PY > s.maxY {
+			s.cut = append(s.cut, cutRail{lane: railLane(e)})
+		}
+		s.drawRail(e)
+	}
+	row.rails = s.buf.String()
+	s.buf.Reset()
+
+	row.labels = make(map[string]string, 5)
+	layer := func(name string, draw func()) {
+		s.railway.dimmed(highlight != nil && !highlight[commit.Hash], draw)
+		row.labels[name] += s.buf.String()
+		s.buf.Reset()
+	}
+	x, y := commit.X, commit.Y
+	offset := 0
+	layer(LayerStops, func() { s.railway.Stop(x, y, commit) })
+	layer(LayerHashes, func() { s.railway.hashLabel(y, commit) })
+	shown, more := s.railway.decorations(commit)
+	layer(LayerBranches, func() { offset = s.railway.decorationsOf(x, y, offset, commit, shown, decoHead, decoBranch) })
+	layer(LayerTags, func() { offset = s.railway.decorationsOf(x, y, offset, commit, shown, decoTag, decoTag) })
+	if len(more) > 0 || slices.ContainsFunc(shown, func(d decoration) bool { return d.kind == decoRemote }) {
+		layer(LayerBranches, func() {
+			offset = s.railway.decorationsOf(x, y, offset, commit, shown, decoRemote, decoRemote)
+			offset = s.railway.moreLabels(x, y, offset, commit, more)
+		})
+	}
+	layer(LayerAnnotations, func() { s.railway.annotations(x, y, offset, commit) })
+	s.rows = append(s.rows, row)
+}
+
+// AddOffCanvas places a commit outside the rows drawn, for a RowRange:
+// positions below row 0 are older than the slice, those above maxY newer.
+// Commits must arrive in arrangement order along with the rows, so the
+// rails from newer ones to their parents in the slice are drawn on arrival.
+func (s *RailwayStream) AddOffCanvas(hash plumbing.Hash, pos [2]int) {
+	s.maxX = max(s.maxX, pos[0])
+	s.display[hash] = [2]int{pos[0], s.maxY - pos[1]}
+	s.lanes.add(pos)
+	ci, ok := s.commits[hash]
+	if !ok || pos[1] <= s.maxY {
+		return
+	}
+
+	commit := newSVGCommit(hash, ci, s.display[hash], s.heads, s.tags)
+	for _, e := range commitEdges(commit, s.commits, s.display, s.children, s.lanes) {
+		if e.PY < 0 || e.PY > s.maxY {
+			continue
+		}
+		s.drawRail(e)
+		s.cut = append(s.cut, cutRail{lane: railLane(e), top: true, rails: s.buf.String()})
+		s.buf.Reset()
+	}
+}
+
+func (s *RailwayStream) drawRail(e railEdge) {
+	highlight := s.opts.Highlight
+	bold := highlight[e.From] && highlight[e.To]
+	s.railway.dimmed(highlight != nil && !bold, func() {
+		s.railway.Group(fmt.Sprintf(`class="rail" id="%srail-%s-%s" data-from="%[2]s" data-to="%[3]s"`, s.opts.IDPrefix, e.From, e.To) + refsAttr(e.Refs))
+		s.railway.refRail(e.X, e.Y, e.PX, e.PY, e.Refs, e.Middle, bold)
+		s.railway.Gend()
+	})
+}
+
+// railLane is the lane of the long vertical run of a rail, see railPaths.
+func railLane(e railEdge) float64 {
+	switch {
+	case e.Middle:
+		dl := e.X - e.PX
+		if dl&1 == 0 {
+			dl--
+		}
+		return float64(e.X) - float64(dl)/2
+	case e.PX > e.X:
+		return float64(e.PX)
+	}
+	return float64(e.X)
+}
+
+// Finish writes the drawing to canvas one layer at a time: every rail
+// first, then the links, then the stops and labels on top, each by row,
+// lane and hash.
+func (s *RailwayStream) Finish(canvas *svg.SVG) {
+	sort.Slice(s.rows, func(i, j int) bool {
+		a, b := s.rows[i].commit, s.rows[j].commit
+		if a.Y != b.Y {
+			return a.Y < b.Y
+		}
+		if a.X != b.X {
+			return a.X < b.X
+		}
+		return a.Hash < b.Hash
+	})
+
+	width := paddingX*2 + (s.maxX+1)*stepX
+	height := paddingY*2 + (s.maxY+1)*stepY
+	dates, gutter := s.dates()
+	width += gutter
+	canvas.Startview(int(float64(width)*scale), int(float64(height)*scale), -gutter, 0, width, height)
+	if s.opts.Highlight != nil {
+		canvas.Writer.Write([]byte(`<defs><filter id="dim"><feColorMatrix type="saturate" values="0.15"/></filter></defs>`))
+	}
+	canvas.Writer.Write([]byte(s.railway.styleSheet()))
+	if s.opts.Print {
+		canvas.Rect(-gutter, 0, width, height, `fill="#ffffff"`)
+	}
+	layer := func(name string) {
+		canvas.Writer.Write([]byte(fmt.Sprintf(`<g class="layer" data-layer="%s">`, name)))
+	}
+	layer(LayerBackground)
+	for _, band := range s.opts.Bands {
+		x := paddingX + band.From*stepX - stepX/2
+		canvas.Writer.Write([]byte(fmt.Sprintf(`<rect class="band" x="%d" y="0" width="%d" height="%d" fill="%s"><title>%s</title></rect>`,
+			x, (band.To-band.From+1)*stepX, height, band.Fill, html.EscapeString(band.Name))))
+	}
+	if s.opts.Swimlanes {
+		s.swimlanes(canvas)
+	}
+	if s.opts.Folded != nil {
+		s.foldedLane(canvas, height)
+	}
+	canvas.Gend()
+	layer(LayerRails)
+	for _, cut := range s.cut {
+		canvas.Writer.Write([]byte(cut.rails))
+	}
+	for _, row := range s.rows {
+		canvas.Writer.Write([]byte(row.rails))
+	}
+	s.continuations(canvas, height)
+	canvas.Gend()
+
+	svgCommits := make([]SVGCommit, len(s.rows))
+	for i, row := range s.rows {
+		svgCommits[i] = row.commit
+	}
+	layer(LayerLinks)
+	railway := NewSVGRailway(canvas, s.opts)
+	railway.links(svgCommits)
+	canvas.Gend()
+
+	for _, name := range Layers[3:] {
+		layer(name)
+		for _, row := range s.rows {
+			canvas.Writer.Write([]byte(row.labels[name]))
+		}
+		canvas.Gend()
+	}
+	if len(dates) > 0 {
+		layer(LayerDates)
+		for i, row := range s.rows {
+			if dates[i] != "" {
+				canvas.Text(-dateMargin, labelBaseline(row.commit.Y), dates[i], fmt.Sprintf(`class="date" data-commit="%s"`, row.commit.Hash))
+			}
+		}
+		canvas.Gend()
+	}
+	if s.opts.Folded != nil {
+		s.foldedList(canvas)
+	}
+	canvas.End()
+}
+
+// dateMargin is the space between the dates and the hashes.
+const dateMargin = 4
+
+// dates formats the date of each row's commit for SVGOptions.Dates, leaving
+// it out where the row above shows the same, and returns them with the
+// width of the gutter they need left of the drawing.
+func (s *RailwayStream) dates() ([]string, int) {
+	if s.opts.Dates == "" {
+		return nil, 0
+	}
+	dates := make([]string, len(s.rows))
+	widest, last := 0, ""
+	for i, row := range s.rows {
+		ci, ok := s.commits[plumbing.NewHash(row.commit.Hash)]
+		if !ok {
+			continue
+		}
+		date := ci.Commit.Committer.When.Format(s.opts.Dates)
+		if date != last {
+			dates[i] = date
+			widest = max(widest, utf8.RuneCountInString(date))
+		}
+		last = date
+	}
+	return dates, gutterWidth(widest)
+}
+
+// gutterWidth is the width of the gutter for dates of widest characters.
+// Dates are set in a monospace font at half the default 16px size, whose
+// characters are about 0.6em wide.
+func gutterWidth(widest int) int {
+	return widest*5 + 2*dateMargin
+}
+
+// DateGutter is the width of the gutter Finish adds left of the rows for
+// the dates of the commits at positions in the time layout dates, or 0 when
+// dates is empty.
+func DateGutter(commits map[plumbing.Hash]*structs.CommitInfo, positions map[plumbing.Hash][2]int, dates string) int {
+	if dates == "" {
+		return 0
+	}
+	// Every distinct date is printed at least once, so the widest of all
+	// sets the gutter.
+	widest := 0
+	for h := range positions {
+		if ci, ok := commits[h]; ok && ci != nil && ci.Commit != nil {
+			widest = max(widest, utf8.RuneCountInString(ci.Commit.Committer.When.Format(dates)))
+		}
+	}
+	return gutterWidth(widest)
+}
+
+// continuations marks where rails cross the top and bottom edge of a
+// RowRange with an arrow pointing the way the rail goes on, one per lane.
+func (s *RailwayStream) continuations(canvas *svg.SVG, height int) {
+	marked := make(map[cutRail]bool)
+	for _, cut := range s.cut {
+		key := cutRail{lane: cut.lane, top: cut.top}
+		if marked[key] {
+			continue
+		}
+		marked[key] = true
+		x := float64(paddingX) + cut.lane*stepX
+		tip, base := float64(height-1), float64(height-paddingY+1)
+		if cut.top {
+			tip, base = 1, paddingY-1
+		}
+		canvas.Writer.Write([]byte(fmt.Sprintf(`<path class="continued" d="M %.1f %.1f L %.1f %.1f L %.1f %.1f Z"/>`,
+			x-4, base, x+4, base, x, tip)))
+	}
+}
+
+// swimlanes tints the lane of every branch from its tip down its
+// first-parent history, until the history leaves the lane or reaches the
+// tip of another branch, which gets a swimlane of its own.
+func (s *RailwayStream) swimlanes(canvas *svg.SVG) {
+	for _, row := range s.rows {
+		if len(row.commit.Heads) == 0 {
+			continue
+		}
+		top, bottom := row.commit.Y, row.commit.Y
+		for h := plumbing.NewHash(row.commit.Hash); ; {
+			ci, ok := s.commits[h]
+			if !ok || ci.Commit.NumParents() == 0 {
+				break
+			}
+			h = ci.Commit.ParentHashes[0]
+			pos, ok := s.display[h]
+			if !ok || pos[0] != row.commit.X || len(s.heads[h]) > 0 {
+				break
+			}
+			bottom = pos[1]
+		}
+		ref := row.commit.Heads[0]
+		if len(row.commit.HeadRefs) > 0 {
+			ref = row.commit.HeadRefs[0]
+		}
+		canvas.Roundrect(paddingX+row.commit.X*stepX-stepX/2+2, paddingY+top*stepY-stopR-3, stepX-4, (bottom-top)*stepY+2*(stopR+3), 4, 4,
+			fmt.Sprintf(`class="swimlane %s"`, s.railway.refClass(ref)))
+	}
+}
+
+// String finishes the drawing into a standalone SVG document.
+func (s *RailwayStream) String() string {
+	var out bytes.Buffer
+	s.Finish(svg.New(&out))
+	return out.String()
+}
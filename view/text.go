@@ -0,0 +1,65 @@
+package view
+
+import (
+	"strings"
+	"unicode"
+)
+
+// columns is the number of monospace cells s takes up: two for East Asian
+// wide and fullwidth characters, none for combining marks and other
+// zero-width characters, one for everything else. Label spacing is
+// computed from it, as byte or rune counts overshoot accented text and
+// undershoot CJK.
+func columns(s string) int {
+	n := 0
+	for _, r := range s {
+		switch {
+		case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		case wide(r):
+			n += 2
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+// wide reports whether r is drawn two cells wide, after the W and F classes
+// of Unicode's East Asian Width.
+func wide(r rune) bool {
+	switch {
+	case r < 0x1100:
+		return false
+	case r <= 0x115f, // Hangul Jamo initials
+		r >= 0x2e80 && r <= 0x303e, // CJK radicals, Kangxi, CJK symbols and punctuation
+		r >= 0x3041 && r <= 0x33ff, // Kana, Bopomofo, Hangul compatibility Jamo, CJK compatibility
+		r >= 0x3400 && r <= 0x4dbf, // CJK extension A
+		r >= 0x4e00 && r <= 0x9fff, // CJK unified ideographs
+		r >= 0xa000 && r <= 0xa4cf, // Yi
+		r >= 0xa960 && r <= 0xa97f, // Hangul Jamo extended A
+		r >= 0xac00 && r <= 0xd7a3, // Hangul syllables
+		r >= 0xf900 && r <= 0xfaff, // CJK compatibility ideographs
+		r >= 0xfe30 && r <= 0xfe4f, // CJK compatibility forms
+		r >= 0xff00 && r <= 0xff60, // Fullwidth forms
+		r >= 0xffe0 && r <= 0xffe6,
+		r >= 0x1f300 && r <= 0x1f64f, // Pictographs and emoticons
+		r >= 0x1f900 && r <= 0x1f9ff,
+		r >= 0x20000 && r <= 0x3fffd: // CJK extensions B and beyond
+		return true
+	}
+	return false
+}
+
+// isolate wraps text containing right-to-left characters in a first-strong
+// isolate, so a Hebrew or Arabic branch name neither reorders nor is
+// reordered by the labels next to it. Other text is returned unchanged.
+func isolate(s string) string {
+	if strings.IndexFunc(s, rtl) < 0 {
+		return s
+	}
+	return "\u2068" + s + "\u2069"
+}
+
+func rtl(r rune) bool {
+	return unicode.In(r, unicode.Hebrew, unicode.Arabic, unicode.Syriac, unicode.Thaana, unicode.Nko)
+}
@@ -0,0 +1,147 @@
+package view
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// TikZRenderer writes the railway as a standalone LaTeX document holding a
+// single TikZ picture, to compile on its own or include in a paper with the
+// standalone package's \includestandalone. Rails keep their routes and
+// colors; labels are set in the document's fonts.
+type TikZRenderer struct{}
+
+// TikZ coordinates are lanes and rows, rows growing downwards.
+const (
+	tikzLane = 0.4 // cm
+	tikzRow  = 0.5 // cm
+	tikzRail = 2.4 // pt, the width of a rail however many stripes it has
+)
+
+func (TikZRenderer) Render(ctx context.Context, g Graph, positions map[plumbing.Hash][2]int, w io.Writer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	maxY := 0
+	for _, pos := range positions {
+		maxY = max(maxY, pos[1])
+	}
+	display := make(map[plumbing.Hash][2]int, len(positions))
+	for h, pos := range positions {
+		display[h] = [2]int{pos[0], maxY - pos[1]}
+	}
+	svgCommits := convertToSVGCommits(g.Commits, display, g.Heads, g.Tags)
+	edges := railEdges(g.Commits, positions, display, maxY, svgCommits, g.Children)
+
+	// Every ref gets a color named after its order of first use.
+	colors := NewSVGRailway(nil, SVGOptions{})
+	names := make(map[string]string)
+	var defs strings.Builder
+	color := func(ref string) string {
+		if name, ok := names[ref]; ok {
+			return name
+		}
+		name := fmt.Sprintf("gtref%d", len(names))
+		names[ref] = name
+		fmt.Fprintf(&defs, "\\definecolor{%s}{HTML}{%s}\n", name, strings.ToUpper(colorToHex(colors.refToColor(ref))[1:]))
+		return name
+	}
+
+	var pic strings.Builder
+	for _, e := range edges {
+		refs := e.Refs
+		if len(refs) == 0 {
+			refs = []string{""}
+		}
+		width := tikzRail / float64(len(refs))
+		path := tikzRailPath(e)
+		for i, ref := range refs {
+			c := "gtuntracked"
+			if ref != "" {
+				c = color(ref)
+			}
+			shift := (float64(i) - float64(len(refs)-1)/2) * width
+			fmt.Fprintf(&pic, "\\draw[rail, draw=%s, line width=%.2fpt, xshift=%.2fpt] %s;\n", c, width, shift, path)
+		}
+	}
+	for _, c := range svgCommits {
+		fmt.Fprintf(&pic, "\\fill[stop] (%d,%d) circle (2.5pt);\n", c.X, c.Y)
+		hash := c.Hash
+		if len(hash) > 7 {
+			hash = hash[:7]
+		}
+		fmt.Fprintf(&pic, "\\node[hashlabel] at (-1,%d) {%s};\n", c.Y, hash)
+
+		var labels []string
+		for i, head := range c.Heads {
+			ref := head
+			if i < len(c.HeadRefs) {
+				ref = c.HeadRefs[i]
+			}
+			labels = append(labels, fmt.Sprintf("\\textcolor{%s}{\\textbf{%s}}", color(ref), texEscape(head)))
+		}
+		for _, tag := range c.Tags {
+			labels = append(labels, fmt.Sprintf("\\textcolor{gttag}{%s}", texEscape(tag)))
+		}
+		if len(labels) > 0 {
+			fmt.Fprintf(&pic, "\\node[reflabel] at (%d.5,%d) {%s};\n", c.X, c.Y, strings.Join(labels, " "))
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `%% Generated by git-tree. Compile with pdflatex, or include with \includestandalone.
+\documentclass[tikz,border=4pt]{standalone}
+\usepackage{xcolor}
+\definecolor{gtuntracked}{HTML}{808080}
+\definecolor{gtstop}{HTML}{555555}
+\definecolor{gthash}{HTML}{888888}
+\definecolor{gttag}{HTML}{A89F2A}
+%s\begin{document}
+\begin{tikzpicture}[x=%.2fcm, y=-%.2fcm,
+  rail/.style={line cap=round},
+  stop/.style={gtstop},
+  hashlabel/.style={anchor=east, font=\ttfamily\scriptsize, text=gthash},
+  reflabel/.style={anchor=west, font=\sffamily\scriptsize, inner xsep=0pt}]
+%s\end{tikzpicture}
+\end{document}
+`, defs.String(), tikzLane, tikzRow, pic.String())
+	return bw.Flush()
+}
+
+// tikzRailPath routes a rail like railPaths does, in lanes and rows: down
+// the lane of the commit or the parent, whichever is further out, with an
+// S-curve over the row next to the other end; or, for a detour, down
+// between the two lanes with an S-curve at both ends.
+func tikzRailPath(e railEdge) string {
+	curve := func(x1 float64, y1 int, x2 float64, y2 int) string {
+		mid := float64(y1+y2) / 2
+		return fmt.Sprintf(" .. controls (%g,%g) and (%g,%g) .. (%g,%d)", x1, mid, x2, mid, x2, y2)
+	}
+	x, px := float64(e.X), float64(e.PX)
+	switch {
+	case e.Middle:
+		dl := e.X - e.PX
+		if dl&1 == 0 {
+			dl--
+		}
+		via := x - float64(dl)/2
+		return fmt.Sprintf("(%g,%d)", x, e.Y) + curve(x, e.Y, via, e.Y+1) +
+			fmt.Sprintf(" -- (%g,%d)", via, e.PY-1) + curve(via, e.PY-1, px, e.PY)
+	case e.X > e.PX:
+		return fmt.Sprintf("(%g,%d) -- (%g,%d)", x, e.Y, x, e.PY-1) + curve(x, e.PY-1, px, e.PY)
+	case e.X < e.PX:
+		return fmt.Sprintf("(%g,%d) -- (%g,%d)", px, e.PY, px, e.Y+1) + curve(px, e.Y+1, x, e.Y)
+	}
+	return fmt.Sprintf("(%g,%d) -- (%g,%d)", x, e.Y, px, e.PY)
+}
+
+// texEscape makes text safe to typeset in LaTeX.
+var texEscape = strings.NewReplacer(
+	`\`, `\textbackslash{}`, `{`, `\{`, `}`, `\}`, `$`, `\$`, `&`, `\&`, `#`, `\#`,
+	`^`, `\^{}`, `_`, `\_`, `%`, `\%`, `~`, `\~{}`,
+).Replace
@@ -2,9 +2,16 @@ package view
 
 import (
 	"crypto/md5"
+	"encoding/base64"
 	"fmt"
+	"html"
 	"image/color"
+	"math"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"sort"
+	"strings"
 
 	svg "github.com/ajstarks/svgo"
 	"github.com/anton-dovnar/git-tree/structs"
@@ -22,8 +29,111 @@ const (
 	stopR     = 5
 	railW     = 6
 	maxColors = 32
+
+	diffstatMaxW = 40
+)
+
+type SVGOptions struct {
+	Aliases   map[string][]string // Former names of renamed branches, keyed by full ref name
+	Upstreams map[string][]string // Upstreams of local branches, keyed by the commit they point at
+	Links     []Link              // Associations drawn as dotted lines between commits
+	Highlight map[string]bool     // Commits to emphasize, dimming all others; nil highlights nothing
+	Broken    map[string]bool     // Missing or unreadable commits, drawn as red crosses
+	Bands     []LaneBand          // Background stripes behind groups of lanes
+	Swimlanes bool                // Tint each branch's lane along the rows it spans
+	Print     bool                // Black on white, telling refs apart by dash pattern and stop shape
+	Font      string              // CSS font stack for labels; empty means "Ubuntu Mono"
+	FontFace  *FontFace           // Font file to embed, used ahead of Font
+	Rows      *RowRange           // Slice of the rows to draw; nil draws them all
+	Dates     string              // Time layout of the commit dates in a gutter left of the rows; empty draws none
+	Groups    map[string]string   // Group of each commit, keyed by full hash; stops are filled in the group's color
+	Halo      string              // CSS color outlining all text, to keep labels legible over rails; "auto" matches the page; empty draws none
+	Head      string              // Full name of the branch HEAD points at, or the hash of a detached HEAD; labeled first, with an arrow
+	MaxRefs   int                 // Most ref labels beside a commit, the rest going into a "+N more" list; 0 draws them all
+	Folded    *FoldedLanes        // Lane the lanes past -max-lanes were folded into; nil when none were
+	IDPrefix  string              // Prepended to every id, for drawings sharing a page
+}
+
+// RowRange is a slice of the arranged rows, counted from the newest commit
+// at 0, To excluded. Rails to commits outside the slice run off its top or
+// bottom edge to a continuation marker.
+type RowRange struct {
+	From, To int
+}
+
+// FontFace is a font file embedded in the drawing, so labels look the same
+// on machines that lack the font. Subset the font to the characters needed
+// to keep the output small.
+type FontFace struct {
+	Data   []byte
+	Format string // CSS font format: woff2, woff, truetype or opentype
+}
+
+// embeddedFont is the family name an embedded FontFace is registered as.
+const embeddedFont = "git-tree-embedded"
+
+// FontFormat maps a font file name to its CSS format, or "" when the
+// extension is not a known font type.
+func FontFormat(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".woff2":
+		return "woff2"
+	case ".woff":
+		return "woff"
+	case ".ttf":
+		return "truetype"
+	case ".otf":
+		return "opentype"
+	}
+	return ""
+}
+
+// Elements of the drawing carry ids and data attributes that scripts can
+// rely on, all hashes being full ones:
+//
+//	stop             id="<hash>" data-commit="<hash>" data-refs="<refs on it>"
+//	rail             id="rail-<hash>-<parent>" data-from="<hash>" data-to="<parent>" data-refs="<refs>"
+//	hash label       id="hash-<hash>" data-commit="<hash>"
+//	branch/tag label id="ref-<full ref name>" data-commit="<hash>" data-ref="<full ref name>"
+//	upstream label   data-commit="<hash>" data-ref="<upstream>"
+//	diffstat         data-commit="<hash>"
+//	badge            id="badge-<hash>-<n>" data-commit="<hash>", n counting the commit's badges from 0
+//	date             data-commit="<hash>"
+//
+// data-refs lists full ref names separated by spaces. Every id starts with
+// SVGOptions.IDPrefix, so drawings sharing a page keep them apart.
+
+// Layers of the drawing, bottom to top. Each is drawn as a
+// <g class="layer" data-layer="..."> so a page or stylesheet can hide a
+// whole layer without rendering again.
+const (
+	LayerBackground  = "background" // Lane bands and swimlanes
+	LayerRails       = "rails"      // Parent-child rails
+	LayerLinks       = "links"      // Dotted associations between commits
+	LayerStops       = "stops"      // Commit stops
+	LayerHashes      = "hashes"     // Abbreviated hashes in the margin
+	LayerBranches    = "branch-labels"
+	LayerTags        = "tag-labels"
+	LayerAnnotations = "annotations" // Upstreams, diffstats and badges
+	LayerDates       = "dates"       // Commit dates in the gutter, drawn only with SVGOptions.Dates
 )
 
+// Layers lists every layer, bottom to top.
+var Layers = []string{LayerBackground, LayerRails, LayerLinks, LayerStops, LayerHashes, LayerBranches, LayerTags, LayerAnnotations}
+
+// LaneBand is a run of lanes drawn over a shared background stripe.
+type LaneBand struct {
+	Name     string // Shown when hovering the stripe
+	From, To int    // First and last lane, inclusive
+	Fill     string // CSS color of the stripe
+}
+
+// Link associates two commits that are related without being parent and
+// child, like a branch tip and the commit it was squash-merged as.
+type Link struct {
+	From, To string // Full commit hashes
+}
+
 type SVGCommit struct {
 	Hash    string
 	X, Y    int
@@ -32,21 +142,189 @@ type SVGCommit struct {
 	Tags    []string        // Tag references
 	Parents []plumbing.Hash // Parent commit hashes
 	Heads   []string        // Head references
+
+	HeadRefs []string // Full names of the head references, parallel to Heads
+
+	Additions, Deletions int  // Summed diffstat of the commit
+	HasStats             bool // Whether a diffstat was computed
+	Badges               []structs.Badge
+	Collapsed            int // Number of commits folded into this node
 }
 
 type SVGRailway struct {
 	*svg.SVG
-	colors map[string]color.RGBA
+	colors   map[string]color.RGBA
+	classes  map[string]string // Class of each ref drawn, see refClass
+	refs     []string          // Refs drawn, in order of first use
+	groups   []string          // Groups of SVGOptions.Groups drawn, in order of first use
+	icons    map[string]icon   // Icons drawn, by name
+	more     bool              // Whether a "+N more" list was drawn
+	detached bool              // Whether a detached HEAD was labeled
+	opts     SVGOptions
 }
 
-func NewSVGRailway(canvas *svg.SVG) *SVGRailway {
+func NewSVGRailway(canvas *svg.SVG, opts SVGOptions) *SVGRailway {
 	return &SVGRailway{
-		SVG:    canvas,
-		colors: make(map[string]color.RGBA),
+		SVG:     canvas,
+		colors:  make(map[string]color.RGBA),
+		classes: make(map[string]string),
+		opts:    opts,
+	}
+}
+
+// pullRequestRef matches the refs code hosts keep the head of each pull
+// request (GitHub) or merge request (GitLab) under.
+var pullRequestRef = regexp.MustCompile(`^refs/(pull|merge-requests)/([0-9]+)/head$`)
+
+// IsPullRequest reports whether name is the head of a pull or merge request.
+func IsPullRequest(name plumbing.ReferenceName) bool {
+	return pullRequestRef.MatchString(name.String())
+}
+
+// RefLabel is the name a branch is labeled with: its short name, or "PR #12"
+// and "MR !12" for the heads of pull and merge requests.
+func RefLabel(name plumbing.ReferenceName) string {
+	m := pullRequestRef.FindStringSubmatch(name.String())
+	switch {
+	case m == nil:
+		return name.Short()
+	case m[1] == "pull":
+		return "PR #" + m[2]
+	}
+	return "MR !" + m[2]
+}
+
+// refClass is the class of the rails and labels of ref: "ref-" followed by
+// the name without "refs/" or "refs/heads/" and with characters CSS does
+// not allow in class names replaced, and a number added if that clashes
+// with another ref. The style sheet gives each class the color of its ref.
+func (sr *SVGRailway) refClass(ref string) string {
+	if class, ok := sr.classes[ref]; ok {
+		return class
+	}
+	name := strings.TrimPrefix(ref, "refs/")
+	name = strings.TrimPrefix(name, "heads/")
+	base := "ref-" + strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return '-'
+	}, name)
+	class := base
+	for n := 2; slices.ContainsFunc(sr.refs, func(r string) bool { return sr.classes[r] == class }); n++ {
+		class = fmt.Sprintf("%s-%d", base, n)
 	}
+	sr.classes[ref] = class
+	sr.refs = append(sr.refs, ref)
+	return class
+}
+
+// styleSheet styles everything drawn by class, so a page can restyle the
+// graph by overriding these rules. Refs get a rule each, in their color.
+func (sr *SVGRailway) styleSheet() string {
+	var b strings.Builder
+	b.WriteString("<defs><style>\n")
+	if face := sr.opts.FontFace; face != nil {
+		mime := map[string]string{"woff2": "font/woff2", "woff": "font/woff", "truetype": "font/ttf", "opentype": "font/otf"}[face.Format]
+		fmt.Fprintf(&b, "@font-face { font-family: \"%s\"; src: url(data:%s;base64,%s) format(\"%s\"); }\n",
+			embeddedFont, mime, base64.StdEncoding.EncodeToString(face.Data), face.Format)
+	}
+	for _, ref := range sr.refs {
+		c := colorToHex(sr.refToColor(ref))
+		fmt.Fprintf(&b, ".%s { fill: %s; stroke: %s; }\n", sr.classes[ref], c, c)
+		if _, dash := printStyle(ref); sr.opts.Print && dash != "" {
+			fmt.Fprintf(&b, ".rail .%s { stroke-dasharray: %s; }\n", sr.classes[ref], dash)
+		}
+	}
+	untracked, stop := "#808080", "fill: #dbdbdb;"
+	broken, cross := "#3a1f1f", "#e5484d"
+	if sr.opts.Print {
+		untracked, stop = "#999999", "fill: #ffffff; stroke: #000000; stroke-width: 1.5;"
+		broken, cross = "#ffffff", "#000000"
+	}
+	fmt.Fprintf(&b, `.rail path { fill: none; }
+.rail .untracked { stroke: %s; }
+.stop { %s }
+.stop.broken { fill: %s; }
+.broken-cross { stroke: %s; stroke-width: 2; }
+.upstream { fill: none; stroke: %s; stroke-width: 1; stroke-dasharray: 2 2; }
+.bubble { fill: none; stroke: #dbdbdb; stroke-width: 2; }
+.link { fill: none; stroke: %s; stroke-opacity: 0.7; stroke-width: 1.5; stroke-dasharray: 1 3; stroke-linecap: round; }
+.swimlane { fill-opacity: 0.15; stroke: none; }
+.hash, .ref-label, .tag-label, .upstream-label, .diffstat, .badge { font-family: %s; }
+.hash { fill: %s; font-size: 50%%; }
+.ref-label { font-size: 60%%; font-weight: bold; }
+.ref-label tspan { stroke: none; }
+.ref-label .alias { fill-opacity: 0.5; font-weight: normal; }
+.tag-label { fill: %s; font-size: 60%%; font-weight: bold; }
+.upstream-label { fill: %s; fill-opacity: 0.6; font-size: 60%%; }
+.diffstat { font-size: 50%%; }
+.diffstat .additions { fill: %s; }
+.diffstat .deletions { fill: %s; }
+.badge { fill: %s; font-size: 60%%; font-weight: bold; }
+`,
+		untracked, stop, broken, cross, sr.muted("#c9bcbc"), sr.muted("#c9bcbc"), sr.font(),
+		sr.muted("#c9bcbc"), sr.ink("#dad682"), sr.muted("#c9bcbc"), sr.ink("#57df6c"), sr.muted("#e06c75"), sr.ink("#f0a35e"))
+	if sr.detached {
+		fmt.Fprintf(&b, ".head-label { fill: %s; }\n", sr.ink("#61afef"))
+	}
+	if sr.opts.Folded != nil {
+		fmt.Fprintf(&b, ".folded-lane { fill: %s; fill-opacity: 0.15; cursor: pointer; }\n.folded-tip { cursor: pointer; }\n", sr.muted("#c9bcbc"))
+	}
+	if sr.more || sr.opts.Folded != nil {
+		fmt.Fprintf(&b, ".more-refs { fill: %s; font-family: %s; font-size: 60%%; cursor: pointer; }\n", sr.muted("#c9bcbc"), sr.font())
+		page := "var(--bg-page, #4e545b)"
+		if sr.opts.Print {
+			page = "#ffffff"
+		}
+		fmt.Fprintf(&b, ".more-list rect { fill: %s; stroke: %s; }\n", page, sr.muted("#c9bcbc"))
+	}
+	if sr.opts.Dates != "" {
+		fmt.Fprintf(&b, ".date { fill: %s; font-family: %s; font-size: 50%%; text-anchor: end; }\n", sr.muted("#c9bcbc"), sr.font())
+	}
+	if !sr.opts.Print {
+		for i, group := range sr.groups {
+			fmt.Fprintf(&b, ".stop.group-%d { fill: %s; }\n", i, GroupColor(group))
+		}
+	}
+	defs, iconStyle := sr.iconDefs()
+	b.WriteString(iconStyle)
+	if sr.opts.Rows != nil {
+		fmt.Fprintf(&b, ".continued { fill: %s; }\n", sr.muted("#c9bcbc"))
+	}
+	if halo := sr.halo(); halo != "" {
+		// Scoped to the layers, so it leaves other drawings on the page
+		// alone and wins over the strokes of the ref rules.
+		fmt.Fprintf(&b, ".layer text, .layer .ref-label tspan { paint-order: stroke fill; stroke: %s; stroke-width: 3px; stroke-linejoin: round; }\n", halo)
+	}
+	b.WriteString("</style>")
+	b.WriteString(defs)
+	b.WriteString("</defs>")
+	return b.String()
+}
+
+// groupClass is the class of the stops of commits in group, "group-"
+// followed by its number in order of first use.
+func (sr *SVGRailway) groupClass(group string) string {
+	i := slices.Index(sr.groups, group)
+	if i < 0 {
+		i = len(sr.groups)
+		sr.groups = append(sr.groups, group)
+	}
+	return fmt.Sprintf("group-%d", i)
+}
+
+// GroupColor is the color the stops of a group of SVGOptions.Groups are
+// filled in.
+func GroupColor(group string) string {
+	hash := md5.Sum([]byte(group))
+	return fmt.Sprintf("hsl(%d, 65%%, 60%%)", int(hash[0])*360/256)
 }
 
 func (sr *SVGRailway) refToColor(ref string) color.RGBA {
+	if sr.opts.Print {
+		return color.RGBA{0, 0, 0, 255}
+	}
 	if c, exists := sr.colors[ref]; exists {
 		return c
 	}
@@ -62,6 +340,58 @@ func (sr *SVGRailway) refToColor(ref string) color.RGBA {
 	return c
 }
 
+// Print mode tells refs apart by these instead of colors.
+var (
+	printShapes = []string{"●", "■", "◆", "▲"}
+	printDashes = []string{"", "6 3", "2 2", "8 3 2 3"}
+)
+
+// printStyle picks the stop shape and rail dash pattern of a ref.
+func printStyle(ref string) (shape int, dash string) {
+	hash := md5.Sum([]byte(ref))
+	return int(hash[0]) % len(printShapes), printDashes[int(hash[1])%len(printDashes)]
+}
+
+// font is the label font stack, escaped for the style sheet.
+func (sr *SVGRailway) font() string {
+	stack := sr.opts.Font
+	if stack == "" {
+		stack = "Ubuntu Mono"
+	}
+	if sr.opts.FontFace != nil {
+		stack = embeddedFont + ", " + stack
+	}
+	return html.EscapeString(stack)
+}
+
+// halo is the color of SVGOptions.Halo, resolving "auto" to the page
+// background, or the dark theme's when the drawing stands alone.
+func (sr *SVGRailway) halo() string {
+	switch {
+	case sr.opts.Halo != "auto":
+		return html.EscapeString(sr.opts.Halo)
+	case sr.opts.Print:
+		return "#ffffff"
+	}
+	return "var(--bg-page, #4e545b)"
+}
+
+// ink is the color of text and marks: c, or black when printing. muted is
+// the gray that stands in for secondary colors when printing.
+func (sr *SVGRailway) ink(c string) string {
+	if sr.opts.Print {
+		return "#000000"
+	}
+	return c
+}
+
+func (sr *SVGRailway) muted(c string) string {
+	if sr.opts.Print {
+		return "#666666"
+	}
+	return c
+}
+
 func hslToRGB(h, s, l float64) color.RGBA {
 	var r, g, b float64
 
@@ -110,7 +440,7 @@ func hueToRGB(p, q, t float64) float64 {
 	}
 }
 
-func (sr *SVGRailway) addS(path *string, dx, dy float64) {
+func addS(path *string, dx, dy float64) {
 	cp1x := 0.0
 	cp1y := float64(stepY) * (1.0 / 5.0) * dy
 	cp2x := -float64(stepX) * (1.0 / 4.0) * dx
@@ -129,17 +459,50 @@ func (sr *SVGRailway) addS(path *string, dx, dy float64) {
 	*path += fmt.Sprintf("c %.1f %.1f %.1f %.1f %.1f %.1f ", cp3x, cp3y, cp4x, cp4y, end2x, end2y)
 }
 
-func (sr *SVGRailway) Rail(x, y, px, py int, colors []color.RGBA, middle bool) {
+func (sr *SVGRailway) Rail(x, y, px, py int, colors []color.RGBA, middle, bold bool) {
 	if len(colors) == 0 {
 		colors = []color.RGBA{{128, 128, 128, 255}} // "gray"
 	}
+	strokes := make([]string, len(colors))
+	for i, c := range colors {
+		strokes[i] = fmt.Sprintf(`fill="none" stroke="%s"`, colorToHex(c))
+	}
+	sr.rail(x, y, px, py, strokes, middle, bold)
+}
+
+// refRail draws a rail carrying refs: a stripe of each ref's class, or a
+// single gray stripe when it carries none.
+func (sr *SVGRailway) refRail(x, y, px, py int, refs []string, middle, bold bool) {
+	if len(refs) == 0 {
+		sr.rail(x, y, px, py, []string{`class="untracked"`}, middle, bold)
+		return
+	}
+	attrs := make([]string, len(refs))
+	for i, ref := range refs {
+		attrs[i] = fmt.Sprintf(`class="%s"`, sr.refClass(ref))
+	}
+	sr.rail(x, y, px, py, attrs, middle, bold)
+}
 
-	n := len(colors)
+func (sr *SVGRailway) rail(x, y, px, py int, attrs []string, middle, bold bool) {
+	paths, w := railPaths(x, y, px, py, len(attrs), middle)
+	if bold {
+		w *= 1.6
+	}
+	for i, attr := range attrs {
+		sr.Path(paths[i], fmt.Sprintf(`%s stroke-width="%.1f"`, attr, w))
+	}
+}
+
+// railPaths returns the SVG path of each of the n stripes of a rail, left to
+// right, and the stripes' stroke width.
+func railPaths(x, y, px, py, n int, middle bool) ([]string, float64) {
 	w := float64(railW) / float64(n)
 	dX := -float64(n-1) / 2 * w
 	dx := x - px
 
-	for i, c := range colors {
+	paths := make([]string, n)
+	for i := range paths {
 		ox := dX + float64(i)*w
 		path := ""
 
@@ -155,13 +518,13 @@ func (sr *SVGRailway) Rail(x, y, px, py int, colors []color.RGBA, middle bool) {
 					dl -= 1
 					dr += 1
 				}
-				sr.addS(&path, dl/2, 1)
+				addS(&path, dl/2, 1)
 				path += fmt.Sprintf("V %d ", paddingY+(py-1)*stepY)
-				sr.addS(&path, dr/2, 1)
+				addS(&path, dr/2, 1)
 			} else {
-				sr.addS(&path, -0.5, 1)
+				addS(&path, -0.5, 1)
 				path += fmt.Sprintf("V %d ", paddingY+(py-1)*stepY)
-				sr.addS(&path, 0.5, 1)
+				addS(&path, 0.5, 1)
 			}
 		} else if dx != 0 {
 			if dx > 0 {
@@ -169,13 +532,13 @@ func (sr *SVGRailway) Rail(x, y, px, py int, colors []color.RGBA, middle bool) {
 				startY := paddingY + float64(y)*stepY
 				path = fmt.Sprintf("M %.1f %d ", startX, int(startY))
 				path += fmt.Sprintf("V %d ", paddingY+(py-1)*stepY)
-				sr.addS(&path, float64(dx), 1)
+				addS(&path, float64(dx), 1)
 			} else {
 				startX := paddingX + float64(px)*stepX + ox
 				startY := paddingY + float64(py)*stepY
 				path = fmt.Sprintf("M %.1f %d ", startX, int(startY))
 				path += fmt.Sprintf("V %d ", paddingY+(y+1)*stepY)
-				sr.addS(&path, float64(-dx), -1)
+				addS(&path, float64(-dx), -1)
 			}
 		} else {
 			startX := paddingX + float64(x)*stepX + ox
@@ -184,45 +547,202 @@ func (sr *SVGRailway) Rail(x, y, px, py int, colors []color.RGBA, middle bool) {
 			path += fmt.Sprintf("V %d", paddingY+py*stepY)
 		}
 
-		strokeWidth := w
-		sr.Path(path, fmt.Sprintf(`fill="none" stroke="%s" stroke-width="%.1f"`, colorToHex(c), strokeWidth))
+		paths[i] = path
 	}
+	return paths, w
 }
 
-func (sr *SVGRailway) Stop(x, y int, c color.RGBA, commit SVGCommit) {
+// Stop draws the stop of a commit. Merge commits' stops have the merge
+// class and root commits' the root class, for style sheets to pick out.
+func (sr *SVGRailway) Stop(x, y int, commit SVGCommit) {
 	cx := paddingX + x*stepX
 	cy := paddingY + y*stepY
-	sr.Circle(cx, cy, stopR, fmt.Sprintf(`class="stop" fill="%s" id="%s" tabindex="0" role="button"`, colorToHex(c), commit.Hash))
-	sr.addLabels(x, y, commit)
+	if len(sr.opts.Upstreams[commit.Hash]) > 0 {
+		sr.Circle(cx, cy, stopR+3, `class="upstream"`)
+	}
+	if commit.Collapsed > 0 {
+		sr.Circle(cx, cy, stopR+3, `class="bubble"`)
+	}
+	class := "stop"
+	switch {
+	case len(commit.Parents) > 1:
+		class += " merge"
+	case len(commit.Parents) == 0:
+		class += " root"
+	}
+	if group, ok := sr.opts.Groups[commit.Hash]; ok {
+		class += " " + sr.groupClass(group)
+	}
+	if sr.opts.Broken[commit.Hash] {
+		sr.Circle(cx, cy, stopR, fmt.Sprintf(`class="%s broken" id="%s%s" data-commit="%[3]s" tabindex="0" role="button"%s`, class, sr.opts.IDPrefix, commit.Hash, refsAttr(commit.Refs)))
+		sr.Line(cx-stopR+1, cy-stopR+1, cx+stopR-1, cy+stopR-1, `class="broken-cross"`)
+		sr.Line(cx-stopR+1, cy+stopR-1, cx+stopR-1, cy-stopR+1, `class="broken-cross"`)
+		return
+	}
+	attrs := fmt.Sprintf(`class="%s" id="%s%s" data-commit="%[3]s" tabindex="0" role="button"%s`, class, sr.opts.IDPrefix, commit.Hash, refsAttr(commit.Refs))
+	if sr.opts.Print {
+		sr.printStop(cx, cy, attrs, commit)
+	} else {
+		sr.Circle(cx, cy, stopR, attrs)
+	}
+}
+
+// printStop draws a stop shaped after the first ref the commit is on.
+func (sr *SVGRailway) printStop(cx, cy int, attrs string, commit SVGCommit) {
+	shape := 0
+	if len(commit.Refs) > 0 {
+		shape, _ = printStyle(commit.Refs[0])
+	}
+	r := stopR
+	switch shape {
+	case 1:
+		sr.Rect(cx-r+1, cy-r+1, 2*r-2, 2*r-2, attrs)
+	case 2:
+		sr.Polygon([]int{cx, cx + r, cx, cx - r}, []int{cy - r, cy, cy + r, cy}, attrs)
+	case 3:
+		sr.Polygon([]int{cx, cx + r, cx - r}, []int{cy - r, cy + r - 1, cy + r - 1}, attrs)
+	default:
+		sr.Circle(cx, cy, r, attrs)
+	}
+}
+
+// labelAttrs are the id and data attributes of the label of ref on commit.
+func (sr *SVGRailway) labelAttrs(commit, ref string) string {
+	ref = html.EscapeString(ref)
+	return fmt.Sprintf(` id="%sref-%s" data-commit="%s" data-ref="%[2]s"`, sr.opts.IDPrefix, ref, commit)
+}
+
+// refsAttr is the data-refs attribute naming the refs an element belongs
+// to, which the page uses to trace a branch on hover.
+
+func refsAttr(refs []string) string {
+	if len(refs) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(` data-refs="%s"`, html.EscapeString(strings.Join(refs, " ")))
+}
+
+// dimmed runs draw inside a faded, desaturated group when dim is set, so
+// -highlight keeps the rest of the graph as context.
+func (sr *SVGRailway) dimmed(dim bool, draw func()) {
+	if !dim {
+		draw()
+		return
+	}
+	sr.Group(`class="dimmed" opacity="0.3" filter="url(#dim)"`)
+	draw()
+	sr.Gend()
+}
+
+// links draws the dotted associations whose both ends are on the canvas.
+func (sr *SVGRailway) links(commits []SVGCommit) {
+	byHash := make(map[string]SVGCommit, len(commits))
+	for _, c := range commits {
+		byHash[c.Hash] = c
+	}
+	for _, l := range sr.opts.Links {
+		from, ok := byHash[l.From]
+		if !ok {
+			continue
+		}
+		to, ok := byHash[l.To]
+		if !ok {
+			continue
+		}
+		x1, y1 := paddingX+from.X*stepX, paddingY+from.Y*stepY
+		x2, y2 := paddingX+to.X*stepX, paddingY+to.Y*stepY
+		bend := stepX * (1 + abs(from.Y-to.Y)/4)
+		sr.Path(fmt.Sprintf("M %d %d C %d %d %d %d %d %d", x1, y1, x1-bend, y1, x2-bend, y2, x2, y2), `class="link"`)
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
 }
 
-func (sr *SVGRailway) addLabels(x, y int, commit SVGCommit) {
-	hashX := 8
-	ty := paddingY + y*stepY + 2
+// labelBaseline is the baseline of the labels in row y.
+func labelBaseline(y int) int {
+	return paddingY + y*stepY + 2
+}
 
-	labelX := paddingX + x*stepX + paddingY
+// labelStart is where the labels of a commit in lane x start.
+func labelStart(x int) int {
+	return paddingX + x*stepX + paddingY
+}
 
+// hashLabel draws the abbreviated hash in the margin left of the lanes.
+func (sr *SVGRailway) hashLabel(y int, commit SVGCommit) {
 	hashText := commit.Hash
 	if len(commit.Hash) >= 7 {
 		hashText = commit.Hash[:7]
 	}
-	sr.Text(hashX, ty, hashText,
-		`fill="#c9bcbc" font-family="Ubuntu Mono" font-size="50%"`)
+	sr.Text(8, labelBaseline(y), hashText, fmt.Sprintf(`class="hash" id="%shash-%s" data-commit="%[2]s"`, sr.opts.IDPrefix, commit.Hash))
+}
+
+// annotations draws the upstreams, diffstat and badges of a commit offset
+// past the start of the labels.
+func (sr *SVGRailway) annotations(x, y, offset int, commit SVGCommit) {
+	labelX, ty := labelStart(x), labelBaseline(y)
+	for _, upstream := range sr.opts.Upstreams[commit.Hash] {
+		if syncedUpstream(commit, upstream) {
+			continue
+		}
+		sr.Writer.Write([]byte(fmt.Sprintf(`<text x="%d" y="%d" class="upstream-label" data-commit="%s" data-ref="%s">⇅ %s </text>`,
+			labelX+offset, ty, commit.Hash, html.EscapeString(upstream), isolate(upstream))))
+		offset += columns(upstream)*6 + 20
+	}
+
+	if commit.HasStats {
+		offset += sr.diffstat(labelX+offset, ty, commit.Hash, commit.Additions, commit.Deletions)
+	}
 
-	refOffset := 0
-	for _, ref := range commit.Heads {
-		refColor := sr.refToColor(ref)
-		sr.Writer.Write([]byte(fmt.Sprintf(`<text x="%d" y="%d"><tspan fill="%s" font-family="Ubuntu Mono" font-size="60%%" font-weight="bold">%s </tspan></text>`,
-			labelX+refOffset, ty, colorToHex(refColor), ref)))
-		refOffset += len(ref)*6 + 10
+	for i, badge := range commit.Badges {
+		id := fmt.Sprintf(`id="%sbadge-%s-%d" data-commit="%[2]s"`, sr.opts.IDPrefix, commit.Hash, i)
+		ic, text, ok := iconFor(badge.Text)
+		if !ok {
+			sr.Writer.Write([]byte(fmt.Sprintf(`<text x="%d" y="%d" class="badge" %s><title>%s</title>%s</text>`,
+				labelX+offset, ty, id, html.EscapeString(badge.Detail), isolate(html.EscapeString(badge.Text)))))
+			offset += columns(badge.Text)*6 + 10
+			continue
+		}
+		sr.Writer.Write([]byte(fmt.Sprintf(`<g class="badge-group" %s><title>%s</title>`, id, html.EscapeString(badge.Detail))))
+		offset += sr.useIcon(labelX+offset, ty, ic)
+		if text != "" {
+			sr.Writer.Write([]byte(fmt.Sprintf(`<text x="%d" y="%d" class="badge">%s</text>`,
+				labelX+offset, ty, isolate(html.EscapeString(text)))))
+			offset += columns(text)*6 + 10
+		} else {
+			offset += 4
+		}
+		sr.Writer.Write([]byte(`</g>`))
 	}
+}
 
-	tagOffset := refOffset
-	for _, tag := range commit.Tags {
-		sr.Writer.Write([]byte(fmt.Sprintf(`<text x="%d" y="%d"><tspan fill="#dad682" font-family="Ubuntu Mono" font-size="60%%" font-weight="bold">🏷 %s </tspan></text>`,
-			labelX+tagOffset, ty, tag)))
-		tagOffset += len(tag)*6 + 20
+// diffstatBar returns the width of a diffstat bar; log scale keeps huge
+// refactorings visible without dwarfing everything else.
+func diffstatBar(n int) int {
+	if n == 0 {
+		return 0
 	}
+	return min(diffstatMaxW, 2+int(4*math.Log2(float64(n))))
+}
+
+// diffstat draws the bars and counts and returns the horizontal space used.
+func (sr *SVGRailway) diffstat(x, y int, hash string, additions, deletions int) int {
+	addW, delW := diffstatBar(additions), diffstatBar(deletions)
+	if addW > 0 {
+		sr.Rect(x, y-5, addW, 5, `class="diffstat additions"`)
+	}
+	if delW > 0 {
+		sr.Rect(x+addW, y-5, delW, 5, `class="diffstat deletions"`)
+	}
+	sr.Writer.Write([]byte(fmt.Sprintf(`<text x="%d" y="%d" class="diffstat" data-commit="%s"><tspan class="additions">+%d</tspan> <tspan class="deletions">-%d</tspan></text>`,
+		x+addW+delW+4, y, hash, additions, deletions)))
+	text := fmt.Sprintf("+%d -%d", additions, deletions)
+	return addW + delW + 4 + len(text)*5 + 10
 }
 
 func colorToHex(c color.RGBA) string {
@@ -241,185 +761,262 @@ func convertToSVGCommits(
 		if !ok {
 			continue
 		}
-		var headNames []string
-		if hs, ok := heads[hash]; ok {
-			for _, r := range hs {
-				headNames = append(headNames, r.Name().Short())
-			}
-		}
-		var refs []string
-		if ci != nil && ci.References != nil {
-			for _, r := range ci.References.ToSlice() {
-				refs = append(refs, r)
-			}
-		}
-		var tagNames []string
-		if ts, ok := tags[hash]; ok {
-			for _, r := range ts {
-				tagNames = append(tagNames, r.Name().Short())
-			}
-		}
-		var parents []plumbing.Hash
-		if ci != nil && ci.Commit != nil {
-			for _, p := range ci.Commit.ParentHashes {
-				parents = append(parents, p)
-			}
-		}
-		svgCommits = append(svgCommits, SVGCommit{
-			Hash: hash.String(),
-			X:    pos[0],
-			Y:    pos[1],
-			Message: func() string {
-				if ci != nil && ci.Commit != nil {
-					return ci.Commit.Message
-				}
-				return ""
-			}(),
-			Refs:    refs,
-			Tags:    tagNames,
-			Parents: parents,
-			Heads:   headNames,
-		})
+		svgCommits = append(svgCommits, newSVGCommit(hash, ci, pos, heads, tags))
 	}
 	return svgCommits
 }
 
-func DrawRailway(
-	canvas *svg.SVG,
-	commits map[plumbing.Hash]*structs.CommitInfo,
-	positions map[plumbing.Hash][2]int,
+func newSVGCommit(
+	hash plumbing.Hash,
+	ci *structs.CommitInfo,
+	pos [2]int,
 	heads map[plumbing.Hash][]*plumbing.Reference,
 	tags map[plumbing.Hash][]*plumbing.Reference,
-	children map[plumbing.Hash]mapset.Set[plumbing.Hash],
-) {
-	maxX, maxY := 0, 0
-	for _, pos := range positions {
-		if pos[0] > maxX {
-			maxX = pos[0]
+) SVGCommit {
+	var headNames, headRefs []string
+	if hs, ok := heads[hash]; ok {
+		hs = append([]*plumbing.Reference(nil), hs...)
+		sort.Slice(hs, func(i, j int) bool { return hs[i].Name() < hs[j].Name() })
+		for _, r := range hs {
+			headNames = append(headNames, RefLabel(r.Name()))
+			headRefs = append(headRefs, r.Name().String())
+		}
+	}
+	var refs []string
+	if ci != nil && ci.References != nil {
+		for _, r := range ci.References.ToSlice() {
+			refs = append(refs, r)
+		}
+		sort.Strings(refs)
+	}
+	var tagNames []string
+	if ts, ok := tags[hash]; ok {
+		for _, r := range ts {
+			tagNames = append(tagNames, r.Name().Short())
 		}
-		if pos[1] > maxY {
-			maxY = pos[1]
+		sort.Strings(tagNames)
+	}
+	additions, deletions := 0, 0
+	if ci != nil {
+		for _, fs := range ci.Files {
+			additions += fs.Additions
+			deletions += fs.Deletions
+		}
+	}
+	var parents []plumbing.Hash
+	if ci != nil && ci.Commit != nil {
+		for _, p := range ci.Commit.ParentHashes {
+			parents = append(parents, p)
 		}
 	}
+	return SVGCommit{
+		Hash: hash.String(),
+		X:    pos[0],
+		Y:    pos[1],
+		Message: func() string {
+			if ci != nil && ci.Commit != nil {
+				return ci.Commit.Message
+			}
+			return ""
+		}(),
+		Refs:    refs,
+		Tags:    tagNames,
+		Parents: parents,
+		Heads:   headNames,
 
-	displayPositions := make(map[plumbing.Hash][2]int, len(positions))
-	for h, pos := range positions {
-		displayPositions[h] = [2]int{pos[0], maxY - pos[1]}
+		HeadRefs:  headRefs,
+		Additions: additions,
+		Deletions: deletions,
+		HasStats:  ci != nil && ci.Files != nil,
+		Badges: func() []structs.Badge {
+			if ci != nil {
+				return ci.Badges
+			}
+			return nil
+		}(),
+		Collapsed: func() int {
+			if ci != nil {
+				return len(ci.Collapsed)
+			}
+			return 0
+		}(),
 	}
+}
 
-	svgCommits := convertToSVGCommits(commits, displayPositions, heads, tags)
+// railEdge is one rail of the drawing, running from a commit down to one of
+// its parents in display coordinates.
+type railEdge struct {
+	From, To     string   // Commit and parent hashes
+	X, Y, PX, PY int      // Display positions of both ends
+	Refs         []string // References whose colors the rail carries, gray when empty
+	Middle       bool     // Whether the rail detours around a commit in the parent's lane
+}
 
-	hashStringToHash := make(map[string]plumbing.Hash)
-	for hash := range commits {
-		hashStringToHash[hash.String()] = hash
+func newRailEdge(commit SVGCommit, parent plumbing.Hash, ppos [2]int, pposOk bool, refs []string, middle bool) railEdge {
+	e := railEdge{From: commit.Hash, To: parent.String(), X: commit.X, Y: commit.Y, Refs: refs}
+	if pposOk {
+		e.PX, e.PY, e.Middle = ppos[0], ppos[1], middle
+	} else {
+		e.PX, e.PY = commit.X, commit.Y-1
 	}
+	return e
+}
 
-	width := paddingX*2 + (maxX+1)*stepX
-	height := paddingY*2 + (maxY+1)*stepY
-
-	canvas.Startview(int(float64(width)*scale), int(float64(height)*scale), 0, 0, width, height)
-	railway := NewSVGRailway(canvas)
+// railEdges decides the route and colors of every rail. It sorts svgCommits
+// into drawing order.
+func railEdges(
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	positions map[plumbing.Hash][2]int,
+	displayPositions map[plumbing.Hash][2]int,
+	maxY int,
+	svgCommits []SVGCommit,
+	children map[plumbing.Hash]mapset.Set[plumbing.Hash],
+) []railEdge {
+	lanes := newLaneIndex(maxY)
+	for _, pos := range positions {
+		lanes.add(pos)
+	}
+	lanes.sort()
 
+	var edges []railEdge
+	// Rails, and later stops and labels, are emitted by row, then lane, then
+	// hash, so the output and the z-order of overlapping elements never
+	// depend on map iteration.
 	sort.Slice(svgCommits, func(i, j int) bool {
-		if svgCommits[i].Y == svgCommits[j].Y {
+		if svgCommits[i].Y != svgCommits[j].Y {
+			return svgCommits[i].Y < svgCommits[j].Y
+		}
+		if svgCommits[i].X != svgCommits[j].X {
 			return svgCommits[i].X < svgCommits[j].X
 		}
-		return svgCommits[i].Y < svgCommits[j].Y
+		return svgCommits[i].Hash < svgCommits[j].Hash
 	})
 
 	for _, commit := range svgCommits {
-		singletons := mapset.NewSet[string]()
-		for _, parentHash := range commit.Parents {
-			if parentInfo, ok := commits[parentHash]; ok {
-				if parentInfo.References.Cardinality() == 1 {
-					singletons.Add(parentInfo.References.ToSlice()[0])
-				}
+		edges = append(edges, commitEdges(commit, commits, displayPositions, children, lanes)...)
+	}
+	return edges
+}
+
+// laneIndex lists the rows taken in every lane, in arrangement order, so a
+// rail can tell whether it would cross a commit in the lane it runs down.
+type laneIndex struct {
+	maxY int
+	rows map[int][]int
+}
+
+func newLaneIndex(maxY int) *laneIndex {
+	return &laneIndex{maxY: maxY, rows: make(map[int][]int)}
+}
+
+// add records an arranged position. Positions added in arrangement order
+// keep every lane sorted.
+func (l *laneIndex) add(pos [2]int) {
+	l.rows[pos[0]] = append(l.rows[pos[0]], pos[1])
+}
+
+func (l *laneIndex) sort() {
+	for _, rows := range l.rows {
+		sort.Ints(rows)
+	}
+}
+
+// between reports whether lane x holds a commit strictly below display row
+// top and above display row bottom.
+func (l *laneIndex) between(x, top, bottom int) bool {
+	lo, hi := l.maxY-bottom, l.maxY-top
+	rows := l.rows[x]
+	i := sort.SearchInts(rows, lo+1)
+	return i < len(rows) && rows[i] < hi
+}
+
+// commitEdges decides the route and colors of the rails from commit to each
+// of its parents. Only the parents' positions are needed, so a commit's
+// rails are final as soon as it is arranged.
+func commitEdges(
+	commit SVGCommit,
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	displayPositions map[plumbing.Hash][2]int,
+	children map[plumbing.Hash]mapset.Set[plumbing.Hash],
+	lanes *laneIndex,
+) []railEdge {
+	var edges []railEdge
+	singletons := mapset.NewSet[string]()
+	for _, parentHash := range commit.Parents {
+		if parentInfo, ok := commits[parentHash]; ok {
+			if parentInfo.References.Cardinality() == 1 {
+				singletons.Add(parentInfo.References.ToSlice()[0])
 			}
 		}
+	}
 
-		for _, parentHash := range commit.Parents {
-			parentInfo, ok := commits[parentHash]
-			if !ok {
-				railway.Rail(commit.X, commit.Y, commit.X, commit.Y-1, []color.RGBA{{128, 128, 128, 255}}, false)
-				continue
-			}
+	for _, parentHash := range commit.Parents {
+		parentInfo, ok := commits[parentHash]
+		if !ok {
+			edges = append(edges, railEdge{From: commit.Hash, To: parentHash.String(),
+				X: commit.X, Y: commit.Y, PX: commit.X, PY: commit.Y - 1})
+			continue
+		}
 
-			parentRefsSet := mapset.NewSet[string]()
-			for r := range parentInfo.References.Iter() {
-				parentRefsSet.Add(r)
-			}
-			commitRefsSet := mapset.NewSet[string]()
-			for _, r := range commit.Refs {
-				commitRefsSet.Add(r)
-			}
+		parentRefsSet := mapset.NewSet[string]()
+		for r := range parentInfo.References.Iter() {
+			parentRefsSet.Add(r)
+		}
+		commitRefsSet := mapset.NewSet[string]()
+		for _, r := range commit.Refs {
+			commitRefsSet.Add(r)
+		}
 
-			common := parentRefsSet.Intersect(commitRefsSet)
+		common := parentRefsSet.Intersect(commitRefsSet)
 
-			var orderedRefs []string
+		var orderedRefs []string
 
-			if commitRefsSet.Cardinality() > 1 && common.Cardinality() > 0 {
-				commonSlice := make([]string, 0, common.Cardinality())
-				for r := range common.Iter() {
-					if parentRefsSet.Cardinality() == 1 || !singletons.Contains(r) {
-						commonSlice = append(commonSlice, r)
-					}
+		if commitRefsSet.Cardinality() > 1 && common.Cardinality() > 0 {
+			commonSlice := make([]string, 0, common.Cardinality())
+			for r := range common.Iter() {
+				if parentRefsSet.Cardinality() == 1 || !singletons.Contains(r) {
+					commonSlice = append(commonSlice, r)
 				}
-				sort.Strings(commonSlice)
-				orderedRefs = commonSlice
-			} else {
-				usedRefs := mapset.NewSet[string]()
-				if childSet, ok := children[parentHash]; ok {
-					for childHash := range childSet.Iter() {
-						if childInfo, ok := commits[childHash]; ok && childInfo.References != nil {
-							for r := range childInfo.References.Iter() {
-								usedRefs.Add(r)
-							}
+			}
+			sort.Strings(commonSlice)
+			orderedRefs = commonSlice
+		} else {
+			usedRefs := mapset.NewSet[string]()
+			if childSet, ok := children[parentHash]; ok {
+				for childHash := range childSet.Iter() {
+					if childInfo, ok := commits[childHash]; ok && childInfo.References != nil {
+						for r := range childInfo.References.Iter() {
+							usedRefs.Add(r)
 						}
 					}
 				}
+			}
 
-				var refsToUse mapset.Set[string]
-				if common.Cardinality() > 0 || len(commit.Parents) <= 1 {
-					refsToUse = commitRefsSet
-				} else {
-					refsToUse = parentRefsSet.Difference(usedRefs)
-				}
+			var refsToUse mapset.Set[string]
+			if common.Cardinality() > 0 || len(commit.Parents) <= 1 {
+				refsToUse = commitRefsSet
+			} else {
+				refsToUse = parentRefsSet.Difference(usedRefs)
+			}
 
-				refsSlice := make([]string, 0, refsToUse.Cardinality())
-				for r := range refsToUse.Iter() {
-					refsSlice = append(refsSlice, r)
-				}
-				sort.Strings(refsSlice)
-				orderedRefs = refsSlice
+			refsSlice := make([]string, 0, refsToUse.Cardinality())
+			for r := range refsToUse.Iter() {
+				refsSlice = append(refsSlice, r)
 			}
+			sort.Strings(refsSlice)
+			orderedRefs = refsSlice
+		}
 
+		// A rail that would run down a lane through another commit detours
+		// around it instead.
 		ppos, pposOk := displayPositions[parentHash]
 		middle := false
 		if pposOk {
-			parentOrigPos, parentOk := positions[parentHash]
-			commitHash, commitHashOk := hashStringToHash[commit.Hash]
-			commitOrigPos, commitOk := positions[commitHash]
-			if parentOk && commitOk && commitHashOk {
-				pxOrig, pyOrig := parentOrigPos[0], parentOrigPos[1]
-				cxOrig, cyOrig := commitOrigPos[0], commitOrigPos[1]
-				intermediateX := pxOrig
-				if pxOrig < cxOrig {
-					intermediateX = cxOrig
-				}
-				pyFlipped := maxY - pyOrig
-				cyFlipped := maxY - cyOrig
-				for otherHash, otherOrigPos := range positions {
-					if otherHash == commitHash || otherHash == parentHash {
-						continue
-					}
-					rxOrig, ryOrig := otherOrigPos[0], otherOrigPos[1]
-					ryFlipped := maxY - ryOrig
-					if rxOrig == intermediateX && pyFlipped > ryFlipped && ryFlipped > cyFlipped {
-						middle = true
-						break
-					}
-				}
+			intermediateX := ppos[0]
+			if ppos[0] < commit.X {
+				intermediateX = commit.X
 			}
+			middle = lanes.between(intermediateX, commit.Y, ppos[1])
 		}
 
 		if len(orderedRefs) == 0 {
@@ -431,12 +1028,7 @@ func DrawRailway(
 				sort.Strings(refsSlice)
 				orderedRefs = refsSlice
 			} else {
-				colors := []color.RGBA{{128, 128, 128, 255}}
-				if pposOk {
-					railway.Rail(commit.X, commit.Y, ppos[0], ppos[1], colors, middle)
-				} else {
-					railway.Rail(commit.X, commit.Y, commit.X, commit.Y-1, colors, false)
-				}
+				edges = append(edges, newRailEdge(commit, parentHash, ppos, pposOk, nil, middle))
 				continue
 			}
 		}
@@ -445,22 +1037,57 @@ func DrawRailway(
 		if limit > maxColors {
 			limit = maxColors
 		}
-		colors := make([]color.RGBA, limit)
-		for i := 0; i < limit; i++ {
-			colors[i] = railway.refToColor(orderedRefs[i])
-		}
+		edges = append(edges, newRailEdge(commit, parentHash, ppos, pposOk, orderedRefs[:limit], middle))
+	}
+	return edges
+}
 
-		if pposOk {
-			railway.Rail(commit.X, commit.Y, ppos[0], ppos[1], colors, middle)
-		} else {
-			railway.Rail(commit.X, commit.Y, commit.X, commit.Y-1, colors, false)
+func DrawRailway(
+	canvas *svg.SVG,
+	commits map[plumbing.Hash]*structs.CommitInfo,
+	positions map[plumbing.Hash][2]int,
+	heads map[plumbing.Hash][]*plumbing.Reference,
+	tags map[plumbing.Hash][]*plumbing.Reference,
+	children map[plumbing.Hash]mapset.Set[plumbing.Hash],
+	opts SVGOptions,
+) {
+	maxY := 0
+	hashes := make([]plumbing.Hash, 0, len(positions))
+	for h, pos := range positions {
+		maxY = max(maxY, pos[1])
+		hashes = append(hashes, h)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		pi, pj := positions[hashes[i]], positions[hashes[j]]
+		if pi[1] != pj[1] {
+			return pi[1] < pj[1]
 		}
+		return hashes[i].String() < hashes[j].String()
+	})
+
+	if opts.Rows == nil {
+		stream := NewRailwayStream(commits, heads, tags, children, opts, maxY)
+		for _, h := range hashes {
+			stream.AddRow(h, positions[h])
 		}
+		stream.Finish(canvas)
+		return
 	}
 
-	for _, commit := range svgCommits {
-		railway.Stop(commit.X, commit.Y, color.RGBA{219, 219, 219, 255}, commit)
+	// Arranged rows lo to hi make up the slice and are drawn as rows 0 to
+	// hi-lo; the commits outside it keep their place relative to it, so
+	// that the rails leading to them take the same route as in the whole
+	// drawing.
+	lo, hi := max(maxY-opts.Rows.To+1, 0), maxY-opts.Rows.From
+	stream := NewRailwayStream(commits, heads, tags, children, opts, max(hi-lo, 0))
+	for _, h := range hashes {
+		pos := positions[h]
+		shifted := [2]int{pos[0], pos[1] - lo}
+		if pos[1] < lo || pos[1] > hi {
+			stream.AddOffCanvas(h, shifted)
+		} else {
+			stream.AddRow(h, shifted)
+		}
 	}
-
-	canvas.End()
+	stream.Finish(canvas)
 }
@@ -0,0 +1,36 @@
+package view
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// WidgetData is the JSON document the widget script renders.
+type WidgetData struct {
+	Title   string                `json:"title"`
+	SVG     string                `json:"svg"`
+	Commits map[string]CommitData `json:"commits"`
+}
+
+// WriteWidget writes the embeddable widget: a standalone script that mounts
+// the graph into an element of an existing page, and the data it loads.
+func WriteWidget(
+	script io.Writer,
+	data io.Writer,
+	svgContent string,
+	commitData map[string]CommitData,
+	title string,
+) error {
+	widget, err := getResource("widget.js")
+	if err != nil {
+		return fmt.Errorf("failed to load widget script: %w", err)
+	}
+	if _, err := io.WriteString(script, widget); err != nil {
+		return err
+	}
+	if err := json.NewEncoder(data).Encode(WidgetData{Title: title, SVG: svgContent, Commits: commitData}); err != nil {
+		return fmt.Errorf("failed to marshal widget data: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// warnings collects the problems met while collecting and labeling commits
+// that do not stop the graph from being drawn, like a ref that cannot be
+// read or a reflog line that does not parse. They are summarized at the end
+// and listed in the HTML output, so a missing branch comes with a reason.
+var warnings warningLog
+
+type warningLog struct {
+	mu   sync.Mutex
+	list []string
+}
+
+func (w *warningLog) add(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, m := range w.list {
+		if m == msg {
+			return
+		}
+	}
+	w.list = append(w.list, msg)
+}
+
+func (w *warningLog) all() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.list...)
+}
+
+// summarize logs the warnings collected so far and forgets them.
+func (w *warningLog) summarize() {
+	w.mu.Lock()
+	list := w.list
+	w.list = nil
+	w.mu.Unlock()
+	if len(list) == 0 {
+		return
+	}
+	log.Printf("⚠️ %d warnings while collecting the graph:", len(list))
+	for _, msg := range list {
+		log.Printf("  %s", msg)
+	}
+}